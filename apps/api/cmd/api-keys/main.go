@@ -0,0 +1,144 @@
+// Command api-keys manages the API keys of one tenant, like the /api/api-keys
+// endpoints. Keys and listings are written to stdout as JSON.
+//
+//	go run ./cmd/api-keys list
+//	go run ./cmd/api-keys create -name payroll -scopes read:schedules,export:billing -expires 2027-01-01
+//	go run ./cmd/api-keys revoke <id>
+//
+// The key itself is only printed by create; store it in the other system
+// right away.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/joho/godotenv"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/config"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	"github.com/forddyce/mini-evv-logger/apps/api/setup"
+)
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML config file; environment variables override it")
+	tenantID := flag.String("tenant", tenant.DefaultID, "tenant whose keys to manage")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: api-keys [-config file] [-tenant id] list | create [flags] | revoke <id>\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	godotenv.Load()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, *tenantID, flag.Args()); err != nil {
+		slog.Error("api-keys failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, cfg config.Config, tenantID string, args []string) error {
+	if len(args) == 0 {
+		flag.Usage()
+		return errors.New("missing command")
+	}
+
+	client, err := setup.NewClient(cfg.Supabase)
+	if err != nil {
+		return err
+	}
+	t, err := repository.NewTenantRepository(client).GetTenant(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+	ctx = tenant.WithTenant(ctx, *t)
+	keys := service.NewAPIKeyService(repository.NewAPIKeyRepository(client))
+
+	switch command, args := args[0], args[1:]; command {
+	case "list":
+		list, err := keys.GetAPIKeys(ctx)
+		if err != nil {
+			return err
+		}
+		return printJSON(list)
+	case "create":
+		key, err := parseCreate(args)
+		if err != nil {
+			return err
+		}
+		created, err := keys.CreateAPIKey(ctx, key)
+		if err != nil {
+			return err
+		}
+		slog.Info("API key created; the key is not shown again", "tenant", tenantID, "key_id", created.ID)
+		return printJSON(created)
+	case "revoke":
+		if len(args) != 1 {
+			return errors.New("usage: api-keys revoke <id>")
+		}
+		if err := keys.RevokeAPIKey(ctx, args[0]); err != nil {
+			return err
+		}
+		slog.Info("API key revoked", "tenant", tenantID, "key_id", args[0])
+		return nil
+	default:
+		flag.Usage()
+		return fmt.Errorf("unknown command %q", command)
+	}
+}
+
+// parseCreate reads the flags of the create command.
+func parseCreate(args []string) (models.APIKey, error) {
+	flags := flag.NewFlagSet("create", flag.ContinueOnError)
+	name := flags.String("name", "", "name of the system the key is for")
+	scopes := flags.String("scopes", "", "comma-separated scopes: read:schedules, write:visits, export:billing")
+	expires := flags.String("expires", "", "expiry, as YYYY-MM-DD (midnight UTC) or RFC 3339; empty never expires")
+	rateLimit := flags.Int("rate-limit", 0, "requests a minute; 0 uses API_KEY_RATE_LIMIT")
+	if err := flags.Parse(args); err != nil {
+		return models.APIKey{}, err
+	}
+
+	key := models.APIKey{Name: *name, RateLimitPerMinute: *rateLimit}
+	for _, scope := range strings.Split(*scopes, ",") {
+		if scope = strings.TrimSpace(scope); scope != "" {
+			key.Scopes = append(key.Scopes, scope)
+		}
+	}
+	if *expires != "" {
+		expiresAt, err := time.Parse(time.RFC3339, *expires)
+		if err != nil {
+			if expiresAt, err = time.Parse("2006-01-02", *expires); err != nil {
+				return models.APIKey{}, fmt.Errorf("-expires %q must be YYYY-MM-DD or RFC 3339", *expires)
+			}
+		}
+		key.ExpiresAt = &expiresAt
+	}
+	return key, nil
+}
+
+func printJSON(v interface{}) error {
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(v)
+}
@@ -1,74 +1,151 @@
 package main
 
 import (
-	"fmt"
-	"log"
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"sync"
+	"syscall"
 
-	"github.com/gorilla/mux"
 	"github.com/joho/godotenv" // For loading .env file locally
 
 	_ "github.com/forddyce/mini-evv-logger/apps/api/docs"
-	httpSwagger "github.com/swaggo/http-swagger"
 
-	"github.com/forddyce/mini-evv-logger/apps/api/internal/handler"
-	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/config"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
-	"github.com/supabase-community/supabase-go"
+	"github.com/forddyce/mini-evv-logger/apps/api/setup"
 )
 
-// This init function is for the local main.go server only.
-func init() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, assuming environment variables are set.")
-	}
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML config file; environment variables override it")
+	flag.Parse()
 
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	supabaseServiceRoleKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	envErr := godotenv.Load()
 
-	if supabaseURL == "" || supabaseServiceRoleKey == "" {
-		log.Fatal("SUPABASE_URL or SUPABASE_SERVICE_ROLE_KEY environment variables are not set.")
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
 	}
 
-	var err error
-	supabaseClient, err := supabase.NewClient(supabaseURL, supabaseServiceRoleKey, nil)
+	app, err := setup.NewApp(cfg)
 	if err != nil {
-		log.Fatalf("Failed to create Supabase client in local main.go init: %v", err)
+		slog.Error("Failed to set up the API", "error", err)
+		os.Exit(1)
+	}
+	if envErr != nil {
+		slog.Info("No .env file found, assuming environment variables are set")
 	}
-	fmt.Println("Successfully initialized Supabase client for local development!")
 
-	scheduleRepo := repository.NewScheduleRepository(supabaseClient)
-	scheduleService := service.NewScheduleService(scheduleRepo)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
 
-	localRouter := mux.NewRouter()
+	workers := startWorkers(ctx, app)
 
-	localScheduleHandler := handler.NewScheduleHandler(scheduleService)
+	srv := &http.Server{
+		Addr:              ":" + cfg.Server.Port,
+		Handler:           app.Handler,
+		ReadHeaderTimeout: cfg.Server.ReadHeaderTimeout,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       cfg.Server.IdleTimeout,
+	}
+	srv.RegisterOnShutdown(app.CloseStreams)
+
+	serveErr := make(chan error, 1)
+	go func() {
+		slog.Info("Local Go API server starting", "port", cfg.Server.Port)
+		serveErr <- srv.ListenAndServe()
+	}()
+
+	exitCode := 0
+	select {
+	case err := <-serveErr:
+		slog.Error("Server stopped", "error", err)
+		exitCode = 1
+	case <-ctx.Done():
+		slog.Info("Shutting down", "timeout", cfg.Server.ShutdownTimeout.String())
+	}
+	stop()
 
-	apiRouter := localRouter.PathPrefix("/api").Subrouter()
-	apiRouter.HandleFunc("/schedules", localScheduleHandler.GetSchedules).Methods("GET")
-	apiRouter.HandleFunc("/schedules/today", localScheduleHandler.GetTodaySchedules).Methods("GET")
-	apiRouter.HandleFunc("/schedules/stats", localScheduleHandler.GetScheduleStats).Methods("GET")
-	apiRouter.HandleFunc("/schedules/reset", localScheduleHandler.ResetSampleData).Methods("POST")
-	apiRouter.HandleFunc("/schedules/{id}", localScheduleHandler.GetScheduleByID).Methods("GET")
-	apiRouter.HandleFunc("/schedules/{id}/start", localScheduleHandler.StartVisit).Methods("POST")
-	apiRouter.HandleFunc("/schedules/{id}/end", localScheduleHandler.EndVisit).Methods("POST")
-	apiRouter.HandleFunc("/tasks/{taskId}/update", localScheduleHandler.UpdateTaskStatus).Methods("POST")
+	// In-flight requests and the current round of each worker get until the
+	// shutdown timeout to finish.
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
 
-	localRouter.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
-	http.Handle("/", localRouter)
+	if err := srv.Shutdown(shutdownCtx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		slog.Error("Failed to drain HTTP requests", "error", err)
+		exitCode = 1
+	}
+	if err := waitFor(shutdownCtx, workers); err != nil {
+		slog.Error("Background workers did not stop in time", "error", err)
+		exitCode = 1
+	}
+	if err := app.Close(shutdownCtx); err != nil {
+		slog.Error("Failed to flush access records and traces", "error", err)
+	}
+
+	slog.Info("Shutdown complete")
+	os.Exit(exitCode)
 }
 
-func main() {
-	if err := godotenv.Load(); err != nil {
-		log.Println("No .env file found, assuming environment variables are set.")
+// startWorkers runs the outbox, missed visit and (optionally) stats rollup,
+// retention purge and location scrub workers for every tenant until ctx is
+// cancelled. The local server is long-lived, so it runs them itself; on Vercel,
+// POST /api/webhooks/dispatch, POST /api/retention/purge and
+// POST /api/retention/locations/scrub do the same jobs for the caller's tenant.
+func startWorkers(ctx context.Context, app *setup.App) *sync.WaitGroup {
+	var wg sync.WaitGroup
+	run := func(worker func()) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			worker()
+		}()
 	}
 
-	port := os.Getenv("API_PORT")
-	if port == "" {
-		port = "8080"
+	workers := app.Config.Workers
+	run(func() {
+		service.RunWebhookDispatcher(ctx, app.WebhookService, app.Tenants, workers.WebhookDispatchInterval)
+	})
+	run(func() {
+		service.RunMissedVisitMonitor(ctx, app.ScheduleService, app.Tenants, workers.MissedVisitInterval)
+	})
+	if app.Config.Stats.DailyRollup {
+		run(func() {
+			service.RunDailyStatsRollup(ctx, app.ScheduleService, app.Tenants, workers.DailyStatsInterval, workers.DailyStatsLookbackDays)
+		})
+	}
+	if app.Config.Retention.Enabled {
+		run(func() {
+			service.RunRetentionPurge(ctx, app.RetentionService, app.Tenants, workers.RetentionPurgeInterval)
+		})
 	}
+	if app.Config.Locations.Mode != models.LocationKeep {
+		run(func() {
+			service.RunLocationScrub(ctx, app.RetentionService, app.Tenants, workers.LocationScrubInterval)
+		})
+	}
+	return &wg
+}
 
-	fmt.Printf("Local Go API server starting on :%s\n", port)
-	log.Fatal(http.ListenAndServe(":"+port, nil))
+// waitFor waits for wg, or returns ctx's error if it ends first.
+func waitFor(ctx context.Context, wg *sync.WaitGroup) error {
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
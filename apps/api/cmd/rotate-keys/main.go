@@ -0,0 +1,126 @@
+// Command rotate-keys rotates the keys behind field-level encryption and
+// re-encrypts existing schedules, for every tenant. It runs next to the API, which keeps
+// reading rows under old and new keys alike while it works. Re-encrypting
+// leaves the decrypted values as they were, so the API's schedule cache stays
+// valid, and the API's visit changes read past it anyway.
+//
+//	go run ./cmd/rotate-keys                  # new data key, re-encrypt every row
+//	go run ./cmd/rotate-keys -new-master-key  # also add a master key and rewrap the data keys
+//
+// Every step can be repeated safely, so an interrupted run is finished by
+// running it again.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/joho/godotenv"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/config"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/encryption"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	"github.com/forddyce/mini-evv-logger/apps/api/setup"
+)
+
+func main() {
+	configFile := flag.String("config", os.Getenv("CONFIG_FILE"), "optional YAML config file; environment variables override it")
+	newMasterKey := flag.Bool("new-master-key", false, "add a master key to the keyfile (creating it if needed) and make it the active one")
+	rotateDataKey := flag.Bool("rotate-data-key", true, "replace the active data key before re-encrypting")
+	batchSize := flag.Int("batch", 100, "schedules read per request")
+	flag.Parse()
+
+	godotenv.Load()
+
+	cfg, err := config.Load(*configFile)
+	if err != nil {
+		slog.Error("Failed to load configuration", "error", err)
+		os.Exit(1)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	if err := run(ctx, cfg, *newMasterKey, *rotateDataKey, *batchSize); err != nil {
+		slog.Error("Key rotation failed", "error", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, cfg config.Config, newMasterKey, rotateDataKey bool, batchSize int) error {
+	if cfg.Encryption.KeyFile == "" {
+		return errors.New("ENCRYPTION_KEYFILE is not set")
+	}
+	if batchSize <= 0 {
+		return errors.New("-batch must be at least 1")
+	}
+	if newMasterKey {
+		if err := addMasterKey(cfg.Encryption.KeyFile); err != nil {
+			return err
+		}
+	}
+
+	client, err := setup.NewClient(cfg.Supabase)
+	if err != nil {
+		return err
+	}
+	keyring, err := setup.NewKeyring(cfg.Encryption, client)
+	if err != nil {
+		return err
+	}
+
+	rewrapped, err := keyring.RewrapDataKeys(ctx)
+	if err != nil {
+		return err
+	}
+	slog.Info("Data keys rewrapped with the active master key", "rewrapped", rewrapped)
+
+	reencrypter := repository.NewScheduleReencrypter(client, keyring)
+	return tenant.Each(ctx, repository.NewTenantRepository(client), func(ctx context.Context) error {
+		tenantID := tenant.ID(ctx)
+		if rotateDataKey {
+			keyID, err := keyring.RotateDataKey(ctx, tenantID)
+			if err != nil {
+				return err
+			}
+			slog.Info("Data key rotated", "tenant", tenantID, "key_id", keyID)
+		}
+
+		result, err := reencrypter.Run(ctx, batchSize)
+		slog.Info("Schedules re-encrypted", "tenant", tenantID, "scanned", result.Scanned, "rewritten", result.Rewritten, "skipped", result.Skipped)
+		if err != nil {
+			return err
+		}
+		if result.Skipped > 0 {
+			slog.Warn("Some schedules changed during re-encryption, run rotate-keys again with -rotate-data-key=false to finish them", "tenant", tenantID, "skipped", result.Skipped)
+		}
+		return nil
+	})
+}
+
+// addMasterKey adds a master key to the keyfile at path, or creates the
+// keyfile if there is none yet.
+func addMasterKey(path string) error {
+	keyfile, err := encryption.LoadKeyfile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		if keyfile, err = encryption.NewKeyfile(); err != nil {
+			return err
+		}
+		slog.Info("Creating keyfile", "path", path)
+	} else if err != nil {
+		return err
+	} else if _, err := keyfile.AddMasterKey(); err != nil {
+		return err
+	}
+	if err := keyfile.Save(path); err != nil {
+		return err
+	}
+	slog.Info("Master key added", "master_key", keyfile.ActiveMasterKey, "master_keys", keyfile.MasterKeyIDs())
+	return nil
+}
@@ -18,20 +18,29 @@ const docTemplate = `{
     "host": "{{.Host}}",
     "basePath": "{{.BasePath}}",
     "paths": {
-        "/schedules": {
+        "/api-keys": {
             "get": {
-                "description": "Get a list of all schedules with their associated tasks.",
+                "description": "Get the agency's API keys, including revoked and expired ones. The keys themselves are never returned, only their prefix.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get all schedules",
+                "summary": "List API keys",
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved schedules",
+                        "description": "Successfully retrieved API keys",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Schedule"
+                                "$ref": "#/definitions/models.APIKey"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     },
@@ -45,18 +54,45 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/schedules/reset": {
+            },
             "post": {
-                "description": "Resets the status of sample schedules and tasks for demonstration purposes.",
+                "description": "Create an API key for another system, with scopes read:schedules, write:visits and export:billing. The response contains the key; it is not shown again. Only admins can create keys.",
+                "consumes": [
+                    "application/json"
+                ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Reset sample data",
+                "summary": "Create an API key",
+                "parameters": [
+                    {
+                        "description": "API key details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateAPIKeyRequest"
+                        }
+                    }
+                ],
                 "responses": {
-                    "200": {
-                        "description": "Sample data reset successfully",
+                    "201": {
+                        "description": "API key created",
+                        "schema": {
+                            "$ref": "#/definitions/models.APIKey"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -76,18 +112,48 @@ const docTemplate = `{
                 }
             }
         },
-        "/schedules/stats": {
-            "get": {
-                "description": "Get aggregated statistics for all schedules (Total, Missed, Upcoming, Completed).",
+        "/api-keys/{id}": {
+            "delete": {
+                "description": "Revoke an API key. Requests made with it are refused from then on.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get schedule statistics",
+                "summary": "Revoke an API key",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "API key ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved schedule statistics",
+                        "description": "API key revoked",
                         "schema": {
-                            "$ref": "#/definitions/models.ScheduleStats"
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "API key not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
                         }
                     },
                     "500": {
@@ -102,20 +168,53 @@ const docTemplate = `{
                 }
             }
         },
-        "/schedules/today": {
+        "/audit/access": {
             "get": {
-                "description": "Get a list of all schedules (for demo purposes, returns all schedules).",
+                "description": "Get who was shown a client's PHI, newest first: the actor and purpose of use, the route, the schedules and the PHI fields each response contained. Only admins and privacy officers may list them.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get today's schedules",
+                "summary": "List PHI access records for a client",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client whose access records to list",
+                        "name": "client_id",
+                        "in": "query",
+                        "required": true
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Maximum number of records (default 100, max 1000)",
+                        "name": "limit",
+                        "in": "query"
+                    }
+                ],
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved today's schedules",
+                        "description": "Successfully retrieved access records",
                         "schema": {
                             "type": "array",
                             "items": {
-                                "$ref": "#/definitions/models.Schedule"
+                                "$ref": "#/definitions/audit.Record"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
                             }
                         }
                     },
@@ -131,31 +230,33 @@ const docTemplate = `{
                 }
             }
         },
-        "/schedules/{id}": {
+        "/branches": {
             "get": {
-                "description": "Get a single schedule by its ID, including its tasks.",
+                "description": "Get the branch offices of the agency, or of one region. Supervisors only get the branches they are assigned to.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Get schedule by ID",
+                "summary": "List branches",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Schedule ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
+                        "description": "Only branches of this region",
+                        "name": "region_id",
+                        "in": "query"
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Successfully retrieved schedule",
+                        "description": "Successfully retrieved branches",
                         "schema": {
-                            "$ref": "#/definitions/models.Schedule"
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Branch"
+                            }
                         }
                     },
-                    "404": {
-                        "description": "Schedule not found",
+                    "400": {
+                        "description": "Bad Request",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -173,44 +274,32 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/schedules/{id}/end": {
+            },
             "post": {
-                "description": "Log the end time and location for a schedule.",
+                "description": "Create a branch office, optionally in a region. Admins only.",
                 "consumes": [
                     "application/json"
                 ],
                 "produces": [
                     "application/json"
                 ],
-                "summary": "End a visit",
+                "summary": "Create a branch",
                 "parameters": [
                     {
-                        "type": "string",
-                        "description": "Schedule ID",
-                        "name": "id",
-                        "in": "path",
-                        "required": true
-                    },
-                    {
-                        "description": "End visit details",
+                        "description": "Branch details",
                         "name": "request",
                         "in": "body",
                         "required": true,
                         "schema": {
-                            "$ref": "#/definitions/handler.EndVisitRequest"
+                            "$ref": "#/definitions/handler.CreateBranchRequest"
                         }
                     }
                 ],
                 "responses": {
-                    "200": {
-                        "description": "Visit ended successfully",
+                    "201": {
+                        "description": "Branch created",
                         "schema": {
-                            "type": "object",
-                            "additionalProperties": {
-                                "type": "string"
-                            }
+                            "$ref": "#/definitions/models.Branch"
                         }
                     },
                     "400": {
@@ -222,8 +311,8 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "409": {
-                        "description": "Conflict (e.g., visit not in progress)",
+                    "403": {
+                        "description": "Forbidden",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -243,37 +332,88 @@ const docTemplate = `{
                 }
             }
         },
-        "/schedules/{id}/start": {
-            "post": {
-                "description": "Log the start time and location for a schedule.",
-                "consumes": [
+        "/branches/{id}": {
+            "get": {
+                "description": "Get a branch office with the IDs of its clients, caregivers and supervisors.",
+                "produces": [
                     "application/json"
                 ],
+                "summary": "Get a branch",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Branch ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved branch",
+                        "schema": {
+                            "$ref": "#/definitions/models.Branch"
+                        }
+                    },
+                    "404": {
+                        "description": "Branch not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/branches/{id}/{kind}/{memberId}": {
+            "put": {
+                "description": "Assign a client, caregiver or supervisor (Supabase user ID) to a branch. A client belongs to one branch, so assigning it moves it and its visits from its previous branch. Admins only.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Start a visit",
+                "summary": "Assign a branch member",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Schedule ID",
+                        "description": "Branch ID",
                         "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Start visit details",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.StartVisitRequest"
-                        }
+                        "enum": [
+                            "clients",
+                            "caregivers",
+                            "supervisors"
+                        ],
+                        "type": "string",
+                        "description": "Kind of member",
+                        "name": "kind",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client, caregiver or user ID",
+                        "name": "memberId",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Visit started successfully",
+                        "description": "Member assigned",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -290,8 +430,17 @@ const docTemplate = `{
                             }
                         }
                     },
-                    "409": {
-                        "description": "Conflict (e.g., visit already in progress)",
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Branch not found",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -309,39 +458,44 @@ const docTemplate = `{
                         }
                     }
                 }
-            }
-        },
-        "/tasks/{taskId}/update": {
-            "post": {
-                "description": "Update the completion status of a specific task.",
-                "consumes": [
-                    "application/json"
-                ],
+            },
+            "delete": {
+                "description": "Remove a client, caregiver or supervisor from a branch. The visits of a removed client no longer belong to any branch. Admins only.",
                 "produces": [
                     "application/json"
                 ],
-                "summary": "Update task status",
+                "summary": "Unassign a branch member",
                 "parameters": [
                     {
                         "type": "string",
-                        "description": "Task ID",
-                        "name": "taskId",
+                        "description": "Branch ID",
+                        "name": "id",
                         "in": "path",
                         "required": true
                     },
                     {
-                        "description": "Task update details",
-                        "name": "request",
-                        "in": "body",
-                        "required": true,
-                        "schema": {
-                            "$ref": "#/definitions/handler.UpdateTaskStatusRequest"
-                        }
+                        "enum": [
+                            "clients",
+                            "caregivers",
+                            "supervisors"
+                        ],
+                        "type": "string",
+                        "description": "Kind of member",
+                        "name": "kind",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "Client, caregiver or user ID",
+                        "name": "memberId",
+                        "in": "path",
+                        "required": true
                     }
                 ],
                 "responses": {
                     "200": {
-                        "description": "Task status updated successfully",
+                        "description": "Member unassigned",
                         "schema": {
                             "type": "object",
                             "additionalProperties": {
@@ -358,6 +512,24 @@ const docTemplate = `{
                             }
                         }
                     },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Branch or member not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
                     "500": {
                         "description": "Internal Server Error",
                         "schema": {
@@ -369,24 +541,2290 @@ const docTemplate = `{
                     }
                 }
             }
-        }
-    },
-    "definitions": {
-        "handler.EndVisitRequest": {
-            "type": "object",
-            "properties": {
-                "address": {
-                    "type": "string"
+        },
+        "/care-plans": {
+            "post": {
+                "description": "Create the client's active care plan from task templates. Any previously active plan for the client is retired, and the client's upcoming scheduled visits are re-planned from the new templates.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create a care plan",
+                "parameters": [
+                    {
+                        "description": "Care plan details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateCarePlanRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Care plan created",
+                        "schema": {
+                            "$ref": "#/definitions/models.CarePlan"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Client not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/care-plans/{id}": {
+            "get": {
+                "description": "Get a care plan and its task templates by ID.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get a care plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Care plan ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved care plan",
+                        "schema": {
+                            "$ref": "#/definitions/models.CarePlan"
+                        }
+                    },
+                    "404": {
+                        "description": "Care plan not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/care-plans/{id}/templates": {
+            "put": {
+                "description": "Replace all task templates of an active care plan. Visits that have started or are in the past keep their tasks; upcoming scheduled visits are re-planned. Tasks added to a visit by hand are kept.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Replace care plan task templates",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Care plan ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "description": "New task templates",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.ReplaceTemplatesRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Templates replaced",
+                        "schema": {
+                            "$ref": "#/definitions/models.CarePlan"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Care plan not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Care plan is no longer active",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/clients/{clientId}/care-plan": {
+            "get": {
+                "description": "Get the care plan new visits for the client are planned from.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get a client's active care plan",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "clientId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved care plan",
+                        "schema": {
+                            "$ref": "#/definitions/models.CarePlan"
+                        }
+                    },
+                    "404": {
+                        "description": "Client has no active care plan",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/regions": {
+            "get": {
+                "description": "Get the service regions of the agency.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List regions",
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved regions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Region"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Create a service region to group branch offices. Admins only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create a region",
+                "parameters": [
+                    {
+                        "description": "Region details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateRegionRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Region created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Region"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/retention/holds": {
+            "get": {
+                "description": "Get the clients whose data is exempt from retention.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List legal holds",
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved legal holds",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.LegalHold"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Exempt all data of a client from retention until the hold is released. Placing a hold on a client that already has one replaces its reason. The caller is recorded as placed_by. Admins and privacy officers only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Place a legal hold",
+                "parameters": [
+                    {
+                        "description": "Hold details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.PlaceLegalHoldRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Legal hold placed",
+                        "schema": {
+                            "$ref": "#/definitions/models.LegalHold"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/retention/holds/{clientId}": {
+            "delete": {
+                "description": "Make a client's data subject to retention again. Data already past its retention period is purged on the next run.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Release a legal hold",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Client ID",
+                        "name": "clientId",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Legal hold released",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Legal hold not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/retention/locations/scrub": {
+            "post": {
+                "description": "Coarsen or drop the clock-in and clock-out coordinates of completed visits that passed the geofence check or are old enough, keeping the verification result and distance. Each scrub is recorded in the PHI access log. Clients on legal hold are skipped. Meant for schedulers in environments without a background worker (e.g. Vercel cron). Admins and privacy officers only.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Scrub visit locations",
+                "responses": {
+                    "200": {
+                        "description": "Scrub report",
+                        "schema": {
+                            "$ref": "#/definitions/models.LocationScrubReport"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/retention/purge": {
+            "post": {
+                "description": "Delete or anonymize every row older than its data class's retention period, except for clients on legal hold. Meant for schedulers in environments without a background worker (e.g. Vercel cron).",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Run the retention purge",
+                "parameters": [
+                    {
+                        "type": "boolean",
+                        "description": "Only report what would be purged",
+                        "name": "dry_run",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Purge report",
+                        "schema": {
+                            "$ref": "#/definitions/models.RetentionReport"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/retention/report": {
+            "get": {
+                "description": "Count, per data class, the rows a purge would delete or anonymize now. Nothing is changed. Clients on legal hold are excluded.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Preview the retention purge",
+                "responses": {
+                    "200": {
+                        "description": "Dry-run report",
+                        "schema": {
+                            "$ref": "#/definitions/models.RetentionReport"
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules": {
+            "get": {
+                "description": "Get a page of schedules with their associated tasks, ordered by scheduled start. Pass the returned next_cursor as cursor to get the following page; it is null on the last page.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get all schedules",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag from an earlier response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "integer",
+                        "description": "Page size (default 50, max 200)",
+                        "name": "limit",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "next_cursor from the previous page",
+                        "name": "cursor",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated statuses (scheduled, in_progress, completed, cancelled)",
+                        "name": "status",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only schedules for this client",
+                        "name": "client_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only schedules whose client name is exactly this",
+                        "name": "client_name",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only schedules for this caregiver",
+                        "name": "caregiver_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated branch IDs; supervisors get their own branches by default",
+                        "name": "branch_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "First shift date to include (YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last shift date to include (YYYY-MM-DD)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "scheduled_start",
+                            "-scheduled_start"
+                        ],
+                        "type": "string",
+                        "description": "scheduled_start (default) or -scheduled_start for newest first",
+                        "name": "sort",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved schedules",
+                        "schema": {
+                            "$ref": "#/definitions/models.SchedulePage"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Strong entity tag of the response body"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified since the If-None-Match ETag"
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Branch not assigned to the supervisor",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Schedule a new visit. Its tasks are generated from the client's active care plan, taking each template's frequency into account.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create a schedule",
+                "parameters": [
+                    {
+                        "description": "Schedule details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateScheduleRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Schedule created",
+                        "schema": {
+                            "$ref": "#/definitions/models.Schedule"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Client not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/missed/detect": {
+            "post": {
+                "description": "Queue visit.missed for every visit whose scheduled end passed in the last 24 hours while it was still scheduled. Visits already reported are skipped. Meant for schedulers in environments without a background worker (e.g. Vercel cron). Admins only.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Detect missed visits",
+                "responses": {
+                    "200": {
+                        "description": "Number of visits newly reported as missed",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/reset": {
+            "post": {
+                "description": "Resets the status of sample schedules and tasks for demonstration purposes.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Reset sample data",
+                "responses": {
+                    "200": {
+                        "description": "Sample data reset successfully",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/stats": {
+            "get": {
+                "description": "Get per-status counts, on-time rate, average visit duration, task completion rate and a daily time series for schedules whose shift date falls in the optional range.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get schedule statistics",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "First shift date to include (YYYY-MM-DD)",
+                        "name": "from",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Last shift date to include (YYYY-MM-DD)",
+                        "name": "to",
+                        "in": "query"
+                    },
+                    {
+                        "enum": [
+                            "day",
+                            "client",
+                            "caregiver",
+                            "service"
+                        ],
+                        "type": "string",
+                        "description": "Break the statistics down by day, client, caregiver or service",
+                        "name": "group_by",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated branch IDs; supervisors get their own branches by default",
+                        "name": "branch_id",
+                        "in": "query"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved schedule statistics",
+                        "schema": {
+                            "$ref": "#/definitions/models.ScheduleStats"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Branch not assigned to the supervisor",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/today": {
+            "get": {
+                "description": "Get a list of all schedules (for demo purposes, returns all schedules).",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get today's schedules",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag from an earlier response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved today's schedules",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Schedule"
+                            }
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Strong entity tag of the response body"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified since the If-None-Match ETag"
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/{id}": {
+            "get": {
+                "description": "Get a single schedule by its ID, including its tasks.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Get schedule by ID",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "ETag from an earlier response",
+                        "name": "If-None-Match",
+                        "in": "header"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved schedule",
+                        "schema": {
+                            "$ref": "#/definitions/models.Schedule"
+                        },
+                        "headers": {
+                            "ETag": {
+                                "type": "string",
+                                "description": "Strong entity tag of the response body"
+                            }
+                        }
+                    },
+                    "304": {
+                        "description": "Not modified since the If-None-Match ETag"
+                    },
+                    "404": {
+                        "description": "Schedule not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/{id}/end": {
+            "post": {
+                "description": "Log the end time and location for a schedule. Refused while a required task is neither completed nor given a reason; the response then lists the outstanding task IDs.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "End a visit",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the schedule the change is based on",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "End visit details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.EndVisitRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Visit ended successfully",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict (visit not in progress, or required tasks are unresolved)",
+                        "schema": {
+                            "$ref": "#/definitions/handler.OutstandingTasksResponse"
+                        }
+                    },
+                    "412": {
+                        "description": "Schedule changed since the If-Match ETag",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/{id}/start": {
+            "post": {
+                "description": "Log the start time and location for a schedule.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Start a visit",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the schedule the change is based on",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Start visit details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.StartVisitRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Visit started successfully",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Conflict (e.g., visit already in progress)",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Schedule changed since the If-Match ETag",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/{id}/tasks": {
+            "post": {
+                "description": "Log unplanned work done during a visit. The task is marked ad_hoc and is never required.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Add an ad-hoc task",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the schedule the change is based on",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Task details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.AddTaskRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Task added",
+                        "schema": {
+                            "$ref": "#/definitions/models.Task"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Schedule not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Visit not in progress or past the update grace window",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Schedule changed since the If-Match ETag",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/schedules/{id}/tasks:batch": {
+            "post": {
+                "description": "Update the status of several tasks of one visit in a single request. The updates are validated together and either all of them are applied or none.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Update several tasks",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Schedule ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the schedule the change is based on",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Task updates",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.BatchUpdateTasksRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Updated tasks",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.Task"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Schedule not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Visit not in progress or past the update grace window",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Schedule changed since the If-Match ETag",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/stream/visits": {
+            "get": {
+                "description": "Server-Sent Events stream of the caller's tenant's visit.started, visit.completed, visit.missed and task.updated events. Supervisors only get the events of their branches. Reconnecting clients send Last-Event-ID to receive the events they missed; when that is no longer possible a \"reset\" event tells them to reload.",
+                "produces": [
+                    "text/event-stream"
+                ],
+                "summary": "Stream visit status changes",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Only events for this client",
+                        "name": "client_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Only events for this caregiver",
+                        "name": "caregiver_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Comma-separated branch IDs",
+                        "name": "branch_id",
+                        "in": "query"
+                    },
+                    {
+                        "type": "string",
+                        "description": "Resume after this event ID",
+                        "name": "Last-Event-ID",
+                        "in": "header"
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Event stream",
+                        "schema": {
+                            "type": "string"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Branch not assigned to the supervisor",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Streaming unsupported",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/tasks/{taskId}/update": {
+            "post": {
+                "description": "Update the completion status of a specific task. Tasks that were not completed need a reason_code (client_declined, client_unavailable, not_needed, insufficient_time, unsafe_conditions, supplies_unavailable or other). Tasks can only be updated while the visit is in progress or shortly after it ended.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Update task status",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Task ID",
+                        "name": "taskId",
+                        "in": "path",
+                        "required": true
+                    },
+                    {
+                        "type": "string",
+                        "description": "ETag of the schedule the change is based on",
+                        "name": "If-Match",
+                        "in": "header"
+                    },
+                    {
+                        "description": "Task update details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.UpdateTaskStatusRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Task status updated successfully",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Task not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Visit not in progress or past the update grace window",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "412": {
+                        "description": "Schedule changed since the If-Match ETag",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks": {
+            "get": {
+                "description": "Get all webhook subscriptions, or to supervisors those limited to their branches. Signing secrets are never included.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List webhook subscriptions",
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved subscriptions",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookSubscription"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            },
+            "post": {
+                "description": "Subscribe a URL to visit lifecycle events (visit.started, visit.completed, task.updated, visit.missed). An empty events list subscribes to all events, and branch_ids limits the subscription to those branches' visits. The signing secret is only returned in this response. Admins only.",
+                "consumes": [
+                    "application/json"
+                ],
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Create a webhook subscription",
+                "parameters": [
+                    {
+                        "description": "Subscription details",
+                        "name": "request",
+                        "in": "body",
+                        "required": true,
+                        "schema": {
+                            "$ref": "#/definitions/handler.CreateWebhookRequest"
+                        }
+                    }
+                ],
+                "responses": {
+                    "201": {
+                        "description": "Subscription created",
+                        "schema": {
+                            "$ref": "#/definitions/models.WebhookSubscription"
+                        }
+                    },
+                    "400": {
+                        "description": "Bad Request",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/deliveries/dead": {
+            "get": {
+                "description": "Get deliveries that exhausted their retries and will not be attempted again. Admins only.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "List dead-lettered webhook deliveries",
+                "responses": {
+                    "200": {
+                        "description": "Successfully retrieved dead letters",
+                        "schema": {
+                            "type": "array",
+                            "items": {
+                                "$ref": "#/definitions/models.WebhookDelivery"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/deliveries/{id}/retry": {
+            "post": {
+                "description": "Move a dead-lettered delivery back into the outbox with a fresh retry budget. Admins only.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Retry a dead-lettered delivery",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Delivery ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Delivery requeued",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Delivery not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "409": {
+                        "description": "Delivery is not dead-lettered",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/dispatch": {
+            "post": {
+                "description": "Attempt every pending delivery that is due. Meant for schedulers in environments without a background worker (e.g. Vercel cron). Admins only.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Dispatch due webhook deliveries",
+                "responses": {
+                    "200": {
+                        "description": "Number of deliveries sent",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "integer"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        },
+        "/webhooks/{id}": {
+            "delete": {
+                "description": "Remove a webhook subscription together with its pending deliveries. Admins only.",
+                "produces": [
+                    "application/json"
+                ],
+                "summary": "Delete a webhook subscription",
+                "parameters": [
+                    {
+                        "type": "string",
+                        "description": "Subscription ID",
+                        "name": "id",
+                        "in": "path",
+                        "required": true
+                    }
+                ],
+                "responses": {
+                    "200": {
+                        "description": "Subscription deleted",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "403": {
+                        "description": "Forbidden",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "404": {
+                        "description": "Subscription not found",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    },
+                    "500": {
+                        "description": "Internal Server Error",
+                        "schema": {
+                            "type": "object",
+                            "additionalProperties": {
+                                "type": "string"
+                            }
+                        }
+                    }
+                }
+            }
+        }
+    },
+    "definitions": {
+        "audit.Record": {
+            "type": "object",
+            "properties": {
+                "action": {
+                    "type": "string"
+                },
+                "actor": {
+                    "type": "string"
+                },
+                "client_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "fields": {
+                    "description": "Fields are the PHI fields the response contained, such as client_name.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "method": {
+                    "type": "string"
+                },
+                "occurred_at": {
+                    "type": "string"
+                },
+                "purpose": {
+                    "type": "string"
+                },
+                "request_id": {
+                    "type": "string"
+                },
+                "route": {
+                    "type": "string"
+                },
+                "schedule_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handler.AddTaskRequest": {
+            "type": "object",
+            "properties": {
+                "category": {
+                    "description": "Optional ADL/IADL code",
+                    "type": "string"
+                },
+                "completed": {
+                    "description": "Defaults to true",
+                    "type": "boolean"
+                },
+                "completed_by": {
+                    "description": "Defaults to the visit's caregiver",
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "reason_code": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.BatchUpdateTasksRequest": {
+            "type": "object",
+            "properties": {
+                "completed_by": {
+                    "description": "Default for updates that don't set their own",
+                    "type": "string"
+                },
+                "updates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.TaskUpdate"
+                    }
+                }
+            }
+        },
+        "handler.CreateAPIKeyRequest": {
+            "type": "object",
+            "properties": {
+                "expires_at": {
+                    "description": "ExpiresAt is optional; keys without one do not expire.",
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "rate_limit_per_minute": {
+                    "description": "RateLimitPerMinute is optional; zero uses the API's default.",
+                    "type": "integer"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handler.CreateBranchRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                },
+                "region_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateCarePlanRequest": {
+            "type": "object",
+            "properties": {
+                "client_id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "templates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.TaskTemplateRequest"
+                    }
+                }
+            }
+        },
+        "handler.CreateRegionRequest": {
+            "type": "object",
+            "properties": {
+                "name": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateScheduleRequest": {
+            "type": "object",
+            "properties": {
+                "caregiver_id": {
+                    "type": "string"
+                },
+                "client_avatar": {
+                    "type": "string"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "client_name": {
+                    "type": "string"
+                },
+                "end_time": {
+                    "description": "HH:MM",
+                    "type": "string"
+                },
+                "location": {
+                    "$ref": "#/definitions/models.Location"
+                },
+                "service_name": {
+                    "type": "string"
+                },
+                "service_notes": {
+                    "type": "string"
+                },
+                "shift_date": {
+                    "description": "YYYY-MM-DD",
+                    "type": "string"
+                },
+                "start_time": {
+                    "description": "HH:MM",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.CreateWebhookRequest": {
+            "type": "object",
+            "properties": {
+                "branch_ids": {
+                    "description": "Optional, limits the subscription to these branches' visits",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "secret": {
+                    "description": "Optional, generated when empty",
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.EndVisitRequest": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                }
+            }
+        },
+        "handler.OutstandingTasksResponse": {
+            "type": "object",
+            "properties": {
+                "error": {
+                    "type": "string"
+                },
+                "outstanding_task_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "handler.PlaceLegalHoldRequest": {
+            "type": "object",
+            "properties": {
+                "client_id": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "handler.ReplaceTemplatesRequest": {
+            "type": "object",
+            "properties": {
+                "templates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/handler.TaskTemplateRequest"
+                    }
+                }
+            }
+        },
+        "handler.StartVisitRequest": {
+            "type": "object",
+            "properties": {
+                "address": {
+                    "type": "string"
+                },
+                "latitude": {
+                    "type": "number"
+                },
+                "longitude": {
+                    "type": "number"
+                }
+            }
+        },
+        "handler.TaskTemplateRequest": {
+            "type": "object",
+            "properties": {
+                "category": {
+                    "description": "ADL/IADL code, e.g. adl.bathing or iadl.meal_preparation",
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "frequency": {
+                    "description": "every_visit (default), mon_wed_fri or weekly",
+                    "type": "string"
+                },
+                "required": {
+                    "description": "Defaults to true",
+                    "type": "boolean"
+                },
+                "weekday": {
+                    "description": "Required for weekly templates, e.g. \"monday\"",
+                    "type": "string"
+                }
+            }
+        },
+        "handler.UpdateTaskStatusRequest": {
+            "type": "object",
+            "properties": {
+                "completed": {
+                    "type": "boolean"
+                },
+                "completed_by": {
+                    "description": "Defaults to the visit's caregiver",
+                    "type": "string"
+                },
+                "reason": {
+                    "description": "Optional note; required with reason_code \"other\"",
+                    "type": "string"
+                },
+                "reason_code": {
+                    "description": "Required if not completed, e.g. client_declined",
+                    "type": "string"
+                }
+            }
+        },
+        "models.APIKey": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
+                },
+                "expires_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "key": {
+                    "description": "Key is only set in the response that creates the key.",
+                    "type": "string"
+                },
+                "last_used_at": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "prefix": {
+                    "description": "The key's first characters, to tell keys apart",
+                    "type": "string"
+                },
+                "rate_limit_per_minute": {
+                    "description": "RateLimitPerMinute caps the key's requests. Zero means the API's\nAPI_KEY_RATE_LIMIT.",
+                    "type": "integer"
+                },
+                "revoked_at": {
+                    "type": "string"
+                },
+                "scopes": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.Branch": {
+            "type": "object",
+            "properties": {
+                "caregiver_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "client_ids": {
+                    "description": "Set by GetBranch only.",
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "region_id": {
+                    "type": "string"
+                },
+                "supervisor_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                }
+            }
+        },
+        "models.CarePlan": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "client_id": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "name": {
+                    "type": "string"
+                },
+                "templates": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.TaskTemplate"
+                    }
+                },
+                "updated_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.DailyStats": {
+            "type": "object",
+            "properties": {
+                "averageVisitMinutes": {
+                    "type": "number"
+                },
+                "cancelledSchedules": {
+                    "type": "integer"
+                },
+                "completedSchedules": {
+                    "type": "integer"
+                },
+                "date": {
+                    "description": "YYYY-MM-DD",
+                    "type": "string"
+                },
+                "inProgressSchedules": {
+                    "type": "integer"
+                },
+                "missedSchedules": {
+                    "type": "integer"
+                },
+                "onTimeRate": {
+                    "type": "number"
+                },
+                "scheduledSchedules": {
+                    "type": "integer"
                 },
-                "latitude": {
+                "taskCompletionRate": {
                     "type": "number"
                 },
-                "longitude": {
-                    "type": "number"
+                "totalSchedules": {
+                    "type": "integer"
                 }
             }
         },
-        "handler.StartVisitRequest": {
+        "models.LegalHold": {
+            "type": "object",
+            "properties": {
+                "client_id": {
+                    "type": "string"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "placed_by": {
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.Location": {
             "type": "object",
             "properties": {
                 "address": {
@@ -400,35 +2838,102 @@ const docTemplate = `{
                 }
             }
         },
-        "handler.UpdateTaskStatusRequest": {
+        "models.LocationScrubReport": {
             "type": "object",
             "properties": {
-                "completed": {
+                "mode": {
+                    "type": "string"
+                },
+                "scanned": {
+                    "type": "integer"
+                },
+                "scrubbed": {
+                    "type": "integer"
+                },
+                "skipped": {
+                    "description": "Skipped visits are not due yet, belong to a client on legal hold, or\nchanged while they were being scrubbed.",
+                    "type": "integer"
+                }
+            }
+        },
+        "models.LocationVerification": {
+            "type": "object",
+            "properties": {
+                "distance_meters": {
+                    "type": "number"
+                },
+                "radius_meters": {
+                    "type": "number"
+                },
+                "verified": {
                     "type": "boolean"
+                }
+            }
+        },
+        "models.Region": {
+            "type": "object",
+            "properties": {
+                "created_at": {
+                    "type": "string"
                 },
-                "reason": {
-                    "description": "Optional reason",
+                "id": {
+                    "type": "string"
+                },
+                "name": {
                     "type": "string"
                 }
             }
         },
-        "models.Location": {
+        "models.RetentionReport": {
             "type": "object",
             "properties": {
-                "address": {
+                "classes": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.RetentionResult"
+                    }
+                },
+                "dry_run": {
+                    "type": "boolean"
+                },
+                "legal_holds": {
+                    "type": "integer"
+                },
+                "ran_at": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.RetentionResult": {
+            "type": "object",
+            "properties": {
+                "action": {
                     "type": "string"
                 },
-                "latitude": {
-                    "type": "number"
+                "affected": {
+                    "type": "integer"
                 },
-                "longitude": {
-                    "type": "number"
+                "cutoff": {
+                    "type": "string"
+                },
+                "data_class": {
+                    "type": "string"
+                },
+                "retain_days": {
+                    "type": "integer"
                 }
             }
         },
         "models.Schedule": {
             "type": "object",
             "properties": {
+                "branch_id": {
+                    "description": "The client's branch, kept in sync by the database",
+                    "type": "string"
+                },
+                "caregiver_id": {
+                    "type": "string"
+                },
                 "client_avatar": {
                     "type": "string"
                 },
@@ -444,12 +2949,22 @@ const docTemplate = `{
                 "end_time": {
                     "type": "string"
                 },
+                "end_verification": {
+                    "$ref": "#/definitions/models.LocationVerification"
+                },
                 "id": {
                     "type": "string"
                 },
                 "location": {
                     "$ref": "#/definitions/models.Location"
                 },
+                "locations_scrubbed_at": {
+                    "type": "string"
+                },
+                "scheduled_start": {
+                    "description": "shift_date + start_time, local wall clock",
+                    "type": "string"
+                },
                 "service_name": {
                     "type": "string"
                 },
@@ -465,6 +2980,14 @@ const docTemplate = `{
                 "start_time": {
                     "type": "string"
                 },
+                "start_verification": {
+                    "description": "Set once the visit locations were coarsened or dropped, see\nLocationScrub.",
+                    "allOf": [
+                        {
+                            "$ref": "#/definitions/models.LocationVerification"
+                        }
+                    ]
+                },
                 "status": {
                     "type": "string"
                 },
@@ -482,15 +3005,71 @@ const docTemplate = `{
                 }
             }
         },
+        "models.SchedulePage": {
+            "type": "object",
+            "properties": {
+                "data": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.Schedule"
+                    }
+                },
+                "next_cursor": {
+                    "type": "string"
+                }
+            }
+        },
         "models.ScheduleStats": {
             "type": "object",
             "properties": {
+                "averageVisitMinutes": {
+                    "type": "number"
+                },
+                "cancelledSchedules": {
+                    "type": "integer"
+                },
+                "completedSchedules": {
+                    "type": "integer"
+                },
                 "completedToday": {
                     "type": "integer"
                 },
+                "daily": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.DailyStats"
+                    }
+                },
+                "from": {
+                    "type": "string"
+                },
+                "groupBy": {
+                    "type": "string"
+                },
+                "groups": {
+                    "type": "array",
+                    "items": {
+                        "$ref": "#/definitions/models.StatsGroup"
+                    }
+                },
+                "inProgressSchedules": {
+                    "type": "integer"
+                },
                 "missedSchedules": {
                     "type": "integer"
                 },
+                "onTimeRate": {
+                    "type": "number"
+                },
+                "scheduledSchedules": {
+                    "type": "integer"
+                },
+                "taskCompletionRate": {
+                    "type": "number"
+                },
+                "to": {
+                    "type": "string"
+                },
                 "totalSchedules": {
                     "type": "integer"
                 },
@@ -499,12 +3078,62 @@ const docTemplate = `{
                 }
             }
         },
+        "models.StatsGroup": {
+            "type": "object",
+            "properties": {
+                "averageVisitMinutes": {
+                    "type": "number"
+                },
+                "cancelledSchedules": {
+                    "type": "integer"
+                },
+                "completedSchedules": {
+                    "type": "integer"
+                },
+                "inProgressSchedules": {
+                    "type": "integer"
+                },
+                "key": {
+                    "type": "string"
+                },
+                "missedSchedules": {
+                    "type": "integer"
+                },
+                "onTimeRate": {
+                    "type": "number"
+                },
+                "scheduledSchedules": {
+                    "type": "integer"
+                },
+                "taskCompletionRate": {
+                    "type": "number"
+                },
+                "totalSchedules": {
+                    "type": "integer"
+                }
+            }
+        },
         "models.Task": {
             "type": "object",
             "properties": {
+                "ad_hoc": {
+                    "description": "Unplanned work logged during the visit",
+                    "type": "boolean"
+                },
+                "category": {
+                    "description": "ADL/IADL code copied from the care plan",
+                    "type": "string"
+                },
                 "completed": {
                     "type": "boolean"
                 },
+                "completed_at": {
+                    "type": "string"
+                },
+                "completed_by": {
+                    "description": "Caregiver who resolved the task",
+                    "type": "string"
+                },
                 "description": {
                     "type": "string"
                 },
@@ -512,10 +3141,150 @@ const docTemplate = `{
                     "type": "string"
                 },
                 "reason": {
+                    "description": "Free-text note; required with reason code \"other\"",
+                    "type": "string"
+                },
+                "reason_code": {
+                    "description": "Why the task was not completed, see TaskReasonCodes",
                     "type": "string"
                 },
+                "required": {
+                    "description": "false for optional care plan tasks",
+                    "type": "boolean"
+                },
                 "schedule_id": {
                     "type": "string"
+                },
+                "template_id": {
+                    "description": "Care plan template the task was generated from",
+                    "type": "string"
+                }
+            }
+        },
+        "models.TaskTemplate": {
+            "type": "object",
+            "properties": {
+                "care_plan_id": {
+                    "type": "string"
+                },
+                "category": {
+                    "type": "string"
+                },
+                "description": {
+                    "type": "string"
+                },
+                "frequency": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "position": {
+                    "type": "integer"
+                },
+                "required": {
+                    "type": "boolean"
+                },
+                "weekday": {
+                    "description": "e.g. \"monday\"; weekly templates only",
+                    "type": "string"
+                }
+            }
+        },
+        "models.TaskUpdate": {
+            "type": "object",
+            "properties": {
+                "completed": {
+                    "type": "boolean"
+                },
+                "completed_by": {
+                    "description": "Defaults to the visit's caregiver",
+                    "type": "string"
+                },
+                "reason": {
+                    "type": "string"
+                },
+                "reason_code": {
+                    "type": "string"
+                },
+                "task_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.WebhookDelivery": {
+            "type": "object",
+            "properties": {
+                "attempts": {
+                    "type": "integer"
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "delivered_at": {
+                    "type": "string"
+                },
+                "event_id": {
+                    "type": "string"
+                },
+                "event_type": {
+                    "type": "string"
+                },
+                "id": {
+                    "type": "string"
+                },
+                "last_error": {
+                    "type": "string"
+                },
+                "last_status_code": {
+                    "type": "integer"
+                },
+                "locked_until": {
+                    "type": "string"
+                },
+                "next_attempt_at": {
+                    "type": "string"
+                },
+                "payload": {
+                    "type": "object"
+                },
+                "status": {
+                    "type": "string"
+                },
+                "subscription_id": {
+                    "type": "string"
+                }
+            }
+        },
+        "models.WebhookSubscription": {
+            "type": "object",
+            "properties": {
+                "active": {
+                    "type": "boolean"
+                },
+                "branch_ids": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "created_at": {
+                    "type": "string"
+                },
+                "events": {
+                    "type": "array",
+                    "items": {
+                        "type": "string"
+                    }
+                },
+                "id": {
+                    "type": "string"
+                },
+                "secret": {
+                    "type": "string"
+                },
+                "url": {
+                    "type": "string"
                 }
             }
         }
@@ -0,0 +1,85 @@
+// Package audit records who was shown which clients' PHI. A middleware on the
+// read endpoints captures each response, and a background recorder extracts
+// the client IDs and PHI fields from it and appends them to the access log.
+// The log also holds the scrubs that reduced stored PHI, which the repository
+// writes together with the scrub itself.
+package audit
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+)
+
+// PurposeHeader is the header callers use to say why they are reading PHI.
+// Who is reading it is never taken from the request: it is the authenticated
+// caller, or UnknownActor when the API does not authenticate its callers.
+const PurposeHeader = "X-Purpose-Of-Use"
+
+// Defaults recorded when the request does not say.
+const (
+	UnknownActor       = "anonymous"
+	UnspecifiedPurpose = "unspecified"
+)
+
+// Actions in the access log.
+const (
+	ActionRead  = "read"
+	ActionScrub = "scrub"
+)
+
+// Record is one response that disclosed PHI, or one scrub.
+type Record struct {
+	ID          string    `json:"id,omitempty"`
+	OccurredAt  time.Time `json:"occurred_at"`
+	Actor       string    `json:"actor"`
+	Purpose     string    `json:"purpose"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Method      string    `json:"method"`
+	Route       string    `json:"route"`
+	Action      string    `json:"action"`
+	ClientIDs   []string  `json:"client_ids"`
+	ScheduleIDs []string  `json:"schedule_ids"`
+	// Fields are the PHI fields the response contained, such as client_name.
+	Fields []string `json:"fields"`
+}
+
+// Store is the append-only access log.
+type Store interface {
+	Append(ctx context.Context, records []Record) error
+	// ListByClient returns the records that include clientID, newest first.
+	ListByClient(ctx context.Context, clientID string, limit int) ([]Record, error)
+}
+
+type actorKey struct{}
+
+// WithActor sets the actor recorded for the requests served with ctx.
+func WithActor(ctx context.Context, actor string) context.Context {
+	return context.WithValue(ctx, actorKey{}, actor)
+}
+
+// validHeaderValue limits caller-supplied purposes to something safe to store
+// and show.
+var validHeaderValue = regexp.MustCompile(`^[A-Za-z0-9._:@/-]{1,128}$`)
+
+// Actor returns the actor set on ctx with WithActor, or UnknownActor.
+func Actor(ctx context.Context) string {
+	if actor, ok := ctx.Value(actorKey{}).(string); ok && actor != "" {
+		return actor
+	}
+	return UnknownActor
+}
+
+// actorFor returns the actor of r.
+func actorFor(r *http.Request) string {
+	return Actor(r.Context())
+}
+
+// purposeFor returns the purpose of use of r, such as TREAT or HPAYMT.
+func purposeFor(r *http.Request) string {
+	if purpose := r.Header.Get(PurposeHeader); validHeaderValue.MatchString(purpose) {
+		return purpose
+	}
+	return UnspecifiedPurpose
+}
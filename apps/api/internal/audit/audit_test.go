@@ -0,0 +1,235 @@
+package audit_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+type memoryStore struct {
+	mu      sync.Mutex
+	records []audit.Record
+	// tenants holds the tenant each record was appended for.
+	tenants []string
+}
+
+func (s *memoryStore) Append(ctx context.Context, records []audit.Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.records = append(s.records, records...)
+	for range records {
+		s.tenants = append(s.tenants, tenant.ID(ctx))
+	}
+	return nil
+}
+
+func (s *memoryStore) ListByClient(ctx context.Context, clientID string, limit int) ([]audit.Record, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) all() []audit.Record {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]audit.Record{}, s.records...)
+}
+
+const schedulePage = `{"data": [
+	{"id": "sch-001", "client_id": "client-001", "client_name": "Jane Doe", "service_notes": "",
+	 "location": {"latitude": -6.2, "longitude": 106.8, "address": "12 Elm Street"},
+	 "tasks": [{"id": "task-001", "description": "Give medication"}]},
+	{"id": "sch-002", "client_id": "client-002", "client_name": "John Roe"}
+], "next_cursor": null}`
+
+// newRouter serves body with status from /api/schedules/{id} behind the audit
+// middleware.
+func newRouter(recorder *audit.Recorder, status int, body string) *mux.Router {
+	router := mux.NewRouter()
+	router.Handle("/api/schedules/{id}", audit.Middleware(recorder)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	})))
+	return router
+}
+
+func TestMiddleware_RecordsPHIReads(t *testing.T) {
+	store := &memoryStore{}
+	recorder := audit.NewRecorder(store, audit.RecorderConfig{FlushInterval: time.Hour})
+	router := newRouter(recorder, http.StatusOK, schedulePage)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil)
+	req.Header.Set(audit.PurposeHeader, "TREAT")
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req.WithContext(audit.WithActor(req.Context(), "user:caregiver-007")))
+
+	var page map[string]interface{}
+	if err := json.Unmarshal(rec.Body.Bytes(), &page); err != nil {
+		t.Fatalf("Expected the response to pass through unchanged, got %v", err)
+	}
+	if len(store.all()) != 0 {
+		t.Fatal("Expected records to be written in the background, not during the request")
+	}
+	if err := recorder.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	records := store.all()
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 record, got %d", len(records))
+	}
+	got := records[0]
+	if got.Actor != "user:caregiver-007" || got.Purpose != "TREAT" || got.Route != "/api/schedules/{id}" || got.Method != http.MethodGet || got.Action != audit.ActionRead {
+		t.Errorf("Expected the actor, purpose and route, got %+v", got)
+	}
+	if want := []string{"client-001", "client-002"}; !reflect.DeepEqual(got.ClientIDs, want) {
+		t.Errorf("Expected client IDs %v, got %v", want, got.ClientIDs)
+	}
+	if want := []string{"sch-001", "sch-002"}; !reflect.DeepEqual(got.ScheduleIDs, want) {
+		t.Errorf("Expected schedule IDs %v, got %v", want, got.ScheduleIDs)
+	}
+	want := []string{"address", "client_name", "description", "latitude", "location", "longitude"}
+	if !reflect.DeepEqual(got.Fields, want) {
+		t.Errorf("Expected the non-empty PHI fields %v, got %v", want, got.Fields)
+	}
+}
+
+func TestMiddleware_SkipsResponsesWithoutPHI(t *testing.T) {
+	cases := []struct {
+		name   string
+		status int
+		body   string
+	}{
+		{"not modified", http.StatusNotModified, ""},
+		{"not found", http.StatusNotFound, `{"error": "schedule not found"}`},
+		{"empty page", http.StatusOK, `{"data": [], "next_cursor": null}`},
+	}
+	for _, tc := range cases {
+		store := &memoryStore{}
+		recorder := audit.NewRecorder(store, audit.RecorderConfig{})
+		newRouter(recorder, tc.status, tc.body).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil))
+		recorder.Close(context.Background())
+
+		if records := store.all(); len(records) != 0 {
+			t.Errorf("%s: expected no record, got %+v", tc.name, records)
+		}
+	}
+}
+
+func TestMiddleware_ActorComesOnlyFromContext(t *testing.T) {
+	store := &memoryStore{}
+	recorder := audit.NewRecorder(store, audit.RecorderConfig{})
+	router := newRouter(recorder, http.StatusOK, schedulePage)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil)
+	req.Header.Set("X-Actor-ID", "someone-else")
+	router.ServeHTTP(httptest.NewRecorder(), req.WithContext(audit.WithActor(req.Context(), "integration:billing")))
+
+	req = httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil)
+	req.Header.Set("X-Actor-ID", "someone-else")
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	recorder.Close(context.Background())
+
+	records := store.all()
+	if len(records) != 2 {
+		t.Fatalf("Expected 2 records, got %d", len(records))
+	}
+	if records[0].Actor != "integration:billing" || records[0].Purpose != audit.UnspecifiedPurpose {
+		t.Errorf("Expected the context's actor and no purpose, got %+v", records[0])
+	}
+	if records[1].Actor != audit.UnknownActor {
+		t.Errorf("Expected a caller-asserted actor to be ignored, got %q", records[1].Actor)
+	}
+}
+
+func TestStreamMiddleware_RecordsEachStreamOnceWhenItOpens(t *testing.T) {
+	store := &memoryStore{}
+	recorder := audit.NewRecorder(store, audit.RecorderConfig{Synchronous: true})
+	router := mux.NewRouter()
+	router.Handle("/api/stream/visits", audit.StreamMiddleware(recorder, "client_id")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("branch_id") == "forbidden" {
+			http.Error(w, "forbidden", http.StatusForbidden)
+			return
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("Expected the stream to stay flushable")
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.WriteHeader(http.StatusOK)
+		for i := 0; i < 3; i++ {
+			w.Write([]byte("event: visit.started\ndata: {}\n\n"))
+			w.(http.Flusher).Flush()
+		}
+	})))
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stream/visits?client_id=client-001", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stream/visits", nil))
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/stream/visits?branch_id=forbidden", nil))
+
+	records := store.all()
+	if len(records) != 2 {
+		t.Fatalf("Expected 1 record for each stream opened, got %+v", records)
+	}
+	if got := records[0]; got.Route != "/api/stream/visits" || got.Action != audit.ActionRead || !reflect.DeepEqual(got.ClientIDs, []string{"client-001"}) {
+		t.Errorf("Expected the stream's route and client, got %+v", got)
+	}
+	if got := records[1]; got.ClientIDs == nil || len(got.ClientIDs) != 0 {
+		t.Errorf("Expected no client IDs for an unfiltered stream, got %+v", got.ClientIDs)
+	}
+}
+
+func TestRecorder_SynchronousWritesBeforeTheRequestEnds(t *testing.T) {
+	store := &memoryStore{}
+	recorder := audit.NewRecorder(store, audit.RecorderConfig{FlushInterval: time.Hour, Synchronous: true})
+	newRouter(recorder, http.StatusOK, schedulePage).ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil))
+
+	if records := store.all(); len(records) != 1 {
+		t.Errorf("Expected the record written without Close, got %d", len(records))
+	}
+}
+
+func TestRecorder_FullQueueDoesNotDropRecords(t *testing.T) {
+	store := &memoryStore{}
+	recorder := audit.NewRecorder(store, audit.RecorderConfig{BufferSize: 1, FlushInterval: time.Hour})
+	router := newRouter(recorder, http.StatusOK, schedulePage)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil))
+		}()
+	}
+	wg.Wait()
+	recorder.Close(context.Background())
+
+	if got := len(store.all()); got != 50 {
+		t.Errorf("Expected all 50 reads to be recorded, got %d", got)
+	}
+}
+
+func TestRecorder_WritesEachTenantsReads(t *testing.T) {
+	store := &memoryStore{}
+	recorder := audit.NewRecorder(store, audit.RecorderConfig{FlushInterval: time.Hour})
+	router := newRouter(recorder, http.StatusOK, schedulePage)
+
+	for _, tenantID := range []string{"agency-a", "agency-b", "agency-a"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req.WithContext(tenant.WithID(req.Context(), tenantID)))
+	}
+	recorder.Close(context.Background())
+
+	if want := []string{"agency-a", "agency-a", "agency-b"}; !reflect.DeepEqual(store.tenants, want) {
+		t.Errorf("Expected each read written for its own tenant, got %v", store.tenants)
+	}
+}
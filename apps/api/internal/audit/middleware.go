@@ -0,0 +1,134 @@
+package audit
+
+import (
+	"bytes"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/requestid"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// Middleware records the successful JSON responses of next with recorder. The
+// body is copied as it is written and, unless the recorder is synchronous,
+// examined in the background, so the response is not held up.
+func Middleware(recorder *Recorder) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			capture := &captureWriter{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(capture, r)
+
+			if capture.status != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+				return
+			}
+			recorder.record(r.Context(), access{
+				tenantID: tenant.ID(r.Context()),
+				record:   readRecord(r),
+				body:     capture.body.Bytes(),
+			})
+		})
+	}
+}
+
+// StreamMiddleware records one access for each stream next opens, when it
+// starts sending. The events themselves are not examined: the record names the
+// client the stream is limited to by the clientParam query parameter, if any.
+func StreamMiddleware(recorder *Recorder, clientParam string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&streamWriter{ResponseWriter: w, opened: func() {
+				record := readRecord(r)
+				record.ClientIDs, record.ScheduleIDs, record.Fields = []string{}, []string{}, []string{}
+				if clientID := r.URL.Query().Get(clientParam); clientID != "" {
+					record.ClientIDs = []string{clientID}
+				}
+				recorder.record(r.Context(), access{tenantID: tenant.ID(r.Context()), record: record})
+			}}, r)
+		})
+	}
+}
+
+// readRecord returns the record of a read made with r, without what it
+// disclosed.
+func readRecord(r *http.Request) Record {
+	route := r.URL.Path
+	if current := mux.CurrentRoute(r); current != nil {
+		if template, err := current.GetPathTemplate(); err == nil {
+			route = template
+		}
+	}
+	return Record{
+		OccurredAt: time.Now().UTC(),
+		Actor:      actorFor(r),
+		Purpose:    purposeFor(r),
+		RequestID:  requestid.FromContext(r.Context()),
+		Method:     r.Method,
+		Route:      route,
+		Action:     ActionRead,
+	}
+}
+
+// captureWriter passes a response through and keeps a copy of its body.
+type captureWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *captureWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.status, w.wroteHeader = status, true
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *captureWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// streamWriter passes a stream through and calls opened once, if it starts
+// with a 200.
+type streamWriter struct {
+	http.ResponseWriter
+	opened      func()
+	wroteHeader bool
+}
+
+func (w *streamWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if status == http.StatusOK {
+			w.opened()
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *streamWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *streamWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (w *streamWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,239 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/logging"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// batchSize caps how many records one append writes.
+const batchSize = 100
+
+// RecorderConfig tunes the background writer.
+type RecorderConfig struct {
+	// BufferSize is how many responses may wait to be written. When the
+	// buffer is full, responses are recorded synchronously instead of dropped.
+	BufferSize int
+	// FlushInterval is the longest a record waits before it is written.
+	FlushInterval time.Duration
+	// Synchronous writes each record before the request finishes instead of
+	// in the background. Serverless functions need it: their process may be
+	// frozen or stopped once the response is sent, and Close is never called.
+	Synchronous bool
+}
+
+// DefaultRecorderConfig returns the settings used for zero fields.
+func DefaultRecorderConfig() RecorderConfig {
+	return RecorderConfig{BufferSize: 1000, FlushInterval: time.Second}
+}
+
+// access is a captured response, turned into a Record by the writer so that
+// parsing the body stays off the request path. It is written to the log of
+// the tenant whose request it was. Streams have no body: their record is
+// complete when they open.
+type access struct {
+	tenantID string
+	record   Record
+	body     []byte
+}
+
+// Recorder writes access records to a Store in the background.
+type Recorder struct {
+	store  Store
+	config RecorderConfig
+	queue  chan access
+
+	// mu keeps record from queueing once Close has started draining.
+	mu        sync.RWMutex
+	closed    bool
+	closeOnce sync.Once
+	closing   chan struct{}
+	done      chan struct{}
+}
+
+// NewRecorder starts a recorder that writes to store. Close flushes it.
+func NewRecorder(store Store, config RecorderConfig) *Recorder {
+	defaults := DefaultRecorderConfig()
+	if config.BufferSize <= 0 {
+		config.BufferSize = defaults.BufferSize
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = defaults.FlushInterval
+	}
+	r := &Recorder{
+		store:   store,
+		config:  config,
+		queue:   make(chan access, config.BufferSize),
+		closing: make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// record queues a captured response. If the queue is full it is written
+// right away, so a burst slows requests down rather than losing records.
+func (r *Recorder) record(ctx context.Context, a access) {
+	if r.config.Synchronous {
+		r.write(context.WithoutCancel(ctx), []access{a})
+		return
+	}
+
+	r.mu.RLock()
+	queued := false
+	if !r.closed {
+		select {
+		case r.queue <- a:
+			queued = true
+		default:
+			slog.WarnContext(ctx, "Audit queue is full, recording synchronously")
+		}
+	}
+	r.mu.RUnlock()
+
+	if !queued {
+		r.write(context.WithoutCancel(ctx), []access{a})
+	}
+}
+
+// Close writes the queued records and stops the writer. It gives up when ctx
+// ends.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.closeOnce.Do(func() {
+		r.mu.Lock()
+		r.closed = true
+		r.mu.Unlock()
+		close(r.closing)
+	})
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(r.config.FlushInterval)
+	defer ticker.Stop()
+
+	var pending []access
+	flush := func() {
+		if len(pending) > 0 {
+			r.write(context.Background(), pending)
+			pending = nil
+		}
+	}
+	for {
+		select {
+		case a := <-r.queue:
+			if pending = append(pending, a); len(pending) >= batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-r.closing:
+			for {
+				select {
+				case a := <-r.queue:
+					pending = append(pending, a)
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func (r *Recorder) write(ctx context.Context, accesses []access) {
+	var tenants []string
+	byTenant := map[string][]Record{}
+	for _, a := range accesses {
+		record, ok := a.toRecord()
+		if !ok {
+			continue
+		}
+		if _, seen := byTenant[a.tenantID]; !seen {
+			tenants = append(tenants, a.tenantID)
+		}
+		byTenant[a.tenantID] = append(byTenant[a.tenantID], record)
+	}
+	for _, tenantID := range tenants {
+		records := byTenant[tenantID]
+		tenantCtx := tenant.WithID(ctx, tenantID)
+		for start := 0; start < len(records); start += batchSize {
+			batch := records[start:min(start+batchSize, len(records))]
+			if err := r.store.Append(tenantCtx, batch); err != nil {
+				slog.ErrorContext(ctx, "Failed to write PHI access records", "tenant", tenantID, "records", len(batch), "error", err)
+			}
+		}
+	}
+}
+
+// toRecord fills in the client IDs, schedule IDs and PHI fields of the
+// response body. It reports false when the body holds no PHI.
+func (a access) toRecord() (Record, bool) {
+	if a.body == nil {
+		return a.record, true
+	}
+	var doc interface{}
+	if err := json.Unmarshal(a.body, &doc); err != nil {
+		return Record{}, false
+	}
+	found := disclosure{clients: map[string]bool{}, schedules: map[string]bool{}, fields: map[string]bool{}}
+	found.walk(doc)
+	if len(found.fields) == 0 {
+		return Record{}, false
+	}
+
+	record := a.record
+	record.ClientIDs = sorted(found.clients)
+	record.ScheduleIDs = sorted(found.schedules)
+	record.Fields = sorted(found.fields)
+	return record, true
+}
+
+type disclosure struct {
+	clients, schedules, fields map[string]bool
+}
+
+// walk collects the PHI fields with a value anywhere in v, and the client_id
+// (and id, for schedules) of every object that has one.
+func (d disclosure) walk(v interface{}) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		if clientID, ok := v["client_id"].(string); ok && clientID != "" {
+			d.clients[clientID] = true
+			if id, ok := v["id"].(string); ok && v["client_name"] != nil {
+				d.schedules[id] = true
+			}
+		}
+		for key, value := range v {
+			if logging.IsPHIKey(key) && value != nil && value != "" {
+				d.fields[key] = true
+			}
+			d.walk(value)
+		}
+	case []interface{}:
+		for _, item := range v {
+			d.walk(item)
+		}
+	}
+}
+
+func sorted(set map[string]bool) []string {
+	values := make([]string, 0, len(set))
+	for value := range set {
+		values = append(values, value)
+	}
+	sort.Strings(values)
+	return values
+}
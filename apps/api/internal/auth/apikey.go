@@ -0,0 +1,148 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+)
+
+// APIKeyPrefix starts every API key, so that keys can be told apart from
+// JWTs and found by secret scanners.
+const APIKeyPrefix = "evv_"
+
+// ErrUnknownAPIKey is returned by an APIKeys store for a key hash it does not
+// hold.
+var ErrUnknownAPIKey = errors.New("auth: unknown API key")
+
+// APIKeys looks API keys up by the hash of the key. It is not scoped to a
+// tenant: the key decides the tenant of the request.
+type APIKeys interface {
+	// APIKeyByHash returns the key whose hash is hash, or an error wrapping
+	// ErrUnknownAPIKey.
+	APIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error)
+	TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error
+}
+
+// GenerateAPIKey returns a new random key and the prefix shown in listings.
+func GenerateAPIKey() (key, prefix string, err error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + hex.EncodeToString(buf)
+	return key, key[:len(APIKeyPrefix)+8], nil
+}
+
+// HashAPIKey returns the hash of key that is stored in place of the key.
+// Keys are random, so a plain SHA-256 is enough.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// IsAPIKey reports whether a bearer token is an API key rather than a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, APIKeyPrefix)
+}
+
+type apiKeyContextKey struct{}
+
+// WithAPIKey marks the requests served with ctx as made with key.
+func WithAPIKey(ctx context.Context, key models.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyContextKey{}, key)
+}
+
+// APIKeyFromContext returns the API key the request was made with, if any.
+func APIKeyFromContext(ctx context.Context) (models.APIKey, bool) {
+	key, ok := ctx.Value(apiKeyContextKey{}).(models.APIKey)
+	return key, ok
+}
+
+// Allows reports whether the caller of ctx may use a route that API keys need
+// one of scopes for. Users are not limited by scopes; an API key must grant
+// one of them, and may not use routes without any.
+func Allows(ctx context.Context, scopes ...string) bool {
+	key, ok := APIKeyFromContext(ctx)
+	if !ok {
+		return true
+	}
+	for _, scope := range scopes {
+		if key.HasScope(scope) {
+			return true
+		}
+	}
+	return false
+}
+
+// touchInterval is how often last_used_at is written for a key in use.
+const touchInterval = time.Minute
+
+// rateLimiter keeps a token bucket per API key, refilled at the key's rate
+// per minute and holding at most a minute's worth of requests. Buckets live
+// in process, so each API instance enforces the limit on its own. A bucket
+// left alone for a minute is full again, the same as no bucket, so idle ones
+// are dropped once a minute.
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+}
+
+type bucket struct {
+	tokens  float64
+	updated time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*bucket{}}
+}
+
+// allow takes a token from id's bucket. If there is none, it returns false and
+// how long until there is. A rate of zero or less is not limited.
+func (l *rateLimiter) allow(id string, perMinute int, now time.Time) (bool, time.Duration) {
+	if perMinute <= 0 {
+		return true, 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.prune(now)
+
+	capacity := float64(perMinute)
+	b, ok := l.buckets[id]
+	if !ok {
+		b = &bucket{tokens: capacity, updated: now}
+		l.buckets[id] = b
+	}
+	perSecond := capacity / 60
+	b.tokens += now.Sub(b.updated).Seconds() * perSecond
+	if b.tokens > capacity {
+		b.tokens = capacity
+	}
+	b.updated = now
+
+	if b.tokens < 1 {
+		return false, time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return true, 0
+}
+
+// prune drops the buckets that have refilled, at most once a minute.
+func (l *rateLimiter) prune(now time.Time) {
+	if now.Sub(l.pruned) < time.Minute {
+		return
+	}
+	l.pruned = now
+	for id, b := range l.buckets {
+		if now.Sub(b.updated) >= time.Minute {
+			delete(l.buckets, id)
+		}
+	}
+}
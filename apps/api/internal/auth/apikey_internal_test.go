@@ -0,0 +1,27 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRateLimiterDropsIdleBuckets(t *testing.T) {
+	l := newRateLimiter()
+	start := time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)
+	l.allow("key-1", 2, start)
+	l.allow("key-1", 2, start)
+	l.allow("key-2", 2, start.Add(30*time.Second))
+
+	if ok, _ := l.allow("key-1", 2, start.Add(time.Second)); ok {
+		t.Fatal("Expected key-1 to be over its limit")
+	}
+	if ok, _ := l.allow("key-2", 2, start.Add(time.Minute+time.Second)); !ok {
+		t.Fatal("Expected key-2 to be within its limit")
+	}
+	if _, ok := l.buckets["key-1"]; ok || len(l.buckets) != 1 {
+		t.Errorf("Expected key-1's idle bucket dropped, got %v", l.buckets)
+	}
+	if ok, _ := l.allow("key-1", 2, start.Add(time.Minute+2*time.Second)); !ok {
+		t.Error("Expected key-1 to start over with a full bucket")
+	}
+}
@@ -0,0 +1,326 @@
+package auth_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant/tenanttest"
+)
+
+var secret = []byte("test-secret-that-is-at-least-32-characters")
+
+func token(t *testing.T, claims auth.Claims, key []byte) string {
+	t.Helper()
+	signed, err := auth.SignToken(claims, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+func claimsFor(tenantID string) auth.Claims {
+	claims := auth.Claims{Subject: "user-1", ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	claims.AppMetadata.TenantID = tenantID
+	return claims
+}
+
+func TestParseToken(t *testing.T) {
+	now := time.Now()
+	claims, err := auth.ParseToken(token(t, claimsFor("agency-a"), secret), secret, now)
+	if err != nil || claims.Tenant() != "agency-a" || claims.Subject != "user-1" {
+		t.Fatalf("Expected agency-a's token to verify, got %+v, %v", claims, err)
+	}
+
+	hooked := claimsFor("agency-a")
+	hooked.TenantID = "agency-b"
+	if claims, _ := auth.ParseToken(token(t, hooked, secret), secret, now); claims.Tenant() != "agency-b" {
+		t.Errorf("Expected the top-level tenant_id claim to win, got %q", claims.Tenant())
+	}
+
+	expired := claimsFor("agency-a")
+	expired.ExpiresAt = now.Add(-time.Hour).Unix()
+	early := claimsFor("agency-a")
+	early.NotBefore = now.Add(time.Hour).Unix()
+	noExpiry := claimsFor("agency-a")
+	noExpiry.ExpiresAt = 0
+	valid := token(t, claimsFor("agency-a"), secret)
+	parts := strings.Split(valid, ".")
+	forged := token(t, claimsFor("agency-b"), secret)
+
+	cases := map[string]string{
+		"wrong secret":       token(t, claimsFor("agency-a"), []byte("another-secret-of-at-least-32-chars")),
+		"expired":            token(t, expired, secret),
+		"not valid yet":      token(t, early, secret),
+		"no expiry":          token(t, noExpiry, secret),
+		"swapped payload":    parts[0] + "." + strings.Split(forged, ".")[1] + "." + parts[2],
+		"unsigned":           "eyJhbGciOiJub25lIn0." + parts[1] + ".",
+		"not a JWT":          "not-a-token",
+		"malformed segments": "a.b.c",
+	}
+	for name, tok := range cases {
+		if _, err := auth.ParseToken(tok, secret, now); !errors.Is(err, auth.ErrInvalidToken) {
+			t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+		}
+	}
+}
+
+func serve(a *auth.Authenticator, req *http.Request) (*httptest.ResponseRecorder, context.Context) {
+	var seen context.Context
+	rec := httptest.NewRecorder()
+	a.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Context()
+	})).ServeHTTP(rec, req)
+	return rec, seen
+}
+
+func TestMiddleware(t *testing.T) {
+	store := tenanttest.NewStore(tenant.Tenant{ID: "agency-a", TimeZone: "UTC"}, tenant.Tenant{ID: "agency-b"})
+	a := auth.NewAuthenticator(string(secret), store, nil)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+	req.Header.Set("Authorization", "Bearer "+token(t, claimsFor("agency-a"), secret))
+	rec, ctx := serve(a, req)
+	if rec.Code != http.StatusOK || ctx == nil {
+		t.Fatalf("Expected a valid token to be served, got %d", rec.Code)
+	}
+	if got, _ := tenant.FromContext(ctx); got.ID != "agency-a" || got.TimeZone != "UTC" {
+		t.Errorf("Expected the request scoped to agency-a with its settings, got %+v", got)
+	}
+
+	cases := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"not a bearer token", "Basic dXNlcjpwYXNz", http.StatusUnauthorized},
+		{"invalid token", "Bearer not-a-token", http.StatusUnauthorized},
+		{"no tenant", "Bearer " + token(t, claimsFor(""), secret), http.StatusForbidden},
+		{"unknown tenant", "Bearer " + token(t, claimsFor("agency-x"), secret), http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+		if tc.header != "" {
+			req.Header.Set("Authorization", tc.header)
+		}
+		if rec, ctx := serve(a, req); rec.Code != tc.want || ctx != nil {
+			t.Errorf("%s: expected %d without reaching the handler, got %d", tc.name, tc.want, rec.Code)
+		}
+	}
+}
+
+func TestMiddlewareStreamToken(t *testing.T) {
+	a := auth.NewAuthenticator(string(secret), tenanttest.NewStore(tenant.Tenant{ID: "agency-a"}), nil)
+	tok := token(t, claimsFor("agency-a"), secret)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/stream/visits?access_token="+tok, nil)
+	req.Header.Set("Accept", "text/event-stream")
+	if rec, ctx := serve(a, req); rec.Code != http.StatusOK || tenant.ID(ctx) != "agency-a" {
+		t.Errorf("Expected the stream to take ?access_token=, got %d", rec.Code)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/schedules?access_token="+tok, nil)
+	if rec, _ := serve(a, req); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected ?access_token= to be ignored outside the stream, got %d", rec.Code)
+	}
+}
+
+func TestMiddlewareWithoutSecret(t *testing.T) {
+	a := auth.NewAuthenticator("", tenanttest.NewStore(), nil)
+	rec, ctx := serve(a, httptest.NewRequest(http.MethodGet, "/api/schedules", nil))
+	if rec.Code != http.StatusOK || tenant.ID(ctx) != tenant.DefaultID {
+		t.Errorf("Expected unauthenticated requests to act for the default tenant, got %d", rec.Code)
+	}
+}
+
+// supervisors assigns user IDs to branches, in every tenant.
+type supervisors map[string][]string
+
+func (s supervisors) SupervisedBranchIDs(ctx context.Context, userID string) ([]string, error) {
+	if tenant.ID(ctx) == "" {
+		return nil, errors.New("not scoped to a tenant")
+	}
+	return s[userID], nil
+}
+
+func TestMiddlewareSupervisor(t *testing.T) {
+	a := auth.NewAuthenticator(string(secret), tenanttest.NewStore(tenant.Tenant{ID: "agency-a"}),
+		supervisors{"user-1": {"branch-1", "branch-2"}})
+
+	serveAs := func(claims auth.Claims) context.Context {
+		req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+		req.Header.Set("Authorization", "Bearer "+token(t, claims, secret))
+		rec, ctx := serve(a, req)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("Expected %+v to be served, got %d", claims, rec.Code)
+		}
+		return ctx
+	}
+
+	supervisor := claimsFor("agency-a")
+	supervisor.AppMetadata.Role = branch.RoleSupervisor
+	ctx := serveAs(supervisor)
+	if !branch.Allows(ctx, "branch-2") || branch.Allows(ctx, "branch-3") || branch.Allows(ctx, "") {
+		t.Errorf("Expected the supervisor limited to branch-1 and branch-2, got %v", branch.Allowed(ctx))
+	}
+
+	unassigned := claimsFor("agency-a")
+	unassigned.Subject = "user-2"
+	unassigned.AppMetadata.Role = branch.RoleSupervisor
+	if ctx := serveAs(unassigned); !branch.Restricted(ctx) || len(branch.Allowed(ctx)) != 0 {
+		t.Errorf("Expected a supervisor without branches to see none, got %v", branch.Allowed(ctx))
+	}
+
+	if ctx := serveAs(claimsFor("agency-a")); branch.Restricted(ctx) {
+		t.Errorf("Expected other users to see every branch, got %v", branch.Allowed(ctx))
+	}
+}
+
+func TestMiddlewareRoles(t *testing.T) {
+	a := auth.NewAuthenticator(string(secret), tenanttest.NewStore(tenant.Tenant{ID: "agency-a"}), nil)
+	serveAs := func(role string) context.Context {
+		claims := claimsFor("agency-a")
+		claims.AppMetadata.Role = role
+		req := httptest.NewRequest(http.MethodGet, "/api/audit/access", nil)
+		req.Header.Set("Authorization", "Bearer "+token(t, claims, secret))
+		_, ctx := serve(a, req)
+		return ctx
+	}
+
+	if ctx := serveAs(auth.RoleAdmin); !auth.HasRole(ctx, auth.RoleAdmin) || auth.HasRole(ctx, auth.RolePrivacyOfficer) {
+		t.Error("Expected an admin token to carry only the admin role")
+	}
+	if ctx := serveAs(auth.RolePrivacyOfficer); !auth.HasRole(ctx, auth.RoleAdmin, auth.RolePrivacyOfficer) {
+		t.Error("Expected a privacy officer to match either role")
+	}
+	for _, role := range []string{"", "caregiver", branch.RoleSupervisor} {
+		if auth.HasRole(serveAs(role), auth.RoleAdmin, auth.RolePrivacyOfficer) {
+			t.Errorf("Expected a %q token to have neither role", role)
+		}
+	}
+
+	_, ctx := serve(auth.NewAuthenticator("", tenanttest.NewStore(), nil), httptest.NewRequest(http.MethodGet, "/api/audit/access", nil))
+	if !auth.HasRole(ctx, auth.RoleAdmin) {
+		t.Error("Expected every role when the API does not authenticate its callers")
+	}
+}
+
+// apiKeys is an APIKeys store holding keys by hash.
+type apiKeys struct {
+	byHash  map[string]models.APIKey
+	touched []string
+}
+
+func (k *apiKeys) APIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	key, ok := k.byHash[hash]
+	if !ok {
+		return nil, auth.ErrUnknownAPIKey
+	}
+	return &key, nil
+}
+
+func (k *apiKeys) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	k.touched = append(k.touched, id)
+	return nil
+}
+
+func (k *apiKeys) add(t *testing.T, key models.APIKey) string {
+	t.Helper()
+	secret, _, err := auth.GenerateAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	k.byHash[auth.HashAPIKey(secret)] = key
+	return secret
+}
+
+func TestMiddlewareAPIKey(t *testing.T) {
+	keys := &apiKeys{byHash: map[string]models.APIKey{}}
+	past, future := time.Now().Add(-time.Hour), time.Now().Add(time.Hour)
+	valid := keys.add(t, models.APIKey{ID: "key-1", TenantID: "agency-a", Scopes: []string{models.ScopeReadSchedules}, ExpiresAt: &future})
+	revoked := keys.add(t, models.APIKey{ID: "key-2", TenantID: "agency-a", RevokedAt: &past})
+	expired := keys.add(t, models.APIKey{ID: "key-3", TenantID: "agency-a", ExpiresAt: &past})
+	otherTenant := keys.add(t, models.APIKey{ID: "key-4", TenantID: "agency-x"})
+
+	for _, secret := range []string{string(secret), ""} {
+		a := auth.NewAuthenticator(secret, tenanttest.NewStore(tenant.Tenant{ID: "agency-a"}), nil, auth.WithAPIKeys(keys, 100))
+
+		serveKey := func(key string) (*httptest.ResponseRecorder, context.Context) {
+			req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+			req.Header.Set("Authorization", "Bearer "+key)
+			return serve(a, req)
+		}
+
+		rec, ctx := serveKey(valid)
+		if rec.Code != http.StatusOK || tenant.ID(ctx) != "agency-a" {
+			t.Fatalf("Expected a valid key to act for its tenant, got %d", rec.Code)
+		}
+		if key, ok := auth.APIKeyFromContext(ctx); !ok || key.ID != "key-1" {
+			t.Errorf("Expected the request to carry its key, got %+v", key)
+		}
+		if !auth.Allows(ctx, models.ScopeReadSchedules) || auth.Allows(ctx, models.ScopeWriteVisits) || auth.Allows(ctx) {
+			t.Error("Expected the key to be limited to its scopes")
+		}
+
+		cases := map[string]struct {
+			key  string
+			want int
+		}{
+			"unknown":        {auth.APIKeyPrefix + "0000", http.StatusUnauthorized},
+			"revoked":        {revoked, http.StatusUnauthorized},
+			"expired":        {expired, http.StatusUnauthorized},
+			"unknown tenant": {otherTenant, http.StatusForbidden},
+		}
+		for name, tc := range cases {
+			if rec, ctx := serveKey(tc.key); rec.Code != tc.want || ctx != nil {
+				t.Errorf("%s: expected %d without reaching the handler, got %d", name, tc.want, rec.Code)
+			}
+		}
+	}
+
+	touched := 0
+	for _, id := range keys.touched {
+		if id == "key-1" {
+			touched++
+		}
+	}
+	if touched != 2 {
+		t.Errorf("Expected each Authenticator to record key-1's use once, got %v", keys.touched)
+	}
+}
+
+func TestMiddlewareAPIKeyRateLimit(t *testing.T) {
+	keys := &apiKeys{byHash: map[string]models.APIKey{}}
+	limited := keys.add(t, models.APIKey{ID: "key-1", TenantID: "agency-a", RateLimitPerMinute: 2})
+	other := keys.add(t, models.APIKey{ID: "key-2", TenantID: "agency-a"})
+	a := auth.NewAuthenticator(string(secret), tenanttest.NewStore(tenant.Tenant{ID: "agency-a"}), nil, auth.WithAPIKeys(keys, 100))
+
+	serveKey := func(key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+		req.Header.Set("Authorization", "Bearer "+key)
+		rec, _ := serve(a, req)
+		return rec
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec := serveKey(limited); rec.Code != http.StatusOK {
+			t.Fatalf("Expected request %d to be within the limit, got %d", i+1, rec.Code)
+		}
+	}
+	rec := serveKey(limited)
+	if rec.Code != http.StatusTooManyRequests || rec.Header().Get("Retry-After") == "" {
+		t.Errorf("Expected 429 with Retry-After over the key's limit, got %d %q", rec.Code, rec.Header().Get("Retry-After"))
+	}
+	if rec := serveKey(other); rec.Code != http.StatusOK {
+		t.Errorf("Expected other keys to keep their own limit, got %d", rec.Code)
+	}
+}
@@ -0,0 +1,208 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// Authenticator resolves the tenant of each request, and the branches of
+// supervisors.
+type Authenticator struct {
+	secret   []byte
+	tenants  tenant.Store
+	branches branch.Assignments
+	now      func() time.Time
+
+	keys         APIKeys
+	keyRateLimit int
+	limiter      *rateLimiter
+	touchedMu    sync.Mutex
+	touched      map[string]time.Time
+}
+
+// Option configures an Authenticator.
+type Option func(*Authenticator)
+
+// WithAPIKeys also accepts the API keys of keys as bearer tokens, limiting
+// each to its own rate, or to ratePerMinute requests a minute if it has none.
+func WithAPIKeys(keys APIKeys, ratePerMinute int) Option {
+	return func(a *Authenticator) {
+		a.keys = keys
+		a.keyRateLimit = ratePerMinute
+	}
+}
+
+// NewAuthenticator returns an Authenticator that verifies tokens with secret,
+// looks their tenants up in tenants and their supervisors' branches up in
+// branches. With an empty secret, requests without an API key are not
+// authenticated and all act for tenant.DefaultID.
+func NewAuthenticator(secret string, tenants tenant.Store, branches branch.Assignments, opts ...Option) *Authenticator {
+	a := &Authenticator{
+		secret:   []byte(secret),
+		tenants:  tenants,
+		branches: branches,
+		now:      time.Now,
+		limiter:  newRateLimiter(),
+		touched:  map[string]time.Time{},
+	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
+}
+
+// Middleware scopes each request to its caller's tenant, limits supervisors
+// to their branches and records the caller as the actor of the PHI it reads.
+// Callers present either a user's JWT or an API key. A request without a
+// valid token gets 401, one whose tenant does not exist gets 403, and one
+// over its key's rate limit gets 429.
+func (a *Authenticator) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		tenantID := tenant.DefaultID
+		var claims Claims
+		authenticated := len(a.secret) > 0
+		if token := bearerToken(r); a.keys != nil && IsAPIKey(token) {
+			key, status := a.authenticateKey(ctx, token)
+			switch status {
+			case http.StatusUnauthorized:
+				unauthorized(w, "invalid API key")
+				return
+			case http.StatusServiceUnavailable:
+				http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+				return
+			}
+			if ok, retryAfter := a.limiter.allow(key.ID, a.rateLimit(*key), a.now()); !ok {
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+				http.Error(w, "API key rate limit exceeded", http.StatusTooManyRequests)
+				return
+			}
+			authenticated = true
+			tenantID = key.TenantID
+			ctx = audit.WithActor(WithAPIKey(ctx, *key), "api_key:"+key.ID)
+		} else if len(a.secret) > 0 {
+			if token == "" {
+				unauthorized(w, "missing bearer token")
+				return
+			}
+			var err error
+			if claims, err = ParseToken(token, a.secret, a.now()); err != nil {
+				unauthorized(w, "invalid bearer token")
+				return
+			}
+			if tenantID = claims.Tenant(); tenantID == "" {
+				http.Error(w, "token has no tenant", http.StatusForbidden)
+				return
+			}
+			ctx = WithRole(ctx, claims.AppMetadata.Role)
+			if claims.Subject != "" {
+				ctx = audit.WithActor(ctx, "user:"+claims.Subject)
+			}
+		}
+
+		t, err := a.tenants.GetTenant(ctx, tenantID)
+		switch {
+		case errors.Is(err, tenant.ErrUnknown):
+			http.Error(w, "unknown tenant", http.StatusForbidden)
+			return
+		case err != nil && !authenticated:
+			// A single agency has no one to be confused with; serve it with the
+			// API's own settings and let the request fail on its own queries
+			// if Supabase is really down.
+			slog.WarnContext(ctx, "Failed to read the default tenant's settings, using the API's", "error", err)
+			t = &tenant.Tenant{ID: tenant.DefaultID}
+		case err != nil:
+			slog.ErrorContext(ctx, "request failed", "error", err)
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+		ctx = tenant.WithTenant(ctx, *t)
+
+		if claims.AppMetadata.Role == branch.RoleSupervisor {
+			var ids []string
+			if a.branches != nil && claims.Subject != "" {
+				if ids, err = a.branches.SupervisedBranchIDs(ctx, claims.Subject); err != nil {
+					slog.ErrorContext(ctx, "request failed", "error", err)
+					http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+					return
+				}
+			}
+			ctx = branch.Restrict(ctx, ids)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authenticateKey returns the active API key token stands for, or the status
+// to refuse the request with.
+func (a *Authenticator) authenticateKey(ctx context.Context, token string) (*models.APIKey, int) {
+	key, err := a.keys.APIKeyByHash(ctx, HashAPIKey(token))
+	switch {
+	case errors.Is(err, ErrUnknownAPIKey):
+		return nil, http.StatusUnauthorized
+	case err != nil:
+		slog.ErrorContext(ctx, "request failed", "error", err)
+		return nil, http.StatusServiceUnavailable
+	}
+	now := a.now()
+	if !key.Active(now) {
+		return nil, http.StatusUnauthorized
+	}
+
+	// Record the use at most once a touchInterval per key, rather than
+	// writing on every request. Uses older than that are as good as none, so
+	// they are dropped whenever a use is recorded.
+	a.touchedMu.Lock()
+	due := now.Sub(a.touched[key.ID]) >= touchInterval
+	if due {
+		for id, touched := range a.touched {
+			if now.Sub(touched) >= touchInterval {
+				delete(a.touched, id)
+			}
+		}
+		a.touched[key.ID] = now
+	}
+	a.touchedMu.Unlock()
+	if due {
+		if err := a.keys.TouchAPIKey(ctx, key.ID, now); err != nil {
+			slog.WarnContext(ctx, "Failed to record the API key's last use", "key_id", key.ID, "error", err)
+		}
+	}
+	return key, http.StatusOK
+}
+
+func (a *Authenticator) rateLimit(key models.APIKey) int {
+	if key.RateLimitPerMinute > 0 {
+		return key.RateLimitPerMinute
+	}
+	return a.keyRateLimit
+}
+
+// bearerToken returns the token of r's Authorization header. EventSource
+// cannot set headers, so the visit stream also takes ?access_token=.
+func bearerToken(r *http.Request) string {
+	if scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " "); ok && strings.EqualFold(scheme, "Bearer") {
+		return strings.TrimSpace(token)
+	}
+	if strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+		return r.URL.Query().Get("access_token")
+	}
+	return ""
+}
+
+func unauthorized(w http.ResponseWriter, message string) {
+	w.Header().Set("WWW-Authenticate", `Bearer realm="api"`)
+	http.Error(w, message, http.StatusUnauthorized)
+}
@@ -0,0 +1,148 @@
+// Package auth authenticates the callers of the API and scopes each request to
+// the tenant the caller belongs to. Callers present a Supabase access token,
+// an HS256 JWT signed with the project's JWT secret.
+package auth
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidToken is returned for a token that is malformed, not signed with
+// the secret, or outside its validity period.
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// clockSkew is how far the issuer's clock may be ahead of or behind ours.
+const clockSkew = 30 * time.Second
+
+// Claims are the claims of an access token the API reads.
+type Claims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf,omitempty"`
+	// TenantID is set by a custom access token hook. Tokens issued without one
+	// carry the tenant in AppMetadata, which only the service role can change.
+	TenantID    string `json:"tenant_id,omitempty"`
+	AppMetadata struct {
+		TenantID string `json:"tenant_id,omitempty"`
+		// Role is the caller's role in its agency, such as
+		// branch.RoleSupervisor. The top-level role claim is Supabase's
+		// database role.
+		Role string `json:"role,omitempty"`
+	} `json:"app_metadata"`
+}
+
+// Roles of users in their agency, besides branch.RoleSupervisor, carried in
+// the app_metadata.role claim.
+const (
+	RoleAdmin          = "admin"
+	RolePrivacyOfficer = "privacy_officer"
+)
+
+type roleContextKey struct{}
+
+// WithRole marks the requests served with ctx as made by a user with role,
+// which may be "".
+func WithRole(ctx context.Context, role string) context.Context {
+	return context.WithValue(ctx, roleContextKey{}, role)
+}
+
+// HasRole reports whether the caller of ctx is a user with one of roles. API
+// keys have no role. When the API does not authenticate its callers, no role
+// is known and every caller has them all.
+func HasRole(ctx context.Context, roles ...string) bool {
+	if _, ok := APIKeyFromContext(ctx); ok {
+		return false
+	}
+	role, ok := ctx.Value(roleContextKey{}).(string)
+	if !ok {
+		return true
+	}
+	for _, candidate := range roles {
+		if role != "" && role == candidate {
+			return true
+		}
+	}
+	return false
+}
+
+// Tenant returns the tenant the token was issued for, or "".
+func (c Claims) Tenant() string {
+	if c.TenantID != "" {
+		return c.TenantID
+	}
+	return c.AppMetadata.TenantID
+}
+
+// ParseToken verifies token's HS256 signature with secret and its expiry at
+// now, and returns its claims. Tokens without an expiry are refused.
+func ParseToken(token string, secret []byte, now time.Time) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: not a JWT", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, err
+	}
+	if header.Alg != "HS256" {
+		return Claims{}, fmt.Errorf("%w: unsupported algorithm %q", ErrInvalidToken, header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: malformed signature", ErrInvalidToken)
+	}
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return Claims{}, fmt.Errorf("%w: bad signature", ErrInvalidToken)
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return Claims{}, err
+	}
+	if claims.ExpiresAt == 0 || now.After(time.Unix(claims.ExpiresAt, 0).Add(clockSkew)) {
+		return Claims{}, fmt.Errorf("%w: expired", ErrInvalidToken)
+	}
+	if claims.NotBefore != 0 && now.Add(clockSkew).Before(time.Unix(claims.NotBefore, 0)) {
+		return Claims{}, fmt.Errorf("%w: not valid yet", ErrInvalidToken)
+	}
+	return claims, nil
+}
+
+// SignToken returns an HS256 JWT of claims signed with secret. The API only
+// verifies tokens; this is for tests and local tools.
+func SignToken(claims Claims, secret []byte) (string, error) {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signed := header + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(signed))
+	return signed + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: malformed segment", ErrInvalidToken)
+	}
+	return nil
+}
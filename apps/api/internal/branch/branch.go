@@ -0,0 +1,109 @@
+// Package branch limits callers to the branch offices they are assigned to.
+// Within a tenant, each client belongs to at most one branch, and its visits
+// belong to that branch. Supervisors are restricted to the branches they
+// supervise; other callers see every branch of their tenant.
+package branch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// RoleSupervisor is the role claim of callers limited to their branches.
+const RoleSupervisor = "supervisor"
+
+// ErrForbidden is returned when a caller asks for a branch it may not see.
+var ErrForbidden = errors.New("branch: not assigned to the branch")
+
+// Assignments looks up which branches a supervisor is assigned to, within the
+// tenant of ctx.
+type Assignments interface {
+	SupervisedBranchIDs(ctx context.Context, userID string) ([]string, error)
+}
+
+// Clients looks up which branch a client belongs to, within the tenant of ctx.
+// Clients without a branch have "".
+type Clients interface {
+	ClientBranchID(ctx context.Context, clientID string) (string, error)
+}
+
+type contextKey struct{}
+
+// Restrict limits the requests served with ctx to the branches ids. With no
+// ids, they see no branch at all.
+func Restrict(ctx context.Context, ids []string) context.Context {
+	if ids == nil {
+		ids = []string{}
+	}
+	return context.WithValue(ctx, contextKey{}, ids)
+}
+
+// Allowed returns the branches ctx is limited to, or nil if it is not limited.
+func Allowed(ctx context.Context) []string {
+	ids, _ := ctx.Value(contextKey{}).([]string)
+	return ids
+}
+
+// Restricted reports whether ctx is limited to some branches.
+func Restricted(ctx context.Context) bool {
+	return Allowed(ctx) != nil
+}
+
+// Allows reports whether ctx may see data of branch id. Visits of clients
+// without a branch are only seen by unrestricted callers.
+func Allows(ctx context.Context, id string) bool {
+	allowed := Allowed(ctx)
+	if allowed == nil {
+		return true
+	}
+	return contains(allowed, id)
+}
+
+// AllowsClient reports whether ctx may see data of clientID, looking its
+// branch up in clients only if ctx is restricted. A restricted ctx sees no
+// client when clients is nil.
+func AllowsClient(ctx context.Context, clients Clients, clientID string) (bool, error) {
+	if !Restricted(ctx) {
+		return true, nil
+	}
+	if clients == nil {
+		return false, nil
+	}
+	id, err := clients.ClientBranchID(ctx, clientID)
+	if err != nil {
+		return false, err
+	}
+	return Allows(ctx, id), nil
+}
+
+// Narrow returns the branches a query of ctx for requested may read: the
+// requested ones, or all allowed ones if none were requested. Nil means every
+// branch, and an empty list none. Requesting a branch that ctx may not see
+// returns an error wrapping ErrForbidden.
+func Narrow(ctx context.Context, requested []string) ([]string, error) {
+	allowed := Allowed(ctx)
+	if len(requested) == 0 {
+		return allowed, nil
+	}
+	if allowed != nil {
+		for _, id := range requested {
+			if !contains(allowed, id) {
+				return nil, fmt.Errorf("%w: %s", ErrForbidden, id)
+			}
+		}
+	}
+	return requested, nil
+}
+
+func contains(ids []string, id string) bool {
+	if id == "" {
+		return false
+	}
+	for _, candidate := range ids {
+		if candidate == id {
+			return true
+		}
+	}
+	return false
+}
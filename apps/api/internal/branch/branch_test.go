@@ -0,0 +1,90 @@
+package branch_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+)
+
+func TestUnrestricted(t *testing.T) {
+	ctx := context.Background()
+	if branch.Restricted(ctx) {
+		t.Error("Expected a plain context to be unrestricted")
+	}
+	if !branch.Allows(ctx, "b1") || !branch.Allows(ctx, "") {
+		t.Error("Expected an unrestricted context to allow every branch, and visits without one")
+	}
+
+	got, err := branch.Narrow(ctx, nil)
+	if err != nil || got != nil {
+		t.Errorf("Expected no branch filter, got %v, %v", got, err)
+	}
+	got, err = branch.Narrow(ctx, []string{"b1"})
+	if err != nil || !reflect.DeepEqual(got, []string{"b1"}) {
+		t.Errorf("Expected the requested branch, got %v, %v", got, err)
+	}
+}
+
+func TestRestricted(t *testing.T) {
+	ctx := branch.Restrict(context.Background(), []string{"b1", "b2"})
+	if !branch.Restricted(ctx) {
+		t.Fatal("Expected the context to be restricted")
+	}
+	if !branch.Allows(ctx, "b2") || branch.Allows(ctx, "b3") || branch.Allows(ctx, "") {
+		t.Error("Expected only the assigned branches to be allowed")
+	}
+
+	got, err := branch.Narrow(ctx, nil)
+	if err != nil || !reflect.DeepEqual(got, []string{"b1", "b2"}) {
+		t.Errorf("Expected the assigned branches, got %v, %v", got, err)
+	}
+	got, err = branch.Narrow(ctx, []string{"b2"})
+	if err != nil || !reflect.DeepEqual(got, []string{"b2"}) {
+		t.Errorf("Expected the requested branch, got %v, %v", got, err)
+	}
+	if _, err := branch.Narrow(ctx, []string{"b2", "b3"}); !errors.Is(err, branch.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for an unassigned branch, got %v", err)
+	}
+}
+
+func TestRestrictedToNone(t *testing.T) {
+	ctx := branch.Restrict(context.Background(), nil)
+	if !branch.Restricted(ctx) || branch.Allows(ctx, "b1") {
+		t.Error("Expected a supervisor without branches to see none")
+	}
+	got, err := branch.Narrow(ctx, nil)
+	if err != nil || got == nil || len(got) != 0 {
+		t.Errorf("Expected an empty, non-nil filter, got %#v, %v", got, err)
+	}
+}
+
+// clientBranches assigns client IDs to branches and counts the lookups.
+type clientBranches struct {
+	branches map[string]string
+	lookups  int
+}
+
+func (c *clientBranches) ClientBranchID(ctx context.Context, clientID string) (string, error) {
+	c.lookups++
+	return c.branches[clientID], nil
+}
+
+func TestAllowsClient(t *testing.T) {
+	clients := &clientBranches{branches: map[string]string{"client-1": "b1", "client-2": "b2"}}
+	if ok, err := branch.AllowsClient(context.Background(), clients, "client-2"); !ok || err != nil || clients.lookups != 0 {
+		t.Errorf("Expected an unrestricted context to see every client without a lookup, got %v, %v after %d lookups", ok, err, clients.lookups)
+	}
+
+	ctx := branch.Restrict(context.Background(), []string{"b1"})
+	for clientID, want := range map[string]bool{"client-1": true, "client-2": false, "client-3": false} {
+		if ok, err := branch.AllowsClient(ctx, clients, clientID); ok != want || err != nil {
+			t.Errorf("Expected %s allowed to be %v, got %v, %v", clientID, want, ok, err)
+		}
+	}
+	if ok, _ := branch.AllowsClient(ctx, nil, "client-1"); ok {
+		t.Error("Expected no client allowed without a lookup")
+	}
+}
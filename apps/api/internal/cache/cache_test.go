@@ -0,0 +1,479 @@
+package cache_test
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/cache"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+func TestLRU(t *testing.T) {
+	lru := cache.NewLRU(2)
+	lru.Set("a", []byte("1"), time.Minute)
+	lru.Set("b", []byte("2"), time.Minute)
+	lru.Get("a")
+	lru.Set("c", []byte("3"), time.Minute)
+
+	if _, ok := lru.Get("b"); ok {
+		t.Error("Expected the least recently used entry to be evicted")
+	}
+	if v, ok := lru.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("Expected a to be kept, got %q", v)
+	}
+
+	lru.Delete("a")
+	if _, ok := lru.Get("a"); ok {
+		t.Error("Expected a to be deleted")
+	}
+
+	lru.Set("short", []byte("x"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := lru.Get("short"); ok {
+		t.Error("Expected an expired entry to be gone")
+	}
+
+	lru.Clear()
+	if lru.Len() != 0 {
+		t.Errorf("Expected Clear to empty the store, %d entries left", lru.Len())
+	}
+}
+
+// fakeRepository keeps schedules in memory and counts the reads that reach it.
+type fakeRepository struct {
+	repository.ScheduleRepository
+
+	mu        sync.Mutex
+	schedules map[string]models.Schedule
+	reads     map[string]int
+	// block, if set, holds GetScheduleByID after it has read its result.
+	block chan struct{}
+}
+
+func newFakeRepository() *fakeRepository {
+	today := time.Now().Format("2006-01-02")
+	return &fakeRepository{
+		schedules: map[string]models.Schedule{
+			"s1": {ID: "s1", ShiftDate: today, Status: "scheduled", Tasks: []models.Task{{ID: "t1", ScheduleID: "s1", Description: "Bathing"}}},
+			"s2": {ID: "s2", ShiftDate: today, Status: "scheduled", Tasks: []models.Task{{ID: "t2", ScheduleID: "s2", Description: "Meals"}}},
+		},
+		reads: map[string]int{},
+	}
+}
+
+func (f *fakeRepository) read(name string) {
+	f.reads[name]++
+}
+
+func (f *fakeRepository) readCount(name string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.reads[name]
+}
+
+func (f *fakeRepository) list() []models.Schedule {
+	schedules := make([]models.Schedule, 0, len(f.schedules))
+	for _, s := range f.schedules {
+		schedules = append(schedules, s)
+	}
+	sort.Slice(schedules, func(i, j int) bool { return schedules[i].ID < schedules[j].ID })
+	return schedules
+}
+
+func (f *fakeRepository) GetSchedules(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.read("GetSchedules")
+	return f.list(), nil
+}
+
+func (f *fakeRepository) GetTodaySchedules(ctx context.Context) ([]models.Schedule, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.read("GetTodaySchedules")
+	return f.list(), nil
+}
+
+func (f *fakeRepository) GetScheduleByID(ctx context.Context, id string) (*models.Schedule, error) {
+	f.mu.Lock()
+	f.read("GetScheduleByID")
+	schedule, ok := f.schedules[id]
+	block := f.block
+	f.mu.Unlock()
+
+	if block != nil {
+		<-block
+	}
+	if !ok {
+		return nil, fmt.Errorf("schedule with ID %s %w", id, repository.ErrNotFound)
+	}
+	return &schedule, nil
+}
+
+func (f *fakeRepository) GetTaskByID(ctx context.Context, taskID string) (*models.Task, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.read("GetTaskByID")
+	for _, s := range f.schedules {
+		for _, task := range s.Tasks {
+			if task.ID == taskID {
+				return &task, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("task with ID %s %w", taskID, repository.ErrNotFound)
+}
+
+func (f *fakeRepository) GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.read("GetScheduleStats")
+	var stats models.ScheduleStats
+	for _, s := range f.schedules {
+		stats.TotalSchedules++
+		switch s.Status {
+		case "in_progress":
+			stats.InProgressSchedules++
+		case "completed":
+			stats.CompletedSchedules++
+		}
+	}
+	return &stats, nil
+}
+
+func (f *fakeRepository) update(id string, change func(*models.Schedule)) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	s := f.schedules[id]
+	s.Tasks = append([]models.Task(nil), s.Tasks...)
+	change(&s)
+	f.schedules[id] = s
+}
+
+func (f *fakeRepository) CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+	f.update(schedule.ID, func(s *models.Schedule) { *s = schedule })
+	return &schedule, nil
+}
+
+func (f *fakeRepository) ReplacePlannedTasks(ctx context.Context, scheduleID string, tasks []models.Task) error {
+	f.update(scheduleID, func(s *models.Schedule) { s.Tasks = tasks })
+	return nil
+}
+
+func (f *fakeRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+	f.update(id, func(s *models.Schedule) { s.Status = "in_progress" })
+	return nil
+}
+
+func (f *fakeRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error {
+	f.update(id, func(s *models.Schedule) { s.Status = "completed" })
+	return nil
+}
+
+func (f *fakeRepository) UpdateTaskStatuses(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error {
+	for _, task := range tasks {
+		f.update(task.ScheduleID, func(s *models.Schedule) {
+			for i := range s.Tasks {
+				if s.Tasks[i].ID == task.ID {
+					s.Tasks[i] = task
+				}
+			}
+		})
+	}
+	return nil
+}
+
+func (f *fakeRepository) AddTask(ctx context.Context, task models.Task, event events.Event) (*models.Task, error) {
+	f.update(task.ScheduleID, func(s *models.Schedule) { s.Tasks = append(s.Tasks, task) })
+	return &task, nil
+}
+
+func (f *fakeRepository) RecordMissedVisit(ctx context.Context, id string, event events.Event) (bool, error) {
+	return true, nil
+}
+
+func (f *fakeRepository) ResetSampleData(ctx context.Context) error {
+	for id := range f.schedules {
+		f.update(id, func(s *models.Schedule) {
+			s.Status = "scheduled"
+			for i := range s.Tasks {
+				s.Tasks[i].Completed = false
+			}
+		})
+	}
+	return nil
+}
+
+// reads returns every cached read for schedule s1 and task t1.
+func reads(t *testing.T, repo repository.ScheduleRepository) map[string]interface{} {
+	t.Helper()
+	ctx := context.Background()
+	results := map[string]interface{}{}
+	var err error
+	if results["GetSchedules"], err = repo.GetSchedules(ctx, models.ScheduleListQuery{Limit: 50}); err != nil {
+		t.Fatal(err)
+	}
+	if results["GetTodaySchedules"], err = repo.GetTodaySchedules(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if results["GetScheduleByID"], err = repo.GetScheduleByID(ctx, "s1"); err != nil {
+		t.Fatal(err)
+	}
+	if results["GetScheduleStats"], err = repo.GetScheduleStats(ctx, models.StatsQuery{}); err != nil {
+		t.Fatal(err)
+	}
+	task, err := repo.GetTaskByID(ctx, "t1")
+	if err != nil {
+		task = nil // ReplacePlannedTasks may remove it.
+	}
+	results["GetTaskByID"] = task
+	return results
+}
+
+func TestReadAfterWriteIsFresh(t *testing.T) {
+	completed := models.Task{ID: "t1", ScheduleID: "s1", Description: "Bathing", Completed: true}
+	writes := map[string]func(context.Context, repository.ScheduleRepository) error{
+		"StartVisit": func(ctx context.Context, repo repository.ScheduleRepository) error {
+			return repo.StartVisit(ctx, "s1", time.Now(), models.Location{}, events.Event{})
+		},
+		"EndVisit": func(ctx context.Context, repo repository.ScheduleRepository) error {
+			return repo.EndVisit(ctx, "s1", time.Now(), models.Location{}, events.Event{})
+		},
+		"UpdateTaskStatuses": func(ctx context.Context, repo repository.ScheduleRepository) error {
+			return repo.UpdateTaskStatuses(ctx, []models.Task{completed}, nil)
+		},
+		"AddTask": func(ctx context.Context, repo repository.ScheduleRepository) error {
+			_, err := repo.AddTask(ctx, models.Task{ID: "t3", ScheduleID: "s1", AdHoc: true}, events.Event{})
+			return err
+		},
+		"ReplacePlannedTasks": func(ctx context.Context, repo repository.ScheduleRepository) error {
+			return repo.ReplacePlannedTasks(ctx, "s1", []models.Task{{ID: "t4", ScheduleID: "s1"}})
+		},
+		"CreateSchedule": func(ctx context.Context, repo repository.ScheduleRepository) error {
+			_, err := repo.CreateSchedule(ctx, models.Schedule{ID: "s3", Status: "scheduled"})
+			return err
+		},
+		"ResetSampleData": func(ctx context.Context, repo repository.ScheduleRepository) error {
+			if err := repo.EndVisit(ctx, "s1", time.Now(), models.Location{}, events.Event{}); err != nil {
+				return err
+			}
+			if err := repo.UpdateTaskStatuses(ctx, []models.Task{completed}, nil); err != nil {
+				return err
+			}
+			reads(t, repo) // Cache the completed state before resetting it.
+			return repo.ResetSampleData(ctx)
+		},
+	}
+
+	for name, write := range writes {
+		fake := newFakeRepository()
+		repo := cache.WrapScheduleRepository(fake, cache.NewLRU(100), time.Minute)
+
+		reads(t, repo)
+		reads(t, repo)
+		for method, count := range fake.reads {
+			if count != 1 {
+				t.Errorf("%s: expected the second %s to be served from the cache, it reached the repository %d times", name, method, count)
+			}
+		}
+
+		if err := write(context.Background(), repo); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if got, want := reads(t, repo), reads(t, fake); !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: expected reads after the write to be fresh\ngot  %+v\nwant %+v", name, got, want)
+		}
+	}
+}
+
+func TestWriteInvalidatesPrecisely(t *testing.T) {
+	fake := newFakeRepository()
+	repo := cache.WrapScheduleRepository(fake, cache.NewLRU(100), time.Minute)
+	ctx := context.Background()
+
+	repo.GetScheduleByID(ctx, "s1")
+	repo.GetScheduleByID(ctx, "s2")
+	if err := repo.StartVisit(ctx, "s1", time.Now(), models.Location{}, events.Event{}); err != nil {
+		t.Fatal(err)
+	}
+	repo.GetScheduleByID(ctx, "s1")
+	repo.GetScheduleByID(ctx, "s2")
+
+	if got := fake.readCount("GetScheduleByID"); got != 3 {
+		t.Errorf("Expected only s1 to be reloaded after starting its visit, got %d repository reads", got)
+	}
+}
+
+func TestTenantsDoNotShareEntries(t *testing.T) {
+	fake := newFakeRepository()
+	repo := cache.WrapScheduleRepository(fake, cache.NewLRU(100), time.Minute)
+	agencyA := tenant.WithID(context.Background(), "agency-a")
+	agencyB := tenant.WithID(context.Background(), "agency-b")
+
+	repo.GetScheduleByID(agencyA, "s1")
+	repo.GetScheduleByID(agencyB, "s1")
+	if got := fake.readCount("GetScheduleByID"); got != 2 {
+		t.Errorf("Expected agency-b's read not to be served from agency-a's entry, got %d repository reads", got)
+	}
+
+	if err := repo.StartVisit(agencyB, "s1", time.Now(), models.Location{}, events.Event{}); err != nil {
+		t.Fatal(err)
+	}
+	repo.GetScheduleByID(agencyA, "s1")
+	if got := fake.readCount("GetScheduleByID"); got != 2 {
+		t.Errorf("Expected agency-b's write to leave agency-a's entry alone, got %d repository reads", got)
+	}
+}
+
+// TestReadRacingAWriteIsNotCached checks that a value read before a write
+// finished is not stored once the write has invalidated it.
+func TestReadRacingAWriteIsNotCached(t *testing.T) {
+	fake := newFakeRepository()
+	repo := cache.WrapScheduleRepository(fake, cache.NewLRU(100), time.Minute)
+	ctx := context.Background()
+
+	fake.block = make(chan struct{})
+	stale := make(chan *models.Schedule)
+	go func() {
+		s, _ := repo.GetScheduleByID(ctx, "s1")
+		stale <- s
+	}()
+	for fake.readCount("GetScheduleByID") == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	if err := repo.StartVisit(ctx, "s1", time.Now(), models.Location{}, events.Event{}); err != nil {
+		t.Fatal(err)
+	}
+	close(fake.block)
+	if s := <-stale; s.Status != "scheduled" {
+		t.Fatalf("Expected the racing read to see the old status, got %s", s.Status)
+	}
+
+	fake.mu.Lock()
+	fake.block = nil
+	fake.mu.Unlock()
+	s, err := repo.GetScheduleByID(ctx, "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Status != "in_progress" {
+		t.Errorf("Expected the read after the write to be fresh, got %s", s.Status)
+	}
+}
+
+func TestCachedValuesAreNotShared(t *testing.T) {
+	repo := cache.WrapScheduleRepository(newFakeRepository(), cache.NewLRU(100), time.Minute)
+	ctx := context.Background()
+
+	s, _ := repo.GetScheduleByID(ctx, "s1")
+	s.Status = "changed by caller"
+	s.Tasks[0].Completed = true
+
+	if again, _ := repo.GetScheduleByID(ctx, "s1"); again.Status != "scheduled" || again.Tasks[0].Completed {
+		t.Errorf("Expected the cached schedule to be unaffected by callers, got %+v", again)
+	}
+}
+
+// changeBehindTheCache updates a schedule the way another process would.
+func (f *fakeRepository) changeBehindTheCache(id, status string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	schedule := f.schedules[id]
+	schedule.Status = status
+	f.schedules[id] = schedule
+}
+
+func TestFreshReadsSkipTheCache(t *testing.T) {
+	fake := newFakeRepository()
+	repo := cache.WrapScheduleRepository(fake, cache.NewLRU(100), time.Minute)
+	ctx := context.Background()
+
+	repo.GetScheduleByID(ctx, "s1")
+	fake.changeBehindTheCache("s1", "cancelled")
+
+	fresh, err := repo.GetScheduleByID(repository.WithFreshReads(ctx), "s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fresh.Status != "cancelled" {
+		t.Errorf("Expected a fresh read to see the current schedule, got status %s", fresh.Status)
+	}
+	if cached, _ := repo.GetScheduleByID(ctx, "s1"); cached.Status != "cancelled" {
+		t.Errorf("Expected the fresh read to refresh the entry, got status %s", cached.Status)
+	}
+}
+
+type retentionRepository struct {
+	repository.RetentionRepository
+}
+
+func (retentionRepository) Purge(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, limit int, dryRun bool) (int, error) {
+	return 1, nil
+}
+
+type branchRepository struct {
+	repository.BranchRepository
+}
+
+func (branchRepository) AssignMember(ctx context.Context, branchID, kind, memberID string) error {
+	return nil
+}
+
+func (branchRepository) UnassignMember(ctx context.Context, branchID, kind, memberID string) error {
+	return nil
+}
+
+func TestPurgesAndClientMovesInvalidate(t *testing.T) {
+	writes := []struct {
+		name       string
+		write      func(ctx context.Context, schedules cache.ScheduleRepository) error
+		invalidate bool
+	}{
+		{"Purge", func(ctx context.Context, schedules cache.ScheduleRepository) error {
+			_, err := cache.InvalidateOnPurge(retentionRepository{}, schedules).Purge(ctx, models.RetentionPolicy{}, time.Now(), 10, false)
+			return err
+		}, true},
+		{"Purge dry run", func(ctx context.Context, schedules cache.ScheduleRepository) error {
+			_, err := cache.InvalidateOnPurge(retentionRepository{}, schedules).Purge(ctx, models.RetentionPolicy{}, time.Now(), 10, true)
+			return err
+		}, false},
+		{"AssignMember client", func(ctx context.Context, schedules cache.ScheduleRepository) error {
+			return cache.InvalidateOnClientMove(branchRepository{}, schedules).AssignMember(ctx, "b1", models.BranchClients, "client-001")
+		}, true},
+		{"UnassignMember client", func(ctx context.Context, schedules cache.ScheduleRepository) error {
+			return cache.InvalidateOnClientMove(branchRepository{}, schedules).UnassignMember(ctx, "b1", models.BranchClients, "client-001")
+		}, true},
+		{"AssignMember caregiver", func(ctx context.Context, schedules cache.ScheduleRepository) error {
+			return cache.InvalidateOnClientMove(branchRepository{}, schedules).AssignMember(ctx, "b1", models.BranchCaregivers, "caregiver-001")
+		}, false},
+	}
+
+	for _, tc := range writes {
+		fake := newFakeRepository()
+		repo := cache.WrapScheduleRepository(fake, cache.NewLRU(100), time.Minute)
+		ctx := context.Background()
+
+		repo.GetScheduleByID(ctx, "s1")
+		repo.GetSchedules(ctx, models.ScheduleListQuery{})
+		fake.changeBehindTheCache("s1", "cancelled")
+		if err := tc.write(ctx, repo); err != nil {
+			t.Fatalf("%s: %v", tc.name, err)
+		}
+
+		schedule, _ := repo.GetScheduleByID(ctx, "s1")
+		list, _ := repo.GetSchedules(ctx, models.ScheduleListQuery{})
+		invalidated := schedule.Status == "cancelled" && list[0].Status == "cancelled"
+		if invalidated != tc.invalidate {
+			t.Errorf("%s: expected invalidation %t, got schedule %s and list %s", tc.name, tc.invalidate, schedule.Status, list[0].Status)
+		}
+	}
+}
@@ -0,0 +1,55 @@
+package cache
+
+import (
+	"context"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+// retentionRepository retires the cached schedule reads after every purge,
+// which deletes or anonymizes schedules and tasks in the database.
+type retentionRepository struct {
+	repository.RetentionRepository
+	schedules ScheduleRepository
+}
+
+// InvalidateOnPurge makes the purges of next invalidate the schedule cache.
+func InvalidateOnPurge(next repository.RetentionRepository, schedules ScheduleRepository) repository.RetentionRepository {
+	return &retentionRepository{RetentionRepository: next, schedules: schedules}
+}
+
+func (r *retentionRepository) Purge(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, limit int, dryRun bool) (int, error) {
+	if !dryRun {
+		defer r.schedules.InvalidateAll(ctx)
+	}
+	return r.RetentionRepository.Purge(ctx, policy, cutoff, limit, dryRun)
+}
+
+// branchRepository retires the cached schedule reads whenever a client
+// changes branch, which the database copies onto the client's schedules.
+type branchRepository struct {
+	repository.BranchRepository
+	schedules ScheduleRepository
+}
+
+// InvalidateOnClientMove makes the client assignments of next invalidate the
+// schedule cache.
+func InvalidateOnClientMove(next repository.BranchRepository, schedules ScheduleRepository) repository.BranchRepository {
+	return &branchRepository{BranchRepository: next, schedules: schedules}
+}
+
+func (r *branchRepository) AssignMember(ctx context.Context, branchID, kind, memberID string) error {
+	if kind == models.BranchClients {
+		defer r.schedules.InvalidateAll(ctx)
+	}
+	return r.BranchRepository.AssignMember(ctx, branchID, kind, memberID)
+}
+
+func (r *branchRepository) UnassignMember(ctx context.Context, branchID, kind, memberID string) error {
+	if kind == models.BranchClients {
+		defer r.schedules.InvalidateAll(ctx)
+	}
+	return r.BranchRepository.UnassignMember(ctx, branchID, kind, memberID)
+}
@@ -0,0 +1,260 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// generation counts the invalidations a cache has seen. Listings, today's
+// schedules and stats depend on every schedule, so a write retires all of them
+// at once by bumping lists, which is part of their keys; tasks does the same
+// for task lookups when tasks are deleted.
+type generation struct {
+	writes uint64
+	lists  uint64
+	tasks  uint64
+}
+
+type scheduleRepository struct {
+	next  repository.ScheduleRepository
+	store Store
+	ttl   time.Duration
+
+	// mu orders filling the cache against invalidating it, so that a value
+	// read before a write finished is never stored after the write has
+	// invalidated it.
+	mu  sync.RWMutex
+	gen generation
+}
+
+// ScheduleRepository is a cached schedule repository.
+type ScheduleRepository interface {
+	repository.ScheduleRepository
+	// InvalidateAll retires every cached read, after a write that changed
+	// schedules or tasks without going through the repository.
+	InvalidateAll(ctx context.Context)
+}
+
+// WrapScheduleRepository caches the reads of next in store for ttl. Every write
+// invalidates the entries it can change, so that a read after a write made
+// through the returned repository never sees stale data. Writes made by other
+// processes are only seen once the entries expire, or by fresh reads.
+func WrapScheduleRepository(next repository.ScheduleRepository, store Store, ttl time.Duration) ScheduleRepository {
+	return &scheduleRepository{next: next, store: store, ttl: ttl}
+}
+
+func (r *scheduleRepository) GetSchedules(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+	return read(ctx, r, func(gen generation) string {
+		return fmt.Sprintf("schedules:%d:%s", gen.lists, encodeKey(query))
+	}, func() ([]models.Schedule, error) {
+		return r.next.GetSchedules(ctx, query)
+	})
+}
+
+func (r *scheduleRepository) GetTodaySchedules(ctx context.Context) ([]models.Schedule, error) {
+	return read(ctx, r, func(gen generation) string {
+		return fmt.Sprintf("today:%d:%s", gen.lists, today(ctx))
+	}, func() ([]models.Schedule, error) {
+		return r.next.GetTodaySchedules(ctx)
+	})
+}
+
+func (r *scheduleRepository) GetScheduleByID(ctx context.Context, id string) (*models.Schedule, error) {
+	return read(ctx, r, func(generation) string {
+		return scheduleKey(id)
+	}, func() (*models.Schedule, error) {
+		return r.next.GetScheduleByID(ctx, id)
+	})
+}
+
+func (r *scheduleRepository) GetTaskByID(ctx context.Context, taskID string) (*models.Task, error) {
+	return read(ctx, r, func(gen generation) string {
+		return taskKey(gen, taskID)
+	}, func() (*models.Task, error) {
+		return r.next.GetTaskByID(ctx, taskID)
+	})
+}
+
+func (r *scheduleRepository) GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+	return read(ctx, r, func(gen generation) string {
+		return fmt.Sprintf("stats:%d:%s:%s", gen.lists, today(ctx), encodeKey(query))
+	}, func() (*models.ScheduleStats, error) {
+		return r.next.GetScheduleStats(ctx, query)
+	})
+}
+
+func (r *scheduleRepository) CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+	defer r.invalidate(ctx, invalidation{lists: true})
+	return r.next.CreateSchedule(ctx, schedule)
+}
+
+func (r *scheduleRepository) ReplacePlannedTasks(ctx context.Context, scheduleID string, tasks []models.Task) error {
+	defer r.invalidate(ctx, invalidation{schedules: []string{scheduleID}, lists: true, tasks: true})
+	return r.next.ReplacePlannedTasks(ctx, scheduleID, tasks)
+}
+
+func (r *scheduleRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+	defer r.invalidate(ctx, invalidation{schedules: []string{id}, lists: true})
+	return r.next.StartVisit(ctx, id, visitStart, startLocation, event)
+}
+
+func (r *scheduleRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error {
+	defer r.invalidate(ctx, invalidation{schedules: []string{id}, lists: true})
+	return r.next.EndVisit(ctx, id, visitEnd, endLocation, event)
+}
+
+func (r *scheduleRepository) UpdateTaskStatuses(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error {
+	inv := invalidation{lists: true}
+	for _, task := range tasks {
+		inv.taskIDs = append(inv.taskIDs, task.ID)
+		inv.schedules = append(inv.schedules, task.ScheduleID)
+	}
+	defer r.invalidate(ctx, inv)
+	return r.next.UpdateTaskStatuses(ctx, tasks, taskEvents)
+}
+
+func (r *scheduleRepository) AddTask(ctx context.Context, task models.Task, event events.Event) (*models.Task, error) {
+	defer r.invalidate(ctx, invalidation{schedules: []string{task.ScheduleID}, lists: true})
+	return r.next.AddTask(ctx, task, event)
+}
+
+func (r *scheduleRepository) RecordMissedVisit(ctx context.Context, id string, event events.Event) (bool, error) {
+	return r.next.RecordMissedVisit(ctx, id, event)
+}
+
+func (r *scheduleRepository) ResetSampleData(ctx context.Context) error {
+	defer r.invalidate(ctx, invalidation{all: true})
+	return r.next.ResetSampleData(ctx)
+}
+
+func (r *scheduleRepository) RefreshDailyStats(ctx context.Context, from, to time.Time) (int, error) {
+	defer r.invalidate(ctx, invalidation{lists: true})
+	return r.next.RefreshDailyStats(ctx, from, to)
+}
+
+// GetUnscrubbedVisits is not cached: the scrub job needs the current rows.
+func (r *scheduleRepository) GetUnscrubbedVisits(ctx context.Context, query models.LocationScrubQuery) ([]models.Schedule, error) {
+	return r.next.GetUnscrubbedVisits(ctx, query)
+}
+
+func (r *scheduleRepository) ScrubVisitLocations(ctx context.Context, scrub models.LocationScrub) (bool, error) {
+	defer r.invalidate(ctx, invalidation{schedules: []string{scrub.ScheduleID}, lists: true})
+	return r.next.ScrubVisitLocations(ctx, scrub)
+}
+
+func (r *scheduleRepository) InvalidateAll(ctx context.Context) {
+	r.invalidate(ctx, invalidation{all: true})
+}
+
+func (r *scheduleRepository) Ping(ctx context.Context) error {
+	return r.next.Ping(ctx)
+}
+
+// read returns the cached value under key, within the tenant of ctx, or loads it and caches it if no
+// write finished while it was loading. Errors are not cached. Fresh reads
+// (repository.WithFreshReads) always load, and refresh the entry.
+func read[T any](ctx context.Context, r *scheduleRepository, key func(generation) string, load func() (T, error)) (T, error) {
+	r.mu.RLock()
+	gen := r.gen
+	r.mu.RUnlock()
+
+	k := tenantKey(ctx, key(gen))
+	if data, ok := r.store.Get(k); ok && !repository.FreshReads(ctx) {
+		var value T
+		if err := json.Unmarshal(data, &value); err == nil {
+			return value, nil
+		}
+		r.store.Delete(k)
+	}
+
+	value, err := load()
+	if err != nil {
+		return value, err
+	}
+	// Values are stored encoded, so that callers never share them.
+	data, err := json.Marshal(value)
+	if err != nil {
+		return value, nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.gen.writes == gen.writes {
+		r.store.Set(k, data, r.ttl)
+	}
+	return value, nil
+}
+
+// invalidation lists what a write can change. Writes invalidate whether or
+// not they succeeded, since a failed request may still have been applied.
+type invalidation struct {
+	schedules []string
+	taskIDs   []string
+	lists     bool
+	tasks     bool
+	all       bool
+}
+
+func (r *scheduleRepository) invalidate(ctx context.Context, inv invalidation) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.gen.writes++
+	if inv.all {
+		r.gen.lists++
+		r.gen.tasks++
+		r.store.Clear()
+		return
+	}
+
+	var keys []string
+	for _, id := range inv.schedules {
+		keys = append(keys, tenantKey(ctx, scheduleKey(id)))
+	}
+	for _, id := range inv.taskIDs {
+		keys = append(keys, tenantKey(ctx, taskKey(r.gen, id)))
+	}
+	r.store.Delete(keys...)
+	if inv.lists {
+		r.gen.lists++
+	}
+	if inv.tasks {
+		r.gen.tasks++
+	}
+}
+
+// tenantKey puts key into the namespace of the tenant of ctx, so that tenants
+// never share entries. Generations are shared: a write retires the lists of
+// every tenant, which costs some hits but never serves stale data.
+func tenantKey(ctx context.Context, key string) string {
+	return tenant.ID(ctx) + "/" + key
+}
+
+// today is the date in the tenant's time zone, which today's schedules and
+// the stats depend on.
+func today(ctx context.Context) string {
+	return time.Now().In(tenant.Location(ctx)).Format("2006-01-02")
+}
+
+func scheduleKey(id string) string {
+	return "schedule:" + id
+}
+
+func taskKey(gen generation, id string) string {
+	return fmt.Sprintf("task:%d:%s", gen.tasks, id)
+}
+
+// encodeKey turns a query into a cache key part. The queries are plain
+// structs, so encoding them cannot fail.
+func encodeKey(query interface{}) string {
+	data, _ := json.Marshal(query)
+	return string(data)
+}
@@ -0,0 +1,458 @@
+// Package config loads the API's settings from an optional YAML file and the
+// environment, and validates them once at startup.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/logging"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tracing"
+)
+
+type Config struct {
+	Supabase   Supabase   `yaml:"supabase"`
+	Auth       Auth       `yaml:"auth"`
+	Server     Server     `yaml:"server"`
+	Log        Log        `yaml:"log"`
+	Tracing    Tracing    `yaml:"tracing"`
+	Tasks      Tasks      `yaml:"tasks"`
+	Stats      Stats      `yaml:"stats"`
+	Cache      Cache      `yaml:"cache"`
+	Encryption Encryption `yaml:"encryption"`
+	Audit      Audit      `yaml:"audit"`
+	Retention  Retention  `yaml:"retention"`
+	Locations  Locations  `yaml:"locations"`
+	Workers    Workers    `yaml:"workers"`
+}
+
+type Supabase struct {
+	URL            string `yaml:"url"`              // SUPABASE_URL
+	ServiceRoleKey string `yaml:"service_role_key"` // SUPABASE_SERVICE_ROLE_KEY
+	// Transient failures are retried up to MaxAttempts tries in all, and
+	// BreakerThreshold consecutive failed requests stop calls to Supabase for
+	// BreakerCooldown.
+	MaxAttempts      int           `yaml:"max_attempts"`      // SUPABASE_MAX_ATTEMPTS
+	BaseBackoff      time.Duration `yaml:"base_backoff"`      // SUPABASE_BASE_BACKOFF
+	MaxBackoff       time.Duration `yaml:"max_backoff"`       // SUPABASE_MAX_BACKOFF
+	BreakerThreshold int           `yaml:"breaker_threshold"` // SUPABASE_BREAKER_THRESHOLD
+	BreakerCooldown  time.Duration `yaml:"breaker_cooldown"`  // SUPABASE_BREAKER_COOLDOWN
+}
+
+// Auth authenticates the callers of /api with Supabase JWTs and scopes each
+// request to the tenant in the token's app_metadata.tenant_id claim. Without
+// a JWT secret the API serves a single agency, the default tenant, and trusts
+// its callers. Tenant settings are re-read once their cached copy is
+// TenantCacheTTL old. API keys are always accepted, and are limited to
+// APIKeyRateLimit requests a minute unless they set their own limit.
+type Auth struct {
+	JWTSecret       string        `yaml:"jwt_secret"`         // SUPABASE_JWT_SECRET
+	TenantCacheTTL  time.Duration `yaml:"tenant_cache_ttl"`   // TENANT_CACHE_TTL
+	APIKeyRateLimit int           `yaml:"api_key_rate_limit"` // API_KEY_RATE_LIMIT
+}
+
+type Server struct {
+	Port              string        `yaml:"port"`                // API_PORT
+	AllowedOrigins    []string      `yaml:"allowed_origins"`     // CORS_ALLOWED_ORIGINS, comma-separated
+	MaxBodyBytes      int64         `yaml:"max_body_bytes"`      // MAX_BODY_BYTES
+	ReadHeaderTimeout time.Duration `yaml:"read_header_timeout"` // SERVER_READ_HEADER_TIMEOUT
+	ReadTimeout       time.Duration `yaml:"read_timeout"`        // SERVER_READ_TIMEOUT
+	WriteTimeout      time.Duration `yaml:"write_timeout"`       // SERVER_WRITE_TIMEOUT; the visit stream is exempt
+	IdleTimeout       time.Duration `yaml:"idle_timeout"`        // SERVER_IDLE_TIMEOUT
+	ShutdownTimeout   time.Duration `yaml:"shutdown_timeout"`    // SHUTDOWN_TIMEOUT
+	// MetricsToken is the bearer token /metrics is served to. Without one,
+	// /metrics is not served.
+	MetricsToken string `yaml:"metrics_token"` // METRICS_TOKEN
+}
+
+type Log struct {
+	Level string `yaml:"level"` // LOG_LEVEL
+}
+
+type Tracing struct {
+	Exporter string `yaml:"exporter"` // OTEL_TRACES_EXPORTER
+}
+
+type Tasks struct {
+	UpdateGrace     time.Duration `yaml:"update_grace"`     // TASK_UPDATE_GRACE
+	RequireResolved bool          `yaml:"require_resolved"` // TASK_REQUIRE_RESOLVED
+}
+
+type Stats struct {
+	DailyRollup bool `yaml:"daily_rollup"` // STATS_DAILY_ROLLUP
+}
+
+// Cache holds schedule reads in process. Writes made through the API
+// invalidate them; writes made elsewhere, including other instances, show up
+// once the entries expire.
+type Cache struct {
+	Enabled    bool          `yaml:"enabled"`     // CACHE_ENABLED
+	TTL        time.Duration `yaml:"ttl"`         // CACHE_TTL
+	MaxEntries int           `yaml:"max_entries"` // CACHE_MAX_ENTRIES
+}
+
+// Encryption turns on field-level encryption of schedule PHI. Without a
+// keyfile the PHI columns are stored as plaintext.
+type Encryption struct {
+	KeyFile string `yaml:"keyfile"` // ENCRYPTION_KEYFILE
+}
+
+// Audit records the PHI returned by the schedule reads in the
+// phi_access_log table. Records are written in the background, at most
+// FlushInterval after the response, or before the response completes when
+// Synchronous is set. The Vercel function sets it, since its process does not
+// outlive the request.
+type Audit struct {
+	Enabled       bool          `yaml:"enabled"`        // AUDIT_ENABLED
+	BufferSize    int           `yaml:"buffer_size"`    // AUDIT_BUFFER_SIZE
+	FlushInterval time.Duration `yaml:"flush_interval"` // AUDIT_FLUSH_INTERVAL
+	Synchronous   bool          `yaml:"-"`
+}
+
+// Retention keeps each data class for RetainDays after the visit (or, for
+// audit logs, after the access) and then purges it. Zero days keeps a class
+// forever. Enabled runs the purge on the local server; on Vercel,
+// POST /api/retention/purge takes its place.
+type Retention struct {
+	Enabled        bool            `yaml:"enabled"`         // RETENTION_ENABLED
+	VisitRecords   RetentionPolicy `yaml:"visit_records"`   // RETENTION_VISIT_RECORDS_DAYS, RETENTION_VISIT_RECORDS_ACTION
+	GPSCoordinates RetentionPolicy `yaml:"gps_coordinates"` // RETENTION_GPS_COORDINATES_DAYS
+	TaskReasons    RetentionPolicy `yaml:"task_reasons"`    // RETENTION_TASK_REASONS_DAYS
+	AuditLogs      RetentionPolicy `yaml:"audit_logs"`      // RETENTION_AUDIT_LOGS_DAYS
+}
+
+// RetentionPolicy's Action is delete or, for visit records only, anonymize.
+type RetentionPolicy struct {
+	RetainDays int    `yaml:"retain_days"`
+	Action     string `yaml:"action"`
+}
+
+// Policies returns the policies in the order they are applied: the partial
+// purges first, so that their counts are not swallowed by whole visits.
+func (r Retention) Policies() []models.RetentionPolicy {
+	return []models.RetentionPolicy{
+		{DataClass: models.DataClassGPSCoordinates, RetainDays: r.GPSCoordinates.RetainDays, Action: r.GPSCoordinates.Action},
+		{DataClass: models.DataClassTaskReasons, RetainDays: r.TaskReasons.RetainDays, Action: r.TaskReasons.Action},
+		{DataClass: models.DataClassVisitRecords, RetainDays: r.VisitRecords.RetainDays, Action: r.VisitRecords.Action},
+		{DataClass: models.DataClassAuditLogs, RetainDays: r.AuditLogs.RetainDays, Action: r.AuditLogs.Action},
+	}
+}
+
+// Locations reduces the precision of the clock-in and clock-out locations of
+// completed visits once they passed the geofence check (AfterVerified) or are
+// AfterDays old. coarsen rounds the coordinates to Decimals places and drops
+// the address; verification_only drops the location. Both keep the geofence
+// result and distance. keep turns it off.
+type Locations struct {
+	Mode                 string `yaml:"mode"`                   // LOCATION_PRECISION_MODE
+	Decimals             int    `yaml:"decimals"`               // LOCATION_PRECISION_DECIMALS
+	AfterVerified        bool   `yaml:"after_verified"`         // LOCATION_PRECISION_AFTER_VERIFIED
+	AfterDays            int    `yaml:"after_days"`             // LOCATION_PRECISION_AFTER_DAYS
+	GeofenceRadiusMeters int    `yaml:"geofence_radius_meters"` // GEOFENCE_RADIUS_METERS
+}
+
+// Workers are the background jobs the local server runs. On Vercel,
+// POST /api/webhooks/dispatch takes their place.
+type Workers struct {
+	WebhookDispatchInterval time.Duration `yaml:"webhook_dispatch_interval"`
+	MissedVisitInterval     time.Duration `yaml:"missed_visit_interval"`
+	DailyStatsInterval      time.Duration `yaml:"daily_stats_interval"`
+	DailyStatsLookbackDays  int           `yaml:"daily_stats_lookback_days"`
+	RetentionPurgeInterval  time.Duration `yaml:"retention_purge_interval"`
+	LocationScrubInterval   time.Duration `yaml:"location_scrub_interval"`
+}
+
+// Default returns the settings used for anything the file and the environment
+// leave out. Supabase's URL and key have no default and must be configured.
+func Default() Config {
+	return Config{
+		Supabase: Supabase{
+			MaxAttempts:      3,
+			BaseBackoff:      100 * time.Millisecond,
+			MaxBackoff:       time.Second,
+			BreakerThreshold: 5,
+			BreakerCooldown:  30 * time.Second,
+		},
+		Auth: Auth{TenantCacheTTL: time.Minute, APIKeyRateLimit: 120},
+		Server: Server{
+			Port:              "8080",
+			AllowedOrigins:    []string{"*"},
+			MaxBodyBytes:      1 << 20,
+			ReadHeaderTimeout: 5 * time.Second,
+			ReadTimeout:       15 * time.Second,
+			WriteTimeout:      30 * time.Second,
+			IdleTimeout:       2 * time.Minute,
+			ShutdownTimeout:   20 * time.Second,
+		},
+		Log:     Log{Level: "info"},
+		Tracing: Tracing{Exporter: tracing.ExporterNone},
+		Tasks:   Tasks{UpdateGrace: 30 * time.Minute, RequireResolved: true},
+		Cache:   Cache{TTL: 10 * time.Second, MaxEntries: 1000},
+		Audit:   Audit{Enabled: true, BufferSize: 1000, FlushInterval: time.Second},
+		Retention: Retention{
+			// Six years. Each state Medicaid program sets its own minimum.
+			VisitRecords:   RetentionPolicy{RetainDays: 2192, Action: models.RetentionDelete},
+			GPSCoordinates: RetentionPolicy{RetainDays: 90, Action: models.RetentionDelete},
+			TaskReasons:    RetentionPolicy{RetainDays: 730, Action: models.RetentionDelete},
+			AuditLogs:      RetentionPolicy{RetainDays: 2192, Action: models.RetentionDelete},
+		},
+		Locations: Locations{
+			Mode:                 models.LocationKeep,
+			Decimals:             2,
+			AfterVerified:        true,
+			AfterDays:            30,
+			GeofenceRadiusMeters: 150,
+		},
+		Workers: Workers{
+			WebhookDispatchInterval: 15 * time.Second,
+			MissedVisitInterval:     time.Minute,
+			DailyStatsInterval:      5 * time.Minute,
+			DailyStatsLookbackDays:  7,
+			RetentionPurgeInterval:  24 * time.Hour,
+			LocationScrubInterval:   15 * time.Minute,
+		},
+	}
+}
+
+// Load starts from Default, applies the YAML file at path (if path is not
+// empty), then the environment variables, and validates the result. Every
+// problem found is reported, not just the first.
+func Load(path string) (Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("config: failed to read %s: %w", path, err)
+		}
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(&cfg); err != nil {
+			return Config{}, fmt.Errorf("config: failed to parse %s: %w", path, err)
+		}
+	}
+
+	env := envReader{}
+	env.string("SUPABASE_URL", &cfg.Supabase.URL)
+	env.string("SUPABASE_SERVICE_ROLE_KEY", &cfg.Supabase.ServiceRoleKey)
+	env.int("SUPABASE_MAX_ATTEMPTS", &cfg.Supabase.MaxAttempts)
+	env.duration("SUPABASE_BASE_BACKOFF", &cfg.Supabase.BaseBackoff)
+	env.duration("SUPABASE_MAX_BACKOFF", &cfg.Supabase.MaxBackoff)
+	env.int("SUPABASE_BREAKER_THRESHOLD", &cfg.Supabase.BreakerThreshold)
+	env.duration("SUPABASE_BREAKER_COOLDOWN", &cfg.Supabase.BreakerCooldown)
+	env.string("SUPABASE_JWT_SECRET", &cfg.Auth.JWTSecret)
+	env.duration("TENANT_CACHE_TTL", &cfg.Auth.TenantCacheTTL)
+	env.int("API_KEY_RATE_LIMIT", &cfg.Auth.APIKeyRateLimit)
+	env.string("API_PORT", &cfg.Server.Port)
+	env.list("CORS_ALLOWED_ORIGINS", &cfg.Server.AllowedOrigins)
+	env.int64("MAX_BODY_BYTES", &cfg.Server.MaxBodyBytes)
+	env.duration("SERVER_READ_HEADER_TIMEOUT", &cfg.Server.ReadHeaderTimeout)
+	env.duration("SERVER_READ_TIMEOUT", &cfg.Server.ReadTimeout)
+	env.duration("SERVER_WRITE_TIMEOUT", &cfg.Server.WriteTimeout)
+	env.duration("SERVER_IDLE_TIMEOUT", &cfg.Server.IdleTimeout)
+	env.duration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	env.string("METRICS_TOKEN", &cfg.Server.MetricsToken)
+	env.string("LOG_LEVEL", &cfg.Log.Level)
+	env.string("OTEL_TRACES_EXPORTER", &cfg.Tracing.Exporter)
+	env.duration("TASK_UPDATE_GRACE", &cfg.Tasks.UpdateGrace)
+	env.bool("TASK_REQUIRE_RESOLVED", &cfg.Tasks.RequireResolved)
+	env.bool("STATS_DAILY_ROLLUP", &cfg.Stats.DailyRollup)
+	env.bool("CACHE_ENABLED", &cfg.Cache.Enabled)
+	env.duration("CACHE_TTL", &cfg.Cache.TTL)
+	env.int("CACHE_MAX_ENTRIES", &cfg.Cache.MaxEntries)
+	env.string("ENCRYPTION_KEYFILE", &cfg.Encryption.KeyFile)
+	env.bool("AUDIT_ENABLED", &cfg.Audit.Enabled)
+	env.int("AUDIT_BUFFER_SIZE", &cfg.Audit.BufferSize)
+	env.duration("AUDIT_FLUSH_INTERVAL", &cfg.Audit.FlushInterval)
+	env.bool("RETENTION_ENABLED", &cfg.Retention.Enabled)
+	env.int("RETENTION_VISIT_RECORDS_DAYS", &cfg.Retention.VisitRecords.RetainDays)
+	env.string("RETENTION_VISIT_RECORDS_ACTION", &cfg.Retention.VisitRecords.Action)
+	env.int("RETENTION_GPS_COORDINATES_DAYS", &cfg.Retention.GPSCoordinates.RetainDays)
+	env.int("RETENTION_TASK_REASONS_DAYS", &cfg.Retention.TaskReasons.RetainDays)
+	env.int("RETENTION_AUDIT_LOGS_DAYS", &cfg.Retention.AuditLogs.RetainDays)
+	env.string("LOCATION_PRECISION_MODE", &cfg.Locations.Mode)
+	env.int("LOCATION_PRECISION_DECIMALS", &cfg.Locations.Decimals)
+	env.bool("LOCATION_PRECISION_AFTER_VERIFIED", &cfg.Locations.AfterVerified)
+	env.int("LOCATION_PRECISION_AFTER_DAYS", &cfg.Locations.AfterDays)
+	env.int("GEOFENCE_RADIUS_METERS", &cfg.Locations.GeofenceRadiusMeters)
+
+	if err := errors.Join(errors.Join(env.errs...), cfg.Validate()); err != nil {
+		return Config{}, fmt.Errorf("config: invalid configuration:\n%w", err)
+	}
+	return cfg, nil
+}
+
+// Validate reports every setting that is missing or out of range.
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	if u, err := url.Parse(c.Supabase.URL); c.Supabase.URL == "" {
+		errs = append(errs, errors.New("supabase.url (SUPABASE_URL) is required"))
+	} else {
+		check(err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "",
+			"supabase.url (SUPABASE_URL) %q must be an http(s) URL", c.Supabase.URL)
+	}
+	check(c.Supabase.ServiceRoleKey != "", "supabase.service_role_key (SUPABASE_SERVICE_ROLE_KEY) is required")
+	check(c.Supabase.MaxAttempts > 0, "supabase.max_attempts (SUPABASE_MAX_ATTEMPTS) must be at least 1")
+	check(c.Supabase.BaseBackoff > 0 && c.Supabase.BaseBackoff <= c.Supabase.MaxBackoff,
+		"supabase.base_backoff (SUPABASE_BASE_BACKOFF) must be positive and at most supabase.max_backoff (SUPABASE_MAX_BACKOFF)")
+	check(c.Supabase.BreakerThreshold > 0, "supabase.breaker_threshold (SUPABASE_BREAKER_THRESHOLD) must be at least 1")
+	check(c.Supabase.BreakerCooldown > 0, "supabase.breaker_cooldown (SUPABASE_BREAKER_COOLDOWN) must be positive")
+
+	check(c.Auth.JWTSecret == "" || len(c.Auth.JWTSecret) >= 32,
+		"auth.jwt_secret (SUPABASE_JWT_SECRET) must be at least 32 characters")
+	check(c.Auth.TenantCacheTTL > 0, "auth.tenant_cache_ttl (TENANT_CACHE_TTL) must be positive")
+	check(c.Auth.APIKeyRateLimit > 0, "auth.api_key_rate_limit (API_KEY_RATE_LIMIT) must be at least 1")
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port (API_PORT) %q must be a port number", c.Server.Port)
+	check(len(c.Server.AllowedOrigins) > 0, "server.allowed_origins (CORS_ALLOWED_ORIGINS) must list at least one origin")
+	for _, origin := range c.Server.AllowedOrigins {
+		u, err := url.Parse(origin)
+		check(origin == "*" || (err == nil && u.Scheme != "" && u.Host != "" && u.Path == ""),
+			"server.allowed_origins (CORS_ALLOWED_ORIGINS) %q must be * or scheme://host[:port]", origin)
+	}
+	check(c.Server.MaxBodyBytes > 0, "server.max_body_bytes (MAX_BODY_BYTES) must be positive")
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 && c.Server.IdleTimeout >= 0,
+		"server timeouts must not be negative")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive")
+	check(c.Server.MetricsToken == "" || len(c.Server.MetricsToken) >= 32,
+		"server.metrics_token (METRICS_TOKEN) must be at least 32 characters")
+
+	_, err = logging.ParseLevel(c.Log.Level)
+	check(err == nil, "log.level (LOG_LEVEL) %q must be debug, info, warn or error", c.Log.Level)
+
+	switch c.Tracing.Exporter {
+	case "", tracing.ExporterNone, tracing.ExporterConsole, tracing.ExporterOTLP:
+	default:
+		check(false, "tracing.exporter (OTEL_TRACES_EXPORTER) %q must be none, console or otlp", c.Tracing.Exporter)
+	}
+
+	check(c.Tasks.UpdateGrace >= 0, "tasks.update_grace (TASK_UPDATE_GRACE) must not be negative")
+
+	if c.Cache.Enabled {
+		check(c.Cache.TTL > 0, "cache.ttl (CACHE_TTL) must be positive")
+		check(c.Cache.MaxEntries > 0, "cache.max_entries (CACHE_MAX_ENTRIES) must be at least 1")
+	}
+
+	if c.Audit.Enabled {
+		check(c.Audit.BufferSize > 0, "audit.buffer_size (AUDIT_BUFFER_SIZE) must be at least 1")
+		check(c.Audit.FlushInterval > 0, "audit.flush_interval (AUDIT_FLUSH_INTERVAL) must be positive")
+	}
+
+	for _, policy := range c.Retention.Policies() {
+		check(policy.RetainDays >= 0, "retention.%s.retain_days (RETENTION_%s_DAYS) must not be negative",
+			policy.DataClass, strings.ToUpper(policy.DataClass))
+		if policy.DataClass == models.DataClassVisitRecords {
+			check(policy.Action == models.RetentionDelete || policy.Action == models.RetentionAnonymize,
+				"retention.%s.action (RETENTION_VISIT_RECORDS_ACTION) %q must be delete or anonymize", policy.DataClass, policy.Action)
+		} else {
+			check(policy.Action == models.RetentionDelete, "retention.%s.action %q must be delete", policy.DataClass, policy.Action)
+		}
+	}
+
+	switch c.Locations.Mode {
+	case models.LocationKeep, models.LocationCoarsen, models.LocationVerificationOnly:
+	default:
+		check(false, "locations.mode (LOCATION_PRECISION_MODE) %q must be keep, coarsen or verification_only", c.Locations.Mode)
+	}
+	check(c.Locations.Decimals >= 0 && c.Locations.Decimals <= 6, "locations.decimals (LOCATION_PRECISION_DECIMALS) must be between 0 and 6")
+	check(c.Locations.AfterDays >= 0, "locations.after_days (LOCATION_PRECISION_AFTER_DAYS) must not be negative")
+	check(c.Locations.GeofenceRadiusMeters > 0, "locations.geofence_radius_meters (GEOFENCE_RADIUS_METERS) must be positive")
+
+	check(c.Workers.WebhookDispatchInterval > 0, "workers.webhook_dispatch_interval must be positive")
+	check(c.Workers.MissedVisitInterval > 0, "workers.missed_visit_interval must be positive")
+	check(c.Workers.DailyStatsInterval > 0, "workers.daily_stats_interval must be positive")
+	check(c.Workers.DailyStatsLookbackDays >= 0, "workers.daily_stats_lookback_days must not be negative")
+	check(c.Workers.RetentionPurgeInterval > 0, "workers.retention_purge_interval must be positive")
+	check(c.Workers.LocationScrubInterval > 0, "workers.location_scrub_interval must be positive")
+
+	return errors.Join(errs...)
+}
+
+// envReader applies set environment variables and collects parse errors.
+type envReader struct {
+	errs []error
+}
+
+func (e *envReader) lookup(name string) (string, bool) {
+	value, ok := os.LookupEnv(name)
+	return strings.TrimSpace(value), ok && strings.TrimSpace(value) != ""
+}
+
+func (e *envReader) string(name string, dst *string) {
+	if value, ok := e.lookup(name); ok {
+		*dst = value
+	}
+}
+
+func (e *envReader) list(name string, dst *[]string) {
+	value, ok := e.lookup(name)
+	if !ok {
+		return
+	}
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	*dst = items
+}
+
+func (e *envReader) int(name string, dst *int) {
+	if value, ok := e.lookup(name); ok {
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s %q is not an integer", name, value))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) int64(name string, dst *int64) {
+	if value, ok := e.lookup(name); ok {
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s %q is not an integer", name, value))
+			return
+		}
+		*dst = n
+	}
+}
+
+func (e *envReader) duration(name string, dst *time.Duration) {
+	if value, ok := e.lookup(name); ok {
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s %q is not a duration such as 30s or 5m", name, value))
+			return
+		}
+		*dst = d
+	}
+}
+
+func (e *envReader) bool(name string, dst *bool) {
+	if value, ok := e.lookup(name); ok {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			e.errs = append(e.errs, fmt.Errorf("%s %q is not true or false", name, value))
+			return
+		}
+		*dst = b
+	}
+}
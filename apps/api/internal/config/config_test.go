@@ -0,0 +1,122 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/config"
+)
+
+func setSupabase(t *testing.T) {
+	t.Setenv("SUPABASE_URL", "https://example.supabase.co")
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "test-key")
+}
+
+func writeFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	setSupabase(t)
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Expected defaults to be valid, got %v", err)
+	}
+	if cfg.Server.Port != "8080" || cfg.Server.MaxBodyBytes != 1<<20 || !cfg.Tasks.RequireResolved {
+		t.Errorf("Expected the defaults, got %+v", cfg)
+	}
+	if cfg.Server.WriteTimeout == 0 || cfg.Server.ShutdownTimeout == 0 {
+		t.Errorf("Expected server timeouts by default, got %+v", cfg.Server)
+	}
+}
+
+func TestEnvironmentOverridesFile(t *testing.T) {
+	setSupabase(t)
+	path := writeFile(t, `
+server:
+  port: "9000"
+  allowed_origins: [https://app.example.com]
+  write_timeout: 10s
+tasks:
+  update_grace: 1h
+  require_resolved: false
+encryption:
+  keyfile: keyfile.json
+retention:
+  gps_coordinates:
+    retain_days: 30
+`)
+	t.Setenv("API_PORT", "9100")
+	t.Setenv("ENCRYPTION_KEYFILE", "/etc/evv/keyfile.json")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "https://a.example.com, https://b.example.com")
+	t.Setenv("RETENTION_VISIT_RECORDS_ACTION", "anonymize")
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Expected the config to load, got %v", err)
+	}
+	if cfg.Server.Port != "9100" {
+		t.Errorf("Expected API_PORT to win over the file, got %s", cfg.Server.Port)
+	}
+	if cfg.Encryption.KeyFile != "/etc/evv/keyfile.json" {
+		t.Errorf("Expected ENCRYPTION_KEYFILE to win over the file, got %s", cfg.Encryption.KeyFile)
+	}
+	if len(cfg.Server.AllowedOrigins) != 2 || cfg.Server.AllowedOrigins[1] != "https://b.example.com" {
+		t.Errorf("Expected the origins from the environment, got %v", cfg.Server.AllowedOrigins)
+	}
+	if cfg.Server.WriteTimeout != 10*time.Second || cfg.Tasks.UpdateGrace != time.Hour || cfg.Tasks.RequireResolved {
+		t.Errorf("Expected the file's values, got %+v %+v", cfg.Server, cfg.Tasks)
+	}
+	if cfg.Retention.GPSCoordinates.RetainDays != 30 || cfg.Retention.GPSCoordinates.Action != "delete" || cfg.Retention.VisitRecords.Action != "anonymize" {
+		t.Errorf("Expected the file's and the environment's retention settings over the defaults, got %+v", cfg.Retention)
+	}
+	if cfg.Server.ReadTimeout != config.Default().Server.ReadTimeout {
+		t.Errorf("Expected unset values to keep their defaults, got %v", cfg.Server.ReadTimeout)
+	}
+}
+
+func TestLoadReportsEveryProblem(t *testing.T) {
+	t.Setenv("SUPABASE_URL", "")
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "")
+	t.Setenv("MAX_BODY_BYTES", "lots")
+	t.Setenv("TASK_UPDATE_GRACE", "30")
+	t.Setenv("LOG_LEVEL", "loud")
+	t.Setenv("CORS_ALLOWED_ORIGINS", "app.example.com")
+	t.Setenv("SUPABASE_MAX_ATTEMPTS", "0")
+	t.Setenv("SUPABASE_BREAKER_THRESHOLD", "many")
+	t.Setenv("CACHE_ENABLED", "true")
+	t.Setenv("CACHE_TTL", "0s")
+	t.Setenv("RETENTION_GPS_COORDINATES_DAYS", "-1")
+	t.Setenv("RETENTION_VISIT_RECORDS_ACTION", "shred")
+	t.Setenv("LOCATION_PRECISION_MODE", "blur")
+	t.Setenv("SUPABASE_JWT_SECRET", "too-short")
+	t.Setenv("METRICS_TOKEN", "too-short")
+
+	_, err := config.Load("")
+	if err == nil {
+		t.Fatal("Expected an invalid configuration")
+	}
+	for _, want := range []string{"SUPABASE_URL", "SUPABASE_SERVICE_ROLE_KEY", "MAX_BODY_BYTES", "TASK_UPDATE_GRACE", "LOG_LEVEL", "CORS_ALLOWED_ORIGINS", "SUPABASE_MAX_ATTEMPTS", "SUPABASE_BREAKER_THRESHOLD", "CACHE_TTL", "RETENTION_GPS_COORDINATES_DAYS", "RETENTION_VISIT_RECORDS_ACTION", "LOCATION_PRECISION_MODE", "SUPABASE_JWT_SECRET", "METRICS_TOKEN"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected the error to mention %s, got %v", want, err)
+		}
+	}
+}
+
+func TestLoadRejectsUnknownFileKeys(t *testing.T) {
+	setSupabase(t)
+	path := writeFile(t, "server:\n  prot: \"9000\"\n")
+
+	if _, err := config.Load(path); err == nil || !strings.Contains(err.Error(), "prot") {
+		t.Errorf("Expected an error naming the unknown key, got %v", err)
+	}
+}
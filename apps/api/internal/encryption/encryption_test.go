@@ -0,0 +1,204 @@
+package encryption_test
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/encryption"
+)
+
+// memoryKeyStore keeps data keys in a map and, like the encryption_keys
+// table, allows one active key per tenant.
+type memoryKeyStore struct {
+	mu   sync.Mutex
+	keys map[string]encryption.DataKey
+}
+
+func newMemoryKeyStore() *memoryKeyStore {
+	return &memoryKeyStore{keys: map[string]encryption.DataKey{}}
+}
+
+func (s *memoryKeyStore) ActiveDataKey(ctx context.Context, tenantID string) (*encryption.DataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, key := range s.keys {
+		if key.TenantID == tenantID && key.Status == encryption.StatusActive {
+			return &key, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *memoryKeyStore) DataKey(ctx context.Context, id string) (*encryption.DataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key, ok := s.keys[id]
+	if !ok {
+		return nil, errors.New("not found")
+	}
+	return &key, nil
+}
+
+func (s *memoryKeyStore) ListDataKeys(ctx context.Context) ([]encryption.DataKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []encryption.DataKey
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func (s *memoryKeyStore) CreateDataKey(ctx context.Context, key encryption.DataKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, existing := range s.keys {
+		if existing.TenantID == key.TenantID && existing.Status == encryption.StatusActive {
+			return errors.New("duplicate active key")
+		}
+	}
+	s.keys[key.ID] = key
+	return nil
+}
+
+func (s *memoryKeyStore) RetireDataKeys(ctx context.Context, tenantID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, key := range s.keys {
+		if key.TenantID == tenantID {
+			key.Status = encryption.StatusRetired
+			s.keys[id] = key
+		}
+	}
+	return nil
+}
+
+func (s *memoryKeyStore) UpdateWrappedKey(ctx context.Context, id, masterKeyID, wrappedKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := s.keys[id]
+	key.MasterKeyID, key.WrappedKey = masterKeyID, wrappedKey
+	s.keys[id] = key
+	return nil
+}
+
+func newKeyring(t *testing.T) (*encryption.Keyring, *encryption.Keyfile, *memoryKeyStore) {
+	t.Helper()
+	keyfile, err := encryption.NewKeyfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := newMemoryKeyStore()
+	return encryption.NewKeyring(keyfile, store), keyfile, store
+}
+
+func TestKeyring_EncryptsAndDecrypts(t *testing.T) {
+	keyring, _, _ := newKeyring(t)
+	ctx := context.Background()
+
+	encrypted, err := keyring.Encrypt(ctx, encryption.DefaultTenant, []byte("Jane Doe"), "schedules.client_name:sch-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !encryption.IsEncrypted(encrypted) || strings.Contains(encrypted, "Jane") {
+		t.Fatalf("Expected ciphertext, got %q", encrypted)
+	}
+	again, _ := keyring.Encrypt(ctx, encryption.DefaultTenant, []byte("Jane Doe"), "schedules.client_name:sch-001")
+	if again == encrypted {
+		t.Error("Expected a fresh nonce for every encryption")
+	}
+
+	plaintext, err := keyring.Decrypt(ctx, encrypted, "schedules.client_name:sch-001")
+	if err != nil || string(plaintext) != "Jane Doe" {
+		t.Fatalf("Expected Jane Doe, got %q, %v", plaintext, err)
+	}
+	if _, err := keyring.Decrypt(ctx, encrypted, "schedules.client_name:sch-002"); err == nil {
+		t.Error("Expected a value moved to another row not to decrypt")
+	}
+	if plaintext, _ := keyring.Decrypt(ctx, "Legacy Name", "schedules.client_name:sch-001"); string(plaintext) != "Legacy Name" {
+		t.Errorf("Expected plaintext to pass through, got %q", plaintext)
+	}
+}
+
+func TestKeyring_RotationKeepsOldValuesReadable(t *testing.T) {
+	keyring, keyfile, store := newKeyring(t)
+	ctx := context.Background()
+
+	old, _ := keyring.Encrypt(ctx, encryption.DefaultTenant, []byte("note"), "aad")
+	newKeyID, err := keyring.RotateDataKey(ctx, encryption.DefaultTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if newKeyID == encryption.KeyID(old) {
+		t.Fatal("Expected rotation to create a new data key")
+	}
+	fresh, _ := keyring.Encrypt(ctx, encryption.DefaultTenant, []byte("note"), "aad")
+	if encryption.KeyID(fresh) != newKeyID {
+		t.Errorf("Expected new values under %s, got %s", newKeyID, encryption.KeyID(fresh))
+	}
+
+	// A new master key: once the data keys are rewrapped, the old master key
+	// can leave the keyfile.
+	oldMaster := keyfile.ActiveMasterKey
+	if _, err := keyfile.AddMasterKey(); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := keyring.RewrapDataKeys(ctx); err != nil || n != 2 {
+		t.Fatalf("Expected 2 data keys rewrapped, got %d, %v", n, err)
+	}
+	delete(keyfile.MasterKeys, oldMaster)
+
+	restarted := encryption.NewKeyring(keyfile, store)
+	for _, value := range []string{old, fresh} {
+		if plaintext, err := restarted.Decrypt(ctx, value, "aad"); err != nil || string(plaintext) != "note" {
+			t.Errorf("Expected %s to decrypt after rotation, got %q, %v", encryption.KeyID(value), plaintext, err)
+		}
+	}
+}
+
+func TestKeyring_BlindIndex(t *testing.T) {
+	keyring, _, _ := newKeyring(t)
+
+	if keyring.BlindIndex("a", "Jane Doe") != keyring.BlindIndex("a", " Jane Doe ") {
+		t.Error("Expected surrounding whitespace to be ignored")
+	}
+	if keyring.BlindIndex("a", "Jane Doe") == keyring.BlindIndex("a", "Jane Roe") {
+		t.Error("Expected different names to get different indexes")
+	}
+	if keyring.BlindIndex("a", "Jane Doe") == keyring.BlindIndex("b", "Jane Doe") {
+		t.Error("Expected indexes to differ between tenants")
+	}
+
+	other, _, _ := newKeyring(t)
+	if keyring.BlindIndex("a", "Jane Doe") == other.BlindIndex("a", "Jane Doe") {
+		t.Error("Expected indexes to depend on the blind index key")
+	}
+}
+
+func TestKeyfile_SaveAndLoad(t *testing.T) {
+	keyfile, err := encryption.NewKeyfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keyfile.json")
+	if err := keyfile.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := encryption.LoadKeyfile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.ActiveMasterKey != keyfile.ActiveMasterKey || len(loaded.MasterKeys) != 1 {
+		t.Errorf("Expected the saved keyfile back, got %+v", loaded.MasterKeyIDs())
+	}
+
+	loaded.ActiveMasterKey = "missing"
+	if err := loaded.Save(path); err == nil {
+		t.Error("Expected a keyfile without its active master key to be rejected")
+	}
+}
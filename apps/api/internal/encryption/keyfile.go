@@ -0,0 +1,147 @@
+// Package encryption encrypts PHI fields with AES-GCM under per-tenant data
+// keys. Data keys are stored wrapped by a master key that never leaves the
+// local keyfile, and blind indexes keep exact-match lookups on encrypted
+// fields possible.
+package encryption
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sort"
+	"time"
+)
+
+const keySize = 32 // AES-256
+
+// Keyfile holds the master keys and the blind index key. It is a JSON file
+// readable only by the API's user:
+//
+//	{
+//	  "active_master_key": "mk-20261019",
+//	  "master_keys": {"mk-20261019": "<base64 of 32 random bytes>"},
+//	  "blind_index_key": "<base64 of 32 random bytes>"
+//	}
+//
+// New data keys are wrapped with the active master key. Older master keys stay
+// in the file until rotate-keys has rewrapped every data key.
+type Keyfile struct {
+	ActiveMasterKey string            `json:"active_master_key"`
+	MasterKeys      map[string][]byte `json:"master_keys"`
+	BlindIndexKey   []byte            `json:"blind_index_key"`
+}
+
+// LoadKeyfile reads and checks the keyfile at path.
+func LoadKeyfile(path string) (*Keyfile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: failed to read keyfile: %w", err)
+	}
+	if info, err := os.Stat(path); err == nil && info.Mode().Perm()&0o077 != 0 {
+		slog.Warn("Keyfile is readable by other users, restrict it to mode 0600", "path", path, "mode", info.Mode().Perm().String())
+	}
+
+	var kf Keyfile
+	if err := json.Unmarshal(data, &kf); err != nil {
+		return nil, fmt.Errorf("encryption: failed to parse keyfile: %w", err)
+	}
+	if err := kf.validate(); err != nil {
+		return nil, err
+	}
+	return &kf, nil
+}
+
+// NewKeyfile returns a keyfile with a fresh master key and blind index key.
+func NewKeyfile() (*Keyfile, error) {
+	kf := &Keyfile{MasterKeys: map[string][]byte{}}
+	if _, err := kf.AddMasterKey(); err != nil {
+		return nil, err
+	}
+	var err error
+	if kf.BlindIndexKey, err = randomKey(); err != nil {
+		return nil, err
+	}
+	return kf, nil
+}
+
+// AddMasterKey generates a master key and makes it the active one. It returns
+// the key's ID.
+func (kf *Keyfile) AddMasterKey() (string, error) {
+	key, err := randomKey()
+	if err != nil {
+		return "", err
+	}
+	id := "mk-" + time.Now().UTC().Format("20060102T150405")
+	for n := 2; kf.MasterKeys[id] != nil; n++ {
+		id = fmt.Sprintf("mk-%s-%d", time.Now().UTC().Format("20060102T150405"), n)
+	}
+	kf.MasterKeys[id] = key
+	kf.ActiveMasterKey = id
+	return id, nil
+}
+
+// Save writes the keyfile to path with mode 0600, replacing it atomically.
+func (kf *Keyfile) Save(path string) error {
+	if err := kf.validate(); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(kf, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o600); err != nil {
+		return fmt.Errorf("encryption: failed to write keyfile: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("encryption: failed to replace keyfile: %w", err)
+	}
+	return nil
+}
+
+// MasterKeyIDs returns the IDs of the master keys in the file, sorted.
+func (kf *Keyfile) MasterKeyIDs() []string {
+	ids := make([]string, 0, len(kf.MasterKeys))
+	for id := range kf.MasterKeys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func (kf *Keyfile) validate() error {
+	var errs []error
+	if _, ok := kf.MasterKeys[kf.ActiveMasterKey]; !ok {
+		errs = append(errs, fmt.Errorf("active_master_key %q is not in master_keys", kf.ActiveMasterKey))
+	}
+	for id, key := range kf.MasterKeys {
+		if len(key) != keySize {
+			errs = append(errs, fmt.Errorf("master key %q must be %d bytes, got %d", id, keySize, len(key)))
+		}
+	}
+	if len(kf.BlindIndexKey) != keySize {
+		errs = append(errs, fmt.Errorf("blind_index_key must be %d bytes, got %d", keySize, len(kf.BlindIndexKey)))
+	}
+	if err := errors.Join(errs...); err != nil {
+		return fmt.Errorf("encryption: invalid keyfile: %w", err)
+	}
+	return nil
+}
+
+func randomKey() ([]byte, error) {
+	key := make([]byte, keySize)
+	if _, err := rand.Read(key); err != nil {
+		return nil, fmt.Errorf("encryption: failed to generate key: %w", err)
+	}
+	return key, nil
+}
+
+// encodeKey is the base64 form of keys outside the keyfile, such as wrapped
+// data keys.
+func encodeKey(b []byte) string {
+	return base64.StdEncoding.EncodeToString(b)
+}
@@ -0,0 +1,332 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultTenant is the tenant of single-agency deployments (tenant.DefaultID),
+// which owns the data keys created before schedules belonged to an agency.
+const DefaultTenant = "default"
+
+// prefix marks an encrypted field value. Values without it are plaintext
+// written before encryption was turned on, and are returned as they are.
+const prefix = "enc:v1:"
+
+// activeKeyTTL is how long a keyring keeps using the active data key it last
+// loaded, so that a rotation made by another process is picked up.
+const activeKeyTTL = 5 * time.Minute
+
+// Data key statuses. Retired keys still decrypt, but nothing new is encrypted
+// with them.
+const (
+	StatusActive  = "active"
+	StatusRetired = "retired"
+)
+
+// DataKey is a tenant's data encryption key, as stored: wrapped by one of the
+// master keys.
+type DataKey struct {
+	ID          string    `json:"id"`
+	TenantID    string    `json:"tenant_id"`
+	MasterKeyID string    `json:"master_key_id"`
+	WrappedKey  string    `json:"wrapped_key"`
+	Status      string    `json:"status"`
+	CreatedAt   time.Time `json:"created_at,omitempty"`
+}
+
+// KeyStore persists wrapped data keys.
+type KeyStore interface {
+	// ActiveDataKey returns the tenant's active data key, or nil if it has none.
+	ActiveDataKey(ctx context.Context, tenantID string) (*DataKey, error)
+	DataKey(ctx context.Context, id string) (*DataKey, error)
+	ListDataKeys(ctx context.Context) ([]DataKey, error)
+	// CreateDataKey stores a new active key. It fails if the tenant already has
+	// an active key.
+	CreateDataKey(ctx context.Context, key DataKey) error
+	// RetireDataKeys retires the tenant's active keys.
+	RetireDataKeys(ctx context.Context, tenantID string) error
+	UpdateWrappedKey(ctx context.Context, id, masterKeyID, wrappedKey string) error
+}
+
+// Keyring encrypts and decrypts field values with the tenants' data keys,
+// creating a tenant's first key on demand. Unwrapped keys are kept in memory.
+type Keyring struct {
+	keyfile *Keyfile
+	store   KeyStore
+	now     func() time.Time
+
+	mu     sync.Mutex
+	aeads  map[string]cipher.AEAD
+	active map[string]activeKey
+}
+
+type activeKey struct {
+	id       string
+	loadedAt time.Time
+}
+
+// NewKeyring returns a keyring that unwraps the data keys in store with the
+// master keys in keyfile.
+func NewKeyring(keyfile *Keyfile, store KeyStore) *Keyring {
+	return &Keyring{
+		keyfile: keyfile,
+		store:   store,
+		now:     time.Now,
+		aeads:   map[string]cipher.AEAD{},
+		active:  map[string]activeKey{},
+	}
+}
+
+// IsEncrypted reports whether value is a field encrypted by a Keyring.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// KeyID returns the ID of the data key value was encrypted with, or "" if
+// value is not encrypted.
+func KeyID(value string) string {
+	if !IsEncrypted(value) {
+		return ""
+	}
+	id, _, _ := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	return id
+}
+
+// Encrypt encrypts plaintext with the tenant's active data key. aad names the
+// field the value belongs to, such as "schedules.client_name:<id>", so that a
+// value copied into another field or row fails to decrypt.
+func (k *Keyring) Encrypt(ctx context.Context, tenantID string, plaintext []byte, aad string) (string, error) {
+	keyID, err := k.ActiveKeyID(ctx, tenantID)
+	if err != nil {
+		return "", err
+	}
+	aead, err := k.aead(ctx, keyID)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("encryption: failed to generate nonce: %w", err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(aad))
+	return prefix + keyID + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value returned by Encrypt with the same aad. Plaintext
+// values are returned unchanged.
+func (k *Keyring) Decrypt(ctx context.Context, value, aad string) ([]byte, error) {
+	if !IsEncrypted(value) {
+		return []byte(value), nil
+	}
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, prefix), ":")
+	if !ok {
+		return nil, errors.New("encryption: malformed ciphertext")
+	}
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: malformed ciphertext: %w", err)
+	}
+	aead, err := k.aead(ctx, keyID)
+	if err != nil {
+		return nil, err
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encryption: malformed ciphertext")
+	}
+	plaintext, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(aad))
+	if err != nil {
+		return nil, fmt.Errorf("encryption: failed to decrypt %s: %w", aad, err)
+	}
+	return plaintext, nil
+}
+
+// BlindIndex returns a keyed hash of value for exact-match lookups on an
+// encrypted field. Equal values get equal indexes within a tenant, but the
+// index reveals nothing else about the value. Surrounding whitespace is
+// ignored.
+func (k *Keyring) BlindIndex(tenantID, value string) string {
+	tenantKey := hmac.New(sha256.New, k.keyfile.BlindIndexKey)
+	tenantKey.Write([]byte("bidx:" + tenantID))
+	mac := hmac.New(sha256.New, tenantKey.Sum(nil))
+	mac.Write([]byte(strings.TrimSpace(value)))
+	return hex.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// ActiveKeyID returns the ID of the tenant's active data key, creating the key
+// if the tenant has none yet.
+func (k *Keyring) ActiveKeyID(ctx context.Context, tenantID string) (string, error) {
+	k.mu.Lock()
+	cached, ok := k.active[tenantID]
+	k.mu.Unlock()
+	if ok && k.now().Sub(cached.loadedAt) < activeKeyTTL {
+		return cached.id, nil
+	}
+
+	key, err := k.store.ActiveDataKey(ctx, tenantID)
+	if err != nil {
+		return "", fmt.Errorf("encryption: failed to load the active data key of tenant %s: %w", tenantID, err)
+	}
+	if key == nil {
+		if key, err = k.createDataKey(ctx, tenantID); err != nil {
+			return "", err
+		}
+	}
+
+	k.mu.Lock()
+	k.active[tenantID] = activeKey{id: key.ID, loadedAt: k.now()}
+	k.mu.Unlock()
+	return key.ID, nil
+}
+
+// RotateDataKey retires the tenant's active data key and replaces it with a
+// new one. Values encrypted with the old key stay readable.
+func (k *Keyring) RotateDataKey(ctx context.Context, tenantID string) (string, error) {
+	if err := k.store.RetireDataKeys(ctx, tenantID); err != nil {
+		return "", fmt.Errorf("encryption: failed to retire the data keys of tenant %s: %w", tenantID, err)
+	}
+	k.mu.Lock()
+	delete(k.active, tenantID)
+	k.mu.Unlock()
+	return k.ActiveKeyID(ctx, tenantID)
+}
+
+// RewrapDataKeys wraps every data key that is not wrapped by the active
+// master key with it, so that older master keys can be removed from the
+// keyfile. It returns the number of keys rewrapped.
+func (k *Keyring) RewrapDataKeys(ctx context.Context) (int, error) {
+	keys, err := k.store.ListDataKeys(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("encryption: failed to list data keys: %w", err)
+	}
+	rewrapped := 0
+	for _, key := range keys {
+		if key.MasterKeyID == k.keyfile.ActiveMasterKey {
+			continue
+		}
+		raw, err := k.unwrap(key)
+		if err != nil {
+			return rewrapped, err
+		}
+		wrapped, err := k.wrap(key.ID, key.TenantID, raw)
+		if err != nil {
+			return rewrapped, err
+		}
+		if err := k.store.UpdateWrappedKey(ctx, key.ID, k.keyfile.ActiveMasterKey, wrapped); err != nil {
+			return rewrapped, fmt.Errorf("encryption: failed to store rewrapped data key %s: %w", key.ID, err)
+		}
+		rewrapped++
+	}
+	return rewrapped, nil
+}
+
+func (k *Keyring) createDataKey(ctx context.Context, tenantID string) (*DataKey, error) {
+	raw, err := randomKey()
+	if err != nil {
+		return nil, err
+	}
+	key := DataKey{
+		ID:          "dk-" + uuid.NewString(),
+		TenantID:    tenantID,
+		MasterKeyID: k.keyfile.ActiveMasterKey,
+		Status:      StatusActive,
+	}
+	if key.WrappedKey, err = k.wrap(key.ID, tenantID, raw); err != nil {
+		return nil, err
+	}
+	if err := k.store.CreateDataKey(ctx, key); err != nil {
+		// Another process may have created the tenant's key first; use theirs.
+		existing, lookupErr := k.store.ActiveDataKey(ctx, tenantID)
+		if lookupErr == nil && existing != nil {
+			return existing, nil
+		}
+		return nil, fmt.Errorf("encryption: failed to store a data key for tenant %s: %w", tenantID, err)
+	}
+	return &key, nil
+}
+
+// aead returns the cipher of a data key, unwrapping the key on first use.
+func (k *Keyring) aead(ctx context.Context, keyID string) (cipher.AEAD, error) {
+	k.mu.Lock()
+	aead, ok := k.aeads[keyID]
+	k.mu.Unlock()
+	if ok {
+		return aead, nil
+	}
+
+	key, err := k.store.DataKey(ctx, keyID)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: failed to load data key %s: %w", keyID, err)
+	}
+	raw, err := k.unwrap(*key)
+	if err != nil {
+		return nil, err
+	}
+	if aead, err = newAEAD(raw); err != nil {
+		return nil, err
+	}
+
+	k.mu.Lock()
+	k.aeads[keyID] = aead
+	k.mu.Unlock()
+	return aead, nil
+}
+
+// wrap encrypts a data key with the active master key, bound to its ID and
+// tenant.
+func (k *Keyring) wrap(keyID, tenantID string, raw []byte) (string, error) {
+	master, err := newAEAD(k.keyfile.MasterKeys[k.keyfile.ActiveMasterKey])
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, master.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", fmt.Errorf("encryption: failed to generate nonce: %w", err)
+	}
+	return encodeKey(master.Seal(nonce, nonce, raw, wrapAAD(keyID, tenantID))), nil
+}
+
+func (k *Keyring) unwrap(key DataKey) ([]byte, error) {
+	masterKey, ok := k.keyfile.MasterKeys[key.MasterKeyID]
+	if !ok {
+		return nil, fmt.Errorf("encryption: data key %s is wrapped by master key %s, which is not in the keyfile", key.ID, key.MasterKeyID)
+	}
+	master, err := newAEAD(masterKey)
+	if err != nil {
+		return nil, err
+	}
+	sealed, err := base64.StdEncoding.DecodeString(key.WrappedKey)
+	if err != nil || len(sealed) < master.NonceSize() {
+		return nil, fmt.Errorf("encryption: data key %s is malformed", key.ID)
+	}
+	raw, err := master.Open(nil, sealed[:master.NonceSize()], sealed[master.NonceSize():], wrapAAD(key.ID, key.TenantID))
+	if err != nil {
+		return nil, fmt.Errorf("encryption: failed to unwrap data key %s: %w", key.ID, err)
+	}
+	return raw, nil
+}
+
+func wrapAAD(keyID, tenantID string) []byte {
+	return []byte("dek:" + keyID + ":" + tenantID)
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,150 @@
+package events
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Sequenced is an event together with its position in the bus history. The
+// sequence number is what SSE clients send back as Last-Event-ID.
+type Sequenced struct {
+	Seq   uint64
+	Event Event
+}
+
+// Filter selects the events a subscriber is interested in. Empty fields match
+// everything, except TenantID: subscribers only ever see their own tenant's
+// events.
+type Filter struct {
+	TenantID    string
+	ClientID    string
+	CaregiverID string
+	// BranchIDs, when not nil, only matches events of these branches.
+	BranchIDs []string
+}
+
+func (f Filter) Matches(e Event) bool {
+	if f.TenantID != e.TenantID {
+		return false
+	}
+	if f.ClientID != "" && f.ClientID != e.ClientID {
+		return false
+	}
+	if f.CaregiverID != "" && f.CaregiverID != e.CaregiverID {
+		return false
+	}
+	if f.BranchIDs != nil && !contains(f.BranchIDs, e.BranchID) {
+		return false
+	}
+	return true
+}
+
+type subscriber struct {
+	filter Filter
+	ch     chan Sequenced
+}
+
+// Bus is an in-process publish/subscribe hub that keeps a bounded history so
+// subscribers can resume after a reconnect.
+type Bus struct {
+	mu          sync.Mutex
+	nextSeq     uint64
+	history     []Sequenced
+	historySize int
+	subscribers map[*subscriber]struct{}
+}
+
+func NewBus(historySize int) *Bus {
+	if historySize <= 0 {
+		historySize = 1024
+	}
+	return &Bus{
+		// Seeding from the clock keeps sequence numbers increasing across restarts,
+		// so a Last-Event-ID from a previous process is detected as a gap.
+		nextSeq:     uint64(time.Now().UnixNano()),
+		historySize: historySize,
+		subscribers: map[*subscriber]struct{}{},
+	}
+}
+
+// Publish never blocks. A subscriber whose buffer is full is disconnected and
+// is expected to reconnect with its last sequence number.
+func (b *Bus) Publish(ctx context.Context, event Event) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.nextSeq++
+	seq := Sequenced{Seq: b.nextSeq, Event: event}
+
+	b.history = append(b.history, seq)
+	if len(b.history) > b.historySize {
+		b.history = b.history[len(b.history)-b.historySize:]
+	}
+
+	for sub := range b.subscribers {
+		if !sub.filter.Matches(event) {
+			continue
+		}
+		select {
+		case sub.ch <- seq:
+		default:
+			delete(b.subscribers, sub)
+			close(sub.ch)
+		}
+	}
+	return nil
+}
+
+// Subscribe registers a subscriber and returns the buffered events after
+// lastSeq that match the filter. complete is false when lastSeq is older than
+// the retained history, meaning some events were lost and the caller should
+// reload its state. The returned channel is closed by cancel or when the
+// subscriber falls behind.
+func (b *Bus) Subscribe(filter Filter, lastSeq uint64, buffer int) (replay []Sequenced, complete bool, ch <-chan Sequenced, cancel func()) {
+	if buffer <= 0 {
+		buffer = 64
+	}
+	sub := &subscriber{filter: filter, ch: make(chan Sequenced, buffer)}
+
+	b.mu.Lock()
+	complete = true
+	if lastSeq > 0 {
+		oldest := b.nextSeq + 1
+		if len(b.history) > 0 {
+			oldest = b.history[0].Seq
+		}
+		if lastSeq+1 < oldest || lastSeq > b.nextSeq {
+			complete = false
+		}
+		for _, s := range b.history {
+			if s.Seq > lastSeq && filter.Matches(s.Event) {
+				replay = append(replay, s)
+			}
+		}
+	}
+	b.subscribers[sub] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	cancel = func() {
+		once.Do(func() {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			if _, ok := b.subscribers[sub]; ok {
+				delete(b.subscribers, sub)
+				close(sub.ch)
+			}
+		})
+	}
+	return replay, complete, sub.ch, cancel
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
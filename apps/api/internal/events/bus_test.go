@@ -0,0 +1,146 @@
+package events_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+)
+
+func TestBus_DeliversMatchingEvents(t *testing.T) {
+	bus := events.NewBus(10)
+	_, _, ch, cancel := bus.Subscribe(events.Filter{CaregiverID: "caregiver-001"}, 0, 10)
+	defer cancel()
+
+	bus.Publish(context.Background(), events.Event{ID: "evt-1", Type: events.VisitStarted, CaregiverID: "caregiver-002"})
+	bus.Publish(context.Background(), events.Event{ID: "evt-2", Type: events.VisitStarted, CaregiverID: "caregiver-001"})
+
+	select {
+	case got := <-ch:
+		if got.Event.ID != "evt-2" {
+			t.Errorf("Expected evt-2, got %s", got.Event.ID)
+		}
+	default:
+		t.Fatal("Expected an event to be delivered")
+	}
+	select {
+	case got := <-ch:
+		t.Errorf("Expected no further events, got %s", got.Event.ID)
+	default:
+	}
+}
+
+func TestBus_ReplaysAfterLastEventID(t *testing.T) {
+	bus := events.NewBus(10)
+	ctx := context.Background()
+
+	_, _, ch, cancel := bus.Subscribe(events.Filter{}, 0, 10)
+	bus.Publish(ctx, events.Event{ID: "evt-1", ClientID: "client-001"})
+	first := <-ch
+	cancel()
+
+	bus.Publish(ctx, events.Event{ID: "evt-2", ClientID: "client-002"})
+	bus.Publish(ctx, events.Event{ID: "evt-3", ClientID: "client-001"})
+
+	replay, complete, _, cancel := bus.Subscribe(events.Filter{ClientID: "client-001"}, first.Seq, 10)
+	defer cancel()
+
+	if !complete {
+		t.Error("Expected the replay to be complete")
+	}
+	if len(replay) != 1 || replay[0].Event.ID != "evt-3" {
+		t.Errorf("Expected only evt-3 to be replayed, got %+v", replay)
+	}
+}
+
+func TestBus_ReportsGapWhenHistoryIsGone(t *testing.T) {
+	bus := events.NewBus(2)
+	ctx := context.Background()
+
+	_, _, ch, cancel := bus.Subscribe(events.Filter{}, 0, 10)
+	bus.Publish(ctx, events.Event{ID: "evt-1"})
+	first := <-ch
+	cancel()
+
+	for _, id := range []string{"evt-2", "evt-3", "evt-4"} {
+		bus.Publish(ctx, events.Event{ID: id})
+	}
+
+	replay, complete, _, cancel := bus.Subscribe(events.Filter{}, first.Seq, 10)
+	defer cancel()
+
+	if complete {
+		t.Error("Expected a gap to be reported")
+	}
+	if len(replay) != 2 || replay[0].Event.ID != "evt-3" {
+		t.Errorf("Expected the retained history to be replayed, got %+v", replay)
+	}
+}
+
+func TestBus_DropsSlowSubscribers(t *testing.T) {
+	bus := events.NewBus(10)
+	_, _, ch, cancel := bus.Subscribe(events.Filter{}, 0, 1)
+	defer cancel()
+
+	bus.Publish(context.Background(), events.Event{ID: "evt-1"})
+	bus.Publish(context.Background(), events.Event{ID: "evt-2"})
+
+	<-ch
+	if _, ok := <-ch; ok {
+		t.Error("Expected the channel to be closed after the subscriber fell behind")
+	}
+}
+
+func TestBus_KeepsTenantsApart(t *testing.T) {
+	bus := events.NewBus(10)
+	_, _, ch, cancel := bus.Subscribe(events.Filter{TenantID: "agency-a"}, 0, 10)
+	defer cancel()
+
+	bus.Publish(context.Background(), events.Event{ID: "evt-1", Type: events.VisitStarted, TenantID: "agency-b"})
+	bus.Publish(context.Background(), events.Event{ID: "evt-2", Type: events.VisitStarted})
+	bus.Publish(context.Background(), events.Event{ID: "evt-3", Type: events.VisitStarted, TenantID: "agency-a"})
+
+	select {
+	case got := <-ch:
+		if got.Event.ID != "evt-3" {
+			t.Errorf("Expected only agency-a's evt-3, got %s", got.Event.ID)
+		}
+	default:
+		t.Fatal("Expected agency-a's event to be delivered")
+	}
+	select {
+	case got := <-ch:
+		t.Errorf("Expected no other tenant's events, got %s", got.Event.ID)
+	default:
+	}
+
+	replay, _, _, cancelReplay := bus.Subscribe(events.Filter{TenantID: "agency-a"}, 1, 10)
+	defer cancelReplay()
+	if len(replay) != 1 || replay[0].Event.ID != "evt-3" {
+		t.Errorf("Expected the replay to hold only agency-a's evt-3, got %+v", replay)
+	}
+}
+
+func TestBus_FiltersByBranch(t *testing.T) {
+	bus := events.NewBus(10)
+	_, _, ch, cancel := bus.Subscribe(events.Filter{BranchIDs: []string{"branch-a"}}, 0, 10)
+	defer cancel()
+
+	bus.Publish(context.Background(), events.Event{ID: "evt-1", Type: events.VisitStarted, BranchID: "branch-b"})
+	bus.Publish(context.Background(), events.Event{ID: "evt-2", Type: events.VisitStarted})
+	bus.Publish(context.Background(), events.Event{ID: "evt-3", Type: events.VisitStarted, BranchID: "branch-a"})
+
+	select {
+	case got := <-ch:
+		if got.Event.ID != "evt-3" {
+			t.Errorf("Expected only branch-a's evt-3, got %s", got.Event.ID)
+		}
+	default:
+		t.Fatal("Expected branch-a's event to be delivered")
+	}
+	select {
+	case got := <-ch:
+		t.Errorf("Expected no other branch's events, got %s", got.Event.ID)
+	default:
+	}
+}
@@ -0,0 +1,67 @@
+package events
+
+import (
+	"context"
+	"time"
+)
+
+type Type string
+
+const (
+	VisitStarted   Type = "visit.started"
+	VisitCompleted Type = "visit.completed"
+	TaskUpdated    Type = "task.updated"
+	VisitMissed    Type = "visit.missed"
+)
+
+// Types lists every event type the service layer can emit.
+var Types = []Type{VisitStarted, VisitCompleted, TaskUpdated, VisitMissed}
+
+func IsValidType(t string) bool {
+	for _, known := range Types {
+		if string(known) == t {
+			return true
+		}
+	}
+	return false
+}
+
+type Event struct {
+	ID          string      `json:"id"`
+	Type        Type        `json:"type"`
+	OccurredAt  time.Time   `json:"occurred_at"`
+	TenantID    string      `json:"tenant_id,omitempty"`
+	ScheduleID  string      `json:"schedule_id"`
+	ClientID    string      `json:"client_id,omitempty"`
+	CaregiverID string      `json:"caregiver_id,omitempty"`
+	BranchID    string      `json:"branch_id,omitempty"`
+	TaskID      string      `json:"task_id,omitempty"`
+	Data        interface{} `json:"data,omitempty"`
+}
+
+// Publisher receives visit lifecycle events after the change has been persisted.
+type Publisher interface {
+	Publish(ctx context.Context, event Event) error
+}
+
+// VisitData is the payload of visit.* events. Location and client details are
+// deliberately left out; receivers fetch the schedule if they need them.
+type VisitData struct {
+	Status         string     `json:"status"`
+	ScheduledStart *time.Time `json:"scheduled_start,omitempty"`
+	ScheduledEnd   *time.Time `json:"scheduled_end,omitempty"`
+	VisitStart     *time.Time `json:"visit_start,omitempty"`
+	VisitEnd       *time.Time `json:"visit_end,omitempty"`
+	// The visit times rounded by the tenant's rounding rule, for billing and
+	// payroll. Only set when the tenant rounds.
+	RoundedVisitStart *time.Time `json:"rounded_visit_start,omitempty"`
+	RoundedVisitEnd   *time.Time `json:"rounded_visit_end,omitempty"`
+}
+
+type TaskData struct {
+	Completed   bool    `json:"completed"`
+	ReasonCode  *string `json:"reason_code,omitempty"`
+	Reason      *string `json:"reason,omitempty"`
+	CompletedBy *string `json:"completed_by,omitempty"`
+	AdHoc       bool    `json:"ad_hoc,omitempty"`
+}
@@ -0,0 +1,107 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type APIKeyHandler struct {
+	apiKeyService service.APIKeyService
+}
+
+func NewAPIKeyHandler(s service.APIKeyService) *APIKeyHandler {
+	return &APIKeyHandler{apiKeyService: s}
+}
+
+type CreateAPIKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+	// ExpiresAt is optional; keys without one do not expire.
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// RateLimitPerMinute is optional; zero uses the API's default.
+	RateLimitPerMinute int `json:"rate_limit_per_minute,omitempty"`
+}
+
+// @Summary List API keys
+// @Description Get the agency's API keys, including revoked and expired ones. The keys themselves are never returned, only their prefix.
+// @Produce json
+// @Success 200 {array} models.APIKey "Successfully retrieved API keys"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /api-keys [get]
+func (h *APIKeyHandler) GetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	keys, err := h.apiKeyService.GetAPIKeys(ctx)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// @Summary Create an API key
+// @Description Create an API key for another system, with scopes read:schedules, write:visits and export:billing. The response contains the key; it is not shown again. Only admins can create keys.
+// @Accept json
+// @Produce json
+// @Param request body CreateAPIKeyRequest true "API key details"
+// @Success 201 {object} models.APIKey "API key created"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /api-keys [post]
+func (h *APIKeyHandler) CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req CreateAPIKeyRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	key, err := h.apiKeyService.CreateAPIKey(ctx, models.APIKey{
+		Name:               req.Name,
+		Scopes:             req.Scopes,
+		ExpiresAt:          req.ExpiresAt,
+		RateLimitPerMinute: req.RateLimitPerMinute,
+	})
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(key)
+}
+
+// @Summary Revoke an API key
+// @Description Revoke an API key. Requests made with it are refused from then on.
+// @Produce json
+// @Param id path string true "API key ID"
+// @Success 200 {object} map[string]string "API key revoked"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "API key not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /api-keys/{id} [delete]
+func (h *APIKeyHandler) RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if err := h.apiKeyService.RevokeAPIKey(ctx, mux.Vars(r)["id"]); err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "API key revoked successfully"})
+}
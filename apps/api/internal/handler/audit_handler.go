@@ -0,0 +1,67 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+)
+
+type AuditHandler struct {
+	store audit.Store
+}
+
+func NewAuditHandler(store audit.Store) *AuditHandler {
+	return &AuditHandler{store: store}
+}
+
+// @Summary List PHI access records for a client
+// @Description Get who was shown a client's PHI, newest first: the actor and purpose of use, the route, the schedules and the PHI fields each response contained. Only admins and privacy officers may list them.
+// @Produce json
+// @Param client_id query string true "Client whose access records to list"
+// @Param limit query int false "Maximum number of records (default 100, max 1000)"
+// @Success 200 {array} audit.Record "Successfully retrieved access records"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /audit/access [get]
+func (h *AuditHandler) GetAccessRecords(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	if !auth.HasRole(ctx, auth.RoleAdmin, auth.RolePrivacyOfficer) {
+		http.Error(w, "only admins and privacy officers may read the access log", http.StatusForbidden)
+		return
+	}
+
+	clientID := r.URL.Query().Get("client_id")
+	if clientID == "" {
+		http.Error(w, "client_id is required", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if raw := r.URL.Query().Get("limit"); raw != "" {
+		parsed, err := strconv.Atoi(raw)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(parsed, 1000)
+	}
+
+	records, err := h.store.ListByClient(ctx, clientID, limit)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+	if records == nil {
+		records = []audit.Record{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(records)
+}
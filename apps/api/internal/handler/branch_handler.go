@@ -0,0 +1,204 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type BranchHandler struct {
+	branchService service.BranchService
+}
+
+func NewBranchHandler(s service.BranchService) *BranchHandler {
+	return &BranchHandler{branchService: s}
+}
+
+type CreateRegionRequest struct {
+	Name string `json:"name"`
+}
+
+type CreateBranchRequest struct {
+	Name     string  `json:"name"`
+	RegionID *string `json:"region_id,omitempty"`
+}
+
+// @Summary List regions
+// @Description Get the service regions of the agency.
+// @Produce json
+// @Success 200 {array} models.Region "Successfully retrieved regions"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /regions [get]
+func (h *BranchHandler) GetRegions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	regions, err := h.branchService.GetRegions(ctx)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(regions)
+}
+
+// @Summary Create a region
+// @Description Create a service region to group branch offices. Admins only.
+// @Accept json
+// @Produce json
+// @Param request body CreateRegionRequest true "Region details"
+// @Success 201 {object} models.Region "Region created"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /regions [post]
+func (h *BranchHandler) CreateRegion(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req CreateRegionRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	region, err := h.branchService.CreateRegion(ctx, req.Name)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(region)
+}
+
+// @Summary List branches
+// @Description Get the branch offices of the agency, or of one region. Supervisors only get the branches they are assigned to.
+// @Produce json
+// @Param region_id query string false "Only branches of this region"
+// @Success 200 {array} models.Branch "Successfully retrieved branches"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /branches [get]
+func (h *BranchHandler) GetBranches(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	branches, err := h.branchService.GetBranches(ctx, r.URL.Query().Get("region_id"))
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branches)
+}
+
+// @Summary Create a branch
+// @Description Create a branch office, optionally in a region. Admins only.
+// @Accept json
+// @Produce json
+// @Param request body CreateBranchRequest true "Branch details"
+// @Success 201 {object} models.Branch "Branch created"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /branches [post]
+func (h *BranchHandler) CreateBranch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req CreateBranchRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	branch, err := h.branchService.CreateBranch(ctx, req.Name, req.RegionID)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(branch)
+}
+
+// @Summary Get a branch
+// @Description Get a branch office with the IDs of its clients, caregivers and supervisors.
+// @Produce json
+// @Param id path string true "Branch ID"
+// @Success 200 {object} models.Branch "Successfully retrieved branch"
+// @Failure 404 {object} map[string]string "Branch not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /branches/{id} [get]
+func (h *BranchHandler) GetBranch(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	branch, err := h.branchService.GetBranch(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(branch)
+}
+
+// @Summary Assign a branch member
+// @Description Assign a client, caregiver or supervisor (Supabase user ID) to a branch. A client belongs to one branch, so assigning it moves it and its visits from its previous branch. Admins only.
+// @Produce json
+// @Param id path string true "Branch ID"
+// @Param kind path string true "Kind of member" Enums(clients, caregivers, supervisors)
+// @Param memberId path string true "Client, caregiver or user ID"
+// @Success 200 {object} map[string]string "Member assigned"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Branch not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /branches/{id}/{kind}/{memberId} [put]
+func (h *BranchHandler) AssignMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	if err := h.branchService.AssignMember(ctx, vars["id"], vars["kind"], vars["memberId"]); err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member assigned successfully"})
+}
+
+// @Summary Unassign a branch member
+// @Description Remove a client, caregiver or supervisor from a branch. The visits of a removed client no longer belong to any branch. Admins only.
+// @Produce json
+// @Param id path string true "Branch ID"
+// @Param kind path string true "Kind of member" Enums(clients, caregivers, supervisors)
+// @Param memberId path string true "Client, caregiver or user ID"
+// @Success 200 {object} map[string]string "Member unassigned"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Branch or member not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /branches/{id}/{kind}/{memberId} [delete]
+func (h *BranchHandler) UnassignMember(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	vars := mux.Vars(r)
+	if err := h.branchService.UnassignMember(ctx, vars["id"], vars["kind"], vars["memberId"]); err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Member unassigned successfully"})
+}
@@ -0,0 +1,169 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type CarePlanHandler struct {
+	carePlanService service.CarePlanService
+}
+
+func NewCarePlanHandler(s service.CarePlanService) *CarePlanHandler {
+	return &CarePlanHandler{carePlanService: s}
+}
+
+type TaskTemplateRequest struct {
+	Description string  `json:"description"`
+	Category    string  `json:"category"`            // ADL/IADL code, e.g. adl.bathing or iadl.meal_preparation
+	Frequency   string  `json:"frequency,omitempty"` // every_visit (default), mon_wed_fri or weekly
+	Weekday     *string `json:"weekday,omitempty"`   // Required for weekly templates, e.g. "monday"
+	Required    *bool   `json:"required,omitempty"`  // Defaults to true
+}
+
+type CreateCarePlanRequest struct {
+	ClientID  string                `json:"client_id"`
+	Name      string                `json:"name"`
+	Templates []TaskTemplateRequest `json:"templates"`
+}
+
+type ReplaceTemplatesRequest struct {
+	Templates []TaskTemplateRequest `json:"templates"`
+}
+
+func (req TaskTemplateRequest) toModel() models.TaskTemplate {
+	required := true
+	if req.Required != nil {
+		required = *req.Required
+	}
+	return models.TaskTemplate{
+		Description: req.Description,
+		Category:    req.Category,
+		Frequency:   req.Frequency,
+		Weekday:     req.Weekday,
+		Required:    required,
+	}
+}
+
+func templatesFromRequest(reqs []TaskTemplateRequest) []models.TaskTemplate {
+	templates := make([]models.TaskTemplate, len(reqs))
+	for i, req := range reqs {
+		templates[i] = req.toModel()
+	}
+	return templates
+}
+
+// @Summary Create a care plan
+// @Description Create the client's active care plan from task templates. Any previously active plan for the client is retired, and the client's upcoming scheduled visits are re-planned from the new templates.
+// @Accept json
+// @Produce json
+// @Param request body CreateCarePlanRequest true "Care plan details"
+// @Success 201 {object} models.CarePlan "Care plan created"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 404 {object} map[string]string "Client not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /care-plans [post]
+func (h *CarePlanHandler) CreateCarePlan(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req CreateCarePlanRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	plan, err := h.carePlanService.CreateCarePlan(ctx, models.CarePlan{
+		ClientID:  req.ClientID,
+		Name:      req.Name,
+		Templates: templatesFromRequest(req.Templates),
+	})
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(plan)
+}
+
+// @Summary Get a care plan
+// @Description Get a care plan and its task templates by ID.
+// @Produce json
+// @Param id path string true "Care plan ID"
+// @Success 200 {object} models.CarePlan "Successfully retrieved care plan"
+// @Failure 404 {object} map[string]string "Care plan not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /care-plans/{id} [get]
+func (h *CarePlanHandler) GetCarePlan(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	plan, err := h.carePlanService.GetCarePlan(ctx, mux.Vars(r)["id"])
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// @Summary Get a client's active care plan
+// @Description Get the care plan new visits for the client are planned from.
+// @Produce json
+// @Param clientId path string true "Client ID"
+// @Success 200 {object} models.CarePlan "Successfully retrieved care plan"
+// @Failure 404 {object} map[string]string "Client has no active care plan"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /clients/{clientId}/care-plan [get]
+func (h *CarePlanHandler) GetActiveCarePlan(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	plan, err := h.carePlanService.GetActiveCarePlan(ctx, mux.Vars(r)["clientId"])
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
+
+// @Summary Replace care plan task templates
+// @Description Replace all task templates of an active care plan. Visits that have started or are in the past keep their tasks; upcoming scheduled visits are re-planned. Tasks added to a visit by hand are kept.
+// @Accept json
+// @Produce json
+// @Param id path string true "Care plan ID"
+// @Param request body ReplaceTemplatesRequest true "New task templates"
+// @Success 200 {object} models.CarePlan "Templates replaced"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 404 {object} map[string]string "Care plan not found"
+// @Failure 409 {object} map[string]string "Care plan is no longer active"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /care-plans/{id}/templates [put]
+func (h *CarePlanHandler) ReplaceTemplates(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 10*time.Second)
+	defer cancel()
+
+	var req ReplaceTemplatesRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	plan, err := h.carePlanService.ReplaceTemplates(ctx, mux.Vars(r)["id"], templatesFromRequest(req.Templates))
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plan)
+}
@@ -0,0 +1,58 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+// writeJSONWithETag writes v with a strong ETag, or answers 304 Not Modified
+// when the request's If-None-Match already names that ETag. The response may
+// be kept by the client, but only for revalidation, and never by a shared
+// cache since it holds PHI.
+func writeJSONWithETag(w http.ResponseWriter, r *http.Request, v interface{}) {
+	etag, err := service.ETag(v)
+	if err != nil {
+		writeError(w, r, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Cache-Control", "no-cache, private")
+	for _, candidate := range requestETags(r, "If-None-Match") {
+		// If-None-Match uses the weak comparison, which ignores the W/ prefix.
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == etag {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
+
+// withIfMatch makes the schedule changes made with ctx conditional on the
+// request's If-Match header, if it has one.
+func withIfMatch(ctx context.Context, r *http.Request) context.Context {
+	if etags := requestETags(r, "If-Match"); len(etags) > 0 {
+		return service.WithIfMatch(ctx, etags)
+	}
+	return ctx
+}
+
+// requestETags returns the entity tags listed in the named header, which may
+// be repeated and hold comma-separated lists.
+func requestETags(r *http.Request, header string) []string {
+	var etags []string
+	for _, value := range r.Header.Values(header) {
+		for _, etag := range strings.Split(value, ",") {
+			if etag = strings.TrimSpace(etag); etag != "" {
+				etags = append(etags, etag)
+			}
+		}
+	}
+	return etags
+}
@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+)
+
+// decodeJSON decodes the request body into dst, rejecting unknown fields and
+// trailing data. On failure it writes the error response and returns false.
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) bool {
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	err := decoder.Decode(dst)
+	if err == nil && decoder.Decode(&struct{}{}) != io.EOF {
+		err = errors.New("unexpected data after JSON object")
+	}
+	if err == nil {
+		return true
+	}
+
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return false
+	}
+	if errors.Is(err, io.EOF) {
+		http.Error(w, "Invalid request body: body is empty", http.StatusBadRequest)
+		return false
+	}
+	http.Error(w, "Invalid request body: "+err.Error(), http.StatusBadRequest)
+	return false
+}
+
+// writeError writes err as the response. Server errors are logged and answered
+// with a generic message, since their text can echo datastore responses.
+func writeError(w http.ResponseWriter, r *http.Request, err error, status int) {
+	if status >= http.StatusInternalServerError {
+		slog.ErrorContext(r.Context(), "request failed", "error", err)
+		http.Error(w, http.StatusText(status), status)
+		return
+	}
+	http.Error(w, err.Error(), status)
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type RetentionHandler struct {
+	retentionService service.RetentionService
+}
+
+func NewRetentionHandler(s service.RetentionService) *RetentionHandler {
+	return &RetentionHandler{retentionService: s}
+}
+
+type PlaceLegalHoldRequest struct {
+	ClientID string `json:"client_id"`
+	Reason   string `json:"reason"`
+}
+
+// @Summary Preview the retention purge
+// @Description Count, per data class, the rows a purge would delete or anonymize now. Nothing is changed. Clients on legal hold are excluded.
+// @Produce json
+// @Success 200 {object} models.RetentionReport "Dry-run report"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /retention/report [get]
+func (h *RetentionHandler) GetReport(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	defer cancel()
+
+	report, err := h.retentionService.Purge(ctx, true)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// @Summary Run the retention purge
+// @Description Delete or anonymize every row older than its data class's retention period, except for clients on legal hold. Meant for schedulers in environments without a background worker (e.g. Vercel cron).
+// @Produce json
+// @Param dry_run query bool false "Only report what would be purged"
+// @Success 200 {object} models.RetentionReport "Purge report"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /retention/purge [post]
+func (h *RetentionHandler) Purge(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	defer cancel()
+
+	dryRun := false
+	switch r.URL.Query().Get("dry_run") {
+	case "", "false":
+	case "true":
+		dryRun = true
+	default:
+		http.Error(w, "dry_run must be true or false", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.retentionService.Purge(ctx, dryRun)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// @Summary Scrub visit locations
+// @Description Coarsen or drop the clock-in and clock-out coordinates of completed visits that passed the geofence check or are old enough, keeping the verification result and distance. Each scrub is recorded in the PHI access log. Clients on legal hold are skipped. Meant for schedulers in environments without a background worker (e.g. Vercel cron). Admins and privacy officers only.
+// @Produce json
+// @Success 200 {object} models.LocationScrubReport "Scrub report"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /retention/locations/scrub [post]
+func (h *RetentionHandler) ScrubLocations(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	defer cancel()
+
+	report, err := h.retentionService.ScrubLocations(ctx)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// @Summary List legal holds
+// @Description Get the clients whose data is exempt from retention.
+// @Produce json
+// @Success 200 {array} models.LegalHold "Successfully retrieved legal holds"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /retention/holds [get]
+func (h *RetentionHandler) GetLegalHolds(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	holds, err := h.retentionService.GetLegalHolds(ctx)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(holds)
+}
+
+// @Summary Place a legal hold
+// @Description Exempt all data of a client from retention until the hold is released. Placing a hold on a client that already has one replaces its reason. The caller is recorded as placed_by. Admins and privacy officers only.
+// @Accept json
+// @Produce json
+// @Param request body PlaceLegalHoldRequest true "Hold details"
+// @Success 201 {object} models.LegalHold "Legal hold placed"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /retention/holds [post]
+func (h *RetentionHandler) PlaceLegalHold(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req PlaceLegalHoldRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	hold, err := h.retentionService.PlaceLegalHold(ctx, req.ClientID, req.Reason)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(hold)
+}
+
+// @Summary Release a legal hold
+// @Description Make a client's data subject to retention again. Data already past its retention period is purged on the next run.
+// @Produce json
+// @Param clientId path string true "Client ID"
+// @Success 200 {object} map[string]string "Legal hold released"
+// @Failure 404 {object} map[string]string "Legal hold not found"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /retention/holds/{clientId} [delete]
+func (h *RetentionHandler) ReleaseLegalHold(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	clientID := mux.Vars(r)["clientId"]
+
+	if err := h.retentionService.ReleaseLegalHold(ctx, clientID); err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Legal hold released successfully"})
+}
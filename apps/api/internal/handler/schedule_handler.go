@@ -3,11 +3,16 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http" // For parsing float64
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
 	"github.com/gorilla/mux"
 )
 
@@ -20,29 +25,94 @@ func NewScheduleHandler(s service.ScheduleService) *ScheduleHandler {
 }
 
 // @Summary Get all schedules
-// @Description Get a list of all schedules with their associated tasks.
+// @Description Get a page of schedules with their associated tasks, ordered by scheduled start. Pass the returned next_cursor as cursor to get the following page; it is null on the last page.
 // @Produce json
-// @Success 200 {array} models.Schedule "Successfully retrieved schedules"
+// @Param If-None-Match header string false "ETag from an earlier response"
+// @Param limit query int false "Page size (default 50, max 200)"
+// @Param cursor query string false "next_cursor from the previous page"
+// @Param status query string false "Comma-separated statuses (scheduled, in_progress, completed, cancelled)"
+// @Param client_id query string false "Only schedules for this client"
+// @Param client_name query string false "Only schedules whose client name is exactly this"
+// @Param caregiver_id query string false "Only schedules for this caregiver"
+// @Param branch_id query string false "Comma-separated branch IDs; supervisors get their own branches by default"
+// @Param from query string false "First shift date to include (YYYY-MM-DD)"
+// @Param to query string false "Last shift date to include (YYYY-MM-DD)"
+// @Param sort query string false "scheduled_start (default) or -scheduled_start for newest first" Enums(scheduled_start, -scheduled_start)
+// @Success 200 {object} models.SchedulePage "Successfully retrieved schedules"
+// @Header 200 {string} ETag "Strong entity tag of the response body"
+// @Success 304 "Not modified since the If-None-Match ETag"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Branch not assigned to the supervisor"
 // @Failure 500 {object} map[string]string "Internal Server Error"
 // @Router /schedules [get]
 func (h *ScheduleHandler) GetSchedules(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	schedules, err := h.scheduleService.GetSchedules(ctx)
+	params := r.URL.Query()
+	query := models.ScheduleListQuery{
+		ClientID:    params.Get("client_id"),
+		ClientName:  strings.TrimSpace(params.Get("client_name")),
+		CaregiverID: params.Get("caregiver_id"),
+	}
+
+	if limit := params.Get("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		query.Limit = parsed
+	}
+	if status := params.Get("status"); status != "" {
+		query.Statuses = strings.Split(status, ",")
+	}
+	if branchID := params.Get("branch_id"); branchID != "" {
+		query.BranchIDs = strings.Split(branchID, ",")
+	}
+	switch params.Get("sort") {
+	case "", "scheduled_start":
+	case "-scheduled_start":
+		query.Descending = true
+	default:
+		http.Error(w, "sort must be scheduled_start or -scheduled_start", http.StatusBadRequest)
+		return
+	}
+	if cursor := params.Get("cursor"); cursor != "" {
+		decoded, err := service.DecodeScheduleCursor(cursor)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		query.Cursor = decoded
+	}
+
+	var err error
+	if query.From, err = parseDateParam(r, "from"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.To, err = parseDateParam(r, "to"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	page, err := h.scheduleService.GetSchedules(ctx, query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, statusForError(err))
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(schedules)
+	writeJSONWithETag(w, r, page)
 }
 
 // @Summary Get today's schedules
 // @Description Get a list of all schedules (for demo purposes, returns all schedules).
 // @Produce json
+// @Param If-None-Match header string false "ETag from an earlier response"
 // @Success 200 {array} models.Schedule "Successfully retrieved today's schedules"
+// @Header 200 {string} ETag "Strong entity tag of the response body"
+// @Success 304 "Not modified since the If-None-Match ETag"
 // @Failure 500 {object} map[string]string "Internal Server Error"
 // @Router /schedules/today [get]
 func (h *ScheduleHandler) GetTodaySchedules(w http.ResponseWriter, r *http.Request) {
@@ -51,19 +121,21 @@ func (h *ScheduleHandler) GetTodaySchedules(w http.ResponseWriter, r *http.Reque
 
 	schedules, err := h.scheduleService.GetTodaySchedules(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(schedules)
+	writeJSONWithETag(w, r, schedules)
 }
 
 // @Summary Get schedule by ID
 // @Description Get a single schedule by its ID, including its tasks.
 // @Produce json
+// @Param If-None-Match header string false "ETag from an earlier response"
 // @Param id path string true "Schedule ID"
 // @Success 200 {object} models.Schedule "Successfully retrieved schedule"
+// @Header 200 {string} ETag "Strong entity tag of the response body"
+// @Success 304 "Not modified since the If-None-Match ETag"
 // @Failure 404 {object} map[string]string "Schedule not found"
 // @Failure 500 {object} map[string]string "Internal Server Error"
 // @Router /schedules/{id} [get]
@@ -76,15 +148,64 @@ func (h *ScheduleHandler) GetScheduleByID(w http.ResponseWriter, r *http.Request
 
 	schedule, err := h.scheduleService.GetScheduleByID(ctx, id)
 	if err != nil {
-		if err.Error() == fmt.Sprintf("schedule with ID %s not found", id) { // Simple check for not found
-			http.Error(w, err.Error(), http.StatusNotFound)
-			return
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	writeJSONWithETag(w, r, schedule)
+}
+
+type CreateScheduleRequest struct {
+	ClientID     string          `json:"client_id"`
+	ClientName   string          `json:"client_name"`
+	ClientAvatar string          `json:"client_avatar,omitempty"`
+	CaregiverID  string          `json:"caregiver_id,omitempty"`
+	ServiceName  string          `json:"service_name"`
+	Location     models.Location `json:"location"`
+	ShiftDate    string          `json:"shift_date"` // YYYY-MM-DD
+	StartTime    string          `json:"start_time"` // HH:MM
+	EndTime      string          `json:"end_time"`   // HH:MM
+	ServiceNotes string          `json:"service_notes,omitempty"`
+}
+
+// @Summary Create a schedule
+// @Description Schedule a new visit. Its tasks are generated from the client's active care plan, taking each template's frequency into account.
+// @Accept json
+// @Produce json
+// @Param request body CreateScheduleRequest true "Schedule details"
+// @Success 201 {object} models.Schedule "Schedule created"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 404 {object} map[string]string "Client not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /schedules [post]
+func (h *ScheduleHandler) CreateSchedule(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req CreateScheduleRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	schedule, err := h.scheduleService.CreateSchedule(ctx, models.Schedule{
+		ClientID:     req.ClientID,
+		ClientName:   req.ClientName,
+		ClientAvatar: req.ClientAvatar,
+		CaregiverID:  req.CaregiverID,
+		ServiceName:  req.ServiceName,
+		Location:     req.Location,
+		ShiftDate:    req.ShiftDate,
+		StartTime:    req.StartTime,
+		EndTime:      req.EndTime,
+		ServiceNotes: req.ServiceNotes,
+	})
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(schedule)
 }
 
@@ -99,22 +220,24 @@ type StartVisitRequest struct {
 // @Accept json
 // @Produce json
 // @Param id path string true "Schedule ID"
+// @Param If-Match header string false "ETag of the schedule the change is based on"
 // @Param request body StartVisitRequest true "Start visit details"
 // @Success 200 {object} map[string]string "Visit started successfully"
 // @Failure 400 {object} map[string]string "Bad Request"
 // @Failure 409 {object} map[string]string "Conflict (e.g., visit already in progress)"
+// @Failure 412 {object} map[string]string "Schedule changed since the If-Match ETag"
 // @Failure 500 {object} map[string]string "Internal Server Error"
 // @Router /schedules/{id}/start [post]
 func (h *ScheduleHandler) StartVisit(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
+	ctx = withIfMatch(ctx, r)
 
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	var req StartVisitRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -129,7 +252,7 @@ func (h *ScheduleHandler) StartVisit(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, "Visit already in progress or completed", http.StatusConflict)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, statusForError(err))
 		return
 	}
 
@@ -143,27 +266,34 @@ type EndVisitRequest struct {
 	Address   string  `json:"address"`
 }
 
+type OutstandingTasksResponse struct {
+	Error              string   `json:"error"`
+	OutstandingTaskIDs []string `json:"outstanding_task_ids"`
+}
+
 // @Summary End a visit
-// @Description Log the end time and location for a schedule.
+// @Description Log the end time and location for a schedule. Refused while a required task is neither completed nor given a reason; the response then lists the outstanding task IDs.
 // @Accept json
 // @Produce json
 // @Param id path string true "Schedule ID"
+// @Param If-Match header string false "ETag of the schedule the change is based on"
 // @Param request body EndVisitRequest true "End visit details"
 // @Success 200 {object} map[string]string "Visit ended successfully"
 // @Failure 400 {object} map[string]string "Bad Request"
-// @Failure 409 {object} map[string]string "Conflict (e.g., visit not in progress)"
+// @Failure 409 {object} OutstandingTasksResponse "Conflict (visit not in progress, or required tasks are unresolved)"
+// @Failure 412 {object} map[string]string "Schedule changed since the If-Match ETag"
 // @Failure 500 {object} map[string]string "Internal Server Error"
 // @Router /schedules/{id}/end [post]
 func (h *ScheduleHandler) EndVisit(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
+	ctx = withIfMatch(ctx, r)
 
 	vars := mux.Vars(r)
 	id := vars["id"]
 
 	var req EndVisitRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
 		return
 	}
 
@@ -174,11 +304,21 @@ func (h *ScheduleHandler) EndVisit(w http.ResponseWriter, r *http.Request) {
 
 	err := h.scheduleService.EndVisit(ctx, id, req.Latitude, req.Longitude, req.Address)
 	if err != nil {
+		var outstanding *service.OutstandingTasksError
+		if errors.As(err, &outstanding) {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusConflict)
+			json.NewEncoder(w).Encode(OutstandingTasksResponse{
+				Error:              "Required tasks must be completed or given a reason before clock-out",
+				OutstandingTaskIDs: outstanding.TaskIDs,
+			})
+			return
+		}
 		if err.Error() == fmt.Sprintf("service: cannot end visit for schedule %s with status scheduled", id) { // Example conflict check
 			http.Error(w, "Visit not in progress", http.StatusConflict)
 			return
 		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, statusForError(err))
 		return
 	}
 
@@ -187,62 +327,187 @@ func (h *ScheduleHandler) EndVisit(w http.ResponseWriter, r *http.Request) {
 }
 
 type UpdateTaskStatusRequest struct {
-	Completed bool    `json:"completed"`
-	Reason    *string `json:"reason,omitempty"` // Optional reason
+	Completed   bool    `json:"completed"`
+	ReasonCode  *string `json:"reason_code,omitempty"`  // Required if not completed, e.g. client_declined
+	Reason      *string `json:"reason,omitempty"`       // Optional note; required with reason_code "other"
+	CompletedBy string  `json:"completed_by,omitempty"` // Defaults to the visit's caregiver
 }
 
 // @Summary Update task status
-// @Description Update the completion status of a specific task.
+// @Description Update the completion status of a specific task. Tasks that were not completed need a reason_code (client_declined, client_unavailable, not_needed, insufficient_time, unsafe_conditions, supplies_unavailable or other). Tasks can only be updated while the visit is in progress or shortly after it ended.
 // @Accept json
 // @Produce json
 // @Param taskId path string true "Task ID"
+// @Param If-Match header string false "ETag of the schedule the change is based on"
 // @Param request body UpdateTaskStatusRequest true "Task update details"
 // @Success 200 {object} map[string]string "Task status updated successfully"
 // @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 404 {object} map[string]string "Task not found"
+// @Failure 409 {object} map[string]string "Visit not in progress or past the update grace window"
+// @Failure 412 {object} map[string]string "Schedule changed since the If-Match ETag"
 // @Failure 500 {object} map[string]string "Internal Server Error"
 // @Router /tasks/{taskId}/update [post]
 func (h *ScheduleHandler) UpdateTaskStatus(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
+	ctx = withIfMatch(ctx, r)
 
 	vars := mux.Vars(r)
 	taskID := vars["taskId"]
 
 	var req UpdateTaskStatusRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	err := h.scheduleService.UpdateTaskStatus(ctx, taskID, models.TaskUpdate{
+		Completed:   req.Completed,
+		ReasonCode:  req.ReasonCode,
+		Reason:      req.Reason,
+		CompletedBy: req.CompletedBy,
+	})
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Task status updated successfully"})
+}
+
+type BatchUpdateTasksRequest struct {
+	Updates     []models.TaskUpdate `json:"updates"`
+	CompletedBy string              `json:"completed_by,omitempty"` // Default for updates that don't set their own
+}
+
+// @Summary Update several tasks
+// @Description Update the status of several tasks of one visit in a single request. The updates are validated together and either all of them are applied or none.
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Param If-Match header string false "ETag of the schedule the change is based on"
+// @Param request body BatchUpdateTasksRequest true "Task updates"
+// @Success 200 {array} models.Task "Updated tasks"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 404 {object} map[string]string "Schedule not found"
+// @Failure 409 {object} map[string]string "Visit not in progress or past the update grace window"
+// @Failure 412 {object} map[string]string "Schedule changed since the If-Match ETag"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /schedules/{id}/tasks:batch [post]
+func (h *ScheduleHandler) BatchUpdateTasks(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	ctx = withIfMatch(ctx, r)
+
+	var req BatchUpdateTasksRequest
+	if !decodeJSON(w, r, &req) {
 		return
 	}
+	for i := range req.Updates {
+		if req.Updates[i].CompletedBy == "" {
+			req.Updates[i].CompletedBy = req.CompletedBy
+		}
+	}
 
-	// If task is not completed, reason is required
-	if !req.Completed && (req.Reason == nil || *req.Reason == "") {
-		http.Error(w, "Reason is required if task is not completed", http.StatusBadRequest)
+	tasks, err := h.scheduleService.UpdateTaskStatuses(ctx, mux.Vars(r)["id"], req.Updates)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
 		return
 	}
 
-	err := h.scheduleService.UpdateTaskStatus(ctx, taskID, req.Completed, req.Reason)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tasks)
+}
+
+type AddTaskRequest struct {
+	Description string  `json:"description"`
+	Category    *string `json:"category,omitempty"`  // Optional ADL/IADL code
+	Completed   *bool   `json:"completed,omitempty"` // Defaults to true
+	ReasonCode  *string `json:"reason_code,omitempty"`
+	Reason      *string `json:"reason,omitempty"`
+	CompletedBy *string `json:"completed_by,omitempty"` // Defaults to the visit's caregiver
+}
+
+// @Summary Add an ad-hoc task
+// @Description Log unplanned work done during a visit. The task is marked ad_hoc and is never required.
+// @Accept json
+// @Produce json
+// @Param id path string true "Schedule ID"
+// @Param If-Match header string false "ETag of the schedule the change is based on"
+// @Param request body AddTaskRequest true "Task details"
+// @Success 201 {object} models.Task "Task added"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 404 {object} map[string]string "Schedule not found"
+// @Failure 409 {object} map[string]string "Visit not in progress or past the update grace window"
+// @Failure 412 {object} map[string]string "Schedule changed since the If-Match ETag"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /schedules/{id}/tasks [post]
+func (h *ScheduleHandler) AddTask(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+	ctx = withIfMatch(ctx, r)
+
+	var req AddTaskRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+	completed := true
+	if req.Completed != nil {
+		completed = *req.Completed
+	}
+
+	task, err := h.scheduleService.AddAdHocTask(ctx, mux.Vars(r)["id"], models.Task{
+		Description: req.Description,
+		Category:    req.Category,
+		Completed:   completed,
+		ReasonCode:  req.ReasonCode,
+		Reason:      req.Reason,
+		CompletedBy: req.CompletedBy,
+	})
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, statusForError(err))
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(map[string]string{"message": "Task status updated successfully"})
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(task)
 }
 
 // @Summary Get schedule statistics
-// @Description Get aggregated statistics for all schedules (Total, Missed, Upcoming, Completed).
+// @Description Get per-status counts, on-time rate, average visit duration, task completion rate and a daily time series for schedules whose shift date falls in the optional range.
 // @Produce json
+// @Param from query string false "First shift date to include (YYYY-MM-DD)"
+// @Param to query string false "Last shift date to include (YYYY-MM-DD)"
+// @Param group_by query string false "Break the statistics down by day, client, caregiver or service" Enums(day, client, caregiver, service)
+// @Param branch_id query string false "Comma-separated branch IDs; supervisors get their own branches by default"
 // @Success 200 {object} models.ScheduleStats "Successfully retrieved schedule statistics"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Branch not assigned to the supervisor"
 // @Failure 500 {object} map[string]string "Internal Server Error"
 // @Router /schedules/stats [get]
 func (h *ScheduleHandler) GetScheduleStats(w http.ResponseWriter, r *http.Request) {
 	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
 	defer cancel()
 
-	stats, err := h.scheduleService.GetScheduleStats(ctx)
+	query := models.StatsQuery{GroupBy: r.URL.Query().Get("group_by")}
+	if branchID := r.URL.Query().Get("branch_id"); branchID != "" {
+		query.BranchIDs = strings.Split(branchID, ",")
+	}
+
+	var err error
+	if query.From, err = parseDateParam(r, "from"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if query.To, err = parseDateParam(r, "to"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.scheduleService.GetScheduleStats(ctx, query)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, statusForError(err))
 		return
 	}
 
@@ -262,10 +527,51 @@ func (h *ScheduleHandler) ResetSampleData(w http.ResponseWriter, r *http.Request
 
 	err := h.scheduleService.ResetSampleData(ctx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err, http.StatusInternalServerError)
 		return
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]string{"message": "Sample data reset successfully"})
 }
+
+// missedVisitLookback is how far back DetectMissedVisits looks. Visits are only
+// reported once, so overlapping runs are harmless, and a run that fails is
+// caught up by the next one.
+const missedVisitLookback = 24 * time.Hour
+
+// @Summary Detect missed visits
+// @Description Queue visit.missed for every visit whose scheduled end passed in the last 24 hours while it was still scheduled. Visits already reported are skipped. Meant for schedulers in environments without a background worker (e.g. Vercel cron). Admins only.
+// @Produce json
+// @Success 200 {object} map[string]int "Number of visits newly reported as missed"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /schedules/missed/detect [post]
+func (h *ScheduleHandler) DetectMissedVisits(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	defer cancel()
+
+	now := time.Now()
+	missed, err := h.scheduleService.DetectMissedVisits(ctx, now.Add(-missedVisitLookback), now)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"missed": missed})
+}
+
+// parseDateParam reads an optional YYYY-MM-DD query parameter as a date in the
+// tenant's time zone.
+func parseDateParam(r *http.Request, name string) (*time.Time, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.ParseInLocation("2006-01-02", value, tenant.Location(r.Context()))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s date, expected YYYY-MM-DD", name)
+	}
+	return &date, nil
+}
@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+const streamHeartbeatInterval = 15 * time.Second
+
+type StreamHandler struct {
+	bus       *events.Bus
+	closing   chan struct{}
+	closeOnce sync.Once
+}
+
+func NewStreamHandler(bus *events.Bus) *StreamHandler {
+	return &StreamHandler{bus: bus, closing: make(chan struct{})}
+}
+
+// Close ends every open stream and makes new ones end straight away. It is
+// called when the server shuts down.
+func (h *StreamHandler) Close() {
+	h.closeOnce.Do(func() { close(h.closing) })
+}
+
+// @Summary Stream visit status changes
+// @Description Server-Sent Events stream of the caller's tenant's visit.started, visit.completed, visit.missed and task.updated events. Supervisors only get the events of their branches. Reconnecting clients send Last-Event-ID to receive the events they missed; when that is no longer possible a "reset" event tells them to reload.
+// @Produce text/event-stream
+// @Param client_id query string false "Only events for this client"
+// @Param caregiver_id query string false "Only events for this caregiver"
+// @Param branch_id query string false "Comma-separated branch IDs"
+// @Param Last-Event-ID header string false "Resume after this event ID"
+// @Success 200 {string} string "Event stream"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Branch not assigned to the supervisor"
+// @Failure 500 {object} map[string]string "Streaming unsupported"
+// @Router /stream/visits [get]
+func (h *StreamHandler) StreamVisits(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	filter := events.Filter{
+		TenantID:    tenant.ID(r.Context()),
+		ClientID:    r.URL.Query().Get("client_id"),
+		CaregiverID: r.URL.Query().Get("caregiver_id"),
+	}
+	var requested []string
+	if branchID := r.URL.Query().Get("branch_id"); branchID != "" {
+		requested = strings.Split(branchID, ",")
+	}
+	branchIDs, err := branch.Narrow(r.Context(), requested)
+	if err != nil {
+		http.Error(w, "Branch not assigned to the caller", http.StatusForbidden)
+		return
+	}
+	filter.BranchIDs = branchIDs
+
+	var lastSeq uint64
+	if lastEventID := r.Header.Get("Last-Event-ID"); lastEventID != "" {
+		parsed, err := strconv.ParseUint(lastEventID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid Last-Event-ID", http.StatusBadRequest)
+			return
+		}
+		lastSeq = parsed
+	}
+
+	replay, complete, ch, cancel := h.bus.Subscribe(filter, lastSeq, 64)
+	defer cancel()
+
+	// The stream outlives the server's write timeout by design.
+	http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprint(w, "retry: 3000\n\n")
+	if !complete {
+		fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+	}
+	for _, s := range replay {
+		if err := writeStreamEvent(w, s); err != nil {
+			return
+		}
+	}
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(streamHeartbeatInterval)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-h.closing:
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+				return
+			}
+			flusher.Flush()
+		case s, ok := <-ch:
+			if !ok {
+				// Dropped for falling behind; the client reconnects with Last-Event-ID.
+				return
+			}
+			if err := writeStreamEvent(w, s); err != nil {
+				return
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+func writeStreamEvent(w http.ResponseWriter, s events.Sequenced) error {
+	data, err := json.Marshal(s.Event)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", s.Seq, s.Event.Type, data)
+	return err
+}
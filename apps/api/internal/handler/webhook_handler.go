@@ -0,0 +1,190 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/gorilla/mux"
+)
+
+type WebhookHandler struct {
+	webhookService service.WebhookService
+}
+
+func NewWebhookHandler(s service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{webhookService: s}
+}
+
+type CreateWebhookRequest struct {
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	BranchIDs []string `json:"branch_ids,omitempty"` // Optional, limits the subscription to these branches' visits
+	Secret    string   `json:"secret,omitempty"`     // Optional, generated when empty
+}
+
+// @Summary Create a webhook subscription
+// @Description Subscribe a URL to visit lifecycle events (visit.started, visit.completed, task.updated, visit.missed). An empty events list subscribes to all events, and branch_ids limits the subscription to those branches' visits. The signing secret is only returned in this response. Admins only.
+// @Accept json
+// @Produce json
+// @Param request body CreateWebhookRequest true "Subscription details"
+// @Success 201 {object} models.WebhookSubscription "Subscription created"
+// @Failure 400 {object} map[string]string "Bad Request"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhooks [post]
+func (h *WebhookHandler) CreateSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	var req CreateWebhookRequest
+	if !decodeJSON(w, r, &req) {
+		return
+	}
+
+	subscription, err := h.webhookService.CreateSubscription(ctx, req.URL, req.Events, req.BranchIDs, req.Secret)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(subscription)
+}
+
+// @Summary List webhook subscriptions
+// @Description Get all webhook subscriptions, or to supervisors those limited to their branches. Signing secrets are never included.
+// @Produce json
+// @Success 200 {array} models.WebhookSubscription "Successfully retrieved subscriptions"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhooks [get]
+func (h *WebhookHandler) GetSubscriptions(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	subscriptions, err := h.webhookService.GetSubscriptions(ctx)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subscriptions)
+}
+
+// @Summary Delete a webhook subscription
+// @Description Remove a webhook subscription together with its pending deliveries. Admins only.
+// @Produce json
+// @Param id path string true "Subscription ID"
+// @Success 200 {object} map[string]string "Subscription deleted"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 404 {object} map[string]string "Subscription not found"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhooks/{id} [delete]
+func (h *WebhookHandler) DeleteSubscription(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id := mux.Vars(r)["id"]
+
+	if err := h.webhookService.DeleteSubscription(ctx, id); err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook subscription deleted successfully"})
+}
+
+// @Summary List dead-lettered webhook deliveries
+// @Description Get deliveries that exhausted their retries and will not be attempted again. Admins only.
+// @Produce json
+// @Success 200 {array} models.WebhookDelivery "Successfully retrieved dead letters"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhooks/deliveries/dead [get]
+func (h *WebhookHandler) GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	deliveries, err := h.webhookService.GetDeadLetters(ctx)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// @Summary Retry a dead-lettered delivery
+// @Description Move a dead-lettered delivery back into the outbox with a fresh retry budget. Admins only.
+// @Produce json
+// @Param id path string true "Delivery ID"
+// @Success 200 {object} map[string]string "Delivery requeued"
+// @Failure 404 {object} map[string]string "Delivery not found"
+// @Failure 409 {object} map[string]string "Delivery is not dead-lettered"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhooks/deliveries/{id}/retry [post]
+func (h *WebhookHandler) RetryDelivery(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 5*time.Second)
+	defer cancel()
+
+	id := mux.Vars(r)["id"]
+
+	if err := h.webhookService.RetryDelivery(ctx, id); err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Webhook delivery requeued successfully"})
+}
+
+// @Summary Dispatch due webhook deliveries
+// @Description Attempt every pending delivery that is due. Meant for schedulers in environments without a background worker (e.g. Vercel cron). Admins only.
+// @Produce json
+// @Success 200 {object} map[string]int "Number of deliveries sent"
+// @Failure 403 {object} map[string]string "Forbidden"
+// @Failure 500 {object} map[string]string "Internal Server Error"
+// @Router /webhooks/dispatch [post]
+func (h *WebhookHandler) DispatchDeliveries(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), 25*time.Second)
+	defer cancel()
+
+	delivered, err := h.webhookService.ProcessDueDeliveries(ctx)
+	if err != nil {
+		writeError(w, r, err, statusForError(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]int{"delivered": delivered})
+}
+
+func statusForError(err error) int {
+	switch {
+	case errors.Is(err, service.ErrInvalidInput):
+		return http.StatusBadRequest
+	case errors.Is(err, service.ErrConflict):
+		return http.StatusConflict
+	case errors.Is(err, service.ErrPreconditionFailed):
+		return http.StatusPreconditionFailed
+	case errors.Is(err, service.ErrForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, service.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	case errors.Is(err, service.ErrNotFound):
+		return http.StatusNotFound
+	default:
+		return http.StatusInternalServerError
+	}
+}
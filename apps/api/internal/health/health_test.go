@@ -0,0 +1,58 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/health"
+)
+
+func ok(ctx context.Context) error { return nil }
+
+func TestRunReportsEveryCheck(t *testing.T) {
+	checker := health.NewChecker(time.Second,
+		health.Check{Name: "supabase", Run: ok},
+		health.Check{Name: "migrations", Run: func(ctx context.Context) error {
+			return errors.New("schema version 5 is behind 6")
+		}},
+	)
+
+	report := checker.Run(context.Background())
+	if report.Ready() || report.Status != health.StatusNotReady {
+		t.Errorf("Expected not_ready, got %s", report.Status)
+	}
+	if got := report.Checks["supabase"]; got.Status != health.StatusOK || got.Error != "" {
+		t.Errorf("Expected supabase to pass, got %+v", got)
+	}
+	if got := report.Checks["migrations"]; got.Status != health.StatusFail || got.Error != "schema version 5 is behind 6" {
+		t.Errorf("Expected migrations to fail with its error, got %+v", got)
+	}
+}
+
+func TestRunIsReadyWhenAllChecksPass(t *testing.T) {
+	report := health.NewChecker(time.Second, health.Check{Name: "supabase", Run: ok}).Run(context.Background())
+	if !report.Ready() {
+		t.Errorf("Expected ready, got %+v", report)
+	}
+}
+
+func TestRunDoesNotWaitForStuckChecks(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+
+	checker := health.NewChecker(20*time.Millisecond, health.Check{Name: "supabase", Run: func(ctx context.Context) error {
+		<-release // Ignores its context.
+		return nil
+	}})
+
+	start := time.Now()
+	report := checker.Run(context.Background())
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("Expected the report after the timeout, took %v", elapsed)
+	}
+	if got := report.Checks["supabase"]; got.Status != health.StatusFail || got.Error != context.DeadlineExceeded.Error() {
+		t.Errorf("Expected the stuck check to fail with a deadline error, got %+v", got)
+	}
+}
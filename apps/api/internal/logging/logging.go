@@ -0,0 +1,85 @@
+// Package logging builds the API's structured JSON logger. Every line logged
+// with a request context carries the request ID, trace ID, route and latency
+// so far, and PHI is redacted before it reaches the output.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/requestid"
+)
+
+// New returns a JSON logger writing to w at the given level.
+func New(w io.Writer, level slog.Leveler) *slog.Logger {
+	return slog.New(&contextHandler{
+		Handler: slog.NewJSONHandler(w, &slog.HandlerOptions{
+			Level:       level,
+			ReplaceAttr: redactAttr,
+		}),
+	})
+}
+
+// ParseLevel parses debug, info, warn or error. An empty string is info.
+func ParseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return slog.LevelInfo, nil
+	}
+	if err := level.UnmarshalText([]byte(strings.TrimSpace(s))); err != nil {
+		return slog.LevelInfo, fmt.Errorf("logging: invalid level %q", s)
+	}
+	return level, nil
+}
+
+type requestInfo struct {
+	method string
+	route  string
+	start  time.Time
+}
+
+type requestInfoKey struct{}
+
+// WithRequest records the request's method, route template and start time in
+// ctx so that lines logged with ctx include them.
+func WithRequest(ctx context.Context, method, route string, start time.Time) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, requestInfo{method: method, route: route, start: start})
+}
+
+// contextHandler adds the request attributes found in the context to each record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, record slog.Record) error {
+	if ctx != nil {
+		if id := requestid.FromContext(ctx); id != "" {
+			record.AddAttrs(slog.String("request_id", id))
+		}
+		if span := trace.SpanContextFromContext(ctx); span.IsValid() {
+			record.AddAttrs(slog.String("trace_id", span.TraceID().String()))
+		}
+		if info, ok := ctx.Value(requestInfoKey{}).(requestInfo); ok {
+			record.AddAttrs(
+				slog.String("method", info.method),
+				slog.String("route", info.route),
+				slog.Float64("latency_ms", float64(time.Since(info.start).Microseconds())/1000),
+			)
+		}
+	}
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{Handler: h.Handler.WithGroup(name)}
+}
@@ -0,0 +1,103 @@
+package logging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/logging"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/requestid"
+)
+
+func logLine(t *testing.T, level slog.Level, log func(*slog.Logger)) (string, map[string]any) {
+	t.Helper()
+	var buf bytes.Buffer
+	log(logging.New(&buf, level))
+
+	if buf.Len() == 0 {
+		return "", nil
+	}
+	var line map[string]any
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("Expected a JSON log line, got %q: %v", buf.String(), err)
+	}
+	return buf.String(), line
+}
+
+func TestRedactsPHI(t *testing.T) {
+	schedule := models.Schedule{
+		ID:           "schedule-1",
+		ClientName:   "Jane Doe",
+		Location:     models.Location{Latitude: 40.7128, Longitude: -74.006, Address: "1 Main St"},
+		ServiceNotes: "Diabetic, check blood sugar",
+		Tasks:        []models.Task{{ID: "task-1", Description: "Administer insulin"}},
+	}
+
+	out, line := logLine(t, slog.LevelInfo, func(l *slog.Logger) {
+		l.Info("visit",
+			"client_name", "Jane Doe",
+			slog.Group("visit", "address", "1 Main St", "latitude", 40.7128),
+			"schedule", schedule,
+			"response", json.RawMessage(`[{"id": "schedule-1", "service_notes": "Diabetic"}]`),
+			"error", errors.New("schedule not found"),
+		)
+	})
+
+	for _, phi := range []string{"Jane Doe", "1 Main St", "40.7128", "-74.006", "Diabetic", "insulin"} {
+		if strings.Contains(out, phi) {
+			t.Errorf("Expected %q to be redacted, got %s", phi, out)
+		}
+	}
+	for _, kept := range []string{"schedule-1", "task-1", "schedule not found"} {
+		if !strings.Contains(out, kept) {
+			t.Errorf("Expected %q to be kept, got %s", kept, out)
+		}
+	}
+	if line["client_name"] != logging.Redacted {
+		t.Errorf("Expected client_name to be %q, got %v", logging.Redacted, line["client_name"])
+	}
+}
+
+func TestAddsRequestAttributes(t *testing.T) {
+	ctx := requestid.NewContext(context.Background(), "req-1")
+	ctx = logging.WithRequest(ctx, "GET", "/api/schedules/{id}", time.Now().Add(-time.Second))
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	ctx = trace.ContextWithSpanContext(ctx, trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID}))
+
+	_, line := logLine(t, slog.LevelInfo, func(l *slog.Logger) {
+		l.InfoContext(ctx, "done")
+	})
+
+	if line["request_id"] != "req-1" || line["route"] != "/api/schedules/{id}" || line["method"] != "GET" {
+		t.Errorf("Expected request attributes on the line, got %v", line)
+	}
+	if line["trace_id"] != traceID.String() {
+		t.Errorf("Expected trace_id %s, got %v", traceID, line["trace_id"])
+	}
+	if latency, _ := line["latency_ms"].(float64); latency < 1000 {
+		t.Errorf("Expected latency_ms of at least 1000, got %v", line["latency_ms"])
+	}
+}
+
+func TestLevel(t *testing.T) {
+	level, err := logging.ParseLevel("warn")
+	if err != nil || level != slog.LevelWarn {
+		t.Fatalf("Expected warn, got %v (%v)", level, err)
+	}
+	if _, err := logging.ParseLevel("loud"); err == nil {
+		t.Error("Expected an error for an unknown level")
+	}
+
+	if out, _ := logLine(t, level, func(l *slog.Logger) { l.Info("hidden") }); out != "" {
+		t.Errorf("Expected info to be dropped at warn level, got %s", out)
+	}
+}
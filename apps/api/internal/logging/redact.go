@@ -0,0 +1,97 @@
+package logging
+
+import (
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces PHI in log output.
+const Redacted = "[REDACTED]"
+
+// phiKeys are the attribute and JSON field names whose values are PHI: who the
+// client is, where they live and what care they receive.
+var phiKeys = map[string]bool{
+	"client_name":    true,
+	"address":        true,
+	"latitude":       true,
+	"longitude":      true,
+	"location":       true,
+	"start_location": true,
+	"end_location":   true,
+	"service_notes":  true,
+	"description":    true,
+	"reason":         true,
+}
+
+// IsPHIKey reports whether a JSON field or attribute named key holds PHI.
+func IsPHIKey(key string) bool {
+	return phiKeys[strings.ToLower(key)]
+}
+
+// redactAttr is the ReplaceAttr hook of the JSON handler. It runs on every
+// attribute, including those nested in groups.
+func redactAttr(groups []string, a slog.Attr) slog.Attr {
+	if IsPHIKey(a.Key) {
+		return slog.String(a.Key, Redacted)
+	}
+	if a.Value.Kind() == slog.KindAny {
+		a.Value = slog.AnyValue(Redact(a.Value.Any()))
+	}
+	return a
+}
+
+// Redact returns v with the PHI fields of structs, maps and JSON documents
+// replaced. Errors and scalar values are returned unchanged.
+func Redact(v any) any {
+	switch v := v.(type) {
+	case nil, error:
+		return v
+	case json.RawMessage:
+		return redactJSON(v)
+	case []byte:
+		return redactJSON(v)
+	}
+
+	switch reflect.Indirect(reflect.ValueOf(v)).Kind() {
+	case reflect.Struct, reflect.Map, reflect.Slice, reflect.Array:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return Redacted
+		}
+		return redactJSON(data)
+	default:
+		return v
+	}
+}
+
+func redactJSON(data []byte) any {
+	var doc any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		// Not JSON, so there is no telling what it contains.
+		return Redacted
+	}
+	return redactValue(doc)
+}
+
+func redactValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for key, value := range v {
+			if IsPHIKey(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactValue(value)
+			}
+		}
+		return v
+	case []any:
+		for i, value := range v {
+			v[i] = redactValue(value)
+		}
+		return v
+	default:
+		return v
+	}
+}
@@ -0,0 +1,91 @@
+// Package metrics collects the API's Prometheus metrics: HTTP requests per
+// route, repository call durations and errors, and visit gauges.
+package metrics
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "evv"
+
+// BackendSupabase labels calls to the Supabase repositories.
+const BackendSupabase = "supabase"
+
+// Metrics owns a registry, so each App (and each test) gets its own set.
+type Metrics struct {
+	registry        *prometheus.Registry
+	requests        *prometheus.CounterVec
+	requestDuration *prometheus.HistogramVec
+	repoDuration    *prometheus.HistogramVec
+	repoErrors      *prometheus.CounterVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by method, route template and status code.",
+		}, []string{"method", "route", "status"}),
+		requestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by method and route template.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route"}),
+		repoDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "repository_call_duration_seconds",
+			Help:      "Repository call latency by backend, repository and method.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"backend", "repository", "method"}),
+		repoErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "repository_errors_total",
+			Help:      "Failed repository calls by backend, repository and method. Lookups that find nothing are not counted.",
+		}, []string{"backend", "repository", "method"}),
+	}
+
+	m.registry.MustRegister(
+		m.requests,
+		m.requestDuration,
+		m.repoDuration,
+		m.repoErrors,
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return m
+}
+
+// Handler serves the metrics in the Prometheus text format.
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// MustRegister adds further collectors, such as the visit gauges.
+func (m *Metrics) MustRegister(cs ...prometheus.Collector) {
+	m.registry.MustRegister(cs...)
+}
+
+// ObserveRequest records one served HTTP request.
+func (m *Metrics) ObserveRequest(method, route string, status int, elapsed time.Duration) {
+	m.requests.WithLabelValues(method, route, strconv.Itoa(status)).Inc()
+	m.requestDuration.WithLabelValues(method, route).Observe(elapsed.Seconds())
+}
+
+// ObserveRepositoryCall records one repository call and whether it failed.
+func (m *Metrics) ObserveRepositoryCall(backend, repo, method string, elapsed time.Duration, err error) {
+	m.repoDuration.WithLabelValues(backend, repo, method).Observe(elapsed.Seconds())
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		m.repoErrors.WithLabelValues(backend, repo, method).Inc()
+	}
+}
@@ -0,0 +1,125 @@
+package metrics_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/metrics"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant/tenanttest"
+)
+
+type statsSource struct {
+	stats  func(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error)
+	missed func(ctx context.Context) (int, error)
+}
+
+func (s statsSource) GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+	return s.stats(ctx, query)
+}
+
+func (s statsSource) CountMissedVisitsToday(ctx context.Context) (int, error) {
+	return s.missed(ctx)
+}
+
+// carePlanRepo fails every lookup with the given error.
+type carePlanRepo struct {
+	repository.CarePlanRepository
+	err error
+}
+
+func (r carePlanRepo) GetCarePlanByID(ctx context.Context, id string) (*models.CarePlan, error) {
+	return nil, r.err
+}
+
+func scrape(t *testing.T, m *metrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from the metrics handler, got %d", rec.Code)
+	}
+	return rec.Body.String()
+}
+
+func TestInstrumentedRepositoryCountsFailures(t *testing.T) {
+	m := metrics.New()
+
+	failing := metrics.InstrumentCarePlanRepository(carePlanRepo{err: errors.New("connection refused")}, m, metrics.BackendSupabase)
+	failing.GetCarePlanByID(context.Background(), "plan-1")
+	failing.GetCarePlanByID(context.Background(), "plan-1")
+
+	missing := metrics.InstrumentCarePlanRepository(carePlanRepo{err: fmt.Errorf("care plan with ID plan-2 %w", repository.ErrNotFound)}, m, metrics.BackendSupabase)
+	missing.GetCarePlanByID(context.Background(), "plan-2")
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`evv_repository_call_duration_seconds_count{backend="supabase",method="GetCarePlanByID",repository="care_plan"} 3`,
+		`evv_repository_errors_total{backend="supabase",method="GetCarePlanByID",repository="care_plan"} 2`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s", want)
+		}
+	}
+}
+
+func TestVisitGauges(t *testing.T) {
+	m := metrics.New()
+	var query models.StatsQuery
+	tenants := tenanttest.NewStore(tenant.Tenant{ID: "agency-a"}, tenant.Tenant{ID: "agency-b"})
+	m.MustRegister(metrics.NewVisitCollector(statsSource{
+		stats: func(ctx context.Context, q models.StatsQuery) (*models.ScheduleStats, error) {
+			query = q
+			stats := &models.ScheduleStats{UpcomingToday: 4, CompletedToday: 3}
+			stats.InProgressSchedules = 2
+			// Today's visits only count as missed in the stats tomorrow.
+			stats.MissedSchedules = 0
+			if tenant.ID(ctx) == "agency-b" {
+				stats.InProgressSchedules = 5
+			}
+			return stats, nil
+		},
+		missed: func(ctx context.Context) (int, error) {
+			return 1, nil
+		},
+	}, tenants))
+
+	body := scrape(t, m)
+	for _, want := range []string{
+		`evv_visits_in_progress{tenant="agency-a"} 2`,
+		`evv_visits_in_progress{tenant="agency-b"} 5`,
+		`evv_visits_missed_today{tenant="agency-a"} 1`,
+		`evv_visits_completed_today{tenant="agency-a"} 3`,
+		`evv_visits_upcoming_today{tenant="agency-a"} 4`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected metrics to contain %s", want)
+		}
+	}
+	if query.From == nil || query.To == nil || !query.From.Equal(*query.To) {
+		t.Errorf("Expected the gauges to read today's stats, got %+v", query)
+	}
+}
+
+func TestVisitGaugesAreOmittedOnError(t *testing.T) {
+	m := metrics.New()
+	m.MustRegister(metrics.NewVisitCollector(statsSource{
+		stats: func(ctx context.Context, q models.StatsQuery) (*models.ScheduleStats, error) {
+			return &models.ScheduleStats{}, nil
+		},
+		missed: func(ctx context.Context) (int, error) {
+			return 0, errors.New("Supabase is down")
+		},
+	}, tenanttest.NewStore()))
+
+	if body := scrape(t, m); strings.Contains(body, "evv_visits_in_progress") {
+		t.Error("Expected no visit gauges when stats cannot be read")
+	}
+}
@@ -0,0 +1,318 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+// instrument times the calls of one repository.
+type instrument struct {
+	metrics    *Metrics
+	backend    string
+	repository string
+}
+
+// observe is deferred with the call's start time and a pointer to its error.
+func (i instrument) observe(method string, start time.Time, err *error) {
+	i.metrics.ObserveRepositoryCall(i.backend, i.repository, method, time.Since(start), *err)
+}
+
+type scheduleRepository struct {
+	instrument
+	next repository.ScheduleRepository
+}
+
+// InstrumentScheduleRepository records the duration and errors of every call
+// made to next.
+func InstrumentScheduleRepository(next repository.ScheduleRepository, m *Metrics, backend string) repository.ScheduleRepository {
+	return &scheduleRepository{instrument: instrument{metrics: m, backend: backend, repository: "schedule"}, next: next}
+}
+
+func (r *scheduleRepository) GetSchedules(ctx context.Context, query models.ScheduleListQuery) (schedules []models.Schedule, err error) {
+	defer r.observe("GetSchedules", time.Now(), &err)
+	return r.next.GetSchedules(ctx, query)
+}
+
+func (r *scheduleRepository) GetTodaySchedules(ctx context.Context) (schedules []models.Schedule, err error) {
+	defer r.observe("GetTodaySchedules", time.Now(), &err)
+	return r.next.GetTodaySchedules(ctx)
+}
+
+func (r *scheduleRepository) GetScheduleByID(ctx context.Context, id string) (schedule *models.Schedule, err error) {
+	defer r.observe("GetScheduleByID", time.Now(), &err)
+	return r.next.GetScheduleByID(ctx, id)
+}
+
+func (r *scheduleRepository) CreateSchedule(ctx context.Context, schedule models.Schedule) (created *models.Schedule, err error) {
+	defer r.observe("CreateSchedule", time.Now(), &err)
+	return r.next.CreateSchedule(ctx, schedule)
+}
+
+func (r *scheduleRepository) ReplacePlannedTasks(ctx context.Context, scheduleID string, tasks []models.Task) (err error) {
+	defer r.observe("ReplacePlannedTasks", time.Now(), &err)
+	return r.next.ReplacePlannedTasks(ctx, scheduleID, tasks)
+}
+
+func (r *scheduleRepository) GetTaskByID(ctx context.Context, taskID string) (task *models.Task, err error) {
+	defer r.observe("GetTaskByID", time.Now(), &err)
+	return r.next.GetTaskByID(ctx, taskID)
+}
+
+func (r *scheduleRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) (err error) {
+	defer r.observe("StartVisit", time.Now(), &err)
+	return r.next.StartVisit(ctx, id, visitStart, startLocation, event)
+}
+
+func (r *scheduleRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) (err error) {
+	defer r.observe("EndVisit", time.Now(), &err)
+	return r.next.EndVisit(ctx, id, visitEnd, endLocation, event)
+}
+
+func (r *scheduleRepository) UpdateTaskStatuses(ctx context.Context, tasks []models.Task, taskEvents []events.Event) (err error) {
+	defer r.observe("UpdateTaskStatuses", time.Now(), &err)
+	return r.next.UpdateTaskStatuses(ctx, tasks, taskEvents)
+}
+
+func (r *scheduleRepository) AddTask(ctx context.Context, task models.Task, event events.Event) (added *models.Task, err error) {
+	defer r.observe("AddTask", time.Now(), &err)
+	return r.next.AddTask(ctx, task, event)
+}
+
+func (r *scheduleRepository) RecordMissedVisit(ctx context.Context, id string, event events.Event) (recorded bool, err error) {
+	defer r.observe("RecordMissedVisit", time.Now(), &err)
+	return r.next.RecordMissedVisit(ctx, id, event)
+}
+
+func (r *scheduleRepository) ResetSampleData(ctx context.Context) (err error) {
+	defer r.observe("ResetSampleData", time.Now(), &err)
+	return r.next.ResetSampleData(ctx)
+}
+
+func (r *scheduleRepository) GetScheduleStats(ctx context.Context, query models.StatsQuery) (stats *models.ScheduleStats, err error) {
+	defer r.observe("GetScheduleStats", time.Now(), &err)
+	return r.next.GetScheduleStats(ctx, query)
+}
+
+func (r *scheduleRepository) RefreshDailyStats(ctx context.Context, from, to time.Time) (refreshed int, err error) {
+	defer r.observe("RefreshDailyStats", time.Now(), &err)
+	return r.next.RefreshDailyStats(ctx, from, to)
+}
+
+func (r *scheduleRepository) GetUnscrubbedVisits(ctx context.Context, query models.LocationScrubQuery) (schedules []models.Schedule, err error) {
+	defer r.observe("GetUnscrubbedVisits", time.Now(), &err)
+	return r.next.GetUnscrubbedVisits(ctx, query)
+}
+
+func (r *scheduleRepository) ScrubVisitLocations(ctx context.Context, scrub models.LocationScrub) (applied bool, err error) {
+	defer r.observe("ScrubVisitLocations", time.Now(), &err)
+	return r.next.ScrubVisitLocations(ctx, scrub)
+}
+
+func (r *scheduleRepository) Ping(ctx context.Context) (err error) {
+	defer r.observe("Ping", time.Now(), &err)
+	return r.next.Ping(ctx)
+}
+
+type carePlanRepository struct {
+	instrument
+	next repository.CarePlanRepository
+}
+
+// InstrumentCarePlanRepository records the duration and errors of every call
+// made to next.
+func InstrumentCarePlanRepository(next repository.CarePlanRepository, m *Metrics, backend string) repository.CarePlanRepository {
+	return &carePlanRepository{instrument: instrument{metrics: m, backend: backend, repository: "care_plan"}, next: next}
+}
+
+func (r *carePlanRepository) CreateCarePlan(ctx context.Context, plan models.CarePlan) (created *models.CarePlan, err error) {
+	defer r.observe("CreateCarePlan", time.Now(), &err)
+	return r.next.CreateCarePlan(ctx, plan)
+}
+
+func (r *carePlanRepository) GetCarePlanByID(ctx context.Context, id string) (plan *models.CarePlan, err error) {
+	defer r.observe("GetCarePlanByID", time.Now(), &err)
+	return r.next.GetCarePlanByID(ctx, id)
+}
+
+func (r *carePlanRepository) GetActiveCarePlan(ctx context.Context, clientID string) (plan *models.CarePlan, err error) {
+	defer r.observe("GetActiveCarePlan", time.Now(), &err)
+	return r.next.GetActiveCarePlan(ctx, clientID)
+}
+
+func (r *carePlanRepository) ReplaceTemplates(ctx context.Context, planID string, templates []models.TaskTemplate, updatedAt time.Time) (err error) {
+	defer r.observe("ReplaceTemplates", time.Now(), &err)
+	return r.next.ReplaceTemplates(ctx, planID, templates, updatedAt)
+}
+
+type webhookRepository struct {
+	instrument
+	next repository.WebhookRepository
+}
+
+// InstrumentWebhookRepository records the duration and errors of every call
+// made to next.
+func InstrumentWebhookRepository(next repository.WebhookRepository, m *Metrics, backend string) repository.WebhookRepository {
+	return &webhookRepository{instrument: instrument{metrics: m, backend: backend, repository: "webhook"}, next: next}
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, subscription models.WebhookSubscription) (created *models.WebhookSubscription, err error) {
+	defer r.observe("CreateSubscription", time.Now(), &err)
+	return r.next.CreateSubscription(ctx, subscription)
+}
+
+func (r *webhookRepository) GetSubscriptions(ctx context.Context) (subscriptions []models.WebhookSubscription, err error) {
+	defer r.observe("GetSubscriptions", time.Now(), &err)
+	return r.next.GetSubscriptions(ctx)
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id string) (err error) {
+	defer r.observe("DeleteSubscription", time.Now(), &err)
+	return r.next.DeleteSubscription(ctx, id)
+}
+
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (deliveries []models.WebhookDelivery, err error) {
+	defer r.observe("ClaimDueDeliveries", time.Now(), &err)
+	return r.next.ClaimDueDeliveries(ctx, limit, lease)
+}
+
+func (r *webhookRepository) GetDeliveriesByStatus(ctx context.Context, status string) (deliveries []models.WebhookDelivery, err error) {
+	defer r.observe("GetDeliveriesByStatus", time.Now(), &err)
+	return r.next.GetDeliveriesByStatus(ctx, status)
+}
+
+func (r *webhookRepository) GetDeliveryByID(ctx context.Context, id string) (delivery *models.WebhookDelivery, err error) {
+	defer r.observe("GetDeliveryByID", time.Now(), &err)
+	return r.next.GetDeliveryByID(ctx, id)
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) (err error) {
+	defer r.observe("UpdateDelivery", time.Now(), &err)
+	return r.next.UpdateDelivery(ctx, delivery)
+}
+
+type retentionRepository struct {
+	instrument
+	next repository.RetentionRepository
+}
+
+// InstrumentRetentionRepository records the duration and errors of every call
+// made to next.
+func InstrumentRetentionRepository(next repository.RetentionRepository, m *Metrics, backend string) repository.RetentionRepository {
+	return &retentionRepository{instrument: instrument{metrics: m, backend: backend, repository: "retention"}, next: next}
+}
+
+func (r *retentionRepository) Purge(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, limit int, dryRun bool) (affected int, err error) {
+	defer r.observe("Purge", time.Now(), &err)
+	return r.next.Purge(ctx, policy, cutoff, limit, dryRun)
+}
+
+func (r *retentionRepository) GetLegalHolds(ctx context.Context) (holds []models.LegalHold, err error) {
+	defer r.observe("GetLegalHolds", time.Now(), &err)
+	return r.next.GetLegalHolds(ctx)
+}
+
+func (r *retentionRepository) PlaceLegalHold(ctx context.Context, hold models.LegalHold) (placed *models.LegalHold, err error) {
+	defer r.observe("PlaceLegalHold", time.Now(), &err)
+	return r.next.PlaceLegalHold(ctx, hold)
+}
+
+func (r *retentionRepository) ReleaseLegalHold(ctx context.Context, clientID string) (err error) {
+	defer r.observe("ReleaseLegalHold", time.Now(), &err)
+	return r.next.ReleaseLegalHold(ctx, clientID)
+}
+
+type branchRepository struct {
+	instrument
+	next repository.BranchRepository
+}
+
+// InstrumentBranchRepository records the duration and errors of every call
+// made to next.
+func InstrumentBranchRepository(next repository.BranchRepository, m *Metrics, backend string) repository.BranchRepository {
+	return &branchRepository{instrument: instrument{metrics: m, backend: backend, repository: "branch"}, next: next}
+}
+
+func (r *branchRepository) GetRegions(ctx context.Context) (regions []models.Region, err error) {
+	defer r.observe("GetRegions", time.Now(), &err)
+	return r.next.GetRegions(ctx)
+}
+
+func (r *branchRepository) CreateRegion(ctx context.Context, region models.Region) (created *models.Region, err error) {
+	defer r.observe("CreateRegion", time.Now(), &err)
+	return r.next.CreateRegion(ctx, region)
+}
+
+func (r *branchRepository) GetBranches(ctx context.Context, regionID string) (branches []models.Branch, err error) {
+	defer r.observe("GetBranches", time.Now(), &err)
+	return r.next.GetBranches(ctx, regionID)
+}
+
+func (r *branchRepository) GetBranchByID(ctx context.Context, id string) (branch *models.Branch, err error) {
+	defer r.observe("GetBranchByID", time.Now(), &err)
+	return r.next.GetBranchByID(ctx, id)
+}
+
+func (r *branchRepository) CreateBranch(ctx context.Context, branch models.Branch) (created *models.Branch, err error) {
+	defer r.observe("CreateBranch", time.Now(), &err)
+	return r.next.CreateBranch(ctx, branch)
+}
+
+func (r *branchRepository) AssignMember(ctx context.Context, branchID, kind, memberID string) (err error) {
+	defer r.observe("AssignMember", time.Now(), &err)
+	return r.next.AssignMember(ctx, branchID, kind, memberID)
+}
+
+func (r *branchRepository) UnassignMember(ctx context.Context, branchID, kind, memberID string) (err error) {
+	defer r.observe("UnassignMember", time.Now(), &err)
+	return r.next.UnassignMember(ctx, branchID, kind, memberID)
+}
+
+func (r *branchRepository) SupervisedBranchIDs(ctx context.Context, userID string) (ids []string, err error) {
+	defer r.observe("SupervisedBranchIDs", time.Now(), &err)
+	return r.next.SupervisedBranchIDs(ctx, userID)
+}
+
+func (r *branchRepository) ClientBranchID(ctx context.Context, clientID string) (id string, err error) {
+	defer r.observe("ClientBranchID", time.Now(), &err)
+	return r.next.ClientBranchID(ctx, clientID)
+}
+
+type apiKeyRepository struct {
+	instrument
+	next repository.APIKeyRepository
+}
+
+// InstrumentAPIKeyRepository records the duration and errors of every call
+// made to next.
+func InstrumentAPIKeyRepository(next repository.APIKeyRepository, m *Metrics, backend string) repository.APIKeyRepository {
+	return &apiKeyRepository{instrument: instrument{metrics: m, backend: backend, repository: "api_key"}, next: next}
+}
+
+func (r *apiKeyRepository) GetAPIKeys(ctx context.Context) (keys []models.APIKey, err error) {
+	defer r.observe("GetAPIKeys", time.Now(), &err)
+	return r.next.GetAPIKeys(ctx)
+}
+
+func (r *apiKeyRepository) CreateAPIKey(ctx context.Context, key models.APIKey) (created *models.APIKey, err error) {
+	defer r.observe("CreateAPIKey", time.Now(), &err)
+	return r.next.CreateAPIKey(ctx, key)
+}
+
+func (r *apiKeyRepository) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) (err error) {
+	defer r.observe("RevokeAPIKey", time.Now(), &err)
+	return r.next.RevokeAPIKey(ctx, id, revokedAt)
+}
+
+func (r *apiKeyRepository) APIKeyByHash(ctx context.Context, hash string) (key *models.APIKey, err error) {
+	defer r.observe("APIKeyByHash", time.Now(), &err)
+	return r.next.APIKeyByHash(ctx, hash)
+}
+
+func (r *apiKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) (err error) {
+	defer r.observe("TouchAPIKey", time.Now(), &err)
+	return r.next.TouchAPIKey(ctx, id, usedAt)
+}
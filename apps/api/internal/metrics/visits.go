@@ -0,0 +1,80 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// StatsSource is the part of the schedule service the visit gauges read.
+type StatsSource interface {
+	GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error)
+	CountMissedVisitsToday(ctx context.Context) (int, error)
+}
+
+var (
+	visitsInProgressDesc = prometheus.NewDesc(namespace+"_visits_in_progress",
+		"Visits of today's shifts that are clocked in and not yet clocked out.", []string{"tenant"}, nil)
+	visitsMissedTodayDesc = prometheus.NewDesc(namespace+"_visits_missed_today",
+		"Visits of today's shifts that are still scheduled although their scheduled end has passed.", []string{"tenant"}, nil)
+	visitsCompletedTodayDesc = prometheus.NewDesc(namespace+"_visits_completed_today",
+		"Visits of today's shifts that were completed.", []string{"tenant"}, nil)
+	visitsUpcomingTodayDesc = prometheus.NewDesc(namespace+"_visits_upcoming_today",
+		"Visits of today's shifts that have not started yet.", []string{"tenant"}, nil)
+)
+
+// visitCollector reads each tenant's visit counts for its today on every
+// scrape, so the gauges are as fresh as the stats endpoint without a
+// background poller.
+type visitCollector struct {
+	stats   StatsSource
+	tenants tenant.Store
+	timeout time.Duration
+}
+
+// NewVisitCollector returns the collector of the visit gauges, labelled by
+// tenant.
+func NewVisitCollector(stats StatsSource, tenants tenant.Store) prometheus.Collector {
+	return &visitCollector{stats: stats, tenants: tenants, timeout: 5 * time.Second}
+}
+
+func (c *visitCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- visitsInProgressDesc
+	ch <- visitsMissedTodayDesc
+	ch <- visitsCompletedTodayDesc
+	ch <- visitsUpcomingTodayDesc
+}
+
+func (c *visitCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.timeout)
+	defer cancel()
+
+	err := tenant.Each(ctx, c.tenants, func(ctx context.Context) error {
+		today := time.Now().In(tenant.Location(ctx))
+		stats, err := c.stats.GetScheduleStats(ctx, models.StatsQuery{From: &today, To: &today})
+		if err != nil {
+			return err
+		}
+		// The stats only count a visit as missed once its day is over.
+		missed, err := c.stats.CountMissedVisitsToday(ctx)
+		if err != nil {
+			return err
+		}
+		id := tenant.ID(ctx)
+		ch <- prometheus.MustNewConstMetric(visitsInProgressDesc, prometheus.GaugeValue, float64(stats.InProgressSchedules), id)
+		ch <- prometheus.MustNewConstMetric(visitsMissedTodayDesc, prometheus.GaugeValue, float64(missed), id)
+		ch <- prometheus.MustNewConstMetric(visitsCompletedTodayDesc, prometheus.GaugeValue, float64(stats.CompletedToday), id)
+		ch <- prometheus.MustNewConstMetric(visitsUpcomingTodayDesc, prometheus.GaugeValue, float64(stats.UpcomingToday), id)
+		return nil
+	})
+	if err != nil {
+		// Leave the failed tenants' gauges out rather than report zeros that
+		// look real.
+		slog.WarnContext(ctx, "Failed to collect visit gauges", "error", err)
+	}
+}
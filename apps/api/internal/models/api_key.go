@@ -0,0 +1,56 @@
+package models
+
+import "time"
+
+// Scopes of API keys. Each route API keys may call requires one of them;
+// routes without one only take user tokens.
+const (
+	ScopeReadSchedules = "read:schedules"
+	ScopeWriteVisits   = "write:visits"
+	ScopeExportBilling = "export:billing"
+)
+
+func IsValidAPIKeyScope(scope string) bool {
+	switch scope {
+	case ScopeReadSchedules, ScopeWriteVisits, ScopeExportBilling:
+		return true
+	}
+	return false
+}
+
+// APIKey authenticates another system, such as a payroll or billing system,
+// as a caller of its tenant. Only a hash of the key is stored.
+type APIKey struct {
+	ID       string   `json:"id" db:"id"`
+	TenantID string   `json:"-" db:"tenant_id"`
+	Name     string   `json:"name" db:"name"`
+	Prefix   string   `json:"prefix" db:"prefix"` // The key's first characters, to tell keys apart
+	KeyHash  string   `json:"-" db:"key_hash"`
+	Scopes   []string `json:"scopes" db:"scopes"`
+	// RateLimitPerMinute caps the key's requests. Zero means the API's
+	// API_KEY_RATE_LIMIT.
+	RateLimitPerMinute int        `json:"rate_limit_per_minute" db:"rate_limit_per_minute"`
+	ExpiresAt          *time.Time `json:"expires_at,omitempty" db:"expires_at"`
+	LastUsedAt         *time.Time `json:"last_used_at,omitempty" db:"last_used_at"`
+	RevokedAt          *time.Time `json:"revoked_at,omitempty" db:"revoked_at"`
+	CreatedAt          time.Time  `json:"created_at" db:"created_at"`
+
+	// Key is only set in the response that creates the key.
+	Key string `json:"key,omitempty"`
+}
+
+// HasScope reports whether the key grants scope.
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// Active reports whether the key can be used at now: it is neither revoked
+// nor expired.
+func (k APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
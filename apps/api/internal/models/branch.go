@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Region groups the branch offices of an agency, e.g. by service area.
+type Region struct {
+	ID        string    `json:"id" db:"id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// Branch is a branch office. Its clients' visits belong to it, and its
+// supervisors only see those.
+type Branch struct {
+	ID        string    `json:"id" db:"id"`
+	RegionID  *string   `json:"region_id,omitempty" db:"region_id"`
+	Name      string    `json:"name" db:"name"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+
+	// Set by GetBranch only.
+	ClientIDs     []string `json:"client_ids,omitempty"`
+	CaregiverIDs  []string `json:"caregiver_ids,omitempty"`
+	SupervisorIDs []string `json:"supervisor_ids,omitempty"`
+}
+
+// Kinds of branch members. A client belongs to one branch; caregivers and
+// supervisors (Supabase user IDs) can be assigned to several.
+const (
+	BranchClients     = "clients"
+	BranchCaregivers  = "caregivers"
+	BranchSupervisors = "supervisors"
+)
+
+func IsValidBranchMemberKind(kind string) bool {
+	switch kind {
+	case BranchClients, BranchCaregivers, BranchSupervisors:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"time"
+)
+
+// Task categories follow the ADL (activities of daily living) and IADL
+// (instrumental activities of daily living) groupings used on care plans.
+const (
+	CategoryADLBathing        = "adl.bathing"
+	CategoryADLDressing       = "adl.dressing"
+	CategoryADLToileting      = "adl.toileting"
+	CategoryADLTransferring   = "adl.transferring"
+	CategoryADLContinence     = "adl.continence"
+	CategoryADLEating         = "adl.eating"
+	CategoryIADLMealPrep      = "iadl.meal_preparation"
+	CategoryIADLHousekeeping  = "iadl.housekeeping"
+	CategoryIADLLaundry       = "iadl.laundry"
+	CategoryIADLMedication    = "iadl.medication"
+	CategoryIADLShopping      = "iadl.shopping"
+	CategoryIADLTransport     = "iadl.transportation"
+	CategoryIADLCommunication = "iadl.communication"
+	CategoryIADLFinances      = "iadl.finances"
+)
+
+var TaskCategories = []string{
+	CategoryADLBathing, CategoryADLDressing, CategoryADLToileting, CategoryADLTransferring,
+	CategoryADLContinence, CategoryADLEating, CategoryIADLMealPrep, CategoryIADLHousekeeping,
+	CategoryIADLLaundry, CategoryIADLMedication, CategoryIADLShopping, CategoryIADLTransport,
+	CategoryIADLCommunication, CategoryIADLFinances,
+}
+
+func IsValidTaskCategory(category string) bool {
+	for _, c := range TaskCategories {
+		if c == category {
+			return true
+		}
+	}
+	return false
+}
+
+// How often a task template applies to a client's visits. Weekly templates
+// apply on the template's weekday only.
+const (
+	FrequencyEveryVisit = "every_visit"
+	FrequencyMonWedFri  = "mon_wed_fri"
+	FrequencyWeekly     = "weekly"
+)
+
+func IsValidTaskFrequency(frequency string) bool {
+	switch frequency {
+	case FrequencyEveryVisit, FrequencyMonWedFri, FrequencyWeekly:
+		return true
+	}
+	return false
+}
+
+type TaskTemplate struct {
+	ID          string  `json:"id" db:"id"`
+	CarePlanID  string  `json:"care_plan_id" db:"care_plan_id"`
+	Description string  `json:"description" db:"description"`
+	Category    string  `json:"category" db:"category"`
+	Frequency   string  `json:"frequency" db:"frequency"`
+	Weekday     *string `json:"weekday,omitempty" db:"weekday"` // e.g. "monday"; weekly templates only
+	Required    bool    `json:"required" db:"required"`
+	Position    int     `json:"position" db:"position"`
+}
+
+// CarePlan is the set of task templates a client's visits are generated from.
+// A client has at most one active plan; creating a new one retires the old.
+type CarePlan struct {
+	ID        string         `json:"id" db:"id"`
+	ClientID  string         `json:"client_id" db:"client_id"`
+	Name      string         `json:"name" db:"name"`
+	Active    bool           `json:"active" db:"active"`
+	CreatedAt time.Time      `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time      `json:"updated_at" db:"updated_at"`
+	Templates []TaskTemplate `json:"templates"`
+}
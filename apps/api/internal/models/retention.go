@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// Data classes with their own retention policy.
+const (
+	DataClassVisitRecords   = "visit_records"
+	DataClassGPSCoordinates = "gps_coordinates"
+	DataClassTaskReasons    = "task_reasons"
+	DataClassAuditLogs      = "audit_logs"
+)
+
+// What a purge does with expired data. Only visit records can be anonymized;
+// the other classes are always deleted.
+const (
+	RetentionDelete    = "delete"
+	RetentionAnonymize = "anonymize"
+)
+
+// RetentionPolicy keeps a data class for RetainDays after the visit (or, for
+// audit logs, after the access). Zero days keeps the data forever.
+type RetentionPolicy struct {
+	DataClass  string `json:"data_class"`
+	RetainDays int    `json:"retain_days"`
+	Action     string `json:"action"`
+}
+
+// RetentionResult is what one purge run did, or would do, to a data class.
+type RetentionResult struct {
+	RetentionPolicy
+	Cutoff   *time.Time `json:"cutoff,omitempty"`
+	Affected int        `json:"affected"`
+}
+
+type RetentionReport struct {
+	DryRun     bool              `json:"dry_run"`
+	RanAt      time.Time         `json:"ran_at"`
+	LegalHolds int               `json:"legal_holds"`
+	Classes    []RetentionResult `json:"classes"`
+}
+
+// LegalHold exempts all data of a client from retention until it is released.
+type LegalHold struct {
+	ClientID  string    `json:"client_id" db:"client_id"`
+	Reason    string    `json:"reason" db:"reason"`
+	PlacedBy  *string   `json:"placed_by,omitempty" db:"placed_by"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+// What happens to the clock-in and clock-out coordinates of a visit once they
+// are no longer needed.
+const (
+	LocationKeep             = "keep"
+	LocationCoarsen          = "coarsen"
+	LocationVerificationOnly = "verification_only"
+)
+
+// LocationScrubQuery selects completed visits whose locations have not been
+// scrubbed, in id order after AfterID. Before, when set, only selects visits
+// scheduled before it.
+type LocationScrubQuery struct {
+	Before  *time.Time
+	AfterID string
+	Limit   int
+}
+
+// LocationScrub replaces the visit locations of a completed schedule. A nil
+// location clears its column. The scrub is recorded in the access log.
+type LocationScrub struct {
+	ScheduleID        string
+	StartLocation     *Location
+	EndLocation       *Location
+	StartVerification *LocationVerification
+	EndVerification   *LocationVerification
+	// Fields are the columns whose precise values were removed.
+	Fields []string
+	Actor  string
+}
+
+type LocationScrubReport struct {
+	Mode     string `json:"mode"`
+	Scanned  int    `json:"scanned"`
+	Scrubbed int    `json:"scrubbed"`
+	// Skipped visits are not due yet, belong to a client on legal hold, or
+	// changed while they were being scrubbed.
+	Skipped int `json:"skipped"`
+}
@@ -10,28 +10,156 @@ type Location struct {
 	Address   string  `json:"address"`
 }
 
+// LocationVerification is the geofence check of a clock-in or clock-out
+// location against the client's location. It is kept when the coordinates are
+// coarsened or dropped.
+type LocationVerification struct {
+	Verified       bool    `json:"verified"`
+	DistanceMeters float64 `json:"distance_meters"`
+	RadiusMeters   float64 `json:"radius_meters"`
+}
+
 type Schedule struct {
-	ID          string    `json:"id" db:"id"`
-	ClientID    string    `json:"client_id" db:"client_id"`
-	ClientName  string    `json:"client_name" db:"client_name"`
-	ClientAvatar string   `json:"client_avatar" db:"client_avatar"`
-	ServiceName string    `json:"service_name" db:"service_name"`
-	Location    Location  `json:"location" db:"location"`
-	ShiftDate   string    `json:"shift_date" db:"shift_date"`
-	StartTime   string    `json:"start_time" db:"start_time"`
-	EndTime     string    `json:"end_time" db:"end_time"`
-	Status      string    `json:"status" db:"status"`
-	VisitStart  *time.Time `json:"visit_start,omitempty" db:"visit_start"`
-	VisitEnd    *time.Time `json:"visit_end,omitempty" db:"visit_end"`
-	StartLocation *Location `json:"start_location,omitempty" db:"start_location"`
-	EndLocation   *Location `json:"end_location,omitempty" db:"end_location"`
-	ServiceNotes string   `json:"service_notes" db:"service_notes"`
-	Tasks       []Task    `json:"tasks,omitempty"`
+	ID             string     `json:"id" db:"id"`
+	ClientID       string     `json:"client_id" db:"client_id"`
+	ClientName     string     `json:"client_name" db:"client_name"`
+	ClientAvatar   string     `json:"client_avatar" db:"client_avatar"`
+	CaregiverID    string     `json:"caregiver_id" db:"caregiver_id"`
+	BranchID       *string    `json:"branch_id,omitempty" db:"branch_id"` // The client's branch, kept in sync by the database
+	ServiceName    string     `json:"service_name" db:"service_name"`
+	Location       Location   `json:"location" db:"location"`
+	ShiftDate      string     `json:"shift_date" db:"shift_date"`
+	StartTime      string     `json:"start_time" db:"start_time"`
+	EndTime        string     `json:"end_time" db:"end_time"`
+	ScheduledStart string     `json:"scheduled_start,omitempty" db:"scheduled_start"` // shift_date + start_time, local wall clock
+	Status         string     `json:"status" db:"status"`
+	VisitStart     *time.Time `json:"visit_start,omitempty" db:"visit_start"`
+	VisitEnd       *time.Time `json:"visit_end,omitempty" db:"visit_end"`
+	StartLocation  *Location  `json:"start_location,omitempty" db:"start_location"`
+	EndLocation    *Location  `json:"end_location,omitempty" db:"end_location"`
+	ServiceNotes   string     `json:"service_notes" db:"service_notes"`
+	Tasks          []Task     `json:"tasks,omitempty"`
+
+	// Set once the visit locations were coarsened or dropped, see
+	// LocationScrub.
+	StartVerification   *LocationVerification `json:"start_verification,omitempty" db:"start_verification"`
+	EndVerification     *LocationVerification `json:"end_verification,omitempty" db:"end_verification"`
+	LocationsScrubbedAt *time.Time            `json:"locations_scrubbed_at,omitempty" db:"locations_scrubbed_at"`
+
+	// Version is bumped by the database whenever the schedule or one of its
+	// tasks changes. It is not part of the representation, so re-encrypting
+	// a row leaves its ETag alone.
+	Version int64 `json:"-" db:"version"`
+}
+
+const (
+	DefaultScheduleListLimit = 50
+	MaxScheduleListLimit     = 200
+)
+
+// ScheduleCursor is the keyset position of the last schedule on a page.
+// Backends return rows strictly after it in (scheduled_start, id) order, or
+// strictly before it when the list is sorted descending.
+type ScheduleCursor struct {
+	ScheduledStart string `json:"s"`
+	ID             string `json:"i"`
+	Descending     bool   `json:"d,omitempty"`
+}
+
+// ScheduleListQuery filters and orders a schedule listing. From and To bound
+// the shift date (inclusive). A zero Limit means no limit and is only used
+// internally. ClientName only matches whole names, which is what the blind
+// index of the encrypted column supports.
+type ScheduleListQuery struct {
+	Limit       int
+	Cursor      *ScheduleCursor
+	Statuses    []string
+	ClientID    string
+	ClientName  string
+	CaregiverID string
+	From        *time.Time
+	To          *time.Time
+	Descending  bool
+	// BranchIDs limits the listing to visits of these branches. Nil means
+	// any branch, and an empty list none.
+	BranchIDs []string
+}
+
+type SchedulePage struct {
+	Data       []Schedule `json:"data"`
+	NextCursor *string    `json:"next_cursor"`
+}
+
+func IsValidScheduleStatus(status string) bool {
+	switch status {
+	case "scheduled", "in_progress", "completed", "cancelled":
+		return true
+	}
+	return false
+}
+
+// StatsCounts are the per-status counters and rates shared by the overall
+// statistics, each group and each day of the time series. Rates are fractions
+// between 0 and 1.
+type StatsCounts struct {
+	TotalSchedules      int     `json:"totalSchedules"`
+	CompletedSchedules  int     `json:"completedSchedules"`
+	ScheduledSchedules  int     `json:"scheduledSchedules"`
+	InProgressSchedules int     `json:"inProgressSchedules"`
+	CancelledSchedules  int     `json:"cancelledSchedules"`
+	MissedSchedules     int     `json:"missedSchedules"`
+	OnTimeRate          float64 `json:"onTimeRate"`
+	AverageVisitMinutes float64 `json:"averageVisitMinutes"`
+	TaskCompletionRate  float64 `json:"taskCompletionRate"`
+}
+
+type StatsGroup struct {
+	Key string `json:"key"`
+	StatsCounts
+}
+
+type DailyStats struct {
+	Date string `json:"date"` // YYYY-MM-DD
+	StatsCounts
 }
 
 type ScheduleStats struct {
-	TotalSchedules    int `json:"totalSchedules"`
-	MissedSchedules   int `json:"missedSchedules"`
-	UpcomingToday     int `json:"upcomingToday"`
-	CompletedToday    int `json:"completedToday"`
+	StatsCounts
+	UpcomingToday  int          `json:"upcomingToday"`
+	CompletedToday int          `json:"completedToday"`
+	From           string       `json:"from,omitempty"`
+	To             string       `json:"to,omitempty"`
+	GroupBy        string       `json:"groupBy,omitempty"`
+	Groups         []StatsGroup `json:"groups,omitempty"`
+	Daily          []DailyStats `json:"daily"`
+}
+
+const (
+	StatsGroupByDay       = "day"
+	StatsGroupByClient    = "client"
+	StatsGroupByCaregiver = "caregiver"
+	StatsGroupByService   = "service"
+)
+
+// StatsQuery restricts statistics to shift dates between From and To
+// (inclusive, either may be nil) and optionally breaks them down by GroupBy.
+// UseDailyRollup reads the overall counts and daily series from the
+// pre-aggregated rollup table instead of the live tables.
+type StatsQuery struct {
+	From           *time.Time
+	To             *time.Time
+	GroupBy        string
+	UseDailyRollup bool
+	// BranchIDs limits the stats to visits of these branches, like
+	// ScheduleListQuery.BranchIDs. The daily rollup is not kept per branch,
+	// so it is not used for branch-limited stats.
+	BranchIDs []string
+}
+
+func IsValidStatsGroupBy(groupBy string) bool {
+	switch groupBy {
+	case "", StatsGroupByDay, StatsGroupByClient, StatsGroupByCaregiver, StatsGroupByService:
+		return true
+	}
+	return false
 }
@@ -1,9 +1,54 @@
 package models
 
+import (
+	"time"
+)
+
 type Task struct {
-	ID         string `json:"id" db:"id"`
-	ScheduleID string `json:"schedule_id" db:"schedule_id"`
-	Description string `json:"description" db:"description"`
-	Completed  bool   `json:"completed" db:"completed"`
-	Reason     *string `json:"reason,omitempty" db:"reason"`
+	ID          string     `json:"id" db:"id"`
+	ScheduleID  string     `json:"schedule_id" db:"schedule_id"`
+	Description string     `json:"description" db:"description"`
+	Completed   bool       `json:"completed" db:"completed"`
+	CompletedAt *time.Time `json:"completed_at,omitempty" db:"completed_at"`
+	CompletedBy *string    `json:"completed_by,omitempty" db:"completed_by"` // Caregiver who resolved the task
+	ReasonCode  *string    `json:"reason_code,omitempty" db:"reason_code"`   // Why the task was not completed, see TaskReasonCodes
+	Reason      *string    `json:"reason,omitempty" db:"reason"`             // Free-text note; required with reason code "other"
+	Category    *string    `json:"category,omitempty" db:"category"`         // ADL/IADL code copied from the care plan
+	Required    bool       `json:"required" db:"required"`                   // false for optional care plan tasks
+	TemplateID  *string    `json:"template_id,omitempty" db:"template_id"`   // Care plan template the task was generated from
+	AdHoc       bool       `json:"ad_hoc" db:"ad_hoc"`                       // Unplanned work logged during the visit
+}
+
+// Structured reasons for a task that was not completed.
+const (
+	ReasonClientDeclined      = "client_declined"
+	ReasonClientUnavailable   = "client_unavailable"
+	ReasonNotNeeded           = "not_needed"
+	ReasonInsufficientTime    = "insufficient_time"
+	ReasonUnsafeConditions    = "unsafe_conditions"
+	ReasonSuppliesUnavailable = "supplies_unavailable"
+	ReasonOther               = "other"
+)
+
+var TaskReasonCodes = []string{
+	ReasonClientDeclined, ReasonClientUnavailable, ReasonNotNeeded, ReasonInsufficientTime,
+	ReasonUnsafeConditions, ReasonSuppliesUnavailable, ReasonOther,
+}
+
+func IsValidTaskReasonCode(code string) bool {
+	for _, c := range TaskReasonCodes {
+		if c == code {
+			return true
+		}
+	}
+	return false
+}
+
+// TaskUpdate is a caregiver's change to one task of a visit.
+type TaskUpdate struct {
+	TaskID      string  `json:"task_id"`
+	Completed   bool    `json:"completed"`
+	ReasonCode  *string `json:"reason_code,omitempty"`
+	Reason      *string `json:"reason,omitempty"`
+	CompletedBy string  `json:"completed_by,omitempty"` // Defaults to the visit's caregiver
 }
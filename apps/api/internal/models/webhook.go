@@ -0,0 +1,44 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// WebhookSubscription receives the events of Events, or every event if it is
+// empty. BranchIDs, when not nil, limits it to the events of those branches;
+// subscriptions created by supervisors get theirs.
+type WebhookSubscription struct {
+	ID        string    `json:"id" db:"id"`
+	URL       string    `json:"url" db:"url"`
+	Secret    string    `json:"secret,omitempty" db:"secret"`
+	Events    []string  `json:"events" db:"events"`
+	Active    bool      `json:"active" db:"active"`
+	BranchIDs []string  `json:"branch_ids,omitempty" db:"branch_ids"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+const (
+	DeliveryPending = "pending"
+	// DeliverySending marks a delivery a dispatcher has claimed, until its
+	// LockedUntil. A claim that runs out is taken over by the next dispatch.
+	DeliverySending   = "sending"
+	DeliveryDelivered = "delivered"
+	DeliveryDead      = "dead"
+)
+
+type WebhookDelivery struct {
+	ID             string          `json:"id" db:"id"`
+	SubscriptionID string          `json:"subscription_id" db:"subscription_id"`
+	EventID        string          `json:"event_id" db:"event_id"`
+	EventType      string          `json:"event_type" db:"event_type"`
+	Payload        json.RawMessage `json:"payload" db:"payload" swaggertype:"object"`
+	Status         string          `json:"status" db:"status"`
+	Attempts       int             `json:"attempts" db:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at" db:"next_attempt_at"`
+	LockedUntil    *time.Time      `json:"locked_until,omitempty" db:"locked_until"`
+	LastError      *string         `json:"last_error,omitempty" db:"last_error"`
+	LastStatusCode *int            `json:"last_status_code,omitempty" db:"last_status_code"`
+	DeliveredAt    *time.Time      `json:"delivered_at,omitempty" db:"delivered_at"`
+	CreatedAt      time.Time       `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,164 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+// APIKeyRepository manages the api_keys table. A key is looked up by its hash
+// before the request's tenant is known, so the table is not scoped by the
+// client; every other method filters on the tenant of ctx itself.
+type APIKeyRepository interface {
+	auth.APIKeys
+	GetAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	CreateAPIKey(ctx context.Context, key models.APIKey) (*models.APIKey, error)
+	// RevokeAPIKey revokes the key with id at revokedAt. Revoking a key that
+	// is already revoked returns a not found error.
+	RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error
+}
+
+// apiKeyRow is an api_keys row; the API never returns the tenant or hash.
+type apiKeyRow struct {
+	models.APIKey
+	TenantID string `json:"tenant_id"`
+	KeyHash  string `json:"key_hash"`
+}
+
+type SupabaseAPIKeyRepository struct {
+	client *Client
+}
+
+func NewAPIKeyRepository(client *Client) APIKeyRepository {
+	return &SupabaseAPIKeyRepository{client: client}
+}
+
+func (r *SupabaseAPIKeyRepository) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	tenantID, err := requireTenant(ctx, "api_keys")
+	if err != nil {
+		return nil, err
+	}
+	resp, _, err := r.client.From(ctx, "api_keys").
+		Select("*", "", false).
+		Filter("tenant_id", "eq", tenantID).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API keys from Supabase: %w", err)
+	}
+	return decodeAPIKeys(resp)
+}
+
+func (r *SupabaseAPIKeyRepository) CreateAPIKey(ctx context.Context, key models.APIKey) (*models.APIKey, error) {
+	tenantID, err := requireTenant(ctx, "api_keys")
+	if err != nil {
+		return nil, err
+	}
+	insertData := map[string]interface{}{
+		"id":                    key.ID,
+		"tenant_id":             tenantID,
+		"name":                  key.Name,
+		"prefix":                key.Prefix,
+		"key_hash":              key.KeyHash,
+		"scopes":                key.Scopes,
+		"rate_limit_per_minute": key.RateLimitPerMinute,
+		"expires_at":            key.ExpiresAt,
+		"created_at":            key.CreatedAt.Format(time.RFC3339),
+	}
+
+	resp, _, err := r.client.From(ctx, "api_keys").
+		Insert(insertData, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to create API key: %w", err)
+	}
+	key.TenantID = tenantID
+	return &key, nil
+}
+
+func (r *SupabaseAPIKeyRepository) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error {
+	tenantID, err := requireTenant(ctx, "api_keys")
+	if err != nil {
+		return err
+	}
+	resp, _, err := r.client.From(ctx, "api_keys").
+		Update(map[string]interface{}{"revoked_at": revokedAt.Format(time.RFC3339)}, "representation", "").
+		Filter("id", "eq", id).
+		Filter("tenant_id", "eq", tenantID).
+		Filter("revoked_at", "is", "null").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to revoke API key %s: %w", id, err)
+	}
+
+	var revoked []map[string]interface{}
+	if err := json.Unmarshal(resp, &revoked); err != nil {
+		return fmt.Errorf("failed to unmarshal API key revoke response: %w", err)
+	}
+	if len(revoked) == 0 {
+		return fmt.Errorf("API key with ID %s %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *SupabaseAPIKeyRepository) APIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	resp, _, err := r.client.From(ctx, "api_keys").
+		Select("*", "", false).
+		Filter("key_hash", "eq", hash).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch API key from Supabase: %w", err)
+	}
+	keys, err := decodeAPIKeys(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, auth.ErrUnknownAPIKey
+	}
+	return &keys[0], nil
+}
+
+func (r *SupabaseAPIKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	resp, _, err := r.client.From(ctx, "api_keys").
+		Update(map[string]interface{}{"last_used_at": usedAt.UTC().Format(time.RFC3339)}, "minimal", "").
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to record use of API key %s: %w", id, err)
+	}
+	return nil
+}
+
+// requireTenant returns the tenant of ctx, for queries on a table the client
+// does not scope.
+func requireTenant(ctx context.Context, table string) (string, error) {
+	tenantID := tenant.ID(ctx)
+	if tenantID == "" {
+		return "", fmt.Errorf("%w: %s", ErrNoTenant, table)
+	}
+	return tenantID, nil
+}
+
+func decodeAPIKeys(resp []byte) ([]models.APIKey, error) {
+	var rows []apiKeyRow
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal API keys response: %w", err)
+	}
+	keys := make([]models.APIKey, len(rows))
+	for i, row := range rows {
+		keys[i] = row.APIKey
+		keys[i].TenantID = row.TenantID
+		keys[i].KeyHash = row.KeyHash
+	}
+	return keys, nil
+}
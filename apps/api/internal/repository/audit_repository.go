@@ -0,0 +1,75 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+)
+
+// SupabaseAuditRepository appends PHI access records to the phi_access_log
+// table, which rejects updates and deletes.
+type SupabaseAuditRepository struct {
+	client *Client
+}
+
+func NewAuditRepository(client *Client) audit.Store {
+	return &SupabaseAuditRepository{client: client}
+}
+
+func (r *SupabaseAuditRepository) Append(ctx context.Context, records []audit.Record) error {
+	if len(records) == 0 {
+		return nil
+	}
+	rows := make([]map[string]interface{}, len(records))
+	for i, record := range records {
+		rows[i] = map[string]interface{}{
+			"occurred_at":  record.OccurredAt.Format(time.RFC3339Nano),
+			"actor":        record.Actor,
+			"purpose":      record.Purpose,
+			"request_id":   record.RequestID,
+			"method":       record.Method,
+			"route":        record.Route,
+			"action":       record.Action,
+			"client_ids":   record.ClientIDs,
+			"schedule_ids": record.ScheduleIDs,
+			"fields":       record.Fields,
+		}
+	}
+
+	resp, _, err := r.client.From(ctx, "phi_access_log").
+		Insert(rows, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to append %d PHI access records: %w", len(records), err)
+	}
+	return nil
+}
+
+func (r *SupabaseAuditRepository) ListByClient(ctx context.Context, clientID string, limit int) ([]audit.Record, error) {
+	var records []audit.Record
+	resp, _, err := r.client.From(ctx, "phi_access_log").
+		Select("*", "", false).
+		Filter("client_ids", "cs", arrayLiteral(clientID)).
+		Order("occurred_at", nil).
+		Limit(limit, "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch PHI access records from Supabase: %w", err)
+	}
+	if err := json.Unmarshal(resp, &records); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal PHI access records response: %w", err)
+	}
+	return records, nil
+}
+
+// arrayLiteral returns a one-element Postgres array literal, quoted so that
+// commas and braces in value are taken literally.
+func arrayLiteral(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(value)
+	return `{"` + escaped + `"}`
+}
@@ -0,0 +1,255 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+type BranchRepository interface {
+	GetRegions(ctx context.Context) ([]models.Region, error)
+	CreateRegion(ctx context.Context, region models.Region) (*models.Region, error)
+	// GetBranches returns the branches, of one region if regionID is set.
+	GetBranches(ctx context.Context, regionID string) ([]models.Branch, error)
+	// GetBranchByID returns the branch with its members.
+	GetBranchByID(ctx context.Context, id string) (*models.Branch, error)
+	CreateBranch(ctx context.Context, branch models.Branch) (*models.Branch, error)
+	// AssignMember adds memberID to the branch's members of kind. A client
+	// is moved from its previous branch, if any.
+	AssignMember(ctx context.Context, branchID, kind, memberID string) error
+	UnassignMember(ctx context.Context, branchID, kind, memberID string) error
+	SupervisedBranchIDs(ctx context.Context, userID string) ([]string, error)
+	// ClientBranchID returns the branch the client belongs to, or "".
+	ClientBranchID(ctx context.Context, clientID string) (string, error)
+}
+
+// branchMembers are the assignment tables of each kind of branch member, with
+// the column holding the member and the key upserts conflict on.
+var branchMembers = map[string]struct {
+	table, column, onConflict string
+}{
+	models.BranchClients:     {"client_branches", "client_id", "tenant_id,client_id"},
+	models.BranchCaregivers:  {"caregiver_branches", "caregiver_id", "tenant_id,caregiver_id,branch_id"},
+	models.BranchSupervisors: {"branch_supervisors", "user_id", "tenant_id,user_id,branch_id"},
+}
+
+type SupabaseBranchRepository struct {
+	client *Client
+}
+
+func NewBranchRepository(client *Client) BranchRepository {
+	return &SupabaseBranchRepository{client: client}
+}
+
+func (r *SupabaseBranchRepository) GetRegions(ctx context.Context) ([]models.Region, error) {
+	var regions []models.Region
+	resp, _, err := r.client.From(ctx, "regions").
+		Select("*", "", false).
+		Order("name", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch regions from Supabase: %w", err)
+	}
+
+	if err := json.Unmarshal(resp, &regions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal regions response: %w", err)
+	}
+	return regions, nil
+}
+
+func (r *SupabaseBranchRepository) CreateRegion(ctx context.Context, region models.Region) (*models.Region, error) {
+	insertData := map[string]interface{}{
+		"id":         region.ID,
+		"name":       region.Name,
+		"created_at": region.CreatedAt.Format(time.RFC3339),
+	}
+
+	resp, _, err := r.client.From(ctx, "regions").
+		Insert(insertData, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to create region: %w", err)
+	}
+	return &region, nil
+}
+
+func (r *SupabaseBranchRepository) GetBranches(ctx context.Context, regionID string) ([]models.Branch, error) {
+	builder := r.client.From(ctx, "branches").
+		Select("*", "", false).
+		Order("name", &postgrest.OrderOpts{Ascending: true})
+	if regionID != "" {
+		builder = builder.Filter("region_id", "eq", regionID)
+	}
+
+	resp, _, err := builder.Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch branches from Supabase: %w", err)
+	}
+
+	var branches []models.Branch
+	if err := json.Unmarshal(resp, &branches); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal branches response: %w", err)
+	}
+	return branches, nil
+}
+
+func (r *SupabaseBranchRepository) GetBranchByID(ctx context.Context, id string) (*models.Branch, error) {
+	resp, _, err := r.client.From(ctx, "branches").
+		Select("*", "", false).
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch branch %s from Supabase: %w", id, err)
+	}
+
+	var branches []models.Branch
+	if err := json.Unmarshal(resp, &branches); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal branch response: %w", err)
+	}
+	if len(branches) == 0 {
+		return nil, fmt.Errorf("branch with ID %s %w", id, ErrNotFound)
+	}
+	branch := &branches[0]
+
+	members := map[string]*[]string{
+		models.BranchClients:     &branch.ClientIDs,
+		models.BranchCaregivers:  &branch.CaregiverIDs,
+		models.BranchSupervisors: &branch.SupervisorIDs,
+	}
+	for kind, ids := range members {
+		if *ids, err = r.memberIDs(ctx, kind, "branch_id", id); err != nil {
+			return nil, err
+		}
+	}
+	return branch, nil
+}
+
+func (r *SupabaseBranchRepository) CreateBranch(ctx context.Context, branch models.Branch) (*models.Branch, error) {
+	insertData := map[string]interface{}{
+		"id":         branch.ID,
+		"region_id":  branch.RegionID,
+		"name":       branch.Name,
+		"created_at": branch.CreatedAt.Format(time.RFC3339),
+	}
+
+	resp, _, err := r.client.From(ctx, "branches").
+		Insert(insertData, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to create branch: %w", err)
+	}
+	return &branch, nil
+}
+
+func (r *SupabaseBranchRepository) AssignMember(ctx context.Context, branchID, kind, memberID string) error {
+	members, ok := branchMembers[kind]
+	if !ok {
+		return fmt.Errorf("repository: unknown branch member kind %q", kind)
+	}
+
+	resp, _, err := r.client.From(ctx, members.table).
+		Insert(map[string]interface{}{"branch_id": branchID, members.column: memberID}, true, members.onConflict, "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to assign %s %s to branch %s: %w", kind, memberID, branchID, err)
+	}
+	return nil
+}
+
+func (r *SupabaseBranchRepository) UnassignMember(ctx context.Context, branchID, kind, memberID string) error {
+	members, ok := branchMembers[kind]
+	if !ok {
+		return fmt.Errorf("repository: unknown branch member kind %q", kind)
+	}
+
+	var removed []map[string]interface{}
+	resp, _, err := r.client.From(ctx, members.table).
+		Delete("representation", "").
+		Filter("branch_id", "eq", branchID).
+		Filter(members.column, "eq", memberID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("repository: failed to unassign %s %s from branch %s: %w", kind, memberID, branchID, err)
+	}
+
+	if err := json.Unmarshal(resp, &removed); err != nil {
+		return fmt.Errorf("failed to unmarshal branch member delete response: %w", err)
+	}
+	if len(removed) == 0 {
+		return fmt.Errorf("%s %s of branch %s %w", kind, memberID, branchID, ErrNotFound)
+	}
+	return nil
+}
+
+func (r *SupabaseBranchRepository) SupervisedBranchIDs(ctx context.Context, userID string) ([]string, error) {
+	resp, _, err := r.client.From(ctx, "branch_supervisors").
+		Select("branch_id", "", false).
+		Filter("user_id", "eq", userID).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch supervised branches from Supabase: %w", err)
+	}
+
+	var rows []struct {
+		BranchID string `json:"branch_id"`
+	}
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal supervised branches response: %w", err)
+	}
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row.BranchID
+	}
+	return ids, nil
+}
+
+func (r *SupabaseBranchRepository) ClientBranchID(ctx context.Context, clientID string) (string, error) {
+	resp, _, err := r.client.From(ctx, "client_branches").
+		Select("branch_id", "", false).
+		Filter("client_id", "eq", clientID).
+		Execute()
+	if err != nil {
+		return "", fmt.Errorf("failed to fetch client branch from Supabase: %w", err)
+	}
+
+	var rows []struct {
+		BranchID string `json:"branch_id"`
+	}
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return "", fmt.Errorf("failed to unmarshal client branch response: %w", err)
+	}
+	if len(rows) == 0 {
+		return "", nil
+	}
+	return rows[0].BranchID, nil
+}
+
+// memberIDs returns the members of kind whose column equals value.
+func (r *SupabaseBranchRepository) memberIDs(ctx context.Context, kind, column, value string) ([]string, error) {
+	members := branchMembers[kind]
+	resp, _, err := r.client.From(ctx, members.table).
+		Select(members.column, "", false).
+		Filter(column, "eq", value).
+		Order(members.column, &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch branch %s from Supabase: %w", kind, err)
+	}
+
+	var rows []map[string]string
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal branch %s response: %w", kind, err)
+	}
+	ids := make([]string, len(rows))
+	for i, row := range rows {
+		ids[i] = row[members.column]
+	}
+	return ids, nil
+}
@@ -0,0 +1,89 @@
+package repository
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// breaker is a circuit breaker over Supabase requests. After threshold
+// consecutive failures it opens and rejects requests with ErrUnavailable for
+// cooldown; then it lets one request through, and that request's outcome
+// closes or reopens it.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	state     breakerState
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow returns ErrUnavailable if a request may not be sent now.
+func (b *breaker) allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if time.Now().Before(b.openUntil) {
+			return ErrUnavailable
+		}
+		b.state = breakerHalfOpen
+	case breakerHalfOpen:
+		if b.probing {
+			return ErrUnavailable
+		}
+	default:
+		return nil
+	}
+	b.probing = true
+	return nil
+}
+
+func (b *breaker) success(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state != breakerClosed {
+		slog.InfoContext(ctx, "Supabase circuit breaker closed")
+	}
+	b.state, b.failures, b.probing = breakerClosed, 0, false
+}
+
+func (b *breaker) failure(ctx context.Context) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		if b.state != breakerOpen {
+			slog.WarnContext(ctx, "Supabase circuit breaker opened", "failures", b.failures, "cooldown", b.cooldown.String())
+		}
+		b.state, b.openUntil, b.probing = breakerOpen, time.Now().Add(b.cooldown), false
+	}
+}
+
+// abandon releases a request that ended without telling whether Supabase is
+// healthy, so that another request can probe it.
+func (b *breaker) abandon() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
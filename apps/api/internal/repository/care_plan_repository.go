@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+type CarePlanRepository interface {
+	CreateCarePlan(ctx context.Context, plan models.CarePlan) (*models.CarePlan, error)
+	GetCarePlanByID(ctx context.Context, id string) (*models.CarePlan, error)
+	GetActiveCarePlan(ctx context.Context, clientID string) (*models.CarePlan, error)
+	ReplaceTemplates(ctx context.Context, planID string, templates []models.TaskTemplate, updatedAt time.Time) error
+}
+
+type SupabaseCarePlanRepository struct {
+	client *Client
+}
+
+func NewCarePlanRepository(client *Client) CarePlanRepository {
+	return &SupabaseCarePlanRepository{client: client}
+}
+
+// CreateCarePlan stores a new active plan with its templates and retires the
+// client's previous active plan.
+func (r *SupabaseCarePlanRepository) CreateCarePlan(ctx context.Context, plan models.CarePlan) (*models.CarePlan, error) {
+	resp, _, err := r.client.From(ctx, "care_plans").
+		Update(map[string]interface{}{"active": false, "updated_at": plan.CreatedAt.Format(time.RFC3339)}, "minimal", "").
+		Filter("client_id", "eq", plan.ClientID).
+		Filter("active", "eq", "true").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to retire care plans for client %s: %w", plan.ClientID, err)
+	}
+
+	insertData := map[string]interface{}{
+		"id":         plan.ID,
+		"client_id":  plan.ClientID,
+		"name":       plan.Name,
+		"active":     true,
+		"created_at": plan.CreatedAt.Format(time.RFC3339),
+		"updated_at": plan.UpdatedAt.Format(time.RFC3339),
+	}
+	resp, _, err = r.client.From(ctx, "care_plans").
+		Insert(insertData, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to create care plan: %w", err)
+	}
+
+	if err := r.insertTemplates(ctx, plan.Templates); err != nil {
+		return nil, err
+	}
+	return r.GetCarePlanByID(ctx, plan.ID)
+}
+
+func (r *SupabaseCarePlanRepository) GetCarePlanByID(ctx context.Context, id string) (*models.CarePlan, error) {
+	var plans []models.CarePlan
+	resp, _, err := r.client.From(ctx, "care_plans").
+		Select("*", "", false).
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch care plan by ID from Supabase: %w", err)
+	}
+	if err := json.Unmarshal(resp, &plans); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal care plan response: %w", err)
+	}
+	if len(plans) == 0 {
+		return nil, fmt.Errorf("care plan with ID %s %w", id, ErrNotFound)
+	}
+
+	plan := &plans[0]
+	if plan.Templates, err = r.getTemplates(ctx, plan.ID); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// GetActiveCarePlan returns the client's active plan, or nil when the client
+// has none.
+func (r *SupabaseCarePlanRepository) GetActiveCarePlan(ctx context.Context, clientID string) (*models.CarePlan, error) {
+	var plans []models.CarePlan
+	resp, _, err := r.client.From(ctx, "care_plans").
+		Select("*", "", false).
+		Filter("client_id", "eq", clientID).
+		Filter("active", "eq", "true").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch active care plan from Supabase: %w", err)
+	}
+	if err := json.Unmarshal(resp, &plans); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal care plan response: %w", err)
+	}
+	if len(plans) == 0 {
+		return nil, nil
+	}
+
+	plan := &plans[0]
+	if plan.Templates, err = r.getTemplates(ctx, plan.ID); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+func (r *SupabaseCarePlanRepository) ReplaceTemplates(ctx context.Context, planID string, templates []models.TaskTemplate, updatedAt time.Time) error {
+	resp, _, err := r.client.From(ctx, "care_plan_task_templates").
+		Delete("minimal", "").
+		Filter("care_plan_id", "eq", planID).
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to delete templates of care plan %s: %w", planID, err)
+	}
+
+	if err := r.insertTemplates(ctx, templates); err != nil {
+		return err
+	}
+
+	resp, _, err = r.client.From(ctx, "care_plans").
+		Update(map[string]interface{}{"updated_at": updatedAt.Format(time.RFC3339)}, "minimal", "").
+		Filter("id", "eq", planID).
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to touch care plan %s: %w", planID, err)
+	}
+	return nil
+}
+
+func (r *SupabaseCarePlanRepository) insertTemplates(ctx context.Context, templates []models.TaskTemplate) error {
+	if len(templates) == 0 {
+		return nil
+	}
+	resp, _, err := r.client.From(ctx, "care_plan_task_templates").
+		Insert(templates, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to insert care plan templates: %w", err)
+	}
+	return nil
+}
+
+func (r *SupabaseCarePlanRepository) getTemplates(ctx context.Context, planID string) ([]models.TaskTemplate, error) {
+	var templates []models.TaskTemplate
+	resp, _, err := r.client.From(ctx, "care_plan_task_templates").
+		Select("*", "", false).
+		Filter("care_plan_id", "eq", planID).
+		Order("position", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch templates of care plan %s from Supabase: %w", planID, err)
+	}
+	if err := json.Unmarshal(resp, &templates); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal care plan templates response: %w", err)
+	}
+	if templates == nil {
+		templates = []models.TaskTemplate{}
+	}
+	return templates, nil
+}
@@ -0,0 +1,135 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+// ErrUnavailable is returned without calling Supabase while the circuit
+// breaker is open.
+var ErrUnavailable = errors.New("repository: Supabase is unavailable")
+
+// ErrNotFound is wrapped by the errors for rows that do not exist, so the
+// message reads "schedule with ID ... not found".
+var ErrNotFound = errors.New("not found")
+
+type ClientConfig struct {
+	// MaxAttempts bounds the tries of one request, the first one included.
+	MaxAttempts int
+	// BaseBackoff and MaxBackoff bound the jittered wait between tries.
+	BaseBackoff time.Duration
+	MaxBackoff  time.Duration
+	// BreakerThreshold consecutive failed requests open the circuit breaker
+	// for BreakerCooldown, after which a single request probes Supabase.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// Transport sends the requests; nil means http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{
+		MaxAttempts:      3,
+		BaseBackoff:      100 * time.Millisecond,
+		MaxBackoff:       time.Second,
+		BreakerThreshold: 5,
+		BreakerCooldown:  30 * time.Second,
+	}
+}
+
+// Client builds PostgREST queries against Supabase. Unlike supabase.Client it
+// binds every query to the caller's context, retries transient failures and
+// fails fast while Supabase is down.
+type Client struct {
+	restURL   string
+	headers   map[string]string
+	transport http.RoundTripper
+}
+
+func NewClient(supabaseURL, key string, config ClientConfig) (*Client, error) {
+	if supabaseURL == "" || key == "" {
+		return nil, errors.New("repository: Supabase URL and key are required")
+	}
+	if _, err := url.Parse(supabaseURL); err != nil {
+		return nil, fmt.Errorf("repository: invalid Supabase URL: %w", err)
+	}
+
+	defaults := DefaultClientConfig()
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = defaults.BaseBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.BreakerThreshold <= 0 {
+		config.BreakerThreshold = defaults.BreakerThreshold
+	}
+	if config.BreakerCooldown <= 0 {
+		config.BreakerCooldown = defaults.BreakerCooldown
+	}
+	if config.Transport == nil {
+		config.Transport = http.DefaultTransport
+	}
+
+	return &Client{
+		restURL: strings.TrimRight(supabaseURL, "/") + "/rest/v1",
+		headers: map[string]string{
+			"Authorization": "Bearer " + key,
+			"apikey":        key,
+		},
+		transport: &retryTransport{
+			next:        config.Transport,
+			breaker:     newBreaker(config.BreakerThreshold, config.BreakerCooldown),
+			maxAttempts: config.MaxAttempts,
+			baseBackoff: config.BaseBackoff,
+			maxBackoff:  config.MaxBackoff,
+		},
+	}, nil
+}
+
+// From starts a query on table whose requests carry ctx and are scoped to the
+// tenant of ctx (see scopeToTenant). postgrest-go builds its requests without a
+// context, so each query gets its own small PostgREST client whose transport
+// attaches ctx instead.
+func (c *Client) From(ctx context.Context, table string) *postgrest.QueryBuilder {
+	rest := postgrest.NewClient(c.restURL, "public", c.headers)
+	rest.Transport.Parent = contextTransport{ctx: ctx, table: table, next: c.transport}
+	return rest.From(table)
+}
+
+// rpc calls a Postgres function through PostgREST (POST /rpc/<name>). It goes
+// through From rather than postgrest.Client.Rpc, which stores failures in the
+// client's ClientError and takes no context.
+func (c *Client) rpc(ctx context.Context, name string, params map[string]interface{}) ([]byte, error) {
+	resp, _, err := c.From(ctx, "rpc/"+name).
+		Insert(params, false, "", "representation", "").
+		Execute()
+	return resp, err
+}
+
+// contextTransport sends requests with ctx, so that they are cancelled with
+// the call that made them, and limits them to the tenant of ctx.
+type contextTransport struct {
+	ctx   context.Context
+	table string
+	next  http.RoundTripper
+}
+
+func (t contextTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	scoped, err := scopeToTenant(req.WithContext(t.ctx), t.table, tenant.ID(t.ctx))
+	if err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(scoped)
+}
@@ -0,0 +1,207 @@
+package repository_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// fakePostgREST serves status codes from statuses in turn, then 200 with an
+// empty result, and counts the requests it receives.
+type fakePostgREST struct {
+	*httptest.Server
+	requests atomic.Int32
+}
+
+func newFakePostgREST(t *testing.T, statuses ...int) *fakePostgREST {
+	t.Helper()
+	fake := &fakePostgREST{}
+	fake.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(fake.requests.Add(1))
+		if r.Header.Get("apikey") != "test-key" {
+			t.Errorf("Expected the API key on %s %s", r.Method, r.URL.Path)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if n <= len(statuses) {
+			w.WriteHeader(statuses[n-1])
+			w.Write([]byte(`{"code": "PGRST000", "message": "Could not connect"}`))
+			return
+		}
+		if r.URL.Path == "/rest/v1/rpc/refresh_schedule_daily_stats" {
+			w.Write([]byte(`3`))
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	t.Cleanup(fake.Close)
+	return fake
+}
+
+// tenantContext returns a context scoped to the default tenant, which the
+// client requires of every query on tenant data.
+func tenantContext() context.Context {
+	return tenant.WithID(context.Background(), tenant.DefaultID)
+}
+
+func newClient(t *testing.T, url string, config repository.ClientConfig) *repository.Client {
+	t.Helper()
+	config.BaseBackoff, config.MaxBackoff = time.Millisecond, 5*time.Millisecond
+	client, err := repository.NewClient(url, "test-key", config)
+	if err != nil {
+		t.Fatalf("Expected the client to build, got %v", err)
+	}
+	return client
+}
+
+func TestClientRetriesTransientFailures(t *testing.T) {
+	refresh := func(repo repository.ScheduleRepository) error {
+		_, err := repo.RefreshDailyStats(tenantContext(), time.Now(), time.Now())
+		return err
+	}
+
+	cases := []struct {
+		name     string
+		call     func(repository.ScheduleRepository) error
+		statuses []int
+		wantErr  bool
+		wantReqs int32
+	}{
+		{"read recovers", func(repo repository.ScheduleRepository) error { return repo.Ping(tenantContext()) },
+			[]int{http.StatusServiceUnavailable, http.StatusBadGateway}, false, 3},
+		{"read gives up", func(repo repository.ScheduleRepository) error { return repo.Ping(tenantContext()) },
+			[]int{http.StatusGatewayTimeout, http.StatusGatewayTimeout, http.StatusGatewayTimeout}, true, 3},
+		{"read error is not retried", func(repo repository.ScheduleRepository) error { return repo.Ping(tenantContext()) },
+			[]int{http.StatusBadRequest}, true, 1},
+		{"write without a database connection recovers", refresh,
+			[]int{http.StatusServiceUnavailable}, false, 2},
+		{"write that may have run is not repeated", refresh,
+			[]int{http.StatusBadGateway}, true, 1},
+	}
+	for _, tc := range cases {
+		fake := newFakePostgREST(t, tc.statuses...)
+		repo := repository.NewScheduleRepository(newClient(t, fake.URL, repository.ClientConfig{MaxAttempts: 3}), nil)
+
+		if err := tc.call(repo); (err != nil) != tc.wantErr {
+			t.Errorf("%s: expected error %v, got %v", tc.name, tc.wantErr, err)
+		}
+		if got := fake.requests.Load(); got != tc.wantReqs {
+			t.Errorf("%s: expected %d requests, got %d", tc.name, tc.wantReqs, got)
+		}
+	}
+}
+
+func TestClientHonorsContext(t *testing.T) {
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer fake.Close()
+	repo := repository.NewScheduleRepository(newClient(t, fake.URL, repository.ClientConfig{}), nil)
+
+	ctx, cancel := context.WithTimeout(tenantContext(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := repo.Ping(ctx)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected the deadline to end the call, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Expected the call to stop at its deadline, took %s", elapsed)
+	}
+}
+
+func TestClientCircuitBreaker(t *testing.T) {
+	fake := newFakePostgREST(t, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	repo := repository.NewScheduleRepository(newClient(t, fake.URL, repository.ClientConfig{
+		MaxAttempts:      1,
+		BreakerThreshold: 2,
+		BreakerCooldown:  100 * time.Millisecond,
+	}), nil)
+	ctx := tenantContext()
+
+	for i := 0; i < 2; i++ {
+		if err := repo.Ping(ctx); err == nil || errors.Is(err, repository.ErrUnavailable) {
+			t.Fatalf("Expected failure %d to reach Supabase, got %v", i+1, err)
+		}
+	}
+	if err := repo.Ping(ctx); !errors.Is(err, repository.ErrUnavailable) {
+		t.Fatalf("Expected the open breaker to fail fast, got %v", err)
+	}
+	if got := fake.requests.Load(); got != 2 {
+		t.Errorf("Expected the open breaker to hold back requests, got %d requests", got)
+	}
+
+	time.Sleep(150 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := repo.Ping(ctx); err != nil {
+			t.Fatalf("Expected the breaker to close once Supabase recovers, got %v", err)
+		}
+	}
+}
+
+// recordedRequest is what a request sent Supabase scoped itself to.
+type recordedRequest struct {
+	method, path, filter string
+	body                 string
+}
+
+func TestClientScopesQueriesToTenant(t *testing.T) {
+	var recorded []recordedRequest
+	fake := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		recorded = append(recorded, recordedRequest{r.Method, r.URL.Path, r.URL.Query().Get("tenant_id"), string(body)})
+		w.Header().Set("Content-Type", "application/json")
+		if strings.HasPrefix(r.URL.Path, "/rest/v1/rpc/") {
+			w.Write([]byte(`0`))
+			return
+		}
+		w.Write([]byte(`[{"id": "t1"}]`))
+	}))
+	defer fake.Close()
+	client := newClient(t, fake.URL, repository.ClientConfig{MaxAttempts: 1})
+	repo := repository.NewScheduleRepository(client, nil)
+
+	if err := repo.Ping(context.Background()); !errors.Is(err, repository.ErrNoTenant) {
+		t.Errorf("Expected a query without a tenant to fail with ErrNoTenant, got %v", err)
+	}
+	if len(recorded) != 0 {
+		t.Fatalf("Expected a query without a tenant not to reach Supabase, got %+v", recorded)
+	}
+
+	ctx := tenant.WithID(context.Background(), "agency-a")
+	repo.Ping(ctx)
+	repository.NewWebhookRepository(client).UpdateDelivery(ctx, models.WebhookDelivery{ID: "d1"})
+	repository.NewWebhookRepository(client).CreateSubscription(ctx, models.WebhookSubscription{ID: "w1"})
+	repo.StartVisit(ctx, "s1", time.Now(), models.Location{}, events.Event{ID: "e1", Type: events.VisitStarted})
+	repo.RefreshDailyStats(ctx, time.Now(), time.Now())
+
+	want := []struct {
+		method, path, filter, bodyField string
+	}{
+		{http.MethodGet, "/rest/v1/schedules", "eq.agency-a", ""},
+		{http.MethodPatch, "/rest/v1/webhook_deliveries", "eq.agency-a", `"tenant_id":"agency-a"`},
+		{http.MethodPost, "/rest/v1/webhook_subscriptions", "", `"tenant_id":"agency-a"`},
+		{http.MethodPost, "/rest/v1/rpc/record_visit_change", "", `"p_tenant_id":"agency-a"`},
+		{http.MethodPost, "/rest/v1/rpc/refresh_schedule_daily_stats", "", `"p_tenant_id":"agency-a"`},
+	}
+	if len(recorded) != len(want) {
+		t.Fatalf("Expected %d requests, got %+v", len(want), recorded)
+	}
+	for i, w := range want {
+		got := recorded[i]
+		if got.method != w.method || got.path != w.path || got.filter != w.filter || !strings.Contains(got.body, w.bodyField) {
+			t.Errorf("Expected %s %s scoped with filter %q and body %s, got %+v", w.method, w.path, w.filter, w.bodyField, got)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/encryption"
+)
+
+// SupabaseKeyRepository stores the wrapped data keys of encryption.Keyring in
+// the encryption_keys table.
+type SupabaseKeyRepository struct {
+	client *Client
+}
+
+func NewKeyRepository(client *Client) encryption.KeyStore {
+	return &SupabaseKeyRepository{client: client}
+}
+
+func (r *SupabaseKeyRepository) ActiveDataKey(ctx context.Context, tenantID string) (*encryption.DataKey, error) {
+	var keys []encryption.DataKey
+	resp, _, err := r.client.From(ctx, "encryption_keys").
+		Select("*", "", false).
+		Filter("tenant_id", "eq", tenantID).
+		Filter("status", "eq", encryption.StatusActive).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch active data key from Supabase: %w", err)
+	}
+	if err := json.Unmarshal(resp, &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data key response: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, nil
+	}
+	return &keys[0], nil
+}
+
+func (r *SupabaseKeyRepository) DataKey(ctx context.Context, id string) (*encryption.DataKey, error) {
+	var keys []encryption.DataKey
+	resp, _, err := r.client.From(ctx, "encryption_keys").
+		Select("*", "", false).
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data key from Supabase: %w", err)
+	}
+	if err := json.Unmarshal(resp, &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data key response: %w", err)
+	}
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("data key %s %w", id, ErrNotFound)
+	}
+	return &keys[0], nil
+}
+
+func (r *SupabaseKeyRepository) ListDataKeys(ctx context.Context) ([]encryption.DataKey, error) {
+	var keys []encryption.DataKey
+	resp, _, err := r.client.From(ctx, "encryption_keys").
+		Select("*", "", false).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch data keys from Supabase: %w", err)
+	}
+	if err := json.Unmarshal(resp, &keys); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal data keys response: %w", err)
+	}
+	return keys, nil
+}
+
+func (r *SupabaseKeyRepository) CreateDataKey(ctx context.Context, key encryption.DataKey) error {
+	insertData := map[string]interface{}{
+		"id":            key.ID,
+		"tenant_id":     key.TenantID,
+		"master_key_id": key.MasterKeyID,
+		"wrapped_key":   key.WrappedKey,
+		"status":        key.Status,
+	}
+	resp, _, err := r.client.From(ctx, "encryption_keys").
+		Insert(insertData, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to create data key: %w", err)
+	}
+	return nil
+}
+
+func (r *SupabaseKeyRepository) RetireDataKeys(ctx context.Context, tenantID string) error {
+	resp, _, err := r.client.From(ctx, "encryption_keys").
+		Update(map[string]interface{}{"status": encryption.StatusRetired}, "", "minimal").
+		Filter("tenant_id", "eq", tenantID).
+		Filter("status", "eq", encryption.StatusActive).
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to retire data keys of tenant %s: %w", tenantID, err)
+	}
+	return nil
+}
+
+func (r *SupabaseKeyRepository) UpdateWrappedKey(ctx context.Context, id, masterKeyID, wrappedKey string) error {
+	updateData := map[string]interface{}{
+		"master_key_id": masterKeyID,
+		"wrapped_key":   wrappedKey,
+	}
+	resp, _, err := r.client.From(ctx, "encryption_keys").
+		Update(updateData, "", "minimal").
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to update data key %s: %w", id, err)
+	}
+	return nil
+}
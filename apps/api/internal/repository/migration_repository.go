@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// RequiredSchemaVersion is the latest version in schemas/schema_migrations.sql.
+// Bump both together when a schema file changes.
+const RequiredSchemaVersion = 19
+
+type MigrationRepository interface {
+	// SchemaVersion returns the highest applied schema version.
+	SchemaVersion(ctx context.Context) (int, error)
+}
+
+type SupabaseMigrationRepository struct {
+	client *Client
+}
+
+func NewMigrationRepository(client *Client) MigrationRepository {
+	return &SupabaseMigrationRepository{client: client}
+}
+
+func (r *SupabaseMigrationRepository) SchemaVersion(ctx context.Context) (int, error) {
+	resp, _, err := r.client.From(ctx, "schema_migrations").
+		Select("version", "", false).
+		Order("version", nil).
+		Limit(1, "").
+		Execute()
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to read schema_migrations: %w", err)
+	}
+
+	var rows []struct {
+		Version int `json:"version"`
+	}
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal schema migrations response: %w", err)
+	}
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	return rows[0].Version, nil
+}
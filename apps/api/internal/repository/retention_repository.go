@@ -0,0 +1,111 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+type RetentionRepository interface {
+	// Purge removes or anonymizes at most limit rows of policy's data class
+	// that are older than cutoff, skipping clients on legal hold, and returns
+	// how many it changed. With dryRun it changes nothing and returns how
+	// many rows are due.
+	Purge(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, limit int, dryRun bool) (int, error)
+	GetLegalHolds(ctx context.Context) ([]models.LegalHold, error)
+	PlaceLegalHold(ctx context.Context, hold models.LegalHold) (*models.LegalHold, error)
+	ReleaseLegalHold(ctx context.Context, clientID string) error
+}
+
+type SupabaseRetentionRepository struct {
+	client *Client
+}
+
+func NewRetentionRepository(client *Client) RetentionRepository {
+	return &SupabaseRetentionRepository{client: client}
+}
+
+func (r *SupabaseRetentionRepository) Purge(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, limit int, dryRun bool) (int, error) {
+	resp, err := r.client.rpc(ctx, "retention_purge", map[string]interface{}{
+		"p_data_class": policy.DataClass,
+		"p_action":     policy.Action,
+		"p_cutoff":     cutoff.Format("2006-01-02T15:04:05"),
+		"p_limit":      limit,
+		"p_dry_run":    dryRun,
+	})
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return 0, fmt.Errorf("repository: failed to purge expired %s: %w", policy.DataClass, err)
+	}
+
+	var affected int
+	if err := json.Unmarshal(resp, &affected); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal retention purge response: %w", err)
+	}
+	return affected, nil
+}
+
+func (r *SupabaseRetentionRepository) GetLegalHolds(ctx context.Context) ([]models.LegalHold, error) {
+	var holds []models.LegalHold
+	resp, _, err := r.client.From(ctx, "legal_holds").
+		Select("*", "", false).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch legal holds from Supabase: %w", err)
+	}
+
+	if err := json.Unmarshal(resp, &holds); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal legal holds response: %w", err)
+	}
+	return holds, nil
+}
+
+// PlaceLegalHold adds hold, or replaces the reason of the client's existing hold.
+func (r *SupabaseRetentionRepository) PlaceLegalHold(ctx context.Context, hold models.LegalHold) (*models.LegalHold, error) {
+	insertData := map[string]interface{}{
+		"client_id":  hold.ClientID,
+		"reason":     hold.Reason,
+		"placed_by":  hold.PlacedBy,
+		"created_at": hold.CreatedAt.Format(time.RFC3339),
+	}
+
+	var placed []models.LegalHold
+	resp, _, err := r.client.From(ctx, "legal_holds").
+		Insert(insertData, true, "tenant_id,client_id", "representation", "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to place legal hold on client %s: %w", hold.ClientID, err)
+	}
+
+	if err := json.Unmarshal(resp, &placed); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal legal hold response: %w", err)
+	}
+	if len(placed) == 0 {
+		return nil, fmt.Errorf("repository: legal hold insert returned no rows")
+	}
+	return &placed[0], nil
+}
+
+func (r *SupabaseRetentionRepository) ReleaseLegalHold(ctx context.Context, clientID string) error {
+	var released []models.LegalHold
+	resp, _, err := r.client.From(ctx, "legal_holds").
+		Delete("representation", "").
+		Filter("client_id", "eq", clientID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("repository: failed to release legal hold on client %s: %w", clientID, err)
+	}
+
+	if err := json.Unmarshal(resp, &released); err != nil {
+		return fmt.Errorf("failed to unmarshal legal hold delete response: %w", err)
+	}
+	if len(released) == 0 {
+		return fmt.Errorf("legal hold on client %s %w", clientID, ErrNotFound)
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"time"
+)
+
+// retryTransport retries transient Supabase failures with jittered backoff
+// and reports each request's outcome to the circuit breaker.
+type retryTransport struct {
+	next        http.RoundTripper
+	breaker     *breaker
+	maxAttempts int
+	baseBackoff time.Duration
+	maxBackoff  time.Duration
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+	if err := t.breaker.allow(); err != nil {
+		return nil, err
+	}
+
+	attemptReq := req
+	for attempt := 1; ; attempt++ {
+		resp, err := t.next.RoundTrip(attemptReq)
+		switch {
+		case ctx.Err() != nil:
+			// The caller gave up, which says nothing about Supabase.
+			t.breaker.abandon()
+			return resp, err
+		case !transient(resp, err):
+			t.breaker.success(ctx)
+			return resp, err
+		case attempt >= t.maxAttempts || !retryable(req, resp, err) || (req.Body != nil && req.GetBody == nil):
+			t.breaker.failure(ctx)
+			return resp, err
+		}
+
+		if resp != nil {
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if err := sleep(ctx, t.backoff(attempt)); err != nil {
+			t.breaker.abandon()
+			return nil, err
+		}
+
+		attemptReq = req.Clone(ctx)
+		if req.GetBody != nil {
+			if attemptReq.Body, err = req.GetBody(); err != nil {
+				t.breaker.abandon()
+				return nil, err
+			}
+		}
+	}
+}
+
+// backoff doubles the wait after every failed attempt, capped at maxBackoff,
+// and picks a random point in its upper half so that callers that failed
+// together do not retry together.
+func (t *retryTransport) backoff(attempt int) time.Duration {
+	wait := t.baseBackoff
+	for i := 1; i < attempt && wait < t.maxBackoff; i++ {
+		wait *= 2
+	}
+	wait = min(wait, t.maxBackoff)
+	return wait/2 + rand.N(wait/2+1)
+}
+
+// transient reports whether a failure may go away on its own: the connection
+// failed, or Supabase's gateway or PostgREST could not reach the database.
+func transient(resp *http.Response, err error) bool {
+	if err != nil {
+		return !errors.Is(err, ErrUnavailable)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// retryable reports whether a transient failure can be retried without
+// repeating a write. Idempotent methods always can; other requests only when
+// they were never sent or PostgREST had no database connection to run them.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	if err != nil {
+		var opErr *net.OpError
+		return errors.As(err, &opErr) && opErr.Op == "dial"
+	}
+	return resp.StatusCode == http.StatusServiceUnavailable
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
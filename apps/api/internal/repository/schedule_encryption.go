@@ -0,0 +1,329 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/encryption"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+// scheduleRow is a schedules row as PostgREST returns it. The location columns
+// hold either a location object or, once encrypted, a JSON string of its
+// ciphertext, so they are decoded separately from the rest of the schedule.
+type scheduleRow struct {
+	models.Schedule
+	Location       json.RawMessage `json:"location"`
+	StartLocation  json.RawMessage `json:"start_location"`
+	EndLocation    json.RawMessage `json:"end_location"`
+	ClientNameBidx *string         `json:"client_name_bidx"`
+	Version        int64           `json:"version"`
+}
+
+// phiFields encrypts and decrypts the PHI columns of schedules: client_name,
+// service_notes and the location columns. Values are encrypted with the data
+// key, and indexed with the blind index key, of the tenant of the context.
+// With a nil keyring values are written as plaintext. Plaintext values are read as they are either way, so
+// rows written before encryption was turned on stay readable until
+// rotate-keys encrypts them.
+type phiFields struct {
+	keyring *encryption.Keyring
+}
+
+// keyTenant returns the tenant whose keys encrypt the rows written with ctx.
+func keyTenant(ctx context.Context) (string, error) {
+	if id := tenant.ID(ctx); id != "" {
+		return id, nil
+	}
+	return "", ErrNoTenant
+}
+
+// fieldAAD binds a ciphertext to its column and row.
+func fieldAAD(column, scheduleID string) string {
+	return "schedules." + column + ":" + scheduleID
+}
+
+func (f phiFields) encryptString(ctx context.Context, column, scheduleID, value string) (string, error) {
+	if f.keyring == nil || value == "" {
+		return value, nil
+	}
+	tenantID, err := keyTenant(ctx)
+	if err != nil {
+		return "", err
+	}
+	encrypted, err := f.keyring.Encrypt(ctx, tenantID, []byte(value), fieldAAD(column, scheduleID))
+	if err != nil {
+		return "", fmt.Errorf("repository: failed to encrypt %s of schedule %s: %w", column, scheduleID, err)
+	}
+	return encrypted, nil
+}
+
+func (f phiFields) decryptString(ctx context.Context, column, scheduleID, value string) (string, error) {
+	if !encryption.IsEncrypted(value) {
+		return value, nil
+	}
+	if f.keyring == nil {
+		return "", fmt.Errorf("repository: %s of schedule %s is encrypted but no keyfile is configured", column, scheduleID)
+	}
+	plaintext, err := f.keyring.Decrypt(ctx, value, fieldAAD(column, scheduleID))
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// encryptLocation returns the value to write to a location column: the
+// location itself, or the JSON string of its ciphertext.
+func (f phiFields) encryptLocation(ctx context.Context, column, scheduleID string, location models.Location) (interface{}, error) {
+	if f.keyring == nil {
+		return location, nil
+	}
+	raw, err := json.Marshal(location)
+	if err != nil {
+		return nil, err
+	}
+	return f.encryptString(ctx, column, scheduleID, string(raw))
+}
+
+// decryptLocation decodes a location column. It returns nil for NULL.
+func (f phiFields) decryptLocation(ctx context.Context, column, scheduleID string, raw json.RawMessage) (*models.Location, error) {
+	raw = bytes.TrimSpace(raw)
+	if len(raw) == 0 || bytes.Equal(raw, []byte("null")) {
+		return nil, nil
+	}
+	if raw[0] == '"' {
+		var encrypted string
+		if err := json.Unmarshal(raw, &encrypted); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal %s of schedule %s: %w", column, scheduleID, err)
+		}
+		plaintext, err := f.decryptString(ctx, column, scheduleID, encrypted)
+		if err != nil {
+			return nil, err
+		}
+		raw = []byte(plaintext)
+	}
+	var location models.Location
+	if err := json.Unmarshal(raw, &location); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal %s of schedule %s: %w", column, scheduleID, err)
+	}
+	return &location, nil
+}
+
+// blindIndex returns the client_name_bidx value for name, or nil when
+// encryption is off.
+func (f phiFields) blindIndex(ctx context.Context, name string) *string {
+	if f.keyring == nil {
+		return nil
+	}
+	bidx := f.keyring.BlindIndex(tenant.ID(ctx), name)
+	return &bidx
+}
+
+// decodeSchedules unmarshals a schedules response and decrypts its PHI.
+func (f phiFields) decodeSchedules(ctx context.Context, resp []byte) ([]models.Schedule, error) {
+	var rows []scheduleRow
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, err
+	}
+	schedules := make([]models.Schedule, len(rows))
+	for i, row := range rows {
+		schedule, err := f.decodeSchedule(ctx, row)
+		if err != nil {
+			return nil, err
+		}
+		schedules[i] = schedule
+	}
+	return schedules, nil
+}
+
+func (f phiFields) decodeSchedule(ctx context.Context, row scheduleRow) (models.Schedule, error) {
+	schedule := row.Schedule
+	schedule.Version = row.Version
+	var err error
+	if schedule.ClientName, err = f.decryptString(ctx, "client_name", schedule.ID, schedule.ClientName); err != nil {
+		return schedule, err
+	}
+	if schedule.ServiceNotes, err = f.decryptString(ctx, "service_notes", schedule.ID, schedule.ServiceNotes); err != nil {
+		return schedule, err
+	}
+	location, err := f.decryptLocation(ctx, "location", schedule.ID, row.Location)
+	if err != nil {
+		return schedule, err
+	}
+	if location != nil {
+		schedule.Location = *location
+	}
+	if schedule.StartLocation, err = f.decryptLocation(ctx, "start_location", schedule.ID, row.StartLocation); err != nil {
+		return schedule, err
+	}
+	if schedule.EndLocation, err = f.decryptLocation(ctx, "end_location", schedule.ID, row.EndLocation); err != nil {
+		return schedule, err
+	}
+	return schedule, nil
+}
+
+// ReencryptResult counts what a ScheduleReencrypter run did.
+type ReencryptResult struct {
+	Scanned   int
+	Rewritten int
+	// Skipped rows changed while they were being re-encrypted; running again
+	// picks them up.
+	Skipped int
+}
+
+// ScheduleReencrypter brings the PHI columns of existing schedules under the
+// active data key: it encrypts values written before encryption was turned
+// on, re-encrypts values under retired keys and fills in missing blind
+// indexes. It is safe to run while the API serves requests.
+type ScheduleReencrypter struct {
+	client *Client
+	fields phiFields
+}
+
+func NewScheduleReencrypter(client *Client, keyring *encryption.Keyring) *ScheduleReencrypter {
+	return &ScheduleReencrypter{client: client, fields: phiFields{keyring: keyring}}
+}
+
+// Run walks the schedules of the tenant of ctx in id order, batchSize rows per
+// request, and rewrites the rows that need it.
+func (r *ScheduleReencrypter) Run(ctx context.Context, batchSize int) (ReencryptResult, error) {
+	var result ReencryptResult
+	tenantID, err := keyTenant(ctx)
+	if err != nil {
+		return result, err
+	}
+	activeKeyID, err := r.fields.keyring.ActiveKeyID(ctx, tenantID)
+	if err != nil {
+		return result, err
+	}
+
+	cursor := ""
+	for {
+		builder := r.client.From(ctx, "schedules").
+			Select("id,status,client_name,client_name_bidx,service_notes,location,start_location,end_location", "", false).
+			Order("id", &postgrest.OrderOpts{Ascending: true}).
+			Limit(batchSize, "")
+		if cursor != "" {
+			builder = builder.Filter("id", "gt", cursor)
+		}
+		resp, _, err := builder.Execute()
+		if err != nil {
+			return result, fmt.Errorf("failed to fetch schedules from Supabase: %w", err)
+		}
+		var rows []scheduleRow
+		if err := json.Unmarshal(resp, &rows); err != nil {
+			return result, fmt.Errorf("failed to unmarshal schedules response: %w", err)
+		}
+
+		for _, row := range rows {
+			result.Scanned++
+			rewritten, err := r.reencrypt(ctx, row, activeKeyID)
+			if err != nil {
+				return result, err
+			}
+			switch {
+			case rewritten == nil:
+			case *rewritten:
+				result.Rewritten++
+			default:
+				result.Skipped++
+			}
+		}
+		if len(rows) < batchSize {
+			return result, nil
+		}
+		cursor = rows[len(rows)-1].ID
+	}
+}
+
+// reencrypt rewrites the columns of row that are not under activeKeyID. It
+// returns nil when the row needed nothing, and whether the update applied
+// otherwise.
+func (r *ScheduleReencrypter) reencrypt(ctx context.Context, row scheduleRow, activeKeyID string) (*bool, error) {
+	schedule, err := r.fields.decodeSchedule(ctx, row)
+	if err != nil {
+		return nil, err
+	}
+	stale := func(value string) bool {
+		return value != "" && encryption.KeyID(value) != activeKeyID
+	}
+
+	updateData := map[string]interface{}{}
+	if stale(row.ClientName) {
+		if updateData["client_name"], err = r.fields.encryptString(ctx, "client_name", schedule.ID, schedule.ClientName); err != nil {
+			return nil, err
+		}
+	}
+	if bidx := r.fields.blindIndex(ctx, schedule.ClientName); row.ClientNameBidx == nil || *row.ClientNameBidx != *bidx {
+		updateData["client_name_bidx"] = *bidx
+	}
+	if stale(row.ServiceNotes) {
+		if updateData["service_notes"], err = r.fields.encryptString(ctx, "service_notes", schedule.ID, schedule.ServiceNotes); err != nil {
+			return nil, err
+		}
+	}
+	locations := []struct {
+		column   string
+		raw      json.RawMessage
+		location *models.Location
+	}{
+		{"location", row.Location, &schedule.Location},
+		{"start_location", row.StartLocation, schedule.StartLocation},
+		{"end_location", row.EndLocation, schedule.EndLocation},
+	}
+	for _, l := range locations {
+		if l.location == nil || !staleLocation(l.raw, activeKeyID) {
+			continue
+		}
+		if updateData[l.column], err = r.fields.encryptLocation(ctx, l.column, schedule.ID, *l.location); err != nil {
+			return nil, err
+		}
+	}
+	if len(updateData) == 0 {
+		return nil, nil
+	}
+
+	// Visits change the location columns together with the status, retention
+	// clears the visit locations, scrubs reduce their precision and
+	// anonymization blanks client_name, which otherwise only changes through
+	// this rewrite. Matching all of them means the values read above are still
+	// the current ones.
+	var updated []struct{ ID string }
+	builder := r.client.From(ctx, "schedules").
+		Update(updateData, "", "representation").
+		Filter("id", "eq", schedule.ID).
+		Filter("status", "eq", row.Status).
+		Filter("client_name", "eq", row.ClientName)
+	for _, column := range []string{"start_location", "end_location"} {
+		if _, ok := updateData[column]; ok {
+			builder = builder.Filter(column, "not.is", "null")
+			if row.LocationsScrubbedAt == nil {
+				builder = builder.Filter("locations_scrubbed_at", "is", "null")
+			}
+		}
+	}
+	resp, _, err := builder.Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to re-encrypt schedule %s: %w", schedule.ID, err)
+	}
+	if err := json.Unmarshal(resp, &updated); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal re-encrypt response: %w", err)
+	}
+	applied := len(updated) > 0
+	return &applied, nil
+}
+
+// staleLocation reports whether a location column holds a value that is not
+// encrypted under activeKeyID.
+func staleLocation(raw json.RawMessage, activeKeyID string) bool {
+	var encrypted string
+	if json.Unmarshal(raw, &encrypted) != nil {
+		return true // a plaintext location object
+	}
+	return encryption.KeyID(encrypted) != activeKeyID
+}
@@ -0,0 +1,274 @@
+package repository_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/encryption"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// tableServer is a PostgREST stand-in that keeps rows in memory. It supports
+// eq and gt filters, limit, insert and update of whole JSON objects and the
+// record_visit_change function, which is all the encryption and conditional
+// write paths use. Schedules start at version 1 and each visit change bumps it.
+// Requests for a table in failing get a 500.
+type tableServer struct {
+	*httptest.Server
+	mu      sync.Mutex
+	tables  map[string][]map[string]interface{}
+	failing map[string]bool
+}
+
+func newTableServer(t *testing.T) *tableServer {
+	t.Helper()
+	s := &tableServer{tables: map[string][]map[string]interface{}{}, failing: map[string]bool{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *tableServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	table := strings.TrimPrefix(r.URL.Path, "/rest/v1/")
+	w.Header().Set("Content-Type", "application/json")
+
+	switch {
+	case s.failing[table]:
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(`{"message":"unavailable"}`))
+	case table == "rpc/record_visit_change":
+		var params map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&params)
+		column := map[string]string{"in_progress": "start", "completed": "end"}[params["p_to_status"].(string)]
+		for _, row := range s.tables["schedules"] {
+			if row["id"] == params["p_schedule_id"] && row["status"] == params["p_from_status"] &&
+				(params["p_if_version"] == nil || params["p_if_version"] == row["version"]) {
+				row["status"] = params["p_to_status"]
+				row["version"] = row["version"].(float64) + 1
+				row["visit_"+column] = params["p_at"]
+				row[column+"_location"] = params["p_location"]
+				w.Write([]byte(`true`))
+				return
+			}
+		}
+		w.Write([]byte(`false`))
+	case r.Method == http.MethodPost:
+		var row map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&row)
+		if table == "schedules" {
+			row["version"] = float64(1)
+		}
+		s.tables[table] = append(s.tables[table], row)
+		w.Write([]byte(`[]`))
+	case r.Method == http.MethodPatch:
+		var update map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&update)
+		matched := s.match(table, r)
+		for _, row := range matched {
+			for column, value := range update {
+				row[column] = value
+			}
+		}
+		json.NewEncoder(w).Encode(matched)
+	default:
+		matched := s.match(table, r)
+		if limit := r.URL.Query().Get("limit"); limit != "" {
+			var n int
+			fmt.Sscan(limit, &n)
+			matched = matched[:min(n, len(matched))]
+		}
+		json.NewEncoder(w).Encode(matched)
+	}
+}
+
+// match returns the table's rows, ordered by id, that pass the request's
+// filters.
+func (s *tableServer) match(table string, r *http.Request) []map[string]interface{} {
+	rows := append([]map[string]interface{}{}, s.tables[table]...)
+	sort.Slice(rows, func(i, j int) bool { return fmt.Sprint(rows[i]["id"]) < fmt.Sprint(rows[j]["id"]) })
+
+	matched := []map[string]interface{}{}
+rows:
+	for _, row := range rows {
+		for column, values := range r.URL.Query() {
+			op, want, ok := strings.Cut(values[0], ".")
+			if !ok || column == "select" || column == "order" || column == "limit" {
+				continue
+			}
+			got := fmt.Sprint(row[column])
+			if (op == "eq" && got != want) || (op == "gt" && got <= want) || op == "in" {
+				continue rows
+			}
+		}
+		matched = append(matched, row)
+	}
+	return matched
+}
+
+func (s *tableServer) row(table, id string) map[string]interface{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, row := range s.tables[table] {
+		if row["id"] == id {
+			return row
+		}
+	}
+	return nil
+}
+
+func newEncryptedRepository(t *testing.T) (*tableServer, *repository.Client, *encryption.Keyring) {
+	t.Helper()
+	server := newTableServer(t)
+	client := newClient(t, server.URL, repository.ClientConfig{})
+	keyfile, err := encryption.NewKeyfile()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return server, client, encryption.NewKeyring(keyfile, repository.NewKeyRepository(client))
+}
+
+func TestScheduleRepository_EncryptsPHI(t *testing.T) {
+	server, client, keyring := newEncryptedRepository(t)
+	repo := repository.NewScheduleRepository(client, keyring)
+	ctx := tenantContext()
+
+	location := models.Location{Latitude: -6.2, Longitude: 106.8, Address: "12 Elm Street"}
+	created, err := repo.CreateSchedule(ctx, models.Schedule{
+		ID: "sch-001", ClientID: "client-001", ClientName: "Jane Doe", ServiceName: "Personal care",
+		Location: location, ServiceNotes: "Allergic to penicillin", Status: "scheduled",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created.ClientName != "Jane Doe" || created.ServiceNotes != "Allergic to penicillin" || created.Location != location {
+		t.Errorf("Expected the created schedule back in plaintext, got %+v", created)
+	}
+
+	stored := server.row("schedules", "sch-001")
+	for _, column := range []string{"client_name", "service_notes", "location"} {
+		value, _ := stored[column].(string)
+		if !encryption.IsEncrypted(value) {
+			t.Errorf("Expected %s to be stored encrypted, got %v", column, stored[column])
+		}
+	}
+	if stored["client_name_bidx"] != keyring.BlindIndex(encryption.DefaultTenant, "Jane Doe") {
+		t.Errorf("Expected the blind index of the client name, got %v", stored["client_name_bidx"])
+	}
+
+	if err := repo.StartVisit(ctx, "sch-001", time.Now(), location, events.Event{ID: "evt-001", Type: events.VisitStarted}); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := server.row("schedules", "sch-001")["start_location"].(string); !encryption.IsEncrypted(value) {
+		t.Error("Expected start_location to be stored encrypted")
+	}
+	schedule, err := repo.GetScheduleByID(ctx, "sch-001")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.StartLocation == nil || *schedule.StartLocation != location {
+		t.Errorf("Expected the start location back in plaintext, got %+v", schedule.StartLocation)
+	}
+
+	for name, want := range map[string]int{"Jane Doe": 1, "Jane": 0} {
+		schedules, err := repo.GetSchedules(ctx, models.ScheduleListQuery{ClientName: name})
+		if err != nil || len(schedules) != want {
+			t.Errorf("Expected %d schedules named %q, got %d, %v", want, name, len(schedules), err)
+		}
+	}
+}
+
+func TestScheduleReencrypter_EncryptsLegacyRowsAndRotates(t *testing.T) {
+	server, client, keyring := newEncryptedRepository(t)
+	ctx := tenantContext()
+	server.tables["schedules"] = []map[string]interface{}{{
+		"id": "sch-legacy", "tenant_id": tenant.DefaultID, "client_name": "John Roe", "service_notes": "Uses a walker", "status": "scheduled",
+		"location": map[string]interface{}{"latitude": 1.5, "longitude": 2.5, "address": "1 Oak Road"},
+	}}
+
+	reencrypter := repository.NewScheduleReencrypter(client, keyring)
+	result, err := reencrypter.Run(ctx, 1)
+	if err != nil || result.Rewritten != 1 {
+		t.Fatalf("Expected the legacy row to be rewritten, got %+v, %v", result, err)
+	}
+	stored := server.row("schedules", "sch-legacy")
+	firstKey := encryption.KeyID(stored["client_name"].(string))
+	if firstKey == "" || encryption.KeyID(stored["location"].(string)) != firstKey {
+		t.Fatalf("Expected the row to be encrypted, got %v", stored)
+	}
+
+	if result, _ := reencrypter.Run(ctx, 1); result.Rewritten != 0 {
+		t.Errorf("Expected nothing left to rewrite, got %+v", result)
+	}
+
+	if _, err := keyring.RotateDataKey(ctx, encryption.DefaultTenant); err != nil {
+		t.Fatal(err)
+	}
+	if result, err := reencrypter.Run(ctx, 10); err != nil || result.Rewritten != 1 {
+		t.Fatalf("Expected the row to move to the new key, got %+v, %v", result, err)
+	}
+	if encryption.KeyID(server.row("schedules", "sch-legacy")["service_notes"].(string)) == firstKey {
+		t.Error("Expected service_notes under the new data key")
+	}
+
+	schedule, err := repository.NewScheduleRepository(client, keyring).GetScheduleByID(ctx, "sch-legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schedule.ClientName != "John Roe" || schedule.ServiceNotes != "Uses a walker" || schedule.Location.Address != "1 Oak Road" {
+		t.Errorf("Expected the re-encrypted row to read back unchanged, got %+v", schedule)
+	}
+}
+
+func TestScheduleRepository_VisitChangesHonorTheIfMatchVersion(t *testing.T) {
+	_, client, keyring := newEncryptedRepository(t)
+	repo := repository.NewScheduleRepository(client, keyring)
+	ctx := tenantContext()
+	if _, err := repo.CreateSchedule(ctx, models.Schedule{ID: "sch-001", ClientName: "Jane Doe", Status: "scheduled"}); err != nil {
+		t.Fatal(err)
+	}
+	schedule, err := repo.GetScheduleByID(ctx, "sch-001")
+	if err != nil || schedule.Version != 1 {
+		t.Fatalf("Expected the schedule at version 1, got %+v, %v", schedule, err)
+	}
+
+	event := events.Event{ID: "evt-001", Type: events.VisitStarted}
+	stale := repository.WithIfVersion(ctx, schedule.Version+1)
+	if err := repo.StartVisit(stale, "sch-001", time.Now(), models.Location{}, event); !errors.Is(err, repository.ErrScheduleChanged) {
+		t.Fatalf("Expected a stale version to be refused, got %v", err)
+	}
+	if err := repo.StartVisit(repository.WithIfVersion(ctx, schedule.Version), "sch-001", time.Now(), models.Location{}, event); err != nil {
+		t.Fatalf("Expected the matching version to be accepted, got %v", err)
+	}
+	if schedule, _ := repo.GetScheduleByID(ctx, "sch-001"); schedule.Version != 2 || schedule.Status != "in_progress" {
+		t.Errorf("Expected the visit started at version 2, got %+v", schedule)
+	}
+}
+
+func TestScheduleRepository_GetSchedulesFailsWhenTasksCannotBeFetched(t *testing.T) {
+	server, client, keyring := newEncryptedRepository(t)
+	repo := repository.NewScheduleRepository(client, keyring)
+	ctx := tenantContext()
+	if _, err := repo.CreateSchedule(ctx, models.Schedule{ID: "sch-001", ClientName: "Jane Doe", Status: "scheduled"}); err != nil {
+		t.Fatal(err)
+	}
+
+	server.mu.Lock()
+	server.failing["tasks"] = true
+	server.mu.Unlock()
+	if schedules, err := repo.GetSchedules(ctx, models.ScheduleListQuery{}); err == nil {
+		t.Fatalf("Expected an error instead of schedules without their tasks, got %+v", schedules)
+	}
+}
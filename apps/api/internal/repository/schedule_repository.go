@@ -3,62 +3,229 @@ package repository
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"strings"
 	"time"
 
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/encryption"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
-	"github.com/supabase-community/supabase-go"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	postgrest "github.com/supabase-community/postgrest-go"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+// tracerName is the instrumentation name of the spans started inside the
+// repositories, below the per-call spans of the tracing decorators.
+const tracerName = "github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+
+// ErrScheduleChanged is returned by visit changes that were refused because
+// the schedule changed since the caller read it.
+var ErrScheduleChanged = errors.New("repository: schedule changed since it was read")
+
+type freshReadsKey struct{}
+
+// WithFreshReads makes the schedule reads made with ctx skip any cache in
+// front of the repository, for reads that a write is authorized and
+// validated against.
+func WithFreshReads(ctx context.Context) context.Context {
+	return context.WithValue(ctx, freshReadsKey{}, true)
+}
+
+// FreshReads reports whether reads made with ctx must skip caches.
+func FreshReads(ctx context.Context) bool {
+	fresh, _ := ctx.Value(freshReadsKey{}).(bool)
+	return fresh
+}
+
+type ifVersionKey struct{}
+
+// WithIfVersion makes the visit and task changes made with ctx conditional on
+// the schedule still being at version, the Version it was read with. They
+// fail with ErrScheduleChanged if it has changed since.
+func WithIfVersion(ctx context.Context, version int64) context.Context {
+	return context.WithValue(ctx, ifVersionKey{}, version)
+}
+
+// IfVersion returns the version set by WithIfVersion, if any.
+func IfVersion(ctx context.Context) (int64, bool) {
+	version, ok := ctx.Value(ifVersionKey{}).(int64)
+	return version, ok
+}
+
+// ifVersion returns the p_if_version parameter of the changes made with ctx.
+func ifVersion(ctx context.Context) *int64 {
+	version, ok := IfVersion(ctx)
+	if !ok {
+		return nil
+	}
+	return &version
+}
+
 type ScheduleRepository interface {
-	GetSchedules(ctx context.Context) ([]models.Schedule, error)
+	GetSchedules(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error)
 	GetTodaySchedules(ctx context.Context) ([]models.Schedule, error)
 	GetScheduleByID(ctx context.Context, id string) (*models.Schedule, error)
-	StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location) error
-	EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location) error
-	UpdateTaskStatus(ctx context.Context, taskID string, completed bool, reason *string) error
+	CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error)
+	ReplacePlannedTasks(ctx context.Context, scheduleID string, tasks []models.Task) error
+	GetTaskByID(ctx context.Context, taskID string) (*models.Task, error)
+	// StartVisit, EndVisit, UpdateTaskStatuses and AddTask queue the events of
+	// their change for webhook delivery in the same transaction as the change.
+	// They return ErrScheduleChanged if the visit's status changed since it
+	// was read or, with WithIfVersion, the schedule changed at all.
+	StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error
+	EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error
+	UpdateTaskStatuses(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error
+	AddTask(ctx context.Context, task models.Task, event events.Event) (*models.Task, error)
+	// RecordMissedVisit marks a visit as missed and queues its visit.missed
+	// event for webhook delivery. It reports false if the visit is no longer
+	// scheduled or was already marked.
+	RecordMissedVisit(ctx context.Context, id string, event events.Event) (bool, error)
 	ResetSampleData(ctx context.Context) error
+	GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error)
+	RefreshDailyStats(ctx context.Context, from, to time.Time) (int, error)
+	// GetUnscrubbedVisits returns completed visits whose locations still have
+	// full precision, without their tasks.
+	GetUnscrubbedVisits(ctx context.Context, query models.LocationScrubQuery) ([]models.Schedule, error)
+	// ScrubVisitLocations applies scrub and records it in the access log. It
+	// reports false if the visit was not completed, already scrubbed or its
+	// client is on legal hold.
+	ScrubVisitLocations(ctx context.Context, scrub models.LocationScrub) (bool, error)
+	// Ping checks that the datastore answers queries.
+	Ping(ctx context.Context) error
 }
 
 type SupabaseScheduleRepository struct {
-	client *supabase.Client
+	client *Client
+	fields phiFields
 }
 
-func NewScheduleRepository(client *supabase.Client) ScheduleRepository {
-	return &SupabaseScheduleRepository{client: client}
+// NewScheduleRepository returns a schedule repository that encrypts the PHI
+// columns with keyring. A nil keyring stores them as plaintext.
+func NewScheduleRepository(client *Client, keyring *encryption.Keyring) ScheduleRepository {
+	return &SupabaseScheduleRepository{client: client, fields: phiFields{keyring: keyring}}
 }
 
-func (r *SupabaseScheduleRepository) GetSchedules(ctx context.Context) ([]models.Schedule, error) {
-	var schedules []models.Schedule
-	resp, _, err := r.client.From("schedules").Select("*", "exact", false).Execute()
+// GetSchedules returns schedules ordered by (scheduled_start, id), applying
+// the query's filters and keyset cursor. Tasks are loaded with one extra
+// request for the whole page.
+func (r *SupabaseScheduleRepository) GetSchedules(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+	order := &postgrest.OrderOpts{Ascending: !query.Descending}
+	builder := r.client.From(ctx, "schedules").
+		Select("*", "", false).
+		Order("scheduled_start", order).
+		Order("id", order)
+
+	if len(query.Statuses) > 0 {
+		builder = builder.In("status", query.Statuses)
+	}
+	if query.ClientID != "" {
+		builder = builder.Filter("client_id", "eq", query.ClientID)
+	}
+	if query.ClientName != "" {
+		if bidx := r.fields.blindIndex(ctx, query.ClientName); bidx != nil {
+			builder = builder.Filter("client_name_bidx", "eq", *bidx)
+		} else {
+			builder = builder.Filter("client_name", "eq", query.ClientName)
+		}
+	}
+	if query.CaregiverID != "" {
+		builder = builder.Filter("caregiver_id", "eq", query.CaregiverID)
+	}
+	if query.BranchIDs != nil {
+		builder = builder.In("branch_id", query.BranchIDs)
+	}
+	// Filter keys params by column, so both bounds on scheduled_start have to
+	// go into a single and=(...) expression.
+	var bounds []string
+	if query.From != nil {
+		bounds = append(bounds, fmt.Sprintf(`scheduled_start.gte."%sT00:00:00"`, query.From.Format("2006-01-02")))
+	}
+	if query.To != nil {
+		bounds = append(bounds, fmt.Sprintf(`scheduled_start.lt."%sT00:00:00"`, query.To.AddDate(0, 0, 1).Format("2006-01-02")))
+	}
+	if len(bounds) > 0 {
+		builder = builder.And(strings.Join(bounds, ","), "")
+	}
+	if query.Cursor != nil {
+		op := "gt"
+		if query.Descending {
+			op = "lt"
+		}
+		builder = builder.Or(fmt.Sprintf(`scheduled_start.%[1]s."%[2]s",and(scheduled_start.eq."%[2]s",id.%[1]s.%[3]s)`,
+			op, query.Cursor.ScheduledStart, query.Cursor.ID), "")
+	}
+	if query.Limit > 0 {
+		builder = builder.Limit(query.Limit, "")
+	}
+
+	resp, _, err := builder.Execute()
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch schedules from Supabase: %w", err)
 	}
 
-	if err := json.Unmarshal(resp, &schedules); err != nil {
+	schedules, err := r.fields.decodeSchedules(ctx, resp)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal schedules response: %w", err)
 	}
 
-	for i := range schedules {
-		tasks, err := r.getTasksByScheduleID(ctx, schedules[i].ID)
-		if err != nil {
-			fmt.Printf("Warning: Failed to fetch tasks for schedule %s: %v\n", schedules[i].ID, err)
-		}
-		schedules[i].Tasks = tasks
+	if err := r.attachTasks(ctx, schedules); err != nil {
+		return nil, fmt.Errorf("failed to fetch tasks for schedules: %w", err)
 	}
 
 	return schedules, nil
 }
 
+func (r *SupabaseScheduleRepository) attachTasks(ctx context.Context, schedules []models.Schedule) error {
+	if len(schedules) == 0 {
+		return nil
+	}
+
+	// One query fetches the tasks of the whole page; its own span shows how much
+	// of a list request it takes.
+	_, span := otel.Tracer(tracerName).Start(ctx, "ScheduleRepository.attachTasks",
+		trace.WithAttributes(attribute.Int("evv.schedule_count", len(schedules))))
+	defer span.End()
+
+	ids := make([]string, len(schedules))
+	for i := range schedules {
+		ids[i] = schedules[i].ID
+	}
+
+	var tasks []models.Task
+	resp, _, err := r.client.From(ctx, "tasks").
+		Select("*", "", false).
+		In("schedule_id", ids).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("failed to fetch tasks from Supabase: %w", err)
+	}
+	if err := json.Unmarshal(resp, &tasks); err != nil {
+		return fmt.Errorf("failed to unmarshal tasks response: %w", err)
+	}
+
+	bySchedule := make(map[string][]models.Task, len(schedules))
+	for _, task := range tasks {
+		bySchedule[task.ScheduleID] = append(bySchedule[task.ScheduleID], task)
+	}
+	for i := range schedules {
+		schedules[i].Tasks = bySchedule[schedules[i].ID]
+	}
+	return nil
+}
+
 func (r *SupabaseScheduleRepository) GetTodaySchedules(ctx context.Context) ([]models.Schedule, error) {
 	// today := time.Now().Format("Mon, 02 Jan 2006")
-	// resp, _, err := r.client.From("schedules").Select("*", "exact", false).Filter("shift_date", "eq", today).Execute()
-	return r.GetSchedules(ctx)
+	// resp, _, err := r.client.From(ctx, "schedules").Select("*", "exact", false).Filter("shift_date", "eq", today).Execute()
+	return r.GetSchedules(ctx, models.ScheduleListQuery{})
 }
 
 func (r *SupabaseScheduleRepository) GetScheduleByID(ctx context.Context, id string) (*models.Schedule, error) {
-	var schedules []models.Schedule
-	resp, _, err := r.client.From("schedules").
+	resp, _, err := r.client.From(ctx, "schedules").
 		Select("*", "exact", false).
 		Filter("id", "eq", id).
 		Execute()
@@ -66,12 +233,13 @@ func (r *SupabaseScheduleRepository) GetScheduleByID(ctx context.Context, id str
 		return nil, fmt.Errorf("failed to fetch schedule by ID from Supabase: %w", err)
 	}
 
-	if err := json.Unmarshal(resp, &schedules); err != nil {
+	schedules, err := r.fields.decodeSchedules(ctx, resp)
+	if err != nil {
 		return nil, fmt.Errorf("failed to unmarshal schedule by ID response: %w", err)
 	}
 
 	if len(schedules) == 0 {
-		return nil, fmt.Errorf("schedule with ID %s not found", id)
+		return nil, fmt.Errorf("schedule with ID %s %w", id, ErrNotFound)
 	}
 
 	schedule := &schedules[0]
@@ -85,9 +253,84 @@ func (r *SupabaseScheduleRepository) GetScheduleByID(ctx context.Context, id str
 	return schedule, nil
 }
 
+// CreateSchedule inserts the schedule and its tasks. scheduled_start is left
+// to the database trigger.
+func (r *SupabaseScheduleRepository) CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+	clientName, err := r.fields.encryptString(ctx, "client_name", schedule.ID, schedule.ClientName)
+	if err != nil {
+		return nil, err
+	}
+	serviceNotes, err := r.fields.encryptString(ctx, "service_notes", schedule.ID, schedule.ServiceNotes)
+	if err != nil {
+		return nil, err
+	}
+	location, err := r.fields.encryptLocation(ctx, "location", schedule.ID, schedule.Location)
+	if err != nil {
+		return nil, err
+	}
+
+	insertData := map[string]interface{}{
+		"id":               schedule.ID,
+		"client_id":        schedule.ClientID,
+		"client_name":      clientName,
+		"client_name_bidx": r.fields.blindIndex(ctx, schedule.ClientName),
+		"client_avatar":    schedule.ClientAvatar,
+		"caregiver_id":     schedule.CaregiverID,
+		"service_name":     schedule.ServiceName,
+		"location":         location,
+		"shift_date":       schedule.ShiftDate,
+		"start_time":       schedule.StartTime,
+		"end_time":         schedule.EndTime,
+		"status":           schedule.Status,
+		"service_notes":    serviceNotes,
+	}
+
+	resp, _, err := r.client.From(ctx, "schedules").
+		Insert(insertData, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to create schedule: %w", err)
+	}
+
+	if err := r.insertTasks(ctx, schedule.Tasks); err != nil {
+		return nil, err
+	}
+	return r.GetScheduleByID(ctx, schedule.ID)
+}
+
+// ReplacePlannedTasks swaps the care plan generated tasks of a schedule for
+// new ones. Tasks that were not generated from a template are kept.
+func (r *SupabaseScheduleRepository) ReplacePlannedTasks(ctx context.Context, scheduleID string, tasks []models.Task) error {
+	resp, _, err := r.client.From(ctx, "tasks").
+		Delete("minimal", "").
+		Filter("schedule_id", "eq", scheduleID).
+		Not("template_id", "is", "null").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to delete planned tasks for schedule %s: %w", scheduleID, err)
+	}
+	return r.insertTasks(ctx, tasks)
+}
+
+func (r *SupabaseScheduleRepository) insertTasks(ctx context.Context, tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	resp, _, err := r.client.From(ctx, "tasks").
+		Insert(tasks, false, "", "minimal", "").
+		Execute()
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return fmt.Errorf("repository: failed to insert tasks: %w", err)
+	}
+	return nil
+}
+
 func (r *SupabaseScheduleRepository) getTasksByScheduleID(ctx context.Context, scheduleID string) ([]models.Task, error) {
 	var tasks []models.Task
-	taskResp, _, err := r.client.From("tasks").
+	taskResp, _, err := r.client.From(ctx, "tasks").
 		Select("*", "exact", false).
 		Filter("schedule_id", "eq", scheduleID).
 		Execute()
@@ -101,96 +344,358 @@ func (r *SupabaseScheduleRepository) getTasksByScheduleID(ctx context.Context, s
 	return tasks, nil
 }
 
-func (r *SupabaseScheduleRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location) error {
-	updateData := map[string]interface{}{
-		"status": "in_progress",
-		"visit_start": visitStart.Format(time.RFC3339),
-		"start_location": startLocation,
+func (r *SupabaseScheduleRepository) GetTaskByID(ctx context.Context, taskID string) (*models.Task, error) {
+	var tasks []models.Task
+	resp, _, err := r.client.From(ctx, "tasks").
+		Select("*", "exact", false).
+		Filter("id", "eq", taskID).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch task by ID from Supabase: %w", err)
 	}
 
-	resp, _, err := r.client.From("schedules").
-		Update(updateData, "exact", "representation").
-		Filter("id", "eq", id).
-		Execute()
+	if err := json.Unmarshal(resp, &tasks); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal task by ID response: %w", err)
+	}
 
-	if err != nil {
-		return fmt.Errorf("repository: failed to update schedule status to in_progress for ID %s: %w, Supabase response: %s", id, err, string(resp))
+	if len(tasks) == 0 {
+		return nil, fmt.Errorf("task with ID %s %w", taskID, ErrNotFound)
 	}
+	return &tasks[0], nil
+}
 
+func (r *SupabaseScheduleRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+	if err := r.recordVisitChange(ctx, id, "scheduled", "in_progress", "start_location", visitStart, startLocation, event); err != nil {
+		return fmt.Errorf("repository: failed to update schedule status to in_progress for ID %s: %w", id, err)
+	}
 	return nil
 }
 
-func (r *SupabaseScheduleRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location) error {
-	updateData := map[string]interface{}{
-		"status": "completed",
-		"visit_end": visitEnd.Format(time.RFC3339),
-		"end_location": endLocation,
+func (r *SupabaseScheduleRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error {
+	if err := r.recordVisitChange(ctx, id, "in_progress", "completed", "end_location", visitEnd, endLocation, event); err != nil {
+		return fmt.Errorf("repository: failed to update schedule status to completed for ID %s: %w", id, err)
 	}
+	return nil
+}
 
-	resp, _, err := r.client.From("schedules").
-		Update(updateData, "exact", "representation").
-		Filter("id", "eq", id).
-		Execute()
+// recordVisitChange moves a visit from one status to the next and queues
+// event for webhook delivery, in one transaction.
+func (r *SupabaseScheduleRepository) recordVisitChange(ctx context.Context, id, from, to, locationColumn string, at time.Time, location models.Location, event events.Event) error {
+	encrypted, err := r.fields.encryptLocation(ctx, locationColumn, id, location)
+	if err != nil {
+		return err
+	}
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
 
+	resp, err := r.client.rpc(ctx, "record_visit_change", map[string]interface{}{
+		"p_schedule_id": id,
+		"p_from_status": from,
+		"p_to_status":   to,
+		"p_at":          at.Format(time.RFC3339),
+		"p_location":    encrypted,
+		"p_event":       json.RawMessage(payload),
+		"p_if_version":  ifVersion(ctx),
+	})
 	if err != nil {
-		return fmt.Errorf("repository: failed to update schedule status to completed for ID %s: %w, Supabase response: %s", id, err, string(resp))
+		logSupabaseResponse(ctx, resp)
+		return err
 	}
 
+	var applied bool
+	if err := json.Unmarshal(resp, &applied); err != nil {
+		return fmt.Errorf("failed to unmarshal visit change response: %w", err)
+	}
+	if !applied {
+		if ifVersion(ctx) != nil {
+			return fmt.Errorf("%w: status is no longer %s or the schedule is no longer at version %d", ErrScheduleChanged, from, *ifVersion(ctx))
+		}
+		return fmt.Errorf("%w: status is no longer %s", ErrScheduleChanged, from)
+	}
 	return nil
 }
 
-func (r *SupabaseScheduleRepository) UpdateTaskStatus(ctx context.Context, taskID string, completed bool, reason *string) error {
-	updateData := map[string]interface{}{
-		"completed": completed,
-		"reason": reason,
+func (r *SupabaseScheduleRepository) GetUnscrubbedVisits(ctx context.Context, query models.LocationScrubQuery) ([]models.Schedule, error) {
+	builder := r.client.From(ctx, "schedules").
+		Select("*", "", false).
+		Filter("status", "eq", "completed").
+		Filter("locations_scrubbed_at", "is", "null").
+		Order("id", &postgrest.OrderOpts{Ascending: true})
+	if query.AfterID != "" {
+		builder = builder.Filter("id", "gt", query.AfterID)
+	}
+	if query.Before != nil {
+		builder = builder.Filter("scheduled_start", "lt", query.Before.Format("2006-01-02T15:04:05"))
+	}
+	if query.Limit > 0 {
+		builder = builder.Limit(query.Limit, "")
 	}
 
-	resp, _, err := r.client.From("tasks").
-		Update(updateData, "exact", "representation").
-		Filter("id", "eq", taskID).
-		Execute()
+	resp, _, err := builder.Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unscrubbed visits from Supabase: %w", err)
+	}
 
+	schedules, err := r.fields.decodeSchedules(ctx, resp)
 	if err != nil {
-		return fmt.Errorf("repository: failed to update task status for ID %s: %w, Supabase response: %s", taskID, err, string(resp))
+		return nil, fmt.Errorf("failed to unmarshal unscrubbed visits response: %w", err)
 	}
+	return schedules, nil
+}
 
+func (r *SupabaseScheduleRepository) ScrubVisitLocations(ctx context.Context, scrub models.LocationScrub) (bool, error) {
+	params := map[string]interface{}{
+		"p_schedule_id":        scrub.ScheduleID,
+		"p_start_location":     nil,
+		"p_end_location":       nil,
+		"p_start_verification": scrub.StartVerification,
+		"p_end_verification":   scrub.EndVerification,
+		"p_fields":             scrub.Fields,
+		"p_actor":              scrub.Actor,
+	}
+	locations := []struct {
+		param, column string
+		location      *models.Location
+	}{
+		{"p_start_location", "start_location", scrub.StartLocation},
+		{"p_end_location", "end_location", scrub.EndLocation},
+	}
+	for _, l := range locations {
+		if l.location == nil {
+			continue
+		}
+		value, err := r.fields.encryptLocation(ctx, l.column, scrub.ScheduleID, *l.location)
+		if err != nil {
+			return false, err
+		}
+		params[l.param] = value
+	}
+
+	resp, err := r.client.rpc(ctx, "scrub_visit_locations", params)
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return false, fmt.Errorf("repository: failed to scrub the locations of schedule %s: %w", scrub.ScheduleID, err)
+	}
+
+	var applied bool
+	if err := json.Unmarshal(resp, &applied); err != nil {
+		return false, fmt.Errorf("failed to unmarshal location scrub response: %w", err)
+	}
+	return applied, nil
+}
+
+// UpdateTaskStatuses writes the completion fields of the given tasks and
+// queues their events in one transaction, so a batch is applied entirely or
+// not at all.
+func (r *SupabaseScheduleRepository) UpdateTaskStatuses(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+	if _, err := r.saveTasks(ctx, tasks, taskEvents); err != nil {
+		return fmt.Errorf("repository: failed to update %d task statuses: %w", len(tasks), err)
+	}
 	return nil
 }
 
+func (r *SupabaseScheduleRepository) AddTask(ctx context.Context, task models.Task, event events.Event) (*models.Task, error) {
+	created, err := r.saveTasks(ctx, []models.Task{task}, []events.Event{event})
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to add task to schedule %s: %w", task.ScheduleID, err)
+	}
+	if len(created) == 0 {
+		return nil, fmt.Errorf("repository: task insert returned no rows")
+	}
+	return &created[0], nil
+}
+
+// saveTasks inserts or updates tasks, which belong to one schedule, and queues
+// the taskEvents of the tasks it saved for webhook delivery, in one
+// transaction.
+func (r *SupabaseScheduleRepository) saveTasks(ctx context.Context, tasks []models.Task, taskEvents []events.Event) ([]models.Task, error) {
+	scheduleID := tasks[0].ScheduleID
+	for _, task := range tasks {
+		if task.ScheduleID != scheduleID {
+			return nil, fmt.Errorf("tasks of schedules %s and %s cannot be saved together", scheduleID, task.ScheduleID)
+		}
+	}
+	if taskEvents == nil {
+		taskEvents = []events.Event{}
+	}
+	resp, err := r.client.rpc(ctx, "save_visit_tasks", map[string]interface{}{
+		"p_schedule_id": scheduleID,
+		"p_if_version":  ifVersion(ctx),
+		"p_tasks":       tasks,
+		"p_events":      taskEvents,
+	})
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, err
+	}
+
+	var saved []models.Task
+	if err := json.Unmarshal(resp, &saved); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal saved tasks response: %w", err)
+	}
+	if len(saved) == 0 && ifVersion(ctx) != nil {
+		return nil, fmt.Errorf("%w: schedule %s is no longer at version %d", ErrScheduleChanged, scheduleID, *ifVersion(ctx))
+	}
+	return saved, nil
+}
+
+// RecordMissedVisit marks the visit as missed and queues event, a visit.missed
+// event, for webhook delivery. It reports false, queueing nothing, if the
+// visit is no longer scheduled or was already marked.
+func (r *SupabaseScheduleRepository) RecordMissedVisit(ctx context.Context, id string, event events.Event) (bool, error) {
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return false, fmt.Errorf("failed to marshal %s event: %w", event.Type, err)
+	}
+	resp, err := r.client.rpc(ctx, "record_missed_visit", map[string]interface{}{
+		"p_schedule_id": id,
+		"p_event":       json.RawMessage(payload),
+	})
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return false, fmt.Errorf("repository: failed to record missed visit %s: %w", id, err)
+	}
+
+	var recorded bool
+	if err := json.Unmarshal(resp, &recorded); err != nil {
+		return false, fmt.Errorf("failed to unmarshal missed visit response: %w", err)
+	}
+	return recorded, nil
+}
+
 func (r *SupabaseScheduleRepository) ResetSampleData(ctx context.Context) error {
 	schedulesToReset := []string{"a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a13", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a14", "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a15"}
 
 	for _, id := range schedulesToReset {
 		updateData := map[string]interface{}{
-			"status":        "scheduled",
-			"visit_start":   nil,
-			"visit_end":     nil,
-			"start_location": nil,
-			"end_location":   nil,
+			"status":             "scheduled",
+			"visit_start":        nil,
+			"visit_end":          nil,
+			"start_location":     nil,
+			"end_location":       nil,
+			"missed_notified_at": nil,
 		}
-		resp, _, err := r.client.From("schedules").
+		resp, _, err := r.client.From(ctx, "schedules").
 			Update(updateData, "exact", "representation").
 			Filter("id", "eq", id).
 			Execute()
 		if err != nil {
-			return fmt.Errorf("repository: failed to reset schedule %s: %w, response: %s", id, err, string(resp))
+			logSupabaseResponse(ctx, resp)
+			return fmt.Errorf("repository: failed to reset schedule %s: %w", id, err)
 		}
 	}
 
 	for _, scheduleID := range schedulesToReset {
 		updateTaskData := map[string]interface{}{
-			"completed": false,
-			"reason":    nil,
+			"completed":    false,
+			"completed_at": nil,
+			"completed_by": nil,
+			"reason_code":  nil,
+			"reason":       nil,
 		}
-		resp, _, err := r.client.From("tasks").
+		resp, _, err := r.client.From(ctx, "tasks").
 			Update(updateTaskData, "exact", "representation").
 			Filter("schedule_id", "eq", scheduleID).
 			Execute()
 		if err != nil {
-			fmt.Printf("Warning: Failed to reset tasks for schedule %s: %v, response: %s\n", scheduleID, err, string(resp))
+			logSupabaseResponse(ctx, resp)
+			slog.WarnContext(ctx, "Failed to reset tasks", "schedule_id", scheduleID, "error", err)
+		}
+
+		resp, _, err = r.client.From(ctx, "tasks").
+			Delete("minimal", "").
+			Filter("schedule_id", "eq", scheduleID).
+			Filter("ad_hoc", "eq", "true").
+			Execute()
+		if err != nil {
+			logSupabaseResponse(ctx, resp)
+			slog.WarnContext(ctx, "Failed to remove ad-hoc tasks", "schedule_id", scheduleID, "error", err)
 		}
 	}
 
-	fmt.Println("Sample data reset successfully!")
+	slog.InfoContext(ctx, "Sample data reset", "schedules", len(schedulesToReset))
+	return nil
+}
+
+// logSupabaseResponse logs the body of a failed Supabase call at debug level.
+// It is kept out of returned errors, which can reach API clients, and the
+// logger redacts any PHI it contains.
+func logSupabaseResponse(ctx context.Context, resp []byte) {
+	if len(resp) > 0 {
+		slog.DebugContext(ctx, "Supabase error response", "response", json.RawMessage(resp))
+	}
+}
+
+// statsClock returns today's date and the current UTC offset in the tenant's
+// time zone, which the SQL functions need to compare local shift times with
+// timestamptz columns.
+func statsClock(ctx context.Context) (string, int) {
+	now := time.Now().In(tenant.Location(ctx))
+	_, offsetSeconds := now.Zone()
+	return now.Format("2006-01-02"), offsetSeconds / 60
+}
+
+func (r *SupabaseScheduleRepository) GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+	today, offset := statsClock(ctx)
+	params := map[string]interface{}{
+		"p_from":               nil,
+		"p_to":                 nil,
+		"p_group_by":           query.GroupBy,
+		"p_today":              today,
+		"p_utc_offset_minutes": offset,
+		"p_use_rollup":         query.UseDailyRollup,
+		"p_branch_ids":         query.BranchIDs, // null for every branch
+	}
+	if query.From != nil {
+		params["p_from"] = query.From.Format("2006-01-02")
+	}
+	if query.To != nil {
+		params["p_to"] = query.To.Format("2006-01-02")
+	}
+
+	resp, err := r.client.rpc(ctx, "schedule_stats", params)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate schedule stats in Supabase: %w", err)
+	}
+
+	var stats models.ScheduleStats
+	if err := json.Unmarshal(resp, &stats); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal schedule stats response: %w", err)
+	}
+	return &stats, nil
+}
+
+func (r *SupabaseScheduleRepository) RefreshDailyStats(ctx context.Context, from, to time.Time) (int, error) {
+	today, offset := statsClock(ctx)
+	resp, err := r.client.rpc(ctx, "refresh_schedule_daily_stats", map[string]interface{}{
+		"p_from":               from.Format("2006-01-02"),
+		"p_to":                 to.Format("2006-01-02"),
+		"p_today":              today,
+		"p_utc_offset_minutes": offset,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("repository: failed to refresh daily schedule stats: %w", err)
+	}
+
+	var refreshed int
+	if err := json.Unmarshal(resp, &refreshed); err != nil {
+		return 0, fmt.Errorf("failed to unmarshal daily stats refresh response: %w", err)
+	}
+	return refreshed, nil
+}
+
+func (r *SupabaseScheduleRepository) Ping(ctx context.Context) error {
+	_, _, err := r.client.From(ctx, "schedules").
+		Select("id", "", false).
+		Limit(1, "").
+		Execute()
+	if err != nil {
+		return fmt.Errorf("repository: failed to query schedules: %w", err)
+	}
 	return nil
 }
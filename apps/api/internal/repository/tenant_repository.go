@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+// tenantRow is a tenants row; the rounding rule is stored in two columns.
+type tenantRow struct {
+	tenant.Tenant
+	RoundingIncrementMinutes int    `json:"rounding_increment_minutes"`
+	RoundingMode             string `json:"rounding_mode"`
+}
+
+// SupabaseTenantRepository reads the tenants table, the one table that is not
+// scoped to a tenant.
+type SupabaseTenantRepository struct {
+	client *Client
+}
+
+func NewTenantRepository(client *Client) tenant.Store {
+	return &SupabaseTenantRepository{client: client}
+}
+
+func (r *SupabaseTenantRepository) GetTenant(ctx context.Context, id string) (*tenant.Tenant, error) {
+	resp, _, err := r.client.From(ctx, "tenants").
+		Select("*", "", false).
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tenant from Supabase: %w", err)
+	}
+	tenants, err := decodeTenants(resp)
+	if err != nil {
+		return nil, err
+	}
+	if len(tenants) == 0 {
+		return nil, fmt.Errorf("%w: %s", tenant.ErrUnknown, id)
+	}
+	return &tenants[0], nil
+}
+
+func (r *SupabaseTenantRepository) ListTenants(ctx context.Context) ([]tenant.Tenant, error) {
+	resp, _, err := r.client.From(ctx, "tenants").
+		Select("*", "", false).
+		Order("id", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch tenants from Supabase: %w", err)
+	}
+	return decodeTenants(resp)
+}
+
+func decodeTenants(resp []byte) ([]tenant.Tenant, error) {
+	var rows []tenantRow
+	if err := json.Unmarshal(resp, &rows); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal tenants response: %w", err)
+	}
+	tenants := make([]tenant.Tenant, len(rows))
+	for i, row := range rows {
+		tenants[i] = row.Tenant
+		tenants[i].Rounding = tenant.Rounding{IncrementMinutes: row.RoundingIncrementMinutes, Mode: row.RoundingMode}
+	}
+	return tenants, nil
+}
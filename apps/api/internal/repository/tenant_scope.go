@@ -0,0 +1,109 @@
+package repository
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ErrNoTenant is returned, without calling Supabase, for a query on tenant
+// data whose context is not scoped to a tenant.
+var ErrNoTenant = errors.New("repository: query is not scoped to a tenant")
+
+// unscopedTables hold no tenant's data (tenants, schema_migrations) or are
+// keyed by tenant explicitly (encryption_keys, and api_keys, whose keys are
+// looked up before the tenant is known). Every other table has a tenant_id
+// column.
+var unscopedTables = map[string]bool{
+	"tenants":           true,
+	"schema_migrations": true,
+	"encryption_keys":   true,
+	"api_keys":          true,
+}
+
+// scopeToTenant rewrites req, a PostgREST request on table, so that it can
+// only see and change the rows of tenantID:
+//   - reads, updates and deletes get a tenant_id=eq.<tenantID> filter, which
+//     replaces any tenant_id filter of the query;
+//   - inserted and updated rows get tenant_id set to tenantID, so that rows
+//     can be neither created for nor moved to another tenant;
+//   - calls of Postgres functions get a p_tenant_id parameter, which every
+//     function the API calls filters on.
+//
+// Enforcing this here rather than in each repository means a query that
+// forgets its tenant cannot reach another tenant's rows.
+func scopeToTenant(req *http.Request, table, tenantID string) (*http.Request, error) {
+	if unscopedTables[table] {
+		return req, nil
+	}
+	if tenantID == "" {
+		return nil, fmt.Errorf("%w: %s %s", ErrNoTenant, req.Method, table)
+	}
+
+	scoped := req.Clone(req.Context())
+	if strings.HasPrefix(table, "rpc/") {
+		return scoped, setBodyField(scoped, "p_tenant_id", tenantID)
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodDelete, http.MethodPatch:
+		query := scoped.URL.Query()
+		query.Set("tenant_id", "eq."+tenantID)
+		scoped.URL.RawQuery = query.Encode()
+	}
+	switch req.Method {
+	case http.MethodPost, http.MethodPatch, http.MethodPut:
+		if err := setBodyField(scoped, "tenant_id", tenantID); err != nil {
+			return nil, err
+		}
+	}
+	return scoped, nil
+}
+
+// setBodyField sets field to value in the JSON object, or in every object of
+// the JSON array, of req's body.
+func setBodyField(req *http.Request, field, value string) error {
+	if req.Body == nil {
+		return nil
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return err
+	}
+
+	var rows []map[string]json.RawMessage
+	single := bytes.HasPrefix(bytes.TrimSpace(data), []byte("{"))
+	if single {
+		var row map[string]json.RawMessage
+		if err := json.Unmarshal(data, &row); err != nil {
+			return fmt.Errorf("repository: failed to scope request body to tenant: %w", err)
+		}
+		rows = []map[string]json.RawMessage{row}
+	} else if err := json.Unmarshal(data, &rows); err != nil {
+		return fmt.Errorf("repository: failed to scope request body to tenant: %w", err)
+	}
+
+	encoded, _ := json.Marshal(value)
+	for _, row := range rows {
+		row[field] = encoded
+	}
+	var body interface{} = rows
+	if single {
+		body = rows[0]
+	}
+	if data, err = json.Marshal(body); err != nil {
+		return err
+	}
+
+	req.Body = io.NopCloser(bytes.NewReader(data))
+	req.ContentLength = int64(len(data))
+	req.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return nil
+}
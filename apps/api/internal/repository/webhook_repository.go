@@ -0,0 +1,171 @@
+package repository
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	postgrest "github.com/supabase-community/postgrest-go"
+)
+
+type WebhookRepository interface {
+	CreateSubscription(ctx context.Context, subscription models.WebhookSubscription) (*models.WebhookSubscription, error)
+	GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	// ClaimDueDeliveries marks up to limit deliveries that are due as being
+	// sent for lease and returns them. Deliveries another dispatcher holds are
+	// skipped, until its lease runs out.
+	ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error)
+	GetDeliveriesByStatus(ctx context.Context, status string) ([]models.WebhookDelivery, error)
+	GetDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error)
+	UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error
+}
+
+type SupabaseWebhookRepository struct {
+	client *Client
+}
+
+func NewWebhookRepository(client *Client) WebhookRepository {
+	return &SupabaseWebhookRepository{client: client}
+}
+
+func (r *SupabaseWebhookRepository) CreateSubscription(ctx context.Context, subscription models.WebhookSubscription) (*models.WebhookSubscription, error) {
+	insertData := map[string]interface{}{
+		"id":         subscription.ID,
+		"url":        subscription.URL,
+		"secret":     subscription.Secret,
+		"events":     subscription.Events,
+		"active":     subscription.Active,
+		"branch_ids": subscription.BranchIDs,
+		"created_at": subscription.CreatedAt.Format(time.RFC3339),
+	}
+
+	var created []models.WebhookSubscription
+	resp, _, err := r.client.From(ctx, "webhook_subscriptions").
+		Insert(insertData, false, "", "representation", "").
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("repository: failed to create webhook subscription: %w", err)
+	}
+
+	if err := json.Unmarshal(resp, &created); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook subscription response: %w", err)
+	}
+	if len(created) == 0 {
+		return nil, fmt.Errorf("repository: webhook subscription insert returned no rows")
+	}
+	return &created[0], nil
+}
+
+func (r *SupabaseWebhookRepository) GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	var subscriptions []models.WebhookSubscription
+	resp, _, err := r.client.From(ctx, "webhook_subscriptions").Select("*", "exact", false).Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook subscriptions from Supabase: %w", err)
+	}
+
+	if err := json.Unmarshal(resp, &subscriptions); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook subscriptions response: %w", err)
+	}
+	return subscriptions, nil
+}
+
+func (r *SupabaseWebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	var deleted []models.WebhookSubscription
+	resp, _, err := r.client.From(ctx, "webhook_subscriptions").
+		Delete("representation", "").
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("repository: failed to delete webhook subscription %s: %w", id, err)
+	}
+
+	if err := json.Unmarshal(resp, &deleted); err != nil {
+		return fmt.Errorf("failed to unmarshal webhook subscription delete response: %w", err)
+	}
+	if len(deleted) == 0 {
+		return fmt.Errorf("webhook subscription with ID %s %w", id, ErrNotFound)
+	}
+	return nil
+}
+
+// ClaimDueDeliveries claims the deliveries in one statement, so that
+// dispatchers running side by side never send the same delivery twice.
+func (r *SupabaseWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	resp, err := r.client.rpc(ctx, "claim_webhook_deliveries", map[string]interface{}{
+		"p_limit":         limit,
+		"p_lease_seconds": int(lease.Seconds()),
+	})
+	if err != nil {
+		logSupabaseResponse(ctx, resp)
+		return nil, fmt.Errorf("repository: failed to claim due webhook deliveries: %w", err)
+	}
+
+	if err := json.Unmarshal(resp, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook deliveries response: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *SupabaseWebhookRepository) GetDeliveriesByStatus(ctx context.Context, status string) ([]models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	resp, _, err := r.client.From(ctx, "webhook_deliveries").
+		Select("*", "exact", false).
+		Filter("status", "eq", status).
+		Order("created_at", &postgrest.OrderOpts{Ascending: true}).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s webhook deliveries from Supabase: %w", status, err)
+	}
+
+	if err := json.Unmarshal(resp, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook deliveries response: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (r *SupabaseWebhookRepository) GetDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	var deliveries []models.WebhookDelivery
+	resp, _, err := r.client.From(ctx, "webhook_deliveries").
+		Select("*", "exact", false).
+		Filter("id", "eq", id).
+		Execute()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch webhook delivery by ID from Supabase: %w", err)
+	}
+
+	if err := json.Unmarshal(resp, &deliveries); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal webhook delivery response: %w", err)
+	}
+	if len(deliveries) == 0 {
+		return nil, fmt.Errorf("webhook delivery with ID %s %w", id, ErrNotFound)
+	}
+	return &deliveries[0], nil
+}
+
+func (r *SupabaseWebhookRepository) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	updateData := map[string]interface{}{
+		"status":           delivery.Status,
+		"attempts":         delivery.Attempts,
+		"next_attempt_at":  delivery.NextAttemptAt.Format(time.RFC3339Nano),
+		"last_error":       delivery.LastError,
+		"last_status_code": delivery.LastStatusCode,
+		"delivered_at":     nil,
+		"locked_until":     nil,
+	}
+	if delivery.DeliveredAt != nil {
+		updateData["delivered_at"] = delivery.DeliveredAt.Format(time.RFC3339Nano)
+	}
+
+	_, _, err := r.client.From(ctx, "webhook_deliveries").
+		Update(updateData, "minimal", "").
+		Filter("id", "eq", delivery.ID).
+		Execute()
+	if err != nil {
+		return fmt.Errorf("repository: failed to update webhook delivery %s (attempt %d): %w", delivery.ID, delivery.Attempts, err)
+	}
+	return nil
+}
@@ -0,0 +1,22 @@
+// Package requestid carries the X-Request-ID of the request being served
+// through its context.
+package requestid
+
+import (
+	"context"
+)
+
+// Header is the request and response header the ID travels in.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID, or "" outside of a request.
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
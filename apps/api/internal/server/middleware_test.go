@@ -0,0 +1,223 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/requestid"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := requestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestid.FromContext(r.Context())
+	}))
+
+	t.Run("propagates a valid incoming ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+		req.Header.Set(requestid.Header, "abc-123")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+
+		if seen != "abc-123" || rec.Header().Get(requestid.Header) != "abc-123" {
+			t.Errorf("Expected request ID abc-123 in context and response, got %q and %q", seen, rec.Header().Get(requestid.Header))
+		}
+	})
+
+	t.Run("replaces a missing or unsafe ID", func(t *testing.T) {
+		for _, incoming := range []string{"", "bad id\nwith newline", strings.Repeat("a", 129)} {
+			req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+			req.Header.Set(requestid.Header, incoming)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(requestid.Header)
+			if got == "" || got == incoming || got != seen {
+				t.Errorf("Expected a generated request ID for %q, got %q (context %q)", incoming, got, seen)
+			}
+		}
+	})
+}
+
+func TestRecoverer(t *testing.T) {
+	h := recoverer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/schedules", nil))
+
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("Expected 500 after a panic, got %d", rec.Code)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/api/schedules", nil)
+	req.Header.Set("X-Forwarded-Proto", "https")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	for header, want := range map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"X-Frame-Options":         "DENY",
+		"Referrer-Policy":         "no-referrer",
+		"Content-Security-Policy": "default-src 'none'; frame-ancestors 'none'",
+		"Cache-Control":           "no-store",
+	} {
+		if got := rec.Header().Get(header); got != want {
+			t.Errorf("Expected %s %q, got %q", header, want, got)
+		}
+	}
+	if rec.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("Expected HSTS behind an HTTPS proxy")
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/swagger/index.html", nil))
+	if rec.Header().Get("Content-Security-Policy") != "" {
+		t.Error("Expected no CSP on Swagger UI")
+	}
+	if rec.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("Expected no HSTS over plain HTTP")
+	}
+
+	// ETag'd reads set their own Cache-Control so clients can revalidate.
+	h = securityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-cache, private")
+	}))
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/schedules/sch-001", nil))
+	if got := rec.Header().Get("Cache-Control"); got != "no-cache, private" {
+		t.Errorf("Expected the handler's Cache-Control to win, got %q", got)
+	}
+}
+
+func TestCORS(t *testing.T) {
+	served := false
+	h := cors([]string{"https://app.example.com"})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+
+	request := func(method, origin string) *httptest.ResponseRecorder {
+		served = false
+		req := httptest.NewRequest(method, "/api/schedules", nil)
+		req.Header.Set("Origin", origin)
+		if method == http.MethodOptions {
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := request(http.MethodGet, "https://app.example.com")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "https://app.example.com" || !served {
+		t.Errorf("Expected an allowed origin to be echoed and served, got %q (served %v)", got, served)
+	}
+
+	rec = request(http.MethodGet, "https://evil.example.com")
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "" {
+		t.Errorf("Expected no CORS headers for other origins, got %q", got)
+	}
+
+	rec = request(http.MethodOptions, "https://app.example.com")
+	if rec.Code != http.StatusNoContent || served {
+		t.Errorf("Expected preflight to be answered with 204, got %d (served %v)", rec.Code, served)
+	}
+	if !strings.Contains(rec.Header().Get("Access-Control-Allow-Headers"), requestid.Header) {
+		t.Errorf("Expected preflight to allow %s, got %q", requestid.Header, rec.Header().Get("Access-Control-Allow-Headers"))
+	}
+
+	rec = request(http.MethodOptions, "https://evil.example.com")
+	if rec.Code != http.StatusForbidden {
+		t.Errorf("Expected preflight from other origins to be refused, got %d", rec.Code)
+	}
+}
+
+func TestBodyLimit(t *testing.T) {
+	var readErr error
+	h := bodyLimit(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, readErr = io.ReadAll(r.Body)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/schedules", strings.NewReader("12345678")))
+	if readErr != nil {
+		t.Errorf("Expected a body at the limit to be read, got %v", readErr)
+	}
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodPost, "/api/schedules", strings.NewReader("123456789")))
+	var tooLarge *http.MaxBytesError
+	if !errors.As(readErr, &tooLarge) {
+		t.Errorf("Expected *http.MaxBytesError for an oversize body, got %v", readErr)
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if scopes := r.Header.Get("X-Test-Scopes"); scopes != "" {
+				key := models.APIKey{ID: "key-1", Scopes: strings.Split(scopes, ",")}
+				r = r.WithContext(auth.WithAPIKey(r.Context(), key))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}, requireScope)
+	ok := func(w http.ResponseWriter, r *http.Request) {}
+	router.HandleFunc("/api/schedules", ok).Methods("GET")
+	router.HandleFunc("/api/schedules/{id}/start", ok).Methods("POST")
+	router.HandleFunc("/api/schedules/reset", ok).Methods("POST")
+
+	cases := []struct {
+		name, method, path, scopes string
+		want                       int
+	}{
+		{"user token", "POST", "/api/schedules/reset", "", http.StatusOK},
+		{"granted scope", "GET", "/api/schedules", "read:schedules", http.StatusOK},
+		{"missing scope", "POST", "/api/schedules/00000000-0000-0000-0000-000000000000/start", "read:schedules", http.StatusForbidden},
+		{"path variables", "POST", "/api/schedules/00000000-0000-0000-0000-000000000000/start", "write:visits", http.StatusOK},
+		{"route without a scope", "POST", "/api/schedules/reset", "read:schedules,write:visits,export:billing", http.StatusForbidden},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(tc.method, tc.path, nil)
+		if tc.scopes != "" {
+			req.Header.Set("X-Test-Scopes", tc.scopes)
+		}
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, req)
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d", tc.name, tc.want, rec.Code)
+		}
+	}
+}
+
+// TestRouteScopesAreRouted keeps routeScopes in step with the route table.
+func TestRouteScopesAreRouted(t *testing.T) {
+	router := mux.NewRouter()
+	registerRoutes(router, Handlers{})
+	routed := map[Route]bool{}
+	for _, route := range (&Server{router: router}).Routes() {
+		routed[route] = true
+	}
+	for route, scopes := range routeScopes {
+		if !routed[route] {
+			t.Errorf("%s %s has scopes but is not routed", route.Method, route.Path)
+		}
+		for _, scope := range scopes {
+			if !models.IsValidAPIKeyScope(scope) {
+				t.Errorf("%s %s has unknown scope %q", route.Method, route.Path, scope)
+			}
+		}
+	}
+}
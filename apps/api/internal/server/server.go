@@ -0,0 +1,234 @@
+// Package server assembles the API's routes and middleware into the single
+// http.Handler served by both the local server and the Vercel function.
+package server
+
+import (
+	"net/http"
+	"sort"
+
+	"github.com/gorilla/mux"
+	httpSwagger "github.com/swaggo/http-swagger"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/handler"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/metrics"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+)
+
+// Handlers are the HTTP handlers the routes are served by.
+type Handlers struct {
+	Schedules *handler.ScheduleHandler
+	CarePlans *handler.CarePlanHandler
+	Webhooks  *handler.WebhookHandler
+	Stream    *handler.StreamHandler
+	Health    *handler.HealthHandler
+	Audit     *handler.AuditHandler
+	Retention *handler.RetentionHandler
+	Branches  *handler.BranchHandler
+	APIKeys   *handler.APIKeyHandler
+	// Auth, when set, scopes every /api request to its caller's tenant. The
+	// repositories refuse queries made without one.
+	Auth *auth.Authenticator
+	// AccessLog, when set, records the PHI returned by the schedule reads.
+	AccessLog *audit.Recorder
+	// Metrics, when set, is fed by the middleware, and served on /metrics to
+	// callers that send MetricsToken as their bearer token.
+	Metrics      *metrics.Metrics
+	MetricsToken string
+}
+
+// Route is one method and path template of the route table.
+type Route struct {
+	Method string
+	Path   string
+}
+
+// Config tunes the middleware chain. The defaults live in the config package.
+type Config struct {
+	// AllowedOrigins are the origins allowed to call the API from a browser.
+	// "*" allows any origin.
+	AllowedOrigins []string
+	// MaxBodyBytes caps the size of request bodies.
+	MaxBodyBytes int64
+}
+
+type Server struct {
+	router  *mux.Router
+	handler http.Handler
+}
+
+// New registers every route and wraps the router in the middleware chain.
+// Build it once and reuse it for all requests.
+func New(h Handlers, cfg Config) *Server {
+	router := mux.NewRouter()
+	registerRoutes(router, h)
+
+	return &Server{
+		router: router,
+		handler: chain(router,
+			requestID,
+			observe(router, h.Metrics),
+			recoverer,
+			securityHeaders,
+			cors(cfg.AllowedOrigins),
+			bodyLimit(cfg.MaxBodyBytes),
+		),
+	}
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.handler.ServeHTTP(w, r)
+}
+
+// Routes lists the registered routes, sorted by path and method.
+func (s *Server) Routes() []Route {
+	var routes []Route
+	s.router.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			// Prefix routes such as /swagger/ answer every method.
+			if route.GetHandler() != nil {
+				routes = append(routes, Route{Method: "*", Path: path})
+			}
+			return nil
+		}
+		for _, method := range methods {
+			routes = append(routes, Route{Method: method, Path: path})
+		}
+		return nil
+	})
+
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+// routeScopes are the routes API keys may call, with the scopes that allow
+// each. A key needs one of them; every other /api route only takes user
+// tokens.
+var routeScopes = map[Route][]string{
+	{"GET", "/api/schedules"}:                       {models.ScopeReadSchedules},
+	{"GET", "/api/schedules/today"}:                 {models.ScopeReadSchedules},
+	{"GET", "/api/schedules/stats"}:                 {models.ScopeReadSchedules, models.ScopeExportBilling},
+	{"GET", "/api/schedules/{id}"}:                  {models.ScopeReadSchedules},
+	{"GET", "/api/care-plans/{id}"}:                 {models.ScopeReadSchedules},
+	{"GET", "/api/clients/{clientId}/care-plan"}:    {models.ScopeReadSchedules},
+	{"GET", "/api/stream/visits"}:                   {models.ScopeReadSchedules},
+	{"POST", "/api/schedules/{id}/start"}:           {models.ScopeWriteVisits},
+	{"POST", "/api/schedules/{id}/end"}:             {models.ScopeWriteVisits},
+	{"POST", "/api/schedules/{id}/tasks"}:           {models.ScopeWriteVisits},
+	{"POST", "/api/schedules/{id}/tasks:batch"}:     {models.ScopeWriteVisits},
+	{"POST", "/api/tasks/{taskId}/update"}:          {models.ScopeWriteVisits},
+	{"GET", "/api/webhooks"}:                        {models.ScopeExportBilling},
+	{"POST", "/api/webhooks"}:                       {models.ScopeExportBilling},
+	{"DELETE", "/api/webhooks/{id}"}:                {models.ScopeExportBilling},
+	{"GET", "/api/webhooks/deliveries/dead"}:        {models.ScopeExportBilling},
+	{"POST", "/api/webhooks/deliveries/{id}/retry"}: {models.ScopeExportBilling},
+}
+
+// requireScope refuses API keys that do not grant a scope of the matched
+// route with 403.
+func requireScope(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := auth.APIKeyFromContext(r.Context()); ok {
+			var scopes []string
+			if route := mux.CurrentRoute(r); route != nil {
+				if path, err := route.GetPathTemplate(); err == nil {
+					scopes = routeScopes[Route{Method: r.Method, Path: path}]
+				}
+			}
+			if !auth.Allows(r.Context(), scopes...) {
+				http.Error(w, "API key lacks the scope for this route", http.StatusForbidden)
+				return
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func registerRoutes(router *mux.Router, h Handlers) {
+	api := router.PathPrefix("/api").Subrouter()
+	if h.Auth != nil {
+		api.Use(h.Auth.Middleware, requireScope)
+	}
+
+	// Reads that return PHI are recorded in the access log.
+	phiRead := func(f http.HandlerFunc) http.Handler {
+		if h.AccessLog == nil {
+			return f
+		}
+		return audit.Middleware(h.AccessLog)(f)
+	}
+	// Streams are recorded once, when they open.
+	phiStream := func(f http.HandlerFunc) http.Handler {
+		if h.AccessLog == nil {
+			return f
+		}
+		return audit.StreamMiddleware(h.AccessLog, "client_id")(f)
+	}
+
+	api.Handle("/schedules", phiRead(h.Schedules.GetSchedules)).Methods("GET")
+	api.HandleFunc("/schedules", h.Schedules.CreateSchedule).Methods("POST")
+	api.Handle("/schedules/today", phiRead(h.Schedules.GetTodaySchedules)).Methods("GET")
+	api.HandleFunc("/schedules/stats", h.Schedules.GetScheduleStats).Methods("GET")
+	api.HandleFunc("/schedules/reset", h.Schedules.ResetSampleData).Methods("POST")
+	api.HandleFunc("/schedules/missed/detect", h.Schedules.DetectMissedVisits).Methods("POST")
+	api.Handle("/schedules/{id}", phiRead(h.Schedules.GetScheduleByID)).Methods("GET")
+	api.HandleFunc("/schedules/{id}/start", h.Schedules.StartVisit).Methods("POST")
+	api.HandleFunc("/schedules/{id}/end", h.Schedules.EndVisit).Methods("POST")
+	api.HandleFunc("/schedules/{id}/tasks", h.Schedules.AddTask).Methods("POST")
+	api.HandleFunc("/schedules/{id}/tasks:batch", h.Schedules.BatchUpdateTasks).Methods("POST")
+
+	api.HandleFunc("/tasks/{taskId}/update", h.Schedules.UpdateTaskStatus).Methods("POST")
+
+	api.HandleFunc("/care-plans", h.CarePlans.CreateCarePlan).Methods("POST")
+	api.Handle("/care-plans/{id}", phiRead(h.CarePlans.GetCarePlan)).Methods("GET")
+	api.HandleFunc("/care-plans/{id}/templates", h.CarePlans.ReplaceTemplates).Methods("PUT")
+	api.Handle("/clients/{clientId}/care-plan", phiRead(h.CarePlans.GetActiveCarePlan)).Methods("GET")
+
+	api.HandleFunc("/webhooks", h.Webhooks.GetSubscriptions).Methods("GET")
+	api.HandleFunc("/webhooks", h.Webhooks.CreateSubscription).Methods("POST")
+	api.HandleFunc("/webhooks/dispatch", h.Webhooks.DispatchDeliveries).Methods("POST")
+	api.HandleFunc("/webhooks/deliveries/dead", h.Webhooks.GetDeadLetters).Methods("GET")
+	api.HandleFunc("/webhooks/deliveries/{id}/retry", h.Webhooks.RetryDelivery).Methods("POST")
+	api.HandleFunc("/webhooks/{id}", h.Webhooks.DeleteSubscription).Methods("DELETE")
+
+	api.Handle("/stream/visits", phiStream(h.Stream.StreamVisits)).Methods("GET")
+
+	api.HandleFunc("/audit/access", h.Audit.GetAccessRecords).Methods("GET")
+
+	api.HandleFunc("/retention/report", h.Retention.GetReport).Methods("GET")
+	api.HandleFunc("/retention/purge", h.Retention.Purge).Methods("POST")
+	api.HandleFunc("/retention/locations/scrub", h.Retention.ScrubLocations).Methods("POST")
+	api.HandleFunc("/retention/holds", h.Retention.GetLegalHolds).Methods("GET")
+	api.HandleFunc("/retention/holds", h.Retention.PlaceLegalHold).Methods("POST")
+	api.HandleFunc("/retention/holds/{clientId}", h.Retention.ReleaseLegalHold).Methods("DELETE")
+
+	api.HandleFunc("/regions", h.Branches.GetRegions).Methods("GET")
+	api.HandleFunc("/regions", h.Branches.CreateRegion).Methods("POST")
+	api.HandleFunc("/branches", h.Branches.GetBranches).Methods("GET")
+	api.HandleFunc("/branches", h.Branches.CreateBranch).Methods("POST")
+	api.HandleFunc("/branches/{id}", h.Branches.GetBranch).Methods("GET")
+	api.HandleFunc("/branches/{id}/{kind}/{memberId}", h.Branches.AssignMember).Methods("PUT")
+	api.HandleFunc("/branches/{id}/{kind}/{memberId}", h.Branches.UnassignMember).Methods("DELETE")
+
+	api.HandleFunc("/api-keys", h.APIKeys.GetAPIKeys).Methods("GET")
+	api.HandleFunc("/api-keys", h.APIKeys.CreateAPIKey).Methods("POST")
+	api.HandleFunc("/api-keys/{id}", h.APIKeys.RevokeAPIKey).Methods("DELETE")
+
+	router.HandleFunc("/healthz", h.Health.Healthz).Methods("GET")
+	router.HandleFunc("/readyz", h.Health.Readyz).Methods("GET")
+	if h.Metrics != nil && h.MetricsToken != "" {
+		router.Handle("/metrics", requireBearer(h.MetricsToken, h.Metrics.Handler())).Methods("GET")
+	}
+	router.PathPrefix("/swagger/").Handler(httpSwagger.WrapHandler)
+}
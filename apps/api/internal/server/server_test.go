@@ -0,0 +1,266 @@
+package server_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	vercel "github.com/forddyce/mini-evv-logger/apps/api/api"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/config"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/health"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/server"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tracing/tracingtest"
+	"github.com/forddyce/mini-evv-logger/apps/api/setup"
+)
+
+var expectedRoutes = []server.Route{
+	{Method: "GET", Path: "/api/api-keys"},
+	{Method: "POST", Path: "/api/api-keys"},
+	{Method: "DELETE", Path: "/api/api-keys/{id}"},
+	{Method: "GET", Path: "/api/audit/access"},
+	{Method: "GET", Path: "/api/branches"},
+	{Method: "POST", Path: "/api/branches"},
+	{Method: "GET", Path: "/api/branches/{id}"},
+	{Method: "DELETE", Path: "/api/branches/{id}/{kind}/{memberId}"},
+	{Method: "PUT", Path: "/api/branches/{id}/{kind}/{memberId}"},
+	{Method: "GET", Path: "/api/care-plans/{id}"},
+	{Method: "POST", Path: "/api/care-plans"},
+	{Method: "PUT", Path: "/api/care-plans/{id}/templates"},
+	{Method: "GET", Path: "/api/clients/{clientId}/care-plan"},
+	{Method: "GET", Path: "/api/regions"},
+	{Method: "POST", Path: "/api/regions"},
+	{Method: "GET", Path: "/api/retention/holds"},
+	{Method: "POST", Path: "/api/retention/holds"},
+	{Method: "DELETE", Path: "/api/retention/holds/{clientId}"},
+	{Method: "POST", Path: "/api/retention/locations/scrub"},
+	{Method: "POST", Path: "/api/retention/purge"},
+	{Method: "GET", Path: "/api/retention/report"},
+	{Method: "GET", Path: "/api/schedules"},
+	{Method: "POST", Path: "/api/schedules"},
+	{Method: "GET", Path: "/api/schedules/stats"},
+	{Method: "GET", Path: "/api/schedules/today"},
+	{Method: "POST", Path: "/api/schedules/reset"},
+	{Method: "POST", Path: "/api/schedules/missed/detect"},
+	{Method: "GET", Path: "/api/schedules/{id}"},
+	{Method: "POST", Path: "/api/schedules/{id}/end"},
+	{Method: "POST", Path: "/api/schedules/{id}/start"},
+	{Method: "POST", Path: "/api/schedules/{id}/tasks"},
+	{Method: "POST", Path: "/api/schedules/{id}/tasks:batch"},
+	{Method: "GET", Path: "/api/stream/visits"},
+	{Method: "POST", Path: "/api/tasks/{taskId}/update"},
+	{Method: "GET", Path: "/api/webhooks"},
+	{Method: "POST", Path: "/api/webhooks"},
+	{Method: "POST", Path: "/api/webhooks/dispatch"},
+	{Method: "GET", Path: "/api/webhooks/deliveries/dead"},
+	{Method: "POST", Path: "/api/webhooks/deliveries/{id}/retry"},
+	{Method: "DELETE", Path: "/api/webhooks/{id}"},
+	{Method: "GET", Path: "/healthz"},
+	{Method: "GET", Path: "/metrics"},
+	{Method: "GET", Path: "/readyz"},
+	{Method: "*", Path: "/swagger/"},
+}
+
+var pathVariable = regexp.MustCompile(`\{[^}]+\}`)
+
+// TestEntryPointsShareRouteTable checks that the local server (which serves
+// setup.NewApp's handler) and the Vercel Handler answer the same routes.
+func TestEntryPointsShareRouteTable(t *testing.T) {
+	app := newApp(t)
+
+	routes := app.Handler.Routes()
+	if !sameRoutes(routes, expectedRoutes) {
+		t.Fatalf("Route table changed, got %v", routes)
+	}
+
+	entryPoints := map[string]http.Handler{
+		"local":  app.Handler,
+		"vercel": http.HandlerFunc(vercel.Handler),
+	}
+	for name, h := range entryPoints {
+		for _, route := range routes {
+			method := route.Method
+			path := pathVariable.ReplaceAllString(route.Path, "00000000-0000-0000-0000-000000000000")
+			if method == "*" {
+				method, path = http.MethodGet, path+"index.html"
+			}
+
+			if status := probe(h, method, path); status == http.StatusNotFound || status == http.StatusMethodNotAllowed {
+				t.Errorf("%s: %s %s is not routed (status %d)", name, route.Method, route.Path, status)
+			}
+		}
+
+		if status := probe(h, http.MethodGet, "/api/not-a-route"); status != http.StatusNotFound {
+			t.Errorf("%s: expected 404 for an unknown route, got %d", name, status)
+		}
+	}
+}
+
+// newApp builds the app from the environment, pointed at a closed port so
+// that Supabase calls fail fast.
+func newApp(t *testing.T) *setup.App {
+	t.Helper()
+	t.Setenv("SUPABASE_URL", "http://127.0.0.1:1")
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "test-key")
+	t.Setenv("METRICS_TOKEN", testMetricsToken)
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Expected the config to load, got %v", err)
+	}
+	app, err := setup.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("Expected the app to build, got %v", err)
+	}
+	return app
+}
+
+func probe(h http.Handler, method, path string) int {
+	// A cancelled context makes the visit stream return straight away.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	req := httptest.NewRequest(method, path, strings.NewReader("{}")).WithContext(ctx)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+// sameRoutes compares route tables regardless of order.
+func sameRoutes(got, want []server.Route) bool {
+	count := func(routes []server.Route) map[server.Route]int {
+		counts := make(map[server.Route]int, len(routes))
+		for _, r := range routes {
+			counts[r]++
+		}
+		return counts
+	}
+	return reflect.DeepEqual(count(got), count(want))
+}
+
+// TestRequestBodiesAreStrict checks that the handlers reject unknown fields
+// and bodies over MAX_BODY_BYTES before reaching the services.
+func TestRequestBodiesAreStrict(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "64")
+
+	app := newApp(t)
+
+	cases := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown field", `{"url": "https://example.com", "events": [], "secret_key": "x"}`, http.StatusBadRequest},
+		{"trailing data", `{"url": "https://example.com"} {}`, http.StatusBadRequest},
+		{"oversize body", `{"url": "https://example.com/` + strings.Repeat("a", 64) + `"}`, http.StatusRequestEntityTooLarge},
+	}
+	for _, tc := range cases {
+		req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(tc.body))
+		rec := httptest.NewRecorder()
+		app.Handler.ServeHTTP(rec, req)
+
+		if rec.Code != tc.want {
+			t.Errorf("%s: expected %d, got %d (%s)", tc.name, tc.want, rec.Code, strings.TrimSpace(rec.Body.String()))
+		}
+		if rec.Header().Get("X-Request-ID") == "" {
+			t.Errorf("%s: expected an X-Request-ID on the response", tc.name)
+		}
+	}
+}
+
+const testMetricsToken = "test-metrics-token-0123456789abcdef"
+
+// TestMetricsEndpoint checks that served requests show up on /metrics under
+// their route template, and that only the metrics token may read them.
+func TestMetricsEndpoint(t *testing.T) {
+	app := newApp(t)
+
+	probe(app.Handler, http.MethodGet, "/api/care-plans/00000000-0000-0000-0000-000000000000")
+
+	for _, authorization := range []string{"", "Bearer wrong-token", testMetricsToken} {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		app.Handler.ServeHTTP(rec, req)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("Authorization %q: expected 401 from /metrics, got %d", authorization, rec.Code)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+	req.Header.Set("Authorization", "Bearer "+testMetricsToken)
+	app.Handler.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected 200 from /metrics, got %d", rec.Code)
+	}
+
+	body := rec.Body.String()
+	for _, want := range []string{
+		`evv_http_requests_total{method="GET",route="/api/care-plans/{id}",status="500"} 1`,
+		`evv_http_request_duration_seconds_count{method="GET",route="/api/care-plans/{id}"} 1`,
+		`evv_repository_call_duration_seconds_count{backend="supabase",method="GetCarePlanByID",repository="care_plan"} 1`,
+		`evv_repository_errors_total{backend="supabase",method="GetCarePlanByID",repository="care_plan"} 1`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("Expected /metrics to contain %s", want)
+		}
+	}
+}
+
+// TestRequestTrace checks that a request continues the caller's trace and that
+// its span tree reaches down to the repository.
+func TestRequestTrace(t *testing.T) {
+	recorder := tracingtest.Install(t)
+
+	app := newApp(t)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	req := httptest.NewRequest(http.MethodGet, "/api/care-plans/00000000-0000-0000-0000-000000000000", nil)
+	req.Header.Set("traceparent", "00-"+traceID+"-00f067aa0ba902b7-01")
+	app.Handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	want := "GET /api/care-plans/{id}\n" +
+		"  CarePlanService.GetCarePlan\n" +
+		"    CarePlanRepository.GetCarePlanByID\n"
+	if got := recorder.Tree(); got != want {
+		t.Errorf("Expected span tree\n%s\ngot\n%s", want, got)
+	}
+	for _, span := range recorder.Ended() {
+		if got := span.SpanContext().TraceID().String(); got != traceID {
+			t.Errorf("Expected %s to continue trace %s, got %s", span.Name(), traceID, got)
+		}
+	}
+}
+
+// TestHealthEndpoints checks that liveness does not depend on Supabase while
+// readiness does.
+func TestHealthEndpoints(t *testing.T) {
+	app := newApp(t)
+
+	if status := probe(app.Handler, http.MethodGet, "/healthz"); status != http.StatusOK {
+		t.Errorf("Expected /healthz to answer 200, got %d", status)
+	}
+
+	rec := httptest.NewRecorder()
+	app.Handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("Expected /readyz to answer 503 without Supabase, got %d", rec.Code)
+	}
+
+	var report health.Report
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("Expected a JSON report, got %q", rec.Body.String())
+	}
+	for _, name := range []string{"supabase", "migrations"} {
+		if result, ok := report.Checks[name]; !ok || result.Status != health.StatusFail || result.Error == "" {
+			t.Errorf("Expected the %s check to fail with an error, got %+v", name, result)
+		}
+	}
+}
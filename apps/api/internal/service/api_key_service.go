@@ -0,0 +1,126 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+// APIKeyService manages the API keys other systems call the API with. Keys
+// are managed by users with access to every branch; supervisors and API keys
+// themselves cannot.
+type APIKeyService interface {
+	GetAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	// CreateAPIKey creates a key with the name, scopes, expiry and rate limit
+	// of key. The returned key carries the key itself, which is not stored.
+	CreateAPIKey(ctx context.Context, key models.APIKey) (*models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id string) error
+}
+
+type apiKeyService struct {
+	repo repository.APIKeyRepository
+}
+
+func NewAPIKeyService(repo repository.APIKeyRepository) APIKeyService {
+	return &apiKeyService{repo: repo}
+}
+
+func (s *apiKeyService) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	if err := checkManagesAPIKeys(ctx); err != nil {
+		return nil, err
+	}
+	keys, err := s.repo.GetAPIKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get API keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, key models.APIKey) (*models.APIKey, error) {
+	if err := checkManagesAPIKeys(ctx); err != nil {
+		return nil, err
+	}
+	key.Name = strings.TrimSpace(key.Name)
+	if key.Name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	if len(key.Scopes) == 0 {
+		return nil, fmt.Errorf("%w: at least one scope is required", ErrInvalidInput)
+	}
+	scopes := []string{}
+	seen := map[string]bool{}
+	for _, scope := range key.Scopes {
+		if !models.IsValidAPIKeyScope(scope) {
+			return nil, fmt.Errorf("%w: unknown scope %q", ErrInvalidInput, scope)
+		}
+		if !seen[scope] {
+			seen[scope] = true
+			scopes = append(scopes, scope)
+		}
+	}
+	if key.RateLimitPerMinute < 0 {
+		return nil, fmt.Errorf("%w: rate_limit_per_minute must not be negative", ErrInvalidInput)
+	}
+	now := time.Now().UTC()
+	if key.ExpiresAt != nil && !key.ExpiresAt.After(now) {
+		return nil, fmt.Errorf("%w: expires_at must be in the future", ErrInvalidInput)
+	}
+
+	secret, prefix, err := auth.GenerateAPIKey()
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to generate API key: %w", err)
+	}
+	created, err := s.repo.CreateAPIKey(ctx, models.APIKey{
+		ID:                 uuid.NewString(),
+		Name:               key.Name,
+		Prefix:             prefix,
+		KeyHash:            auth.HashAPIKey(secret),
+		Scopes:             scopes,
+		RateLimitPerMinute: key.RateLimitPerMinute,
+		ExpiresAt:          key.ExpiresAt,
+		CreatedAt:          now,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to create API key: %w", err)
+	}
+	// The key is only ever shown once, when it is created.
+	created.Key = secret
+	return created, nil
+}
+
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := checkManagesAPIKeys(ctx); err != nil {
+		return err
+	}
+	if _, err := uuid.Parse(id); err != nil {
+		return fmt.Errorf("API key with ID %s %w", id, ErrNotFound)
+	}
+	if err := s.repo.RevokeAPIKey(ctx, id, time.Now().UTC()); err != nil {
+		return fmt.Errorf("service: failed to revoke API key %s: %w", id, err)
+	}
+	return nil
+}
+
+// checkManagesAPIKeys only lets admins manage keys, which act for the whole
+// agency. Supervisors are limited to some branches while keys are not, and
+// API keys could otherwise mint themselves broader ones.
+func checkManagesAPIKeys(ctx context.Context) error {
+	if branch.Restricted(ctx) {
+		return fmt.Errorf("%w: supervisors cannot manage API keys", ErrForbidden)
+	}
+	if _, ok := auth.APIKeyFromContext(ctx); ok {
+		return fmt.Errorf("%w: API keys cannot manage API keys", ErrForbidden)
+	}
+	if !auth.HasRole(ctx, auth.RoleAdmin) {
+		return fmt.Errorf("%w: only admins can manage API keys", ErrForbidden)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+type fakeAPIKeyRepository struct {
+	keys    []models.APIKey
+	revoked []string
+}
+
+var _ repository.APIKeyRepository = &fakeAPIKeyRepository{}
+
+func (f *fakeAPIKeyRepository) APIKeyByHash(ctx context.Context, hash string) (*models.APIKey, error) {
+	for _, k := range f.keys {
+		if k.KeyHash == hash {
+			return &k, nil
+		}
+	}
+	return nil, auth.ErrUnknownAPIKey
+}
+
+func (f *fakeAPIKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) error {
+	return nil
+}
+
+func (f *fakeAPIKeyRepository) GetAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	return f.keys, nil
+}
+
+func (f *fakeAPIKeyRepository) CreateAPIKey(ctx context.Context, key models.APIKey) (*models.APIKey, error) {
+	f.keys = append(f.keys, key)
+	return &key, nil
+}
+
+func (f *fakeAPIKeyRepository) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) error {
+	f.revoked = append(f.revoked, id)
+	return nil
+}
+
+func TestCreateAPIKey_ReturnsTheKeyOnceAndStoresItsHash(t *testing.T) {
+	repo := &fakeAPIKeyRepository{}
+	s := service.NewAPIKeyService(repo)
+
+	created, err := s.CreateAPIKey(context.Background(), models.APIKey{
+		Name:   " Payroll ",
+		Scopes: []string{models.ScopeReadSchedules, models.ScopeExportBilling, models.ScopeReadSchedules},
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey returned error: %v", err)
+	}
+	if !auth.IsAPIKey(created.Key) || !strings.HasPrefix(created.Key, created.Prefix) {
+		t.Errorf("Expected the key and its prefix to be returned, got %q and %q", created.Key, created.Prefix)
+	}
+	if created.Name != "Payroll" || !reflect.DeepEqual(created.Scopes, []string{models.ScopeReadSchedules, models.ScopeExportBilling}) {
+		t.Errorf("Expected a trimmed name and unique scopes, got %q %v", created.Name, created.Scopes)
+	}
+
+	stored := repo.keys[0]
+	if stored.Key != "" || stored.KeyHash != auth.HashAPIKey(created.Key) {
+		t.Errorf("Expected only the key's hash to be stored, got %+v", stored)
+	}
+	if found, err := repo.APIKeyByHash(context.Background(), auth.HashAPIKey(created.Key)); err != nil || found.ID != created.ID {
+		t.Errorf("Expected the key to be found by its hash, got %v", err)
+	}
+}
+
+func TestCreateAPIKey_ValidatesInput(t *testing.T) {
+	s := service.NewAPIKeyService(&fakeAPIKeyRepository{})
+	past := time.Now().Add(-time.Hour)
+
+	cases := map[string]models.APIKey{
+		"no name":             {Scopes: []string{models.ScopeReadSchedules}},
+		"no scopes":           {Name: "Payroll"},
+		"unknown scope":       {Name: "Payroll", Scopes: []string{"admin"}},
+		"negative rate limit": {Name: "Payroll", Scopes: []string{models.ScopeReadSchedules}, RateLimitPerMinute: -1},
+		"expired":             {Name: "Payroll", Scopes: []string{models.ScopeReadSchedules}, ExpiresAt: &past},
+	}
+	for name, key := range cases {
+		if _, err := s.CreateAPIKey(context.Background(), key); !errors.Is(err, service.ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", name, err)
+		}
+	}
+}
+
+func TestAPIKeyService_OnlyAdminsManageKeys(t *testing.T) {
+	repo := &fakeAPIKeyRepository{}
+	s := service.NewAPIKeyService(repo)
+	key := models.APIKey{Name: "Payroll", Scopes: []string{models.ScopeReadSchedules}}
+	keyCtx := auth.WithAPIKey(context.Background(), models.APIKey{ID: "key-1", Scopes: []string{models.ScopeExportBilling}})
+
+	callers := map[string]context.Context{
+		"supervisor": supervising(branchA),
+		"API key":    keyCtx,
+		"caregiver":  auth.WithRole(context.Background(), "caregiver"),
+		"no role":    auth.WithRole(context.Background(), ""),
+	}
+	for name, ctx := range callers {
+		if _, err := s.GetAPIKeys(ctx); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected GetAPIKeys to be forbidden, got %v", name, err)
+		}
+		if _, err := s.CreateAPIKey(ctx, key); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected CreateAPIKey to be forbidden, got %v", name, err)
+		}
+		if err := s.RevokeAPIKey(ctx, branchA); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected RevokeAPIKey to be forbidden, got %v", name, err)
+		}
+	}
+	if len(repo.keys) != 0 || len(repo.revoked) != 0 {
+		t.Errorf("Expected no changes, got %v and %v", repo.keys, repo.revoked)
+	}
+
+	if _, err := s.CreateAPIKey(auth.WithRole(context.Background(), auth.RoleAdmin), key); err != nil {
+		t.Errorf("Expected admins to create keys, got %v", err)
+	}
+}
+
+func TestRevokeAPIKey_UnknownIDIsNotFound(t *testing.T) {
+	repo := &fakeAPIKeyRepository{}
+	s := service.NewAPIKeyService(repo)
+	if err := s.RevokeAPIKey(context.Background(), "not-a-uuid"); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+	if len(repo.revoked) != 0 {
+		t.Errorf("Expected nothing revoked, got %v", repo.revoked)
+	}
+}
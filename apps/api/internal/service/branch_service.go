@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+// BranchService manages regions, branch offices and who belongs to them.
+// Supervisors only see their own branches and cannot change any.
+type BranchService interface {
+	GetRegions(ctx context.Context) ([]models.Region, error)
+	CreateRegion(ctx context.Context, name string) (*models.Region, error)
+	GetBranches(ctx context.Context, regionID string) ([]models.Branch, error)
+	GetBranch(ctx context.Context, id string) (*models.Branch, error)
+	CreateBranch(ctx context.Context, name string, regionID *string) (*models.Branch, error)
+	AssignMember(ctx context.Context, branchID, kind, memberID string) error
+	UnassignMember(ctx context.Context, branchID, kind, memberID string) error
+}
+
+type branchService struct {
+	repo repository.BranchRepository
+}
+
+func NewBranchService(repo repository.BranchRepository) BranchService {
+	return &branchService{repo: repo}
+}
+
+func (s *branchService) GetRegions(ctx context.Context) ([]models.Region, error) {
+	regions, err := s.repo.GetRegions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get regions: %w", err)
+	}
+	return regions, nil
+}
+
+func (s *branchService) CreateRegion(ctx context.Context, name string) (*models.Region, error) {
+	if err := checkManagesBranches(ctx); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+
+	region := models.Region{ID: uuid.NewString(), Name: name, CreatedAt: time.Now().UTC()}
+	created, err := s.repo.CreateRegion(ctx, region)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to create region: %w", err)
+	}
+	return created, nil
+}
+
+func (s *branchService) GetBranches(ctx context.Context, regionID string) ([]models.Branch, error) {
+	if regionID != "" {
+		if _, err := uuid.Parse(regionID); err != nil {
+			return nil, fmt.Errorf("%w: region_id %q is not a UUID", ErrInvalidInput, regionID)
+		}
+	}
+
+	branches, err := s.repo.GetBranches(ctx, regionID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get branches: %w", err)
+	}
+	allowed := []models.Branch{}
+	for _, b := range branches {
+		if branch.Allows(ctx, b.ID) {
+			allowed = append(allowed, b)
+		}
+	}
+	return allowed, nil
+}
+
+func (s *branchService) GetBranch(ctx context.Context, id string) (*models.Branch, error) {
+	if _, err := uuid.Parse(id); err != nil || !branch.Allows(ctx, id) {
+		return nil, fmt.Errorf("branch with ID %s %w", id, ErrNotFound)
+	}
+
+	b, err := s.repo.GetBranchByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get branch %s: %w", id, err)
+	}
+	return b, nil
+}
+
+func (s *branchService) CreateBranch(ctx context.Context, name string, regionID *string) (*models.Branch, error) {
+	if err := checkManagesBranches(ctx); err != nil {
+		return nil, err
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidInput)
+	}
+	if regionID != nil {
+		if err := s.checkRegion(ctx, *regionID); err != nil {
+			return nil, err
+		}
+	}
+
+	b := models.Branch{ID: uuid.NewString(), RegionID: regionID, Name: name, CreatedAt: time.Now().UTC()}
+	created, err := s.repo.CreateBranch(ctx, b)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to create branch: %w", err)
+	}
+	return created, nil
+}
+
+// AssignMember adds a client, caregiver or supervisor to a branch. Assigning
+// a client moves it, and its visits, from its previous branch.
+func (s *branchService) AssignMember(ctx context.Context, branchID, kind, memberID string) error {
+	if err := s.checkMember(ctx, branchID, kind, memberID); err != nil {
+		return err
+	}
+	if err := s.repo.AssignMember(ctx, branchID, kind, memberID); err != nil {
+		return fmt.Errorf("service: failed to assign %s %s to branch %s: %w", kind, memberID, branchID, err)
+	}
+	return nil
+}
+
+func (s *branchService) UnassignMember(ctx context.Context, branchID, kind, memberID string) error {
+	if err := s.checkMember(ctx, branchID, kind, memberID); err != nil {
+		return err
+	}
+	if err := s.repo.UnassignMember(ctx, branchID, kind, memberID); err != nil {
+		return fmt.Errorf("service: failed to unassign %s %s from branch %s: %w", kind, memberID, branchID, err)
+	}
+	return nil
+}
+
+func (s *branchService) checkMember(ctx context.Context, branchID, kind, memberID string) error {
+	if err := checkManagesBranches(ctx); err != nil {
+		return err
+	}
+	if !models.IsValidBranchMemberKind(kind) {
+		return fmt.Errorf("%w: unknown branch member kind %q", ErrInvalidInput, kind)
+	}
+	if strings.TrimSpace(memberID) == "" {
+		return fmt.Errorf("%w: member ID is required", ErrInvalidInput)
+	}
+	if _, err := uuid.Parse(branchID); err != nil {
+		return fmt.Errorf("branch with ID %s %w", branchID, ErrNotFound)
+	}
+	if _, err := s.repo.GetBranchByID(ctx, branchID); err != nil {
+		return fmt.Errorf("service: failed to get branch %s: %w", branchID, err)
+	}
+	return nil
+}
+
+func (s *branchService) checkRegion(ctx context.Context, id string) error {
+	regions, err := s.repo.GetRegions(ctx)
+	if err != nil {
+		return fmt.Errorf("service: failed to get regions: %w", err)
+	}
+	for _, region := range regions {
+		if region.ID == id {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: unknown region_id %q", ErrInvalidInput, id)
+}
+
+// checkClient reports a client outside the caller's branches as not found,
+// like a visit of another branch.
+func checkClient(ctx context.Context, clients branch.Clients, clientID string) error {
+	ok, err := branch.AllowsClient(ctx, clients, clientID)
+	if err != nil {
+		return fmt.Errorf("service: failed to look up the branch of client %s: %w", clientID, err)
+	}
+	if !ok {
+		return fmt.Errorf("client %s %w", clientID, ErrNotFound)
+	}
+	return nil
+}
+
+// checkManagesBranches lets admins create regions and branches and change
+// assignments. Callers limited to some branches could otherwise assign
+// themselves to any other.
+func checkManagesBranches(ctx context.Context) error {
+	if branch.Restricted(ctx) {
+		return fmt.Errorf("%w: supervisors cannot manage branches", ErrForbidden)
+	}
+	if !auth.HasRole(ctx, auth.RoleAdmin) {
+		return fmt.Errorf("%w: only admins can manage branches", ErrForbidden)
+	}
+	return nil
+}
@@ -0,0 +1,377 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+const (
+	branchA = "b0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+	branchB = "b0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12"
+)
+
+type fakeBranchRepository struct {
+	regions  []models.Region
+	branches []models.Branch
+	assigned []string
+	// clients maps client IDs to their branches.
+	clients map[string]string
+}
+
+var _ repository.BranchRepository = &fakeBranchRepository{}
+
+func (f *fakeBranchRepository) GetRegions(ctx context.Context) ([]models.Region, error) {
+	return f.regions, nil
+}
+
+func (f *fakeBranchRepository) CreateRegion(ctx context.Context, region models.Region) (*models.Region, error) {
+	f.regions = append(f.regions, region)
+	return &region, nil
+}
+
+func (f *fakeBranchRepository) GetBranches(ctx context.Context, regionID string) ([]models.Branch, error) {
+	return f.branches, nil
+}
+
+func (f *fakeBranchRepository) GetBranchByID(ctx context.Context, id string) (*models.Branch, error) {
+	for _, b := range f.branches {
+		if b.ID == id {
+			return &b, nil
+		}
+	}
+	return nil, fmt.Errorf("branch with ID %s %w", id, repository.ErrNotFound)
+}
+
+func (f *fakeBranchRepository) CreateBranch(ctx context.Context, b models.Branch) (*models.Branch, error) {
+	f.branches = append(f.branches, b)
+	return &b, nil
+}
+
+func (f *fakeBranchRepository) AssignMember(ctx context.Context, branchID, kind, memberID string) error {
+	f.assigned = append(f.assigned, branchID+"/"+kind+"/"+memberID)
+	return nil
+}
+
+func (f *fakeBranchRepository) UnassignMember(ctx context.Context, branchID, kind, memberID string) error {
+	return nil
+}
+
+func (f *fakeBranchRepository) SupervisedBranchIDs(ctx context.Context, userID string) ([]string, error) {
+	return nil, nil
+}
+
+func (f *fakeBranchRepository) ClientBranchID(ctx context.Context, clientID string) (string, error) {
+	return f.clients[clientID], nil
+}
+
+func supervising(ids ...string) context.Context {
+	return branch.Restrict(context.Background(), ids)
+}
+
+func TestGetSchedules_LimitsSupervisorsToTheirBranches(t *testing.T) {
+	var got []string
+	mockRepo := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			got = query.BranchIDs
+			return nil, nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+
+	if _, err := s.GetSchedules(context.Background(), models.ScheduleListQuery{}); err != nil || got != nil {
+		t.Errorf("Expected no branch filter for unrestricted callers, got %v, %v", got, err)
+	}
+	if _, err := s.GetSchedules(supervising(branchA, branchB), models.ScheduleListQuery{}); err != nil || !reflect.DeepEqual(got, []string{branchA, branchB}) {
+		t.Errorf("Expected the supervisor's branches, got %v, %v", got, err)
+	}
+	if _, err := s.GetSchedules(supervising(branchA, branchB), models.ScheduleListQuery{BranchIDs: []string{branchB}}); err != nil || !reflect.DeepEqual(got, []string{branchB}) {
+		t.Errorf("Expected the requested branch, got %v, %v", got, err)
+	}
+	if _, err := s.GetSchedules(supervising(branchA), models.ScheduleListQuery{BranchIDs: []string{branchB}}); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for another branch, got %v", err)
+	}
+	if _, err := s.GetSchedules(context.Background(), models.ScheduleListQuery{BranchIDs: []string{"downtown"}}); !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a branch ID that is not a UUID, got %v", err)
+	}
+}
+
+func TestGetScheduleStats_LimitsSupervisorsToTheirBranches(t *testing.T) {
+	var got models.StatsQuery
+	mockRepo := &MockScheduleRepository{
+		GetScheduleStatsFunc: func(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+			got = query
+			return &models.ScheduleStats{}, nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+
+	if _, err := s.GetScheduleStats(supervising(branchA), models.StatsQuery{}); err != nil || !reflect.DeepEqual(got.BranchIDs, []string{branchA}) {
+		t.Errorf("Expected stats of the supervisor's branch, got %v, %v", got.BranchIDs, err)
+	}
+	if _, err := s.GetScheduleStats(supervising(branchA), models.StatsQuery{BranchIDs: []string{branchB}}); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected ErrForbidden for another branch, got %v", err)
+	}
+}
+
+func TestScheduleOfAnotherBranchIsNotFound(t *testing.T) {
+	other := branchB
+	started := false
+	mockRepo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) {
+			return &models.Schedule{ID: id, Status: "scheduled", BranchID: &other, Tasks: []models.Task{}}, nil
+		},
+		StartVisitFunc: func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+			started = true
+			return nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+	id := "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+
+	if _, err := s.GetScheduleByID(supervising(branchA), id); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected another branch's schedule to be not found, got %v", err)
+	}
+	if err := s.StartVisit(supervising(branchA), id, -6.2, 106.8, "Somewhere"); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected starting another branch's visit to be refused as not found, got %v", err)
+	}
+	if started {
+		t.Error("Expected another branch's visit not to be started")
+	}
+	if _, err := s.GetScheduleByID(supervising(branchB), id); err != nil {
+		t.Errorf("Expected the supervisor's own branch's schedule, got %v", err)
+	}
+}
+
+func TestGetTodaySchedules_LimitsSupervisorsToTheirBranches(t *testing.T) {
+	a, b := branchA, branchB
+	mockRepo := &MockScheduleRepository{
+		GetTodaySchedulesFunc: func(ctx context.Context) ([]models.Schedule, error) {
+			return []models.Schedule{{ID: "sch-a", BranchID: &a}, {ID: "sch-b", BranchID: &b}, {ID: "sch-none"}}, nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+
+	schedules, err := s.GetTodaySchedules(supervising(branchA))
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(schedules) != 1 || schedules[0].ID != "sch-a" {
+		t.Errorf("Expected only the supervisor's branch's visit, got %+v", schedules)
+	}
+	if all, _ := s.GetTodaySchedules(context.Background()); len(all) != 3 {
+		t.Errorf("Expected every visit for unrestricted callers, got %d", len(all))
+	}
+}
+
+func TestBranchService_SupervisorsSeeOnlyTheirBranches(t *testing.T) {
+	repo := &fakeBranchRepository{branches: []models.Branch{{ID: branchA, Name: "North"}, {ID: branchB, Name: "South"}}}
+	s := service.NewBranchService(repo)
+
+	branches, err := s.GetBranches(supervising(branchA), "")
+	if err != nil || len(branches) != 1 || branches[0].ID != branchA {
+		t.Errorf("Expected only the supervisor's branch, got %+v, %v", branches, err)
+	}
+	if _, err := s.GetBranch(supervising(branchA), branchB); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected another branch to be not found, got %v", err)
+	}
+	if _, err := s.CreateBranch(supervising(branchA), "East", nil); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to create branches, got %v", err)
+	}
+	if err := s.AssignMember(supervising(branchA), branchB, models.BranchSupervisors, "user-1"); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to change assignments, got %v", err)
+	}
+	if len(repo.assigned) != 0 {
+		t.Errorf("Expected no assignment, got %v", repo.assigned)
+	}
+}
+
+func TestBranchService_OnlyAdminsManageBranches(t *testing.T) {
+	repo := &fakeBranchRepository{branches: []models.Branch{{ID: branchA, Name: "North"}}}
+	s := service.NewBranchService(repo)
+	caregiver := auth.WithRole(context.Background(), "caregiver")
+
+	if _, err := s.CreateRegion(caregiver, "Coast"); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected a caregiver not to create regions, got %v", err)
+	}
+	if _, err := s.CreateBranch(caregiver, "East", nil); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected a caregiver not to create branches, got %v", err)
+	}
+	if err := s.AssignMember(caregiver, branchA, models.BranchSupervisors, "user-1"); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected a caregiver not to change assignments, got %v", err)
+	}
+	if err := s.UnassignMember(caregiver, branchA, models.BranchClients, "client-001"); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected a caregiver not to change assignments, got %v", err)
+	}
+	if len(repo.assigned) != 0 {
+		t.Fatalf("Expected no assignment, got %v", repo.assigned)
+	}
+
+	if err := s.AssignMember(auth.WithRole(context.Background(), auth.RoleAdmin), branchA, models.BranchClients, "client-001"); err != nil {
+		t.Errorf("Expected an admin to assign clients, got %v", err)
+	}
+}
+
+func TestBranchService_ValidatesInput(t *testing.T) {
+	repo := &fakeBranchRepository{branches: []models.Branch{{ID: branchA, Name: "North"}}}
+	s := service.NewBranchService(repo)
+	ctx := context.Background()
+
+	if _, err := s.CreateBranch(ctx, " ", nil); !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a blank name, got %v", err)
+	}
+	unknown := "c0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11"
+	if _, err := s.CreateBranch(ctx, "East", &unknown); !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown region, got %v", err)
+	}
+	if err := s.AssignMember(ctx, branchA, "managers", "user-1"); !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown member kind, got %v", err)
+	}
+	if err := s.AssignMember(ctx, branchB, models.BranchClients, "client-001"); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected an unknown branch to be not found, got %v", err)
+	}
+
+	if err := s.AssignMember(ctx, branchA, models.BranchClients, "client-001"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(repo.assigned, []string{branchA + "/clients/client-001"}) {
+		t.Errorf("Unexpected assignments: %v", repo.assigned)
+	}
+}
+
+func TestCarePlans_LimitSupervisorsToTheirBranchesClients(t *testing.T) {
+	clients := &fakeBranchRepository{clients: map[string]string{"client-001": branchA, "client-002": branchB}}
+	plans := &MockCarePlanRepository{
+		GetCarePlanByIDFunc: func(ctx context.Context, id string) (*models.CarePlan, error) {
+			return &models.CarePlan{ID: id, ClientID: "client-002", Active: true}, nil
+		},
+		GetActiveCarePlanFunc: func(ctx context.Context, clientID string) (*models.CarePlan, error) {
+			return &models.CarePlan{ID: "plan-" + clientID, ClientID: clientID, Active: true}, nil
+		},
+	}
+	s := service.NewCarePlanService(plans, &MockScheduleRepository{}, clients)
+
+	if _, err := s.GetActiveCarePlan(supervising(branchA), "client-001"); err != nil {
+		t.Errorf("Expected the plan of the supervisor's client, got %v", err)
+	}
+	if _, err := s.GetActiveCarePlan(supervising(branchA), "client-002"); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected another branch's client to be not found, got %v", err)
+	}
+	if _, err := s.GetCarePlan(supervising(branchA), "plan-002"); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected another branch's plan to be not found, got %v", err)
+	}
+	if _, err := s.ReplaceTemplates(supervising(branchA), "plan-002", nil); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected another branch's plan not to be changed, got %v", err)
+	}
+	if _, err := s.CreateCarePlan(supervising(branchA), models.CarePlan{ClientID: "client-003", Name: "Daily support"}); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected no plan for a client without a branch, got %v", err)
+	}
+	if _, err := s.GetCarePlan(context.Background(), "plan-002"); err != nil {
+		t.Errorf("Expected unrestricted callers to see every plan, got %v", err)
+	}
+}
+
+func TestCreateSchedule_LimitsSupervisorsToTheirBranchesClients(t *testing.T) {
+	created := 0
+	mockRepo := &MockScheduleRepository{
+		CreateScheduleFunc: func(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+			created++
+			return &schedule, nil
+		},
+	}
+	clients := &fakeBranchRepository{clients: map[string]string{"client-001": branchA, "client-002": branchB}}
+	visit := func(clientID string) models.Schedule {
+		return models.Schedule{ClientID: clientID, ClientName: "Jane Doe", ServiceName: "Personal care", ShiftDate: "2026-03-02", StartTime: "09:00", EndTime: "10:00"}
+	}
+
+	s := service.NewScheduleService(mockRepo, service.WithClientBranches(clients))
+	if _, err := s.CreateSchedule(supervising(branchA), visit("client-001")); err != nil {
+		t.Errorf("Expected a visit for the supervisor's client, got %v", err)
+	}
+	if _, err := s.CreateSchedule(supervising(branchA), visit("client-002")); !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("Expected another branch's client to be not found, got %v", err)
+	}
+	if _, err := service.NewScheduleService(mockRepo).CreateSchedule(supervising(branchA), visit("client-001")); err == nil {
+		t.Error("Expected supervisors refused without a way to look clients up")
+	}
+	if created != 1 {
+		t.Errorf("Expected 1 visit created, got %d", created)
+	}
+}
+
+func TestRetention_RefusesSupervisors(t *testing.T) {
+	repo := &memoryRetentionRepository{expired: map[string]int{}, holds: map[string]models.LegalHold{}}
+	svc := service.NewRetentionService(repo, &MockScheduleRepository{}, service.RetentionConfig{Policies: testPolicies})
+	ctx := supervising(branchA)
+
+	if _, err := svc.Purge(ctx, true); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to purge, got %v", err)
+	}
+	if _, err := svc.GetLegalHolds(ctx); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to list holds, got %v", err)
+	}
+	if _, err := svc.PlaceLegalHold(ctx, "client-001", "Litigation"); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to place holds, got %v", err)
+	}
+	if err := svc.ReleaseLegalHold(ctx, "client-001"); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to release holds, got %v", err)
+	}
+	if _, err := svc.ScrubLocations(ctx); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to scrub locations, got %v", err)
+	}
+	if len(repo.calls) != 0 || len(repo.holds) != 0 {
+		t.Errorf("Expected nothing changed, got %+v", repo)
+	}
+}
+
+func TestWebhookSubscriptions_LimitedToTheSupervisorsBranches(t *testing.T) {
+	repo := newMemoryWebhookRepository()
+	svc := service.NewWebhookService(repo, service.WebhookConfig{AllowPrivateTargets: true})
+	admin := auth.WithRole(context.Background(), auth.RoleAdmin)
+
+	agency, err := svc.CreateSubscription(admin, "https://example.com/all", nil, nil, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	north, err := svc.CreateSubscription(admin, "https://example.com/north", nil, []string{branchA}, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if agency.BranchIDs != nil || !reflect.DeepEqual(north.BranchIDs, []string{branchA}) {
+		t.Fatalf("Expected only the second subscription limited to a branch, got %v and %v", agency.BranchIDs, north.BranchIDs)
+	}
+
+	repo.enqueue(t, events.Event{ID: "evt-a", Type: events.VisitStarted, BranchID: branchA})
+	repo.enqueue(t, events.Event{ID: "evt-b", Type: events.VisitStarted, BranchID: branchB})
+	for id, want := range map[string]bool{"evt-a/" + north.ID: true, "evt-b/" + north.ID: false, "evt-b/" + agency.ID: true} {
+		if _, err := repo.GetDeliveryByID(context.Background(), id); (err == nil) != want {
+			t.Errorf("Expected delivery %s queued to be %v, got %v", id, want, err)
+		}
+	}
+
+	if subscriptions, _ := svc.GetSubscriptions(supervising(branchA)); len(subscriptions) != 1 || subscriptions[0].ID != north.ID {
+		t.Errorf("Expected the supervisor to see only its branch's subscription, got %+v", subscriptions)
+	}
+	if _, err := svc.CreateSubscription(supervising(branchA), "https://example.com/own", nil, []string{branchA}, ""); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to create subscriptions, got %v", err)
+	}
+	if err := svc.DeleteSubscription(supervising(branchA), north.ID); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to delete subscriptions, got %v", err)
+	}
+	if _, err := svc.GetDeadLetters(supervising(branchA)); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to read dead letters, got %v", err)
+	}
+	if _, err := svc.ProcessDueDeliveries(supervising(branchA)); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected supervisors not to dispatch deliveries, got %v", err)
+	}
+}
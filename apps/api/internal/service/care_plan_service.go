@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// TaskPlanner produces the tasks a new visit starts out with.
+type TaskPlanner interface {
+	PlanTasks(ctx context.Context, schedule models.Schedule) ([]models.Task, error)
+}
+
+type CarePlanService interface {
+	TaskPlanner
+	CreateCarePlan(ctx context.Context, plan models.CarePlan) (*models.CarePlan, error)
+	GetCarePlan(ctx context.Context, id string) (*models.CarePlan, error)
+	GetActiveCarePlan(ctx context.Context, clientID string) (*models.CarePlan, error)
+	ReplaceTemplates(ctx context.Context, id string, templates []models.TaskTemplate) (*models.CarePlan, error)
+}
+
+type carePlanService struct {
+	plans     repository.CarePlanRepository
+	schedules repository.ScheduleRepository
+	clients   branch.Clients
+}
+
+// NewCarePlanService needs the schedule repository to re-plan visits that
+// have not happened yet whenever a client's care plan changes, and clients to
+// keep supervisors to the care plans of their branches' clients.
+func NewCarePlanService(plans repository.CarePlanRepository, schedules repository.ScheduleRepository, clients branch.Clients) CarePlanService {
+	return &carePlanService{plans: plans, schedules: schedules, clients: clients}
+}
+
+func (s *carePlanService) CreateCarePlan(ctx context.Context, plan models.CarePlan) (*models.CarePlan, error) {
+	plan.ClientID = strings.TrimSpace(plan.ClientID)
+	plan.Name = strings.TrimSpace(plan.Name)
+	if plan.ClientID == "" || plan.Name == "" {
+		return nil, fmt.Errorf("%w: client_id and name are required", ErrInvalidInput)
+	}
+	if err := checkClient(ctx, s.clients, plan.ClientID); err != nil {
+		return nil, err
+	}
+
+	plan.ID = uuid.NewString()
+	templates, err := normalizeTemplates(plan.ID, plan.Templates)
+	if err != nil {
+		return nil, err
+	}
+	plan.Templates = templates
+	plan.Active = true
+	plan.CreatedAt = time.Now().UTC()
+	plan.UpdatedAt = plan.CreatedAt
+
+	created, err := s.plans.CreateCarePlan(ctx, plan)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to create care plan: %w", err)
+	}
+	if _, err := s.replanUpcomingVisits(ctx, created); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+func (s *carePlanService) GetCarePlan(ctx context.Context, id string) (*models.CarePlan, error) {
+	plan, err := s.plans.GetCarePlanByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get care plan %s: %w", id, err)
+	}
+	if err := s.checkPlanClient(ctx, plan); err != nil {
+		return nil, err
+	}
+	return plan, nil
+}
+
+// GetActiveCarePlan returns the client's active plan, or a not found error.
+func (s *carePlanService) GetActiveCarePlan(ctx context.Context, clientID string) (*models.CarePlan, error) {
+	if err := checkClient(ctx, s.clients, clientID); err != nil {
+		return nil, err
+	}
+	plan, err := s.plans.GetActiveCarePlan(ctx, clientID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get active care plan for client %s: %w", clientID, err)
+	}
+	if plan == nil {
+		return nil, fmt.Errorf("active care plan for client %s %w", clientID, ErrNotFound)
+	}
+	return plan, nil
+}
+
+// ReplaceTemplates swaps the plan's task templates. Visits that are already
+// under way or in the past keep the tasks they were planned with; upcoming
+// visits are re-planned from the new templates.
+func (s *carePlanService) ReplaceTemplates(ctx context.Context, id string, templates []models.TaskTemplate) (*models.CarePlan, error) {
+	plan, err := s.plans.GetCarePlanByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get care plan %s: %w", id, err)
+	}
+	if err := s.checkPlanClient(ctx, plan); err != nil {
+		return nil, err
+	}
+	if !plan.Active {
+		return nil, fmt.Errorf("%w: care plan %s has been replaced and can no longer be edited", ErrConflict, id)
+	}
+
+	normalized, err := normalizeTemplates(plan.ID, templates)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.plans.ReplaceTemplates(ctx, plan.ID, normalized, time.Now().UTC()); err != nil {
+		return nil, fmt.Errorf("service: failed to replace templates of care plan %s: %w", id, err)
+	}
+
+	updated, err := s.plans.GetCarePlanByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to reload care plan %s: %w", id, err)
+	}
+	if _, err := s.replanUpcomingVisits(ctx, updated); err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// PlanTasks materializes the tasks for a visit from the client's active care
+// plan. Clients without a plan get no tasks.
+func (s *carePlanService) PlanTasks(ctx context.Context, schedule models.Schedule) ([]models.Task, error) {
+	plan, err := s.plans.GetActiveCarePlan(ctx, schedule.ClientID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get active care plan for client %s: %w", schedule.ClientID, err)
+	}
+	if plan == nil {
+		return nil, nil
+	}
+	return tasksFromTemplates(schedule, plan.Templates)
+}
+
+// checkPlanClient reports a plan of a client outside the caller's branches
+// as not found.
+func (s *carePlanService) checkPlanClient(ctx context.Context, plan *models.CarePlan) error {
+	ok, err := branch.AllowsClient(ctx, s.clients, plan.ClientID)
+	if err != nil {
+		return fmt.Errorf("service: failed to look up the branch of client %s: %w", plan.ClientID, err)
+	}
+	if !ok {
+		return fmt.Errorf("care plan with ID %s %w", plan.ID, ErrNotFound)
+	}
+	return nil
+}
+
+// replanUpcomingVisits regenerates the planned tasks of the client's visits
+// that are still scheduled and have not reached their start time yet.
+func (s *carePlanService) replanUpcomingVisits(ctx context.Context, plan *models.CarePlan) (int, error) {
+	now := time.Now().In(tenant.Location(ctx))
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	query := models.ScheduleListQuery{
+		Limit:    models.MaxScheduleListLimit,
+		Statuses: []string{"scheduled"},
+		ClientID: plan.ClientID,
+		From:     &today,
+	}
+
+	replanned := 0
+	for {
+		// Visits may have started since a cached read; those keep their tasks.
+		schedules, err := s.schedules.GetSchedules(repository.WithFreshReads(ctx), query)
+		if err != nil {
+			return replanned, fmt.Errorf("service: failed to get upcoming visits for client %s: %w", plan.ClientID, err)
+		}
+
+		for _, schedule := range schedules {
+			start, err := scheduledTime(ctx, schedule.ShiftDate, schedule.StartTime)
+			if err != nil || !start.After(now) {
+				continue
+			}
+			tasks, err := tasksFromTemplates(schedule, plan.Templates)
+			if err != nil {
+				return replanned, err
+			}
+			if err := s.schedules.ReplacePlannedTasks(ctx, schedule.ID, tasks); err != nil {
+				return replanned, fmt.Errorf("service: failed to re-plan tasks for schedule %s: %w", schedule.ID, err)
+			}
+			replanned++
+		}
+
+		if len(schedules) < query.Limit {
+			return replanned, nil
+		}
+		last := schedules[len(schedules)-1]
+		query.Cursor = &models.ScheduleCursor{ScheduledStart: last.ScheduledStart, ID: last.ID}
+	}
+}
+
+func tasksFromTemplates(schedule models.Schedule, templates []models.TaskTemplate) ([]models.Task, error) {
+	day, err := time.ParseInLocation(shiftDateLayout, strings.TrimSpace(schedule.ShiftDate), time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("service: invalid shift date %q on schedule %s: %w", schedule.ShiftDate, schedule.ID, err)
+	}
+
+	var tasks []models.Task
+	for _, template := range templates {
+		if !templateApplies(template, day.Weekday()) {
+			continue
+		}
+		templateID := template.ID
+		category := template.Category
+		tasks = append(tasks, models.Task{
+			ID:          uuid.NewString(),
+			ScheduleID:  schedule.ID,
+			Description: template.Description,
+			Category:    &category,
+			Required:    template.Required,
+			TemplateID:  &templateID,
+		})
+	}
+	return tasks, nil
+}
+
+func templateApplies(template models.TaskTemplate, weekday time.Weekday) bool {
+	switch template.Frequency {
+	case models.FrequencyEveryVisit:
+		return true
+	case models.FrequencyMonWedFri:
+		return weekday == time.Monday || weekday == time.Wednesday || weekday == time.Friday
+	case models.FrequencyWeekly:
+		return template.Weekday != nil && strings.EqualFold(*template.Weekday, weekday.String())
+	}
+	return false
+}
+
+// normalizeTemplates validates client supplied templates and assigns their
+// IDs and positions.
+func normalizeTemplates(planID string, templates []models.TaskTemplate) ([]models.TaskTemplate, error) {
+	normalized := make([]models.TaskTemplate, 0, len(templates))
+	for i, template := range templates {
+		template.Description = strings.TrimSpace(template.Description)
+		if template.Description == "" {
+			return nil, fmt.Errorf("%w: template %d has no description", ErrInvalidInput, i)
+		}
+		if !models.IsValidTaskCategory(template.Category) {
+			return nil, fmt.Errorf("%w: template %d has unknown category %q", ErrInvalidInput, i, template.Category)
+		}
+		if template.Frequency == "" {
+			template.Frequency = models.FrequencyEveryVisit
+		}
+		if !models.IsValidTaskFrequency(template.Frequency) {
+			return nil, fmt.Errorf("%w: template %d has unknown frequency %q", ErrInvalidInput, i, template.Frequency)
+		}
+
+		if template.Frequency == models.FrequencyWeekly {
+			if template.Weekday == nil || !isWeekday(*template.Weekday) {
+				return nil, fmt.Errorf("%w: weekly template %d needs a weekday such as \"monday\"", ErrInvalidInput, i)
+			}
+			weekday := strings.ToLower(*template.Weekday)
+			template.Weekday = &weekday
+		} else {
+			template.Weekday = nil
+		}
+
+		template.ID = uuid.NewString()
+		template.CarePlanID = planID
+		template.Position = i
+		normalized = append(normalized, template)
+	}
+	return normalized, nil
+}
+
+func isWeekday(name string) bool {
+	for day := time.Sunday; day <= time.Saturday; day++ {
+		if strings.EqualFold(name, day.String()) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,215 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+type MockCarePlanRepository struct {
+	CreateCarePlanFunc    func(ctx context.Context, plan models.CarePlan) (*models.CarePlan, error)
+	GetCarePlanByIDFunc   func(ctx context.Context, id string) (*models.CarePlan, error)
+	GetActiveCarePlanFunc func(ctx context.Context, clientID string) (*models.CarePlan, error)
+	ReplaceTemplatesFunc  func(ctx context.Context, planID string, templates []models.TaskTemplate, updatedAt time.Time) error
+}
+
+var _ repository.CarePlanRepository = &MockCarePlanRepository{}
+
+func (m *MockCarePlanRepository) CreateCarePlan(ctx context.Context, plan models.CarePlan) (*models.CarePlan, error) {
+	if m.CreateCarePlanFunc != nil {
+		return m.CreateCarePlanFunc(ctx, plan)
+	}
+	return nil, errors.New("CreateCarePlanFunc not set")
+}
+
+func (m *MockCarePlanRepository) GetCarePlanByID(ctx context.Context, id string) (*models.CarePlan, error) {
+	if m.GetCarePlanByIDFunc != nil {
+		return m.GetCarePlanByIDFunc(ctx, id)
+	}
+	return nil, errors.New("GetCarePlanByIDFunc not set")
+}
+
+func (m *MockCarePlanRepository) GetActiveCarePlan(ctx context.Context, clientID string) (*models.CarePlan, error) {
+	if m.GetActiveCarePlanFunc != nil {
+		return m.GetActiveCarePlanFunc(ctx, clientID)
+	}
+	return nil, errors.New("GetActiveCarePlanFunc not set")
+}
+
+func (m *MockCarePlanRepository) ReplaceTemplates(ctx context.Context, planID string, templates []models.TaskTemplate, updatedAt time.Time) error {
+	if m.ReplaceTemplatesFunc != nil {
+		return m.ReplaceTemplatesFunc(ctx, planID, templates, updatedAt)
+	}
+	return errors.New("ReplaceTemplatesFunc not set")
+}
+
+func sampleCarePlan() *models.CarePlan {
+	thursday := "thursday"
+	return &models.CarePlan{
+		ID:       "plan-001",
+		ClientID: "client-001",
+		Name:     "Daily support",
+		Active:   true,
+		Templates: []models.TaskTemplate{
+			{ID: "tpl-bath", Description: "Assist with bathing", Category: models.CategoryADLBathing, Frequency: models.FrequencyEveryVisit, Required: true},
+			{ID: "tpl-laundry", Description: "Do the laundry", Category: models.CategoryIADLLaundry, Frequency: models.FrequencyMonWedFri, Required: false},
+			{ID: "tpl-shop", Description: "Grocery shopping", Category: models.CategoryIADLShopping, Frequency: models.FrequencyWeekly, Weekday: &thursday, Required: true},
+		},
+	}
+}
+
+func TestPlanTasks_AppliesTemplateFrequency(t *testing.T) {
+	plans := &MockCarePlanRepository{
+		GetActiveCarePlanFunc: func(ctx context.Context, clientID string) (*models.CarePlan, error) {
+			return sampleCarePlan(), nil
+		},
+	}
+	s := service.NewCarePlanService(plans, &MockScheduleRepository{}, nil)
+
+	tests := []struct {
+		shiftDate string
+		want      []string
+	}{
+		{"Mon, 13 Jan 2025", []string{"tpl-bath", "tpl-laundry"}},
+		{"Tue, 14 Jan 2025", []string{"tpl-bath"}},
+		{"Thu, 16 Jan 2025", []string{"tpl-bath", "tpl-shop"}},
+	}
+	for _, tt := range tests {
+		tasks, err := s.PlanTasks(context.Background(), models.Schedule{ID: "sch-001", ClientID: "client-001", ShiftDate: tt.shiftDate})
+		if err != nil {
+			t.Fatalf("%s: expected no error, got %v", tt.shiftDate, err)
+		}
+		if len(tasks) != len(tt.want) {
+			t.Fatalf("%s: expected %d tasks, got %d", tt.shiftDate, len(tt.want), len(tasks))
+		}
+		for i, task := range tasks {
+			if task.TemplateID == nil || *task.TemplateID != tt.want[i] {
+				t.Errorf("%s: expected task %d from template %s, got %v", tt.shiftDate, i, tt.want[i], task.TemplateID)
+			}
+			if task.ScheduleID != "sch-001" || task.ID == "" || task.Category == nil {
+				t.Errorf("%s: expected a fully populated task, got %+v", tt.shiftDate, task)
+			}
+		}
+	}
+}
+
+func TestCreateSchedule_MaterializesCarePlanTasks(t *testing.T) {
+	plans := &MockCarePlanRepository{
+		GetActiveCarePlanFunc: func(ctx context.Context, clientID string) (*models.CarePlan, error) {
+			return sampleCarePlan(), nil
+		},
+	}
+	var stored models.Schedule
+	repo := &MockScheduleRepository{
+		CreateScheduleFunc: func(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+			stored = schedule
+			return &schedule, nil
+		},
+	}
+	s := service.NewScheduleService(repo, service.WithTaskPlanner(service.NewCarePlanService(plans, repo, nil)))
+
+	created, err := s.CreateSchedule(context.Background(), models.Schedule{
+		ClientID:    "client-001",
+		ClientName:  "Melisa Adam",
+		ServiceName: "Personal care",
+		ShiftDate:   "2025-01-15",
+		StartTime:   "09:00",
+		EndTime:     "10:00",
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if stored.ShiftDate != "Wed, 15 Jan 2025" || stored.Status != "scheduled" || stored.ID == "" {
+		t.Errorf("Expected a normalized scheduled visit, got %+v", stored)
+	}
+	if len(created.Tasks) != 2 {
+		t.Fatalf("Expected the every-visit and Mon/Wed/Fri tasks, got %d tasks", len(created.Tasks))
+	}
+	if created.Tasks[1].Required {
+		t.Errorf("Expected the optional template to produce an optional task")
+	}
+}
+
+func TestCreateSchedule_InvalidTimes(t *testing.T) {
+	s := service.NewScheduleService(&MockScheduleRepository{})
+
+	_, err := s.CreateSchedule(context.Background(), models.Schedule{
+		ClientID: "client-001", ClientName: "Melisa Adam", ServiceName: "Personal care",
+		ShiftDate: "2025-01-15", StartTime: "10:00", EndTime: "09:00",
+	})
+	if !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an end before the start, got %v", err)
+	}
+}
+
+func TestReplaceTemplates_ReplansOnlyUpcomingVisits(t *testing.T) {
+	plan := sampleCarePlan()
+	plans := &MockCarePlanRepository{
+		GetCarePlanByIDFunc: func(ctx context.Context, id string) (*models.CarePlan, error) {
+			return plan, nil
+		},
+		ReplaceTemplatesFunc: func(ctx context.Context, planID string, templates []models.TaskTemplate, updatedAt time.Time) error {
+			plan.Templates = templates
+			return nil
+		},
+	}
+
+	earlier := time.Now().Add(-2 * time.Hour)
+	later := time.Now().AddDate(0, 0, 2)
+	var queried models.ScheduleListQuery
+	replanned := map[string][]models.Task{}
+	schedules := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			queried = query
+			return []models.Schedule{
+				{ID: "sch-earlier", ClientID: "client-001", ShiftDate: earlier.Format("Mon, 02 Jan 2006"), StartTime: earlier.Format("15:04"), Status: "scheduled"},
+				{ID: "sch-later", ClientID: "client-001", ShiftDate: later.Format("Mon, 02 Jan 2006"), StartTime: later.Format("15:04"), Status: "scheduled"},
+			}, nil
+		},
+		ReplacePlannedTasksFunc: func(ctx context.Context, scheduleID string, tasks []models.Task) error {
+			replanned[scheduleID] = tasks
+			return nil
+		},
+	}
+	s := service.NewCarePlanService(plans, schedules, nil)
+
+	_, err := s.ReplaceTemplates(context.Background(), plan.ID, []models.TaskTemplate{
+		{Description: "Medication reminder", Category: models.CategoryIADLMedication, Required: true},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if queried.ClientID != "client-001" || len(queried.Statuses) != 1 || queried.Statuses[0] != "scheduled" {
+		t.Errorf("Expected only the client's scheduled visits to be considered, got %+v", queried)
+	}
+	if _, ok := replanned["sch-earlier"]; ok {
+		t.Errorf("Expected a visit whose start has passed to keep its tasks")
+	}
+	tasks, ok := replanned["sch-later"]
+	if !ok || len(tasks) != 1 || tasks[0].Description != "Medication reminder" {
+		t.Errorf("Expected the upcoming visit to be re-planned from the new templates, got %+v", tasks)
+	}
+}
+
+func TestReplaceTemplates_RejectsUnknownCategory(t *testing.T) {
+	plans := &MockCarePlanRepository{
+		GetCarePlanByIDFunc: func(ctx context.Context, id string) (*models.CarePlan, error) {
+			return sampleCarePlan(), nil
+		},
+	}
+	s := service.NewCarePlanService(plans, &MockScheduleRepository{}, nil)
+
+	_, err := s.ReplaceTemplates(context.Background(), "plan-001", []models.TaskTemplate{
+		{Description: "Walk the dog", Category: "pets"},
+	})
+	if !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
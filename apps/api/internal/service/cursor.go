@@ -0,0 +1,42 @@
+package service
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+)
+
+const cursorTimeLayout = "2006-01-02T15:04:05"
+
+// EncodeScheduleCursor turns a keyset position into the opaque next_cursor
+// string handed to clients.
+func EncodeScheduleCursor(cursor models.ScheduleCursor) string {
+	raw, _ := json.Marshal(cursor)
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+// DecodeScheduleCursor parses a cursor previously returned as next_cursor. The
+// fields are validated strictly because backends embed them in filters.
+func DecodeScheduleCursor(value string) (*models.ScheduleCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+
+	var cursor models.ScheduleCursor
+	if err := json.Unmarshal(raw, &cursor); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+	if _, err := time.Parse(cursorTimeLayout, cursor.ScheduledStart); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+	if _, err := uuid.Parse(cursor.ID); err != nil {
+		return nil, fmt.Errorf("%w: malformed cursor", ErrInvalidInput)
+	}
+	return &cursor, nil
+}
@@ -0,0 +1,28 @@
+package service
+
+import (
+	"errors"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+var (
+	// ErrInvalidInput wraps validation failures that should surface as 400s.
+	ErrInvalidInput = errors.New("invalid input")
+	// ErrConflict wraps state conflicts that should surface as 409s.
+	ErrConflict = errors.New("conflict")
+	// ErrPreconditionFailed wraps writes refused because the resource changed
+	// since the caller read it, and surfaces as a 412.
+	ErrPreconditionFailed = errors.New("precondition failed")
+	// ErrNotFound wraps lookups of resources that do not exist, or that the
+	// caller may not know exist, and surfaces as a 404.
+	ErrNotFound = repository.ErrNotFound
+	// ErrForbidden is returned when the caller may not see or change the
+	// resource, such as a supervisor asking for another branch, and surfaces
+	// as a 403.
+	ErrForbidden = branch.ErrForbidden
+	// ErrUnavailable is returned while calls to the datastore are suspended
+	// after repeated failures, and surfaces as a 503.
+	ErrUnavailable = repository.ErrUnavailable
+)
@@ -0,0 +1,66 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+// ETag returns a strong entity tag for v, derived from a hash of its JSON
+// representation, so that it changes whenever the representation does.
+func ETag(v interface{}) (string, error) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(raw)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`, nil
+}
+
+type ifMatchKey struct{}
+
+// WithIfMatch makes the visit and task changes made with ctx conditional: they
+// fail with ErrPreconditionFailed unless the schedule's current ETag is one of
+// etags. "*" matches any existing schedule.
+func WithIfMatch(ctx context.Context, etags []string) context.Context {
+	return context.WithValue(ctx, ifMatchKey{}, etags)
+}
+
+// checkIfMatch is called with the schedule a change was validated against,
+// right before the change is written. The returned context makes the write
+// conditional on the schedule still being at the version that matched, so
+// that a concurrent change made between the check and the write is caught.
+func checkIfMatch(ctx context.Context, schedule *models.Schedule) (context.Context, error) {
+	etags, ok := ctx.Value(ifMatchKey{}).([]string)
+	if !ok {
+		return ctx, nil
+	}
+	current, err := ETag(schedule)
+	if err != nil {
+		return ctx, fmt.Errorf("service: failed to compute the ETag of schedule %s: %w", schedule.ID, err)
+	}
+	for _, etag := range etags {
+		if etag == "*" {
+			return ctx, nil
+		}
+		if etag == current {
+			return repository.WithIfVersion(ctx, schedule.Version), nil
+		}
+	}
+	return ctx, fmt.Errorf("%w: schedule %s has changed since it was read", ErrPreconditionFailed, schedule.ID)
+}
+
+// scheduleChanged reports a write the repository refused because schedule id
+// changed while it was being written: a failed precondition if the caller
+// sent If-Match, a conflict otherwise.
+func scheduleChanged(ctx context.Context, id, while string) error {
+	if _, ok := ctx.Value(ifMatchKey{}).([]string); ok {
+		return fmt.Errorf("%w: schedule %s changed while %s", ErrPreconditionFailed, id, while)
+	}
+	return fmt.Errorf("%w: schedule %s changed while %s", ErrConflict, id, while)
+}
@@ -0,0 +1,131 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+func TestETag_FollowsContent(t *testing.T) {
+	schedule := models.Schedule{ID: "sch-001", Status: "scheduled"}
+	first, err := service.ETag(schedule)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, _ := service.ETag(schedule)
+	schedule.Version++
+	reencrypted, _ := service.ETag(schedule)
+	schedule.Status = "in_progress"
+	changed, _ := service.ETag(schedule)
+
+	if first != again {
+		t.Errorf("Expected the same content to get the same ETag, got %s and %s", first, again)
+	}
+	if first != reencrypted {
+		t.Errorf("Expected the version to be left out of the ETag, got %s and %s", first, reencrypted)
+	}
+	if first == changed {
+		t.Errorf("Expected a change to get a new ETag, both are %s", first)
+	}
+	if first[0] != '"' || first[len(first)-1] != '"' {
+		t.Errorf("Expected a quoted strong ETag, got %s", first)
+	}
+}
+
+func TestIfMatch_RejectsChangesBasedOnStaleReads(t *testing.T) {
+	schedule := &models.Schedule{ID: "sch-001", ClientID: "client-001", Status: "scheduled"}
+	current, _ := service.ETag(schedule)
+
+	started := 0
+	repo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) { return schedule, nil },
+		StartVisitFunc: func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+			started++
+			return nil
+		},
+	}
+	svc := service.NewScheduleService(repo)
+
+	stale := service.WithIfMatch(context.Background(), []string{`"0000"`})
+	if err := svc.StartVisit(stale, "sch-001", -6.2, 106.8, "Casa Grande"); !errors.Is(err, service.ErrPreconditionFailed) {
+		t.Fatalf("Expected ErrPreconditionFailed for a stale ETag, got %v", err)
+	}
+	if started != 0 {
+		t.Fatal("Expected the visit not to be started")
+	}
+
+	for _, etags := range [][]string{{`"0000"`, current}, {"*"}} {
+		if err := svc.StartVisit(service.WithIfMatch(context.Background(), etags), "sch-001", -6.2, 106.8, "Casa Grande"); err != nil {
+			t.Errorf("Expected If-Match %v to let the change through, got %v", etags, err)
+		}
+	}
+	if started != 2 {
+		t.Errorf("Expected 2 visits to be started, got %d", started)
+	}
+}
+
+func TestIfMatch_AppliesToTaskUpdates(t *testing.T) {
+	schedule := inProgressSchedule(models.Task{ID: "task-001", ScheduleID: "sch-001", Required: true})
+	updated := false
+	repo := &MockScheduleRepository{
+		GetTaskByIDFunc: func(ctx context.Context, taskID string) (*models.Task, error) {
+			return &schedule.Tasks[0], nil
+		},
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) { return schedule, nil },
+		UpdateTaskStatusesFunc: func(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error {
+			updated = true
+			return nil
+		},
+	}
+
+	ctx := service.WithIfMatch(context.Background(), []string{`"0000"`})
+	err := service.NewScheduleService(repo).UpdateTaskStatus(ctx, "task-001", models.TaskUpdate{Completed: true})
+	if !errors.Is(err, service.ErrPreconditionFailed) {
+		t.Fatalf("Expected ErrPreconditionFailed, got %v", err)
+	}
+	if updated {
+		t.Error("Expected the task not to be updated")
+	}
+}
+
+// TestIfMatch_WritesAreConditionalOnTheMatchedVersion checks that a change
+// whose ETag matched is only written if the schedule is still at the version
+// that matched, and that a change made in between fails with 412.
+func TestIfMatch_WritesAreConditionalOnTheMatchedVersion(t *testing.T) {
+	schedule := &models.Schedule{ID: "sch-001", Status: "scheduled", Version: 7}
+	current, _ := service.ETag(schedule)
+
+	var versions []int64
+	repo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) { return schedule, nil },
+		StartVisitFunc: func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+			version, ok := repository.IfVersion(ctx)
+			if !ok {
+				return nil
+			}
+			versions = append(versions, version)
+			// Another writer with the same ETag got there first.
+			return fmt.Errorf("%w: schedule is no longer at version %d", repository.ErrScheduleChanged, version)
+		},
+	}
+	svc := service.NewScheduleService(repo)
+
+	err := svc.StartVisit(service.WithIfMatch(context.Background(), []string{current}), "sch-001", -6.2, 106.8, "Casa Grande")
+	if !errors.Is(err, service.ErrPreconditionFailed) {
+		t.Errorf("Expected ErrPreconditionFailed when the schedule changed before the write, got %v", err)
+	}
+	if len(versions) != 1 || versions[0] != 7 {
+		t.Errorf("Expected the write to be conditional on version 7, got %v", versions)
+	}
+
+	if err := svc.StartVisit(service.WithIfMatch(context.Background(), []string{"*"}), "sch-001", -6.2, 106.8, "Casa Grande"); err != nil {
+		t.Errorf("Expected If-Match * not to pin a version, got %v", err)
+	}
+}
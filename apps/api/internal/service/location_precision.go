@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// scrubActor is recorded in the access log for the scrubs of the location job.
+const scrubActor = "system:location-precision"
+
+// LocationPolicy reduces the precision of the clock-in and clock-out locations
+// of completed visits once they are no longer needed.
+type LocationPolicy struct {
+	// Mode is models.LocationKeep, LocationCoarsen or LocationVerificationOnly.
+	Mode string
+	// Decimals is how many decimal places coarsened coordinates keep. Two are
+	// roughly a kilometre.
+	Decimals int
+	// AfterVerified scrubs a visit as soon as both of its locations are within
+	// GeofenceRadiusMeters of the client's location.
+	AfterVerified bool
+	// AfterDays scrubs every completed visit scheduled at least this many days
+	// ago, verified or not. Zero turns the age rule off.
+	AfterDays int
+	// GeofenceRadiusMeters is the default radius; a tenant's own radius takes
+	// precedence.
+	GeofenceRadiusMeters float64
+}
+
+func DefaultLocationPolicy() LocationPolicy {
+	return LocationPolicy{Mode: models.LocationKeep, Decimals: 2, AfterVerified: true, AfterDays: 30, GeofenceRadiusMeters: 150}
+}
+
+func (p LocationPolicy) enabled() bool {
+	return p.Mode != "" && p.Mode != models.LocationKeep && (p.AfterVerified || p.AfterDays > 0)
+}
+
+func (s *retentionService) ScrubLocations(ctx context.Context) (*models.LocationScrubReport, error) {
+	if err := checkManagesRetention(ctx); err != nil {
+		return nil, err
+	}
+	policy := s.config.Locations
+	if t, _ := tenant.FromContext(ctx); t.GeofenceRadiusMeters > 0 {
+		policy.GeofenceRadiusMeters = float64(t.GeofenceRadiusMeters)
+	}
+	report := &models.LocationScrubReport{Mode: policy.Mode}
+	if !policy.enabled() {
+		return report, nil
+	}
+
+	holds, err := s.repo.GetLegalHolds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get legal holds: %w", err)
+	}
+	held := make(map[string]bool, len(holds))
+	for _, hold := range holds {
+		held[hold.ClientID] = true
+	}
+
+	var cutoff *time.Time
+	if policy.AfterDays > 0 {
+		now := time.Now().In(tenant.Location(ctx))
+		c := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -policy.AfterDays)
+		cutoff = &c
+	}
+	query := models.LocationScrubQuery{Limit: s.config.BatchSize}
+	if !policy.AfterVerified {
+		// Only the age rule applies, so younger visits need not be read.
+		query.Before = cutoff
+	}
+
+	for {
+		visits, err := s.schedules.GetUnscrubbedVisits(ctx, query)
+		if err != nil {
+			return nil, fmt.Errorf("service: failed to get unscrubbed visits: %w", err)
+		}
+		for _, visit := range visits {
+			report.Scanned++
+			scrub, due := policy.scrub(visit, cutoff)
+			if !due || held[visit.ClientID] {
+				report.Skipped++
+				continue
+			}
+			applied, err := s.schedules.ScrubVisitLocations(ctx, scrub)
+			if err != nil {
+				return nil, fmt.Errorf("service: failed to scrub the locations of schedule %s: %w", visit.ID, err)
+			}
+			if applied {
+				report.Scrubbed++
+			} else {
+				report.Skipped++
+			}
+		}
+		if len(visits) < s.config.BatchSize {
+			return report, nil
+		}
+		query.AfterID = visits[len(visits)-1].ID
+	}
+}
+
+// scrub returns the scrub of visit, and whether it is due: both locations
+// passed the geofence check (if AfterVerified), or the visit is older than
+// cutoff.
+func (p LocationPolicy) scrub(visit models.Schedule, cutoff *time.Time) (models.LocationScrub, bool) {
+	scrub := models.LocationScrub{
+		ScheduleID:        visit.ID,
+		StartVerification: p.verify(visit.StartLocation, visit.Location),
+		EndVerification:   p.verify(visit.EndLocation, visit.Location),
+		Actor:             scrubActor,
+	}
+	if visit.StartLocation != nil {
+		scrub.Fields = append(scrub.Fields, "start_location")
+	}
+	if visit.EndLocation != nil {
+		scrub.Fields = append(scrub.Fields, "end_location")
+	}
+	if p.Mode == models.LocationCoarsen {
+		scrub.StartLocation = p.coarsen(visit.StartLocation)
+		scrub.EndLocation = p.coarsen(visit.EndLocation)
+	}
+
+	verified := scrub.StartVerification != nil && scrub.StartVerification.Verified &&
+		scrub.EndVerification != nil && scrub.EndVerification.Verified
+	if p.AfterVerified && verified {
+		return scrub, true
+	}
+	if cutoff != nil {
+		scheduled, err := time.ParseInLocation("2006-01-02T15:04:05", visit.ScheduledStart, cutoff.Location())
+		return scrub, err == nil && scheduled.Before(*cutoff)
+	}
+	return scrub, false
+}
+
+// verify checks location against the geofence around the client's location.
+// It returns nil when there is nothing to check against.
+func (p LocationPolicy) verify(location *models.Location, client models.Location) *models.LocationVerification {
+	if location == nil || (client.Latitude == 0 && client.Longitude == 0) {
+		return nil
+	}
+	distance := distanceMeters(location.Latitude, location.Longitude, client.Latitude, client.Longitude)
+	return &models.LocationVerification{
+		Verified:       distance <= p.GeofenceRadiusMeters,
+		DistanceMeters: math.Round(distance),
+		RadiusMeters:   p.GeofenceRadiusMeters,
+	}
+}
+
+// coarsen rounds the coordinates of location to Decimals places and drops
+// the address the caregiver's device reported.
+func (p LocationPolicy) coarsen(location *models.Location) *models.Location {
+	if location == nil {
+		return nil
+	}
+	scale := math.Pow(10, float64(p.Decimals))
+	return &models.Location{
+		Latitude:  math.Round(location.Latitude*scale) / scale,
+		Longitude: math.Round(location.Longitude*scale) / scale,
+	}
+}
+
+// distanceMeters is the great-circle distance between two coordinates.
+func distanceMeters(lat1, lng1, lat2, lng2 float64) float64 {
+	const earthRadiusMeters = 6371000
+	toRadians := func(degrees float64) float64 { return degrees * math.Pi / 180 }
+	dLat := toRadians(lat2 - lat1)
+	dLng := toRadians(lng2 - lng1)
+	a := math.Sin(dLat/2)*math.Sin(dLat/2) +
+		math.Cos(toRadians(lat1))*math.Cos(toRadians(lat2))*math.Sin(dLng/2)*math.Sin(dLng/2)
+	return 2 * earthRadiusMeters * math.Asin(math.Sqrt(a))
+}
+
+// RunLocationScrub scrubs the locations of due visits immediately and then
+// every interval, until ctx is cancelled.
+func RunLocationScrub(ctx context.Context, s RetentionService, tenants tenant.Store, interval time.Duration) {
+	scrub := func() {
+		err := tenant.Each(ctx, tenants, func(ctx context.Context) error {
+			report, err := s.ScrubLocations(ctx)
+			if err != nil {
+				return err
+			}
+			if report.Scrubbed > 0 {
+				slog.InfoContext(ctx, "Scrubbed visit locations", "tenant", tenant.ID(ctx), "mode", report.Mode, "visits", report.Scrubbed)
+			}
+			return nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "Location scrub failed", "error", err)
+		}
+	}
+
+	scrub()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			scrub()
+		}
+	}
+}
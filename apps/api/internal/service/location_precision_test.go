@@ -0,0 +1,135 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+// clientHome is the client location the geofence is drawn around.
+var clientHome = models.Location{Latitude: 40.712800, Longitude: -74.006000, Address: "12 Elm Street"}
+
+// visitAt returns a completed visit scheduled daysAgo whose clock-in and
+// clock-out were latitudeOffset degrees north of the client (0.001 is ~111m).
+func visitAt(id, clientID string, daysAgo int, latitudeOffset float64) models.Schedule {
+	at := &models.Location{Latitude: clientHome.Latitude + latitudeOffset, Longitude: clientHome.Longitude, Address: "Device address"}
+	return models.Schedule{
+		ID:             id,
+		ClientID:       clientID,
+		Location:       clientHome,
+		Status:         "completed",
+		ScheduledStart: time.Now().AddDate(0, 0, -daysAgo).Format("2006-01-02T15:04:05"),
+		StartLocation:  at,
+		EndLocation:    at,
+	}
+}
+
+func newScrubRepository(visits []models.Schedule, scrubs map[string]models.LocationScrub) *MockScheduleRepository {
+	return &MockScheduleRepository{
+		GetUnscrubbedVisitsFunc: func(ctx context.Context, query models.LocationScrubQuery) ([]models.Schedule, error) {
+			var page []models.Schedule
+			for _, visit := range visits {
+				if visit.ID > query.AfterID && len(page) < query.Limit {
+					page = append(page, visit)
+				}
+			}
+			return page, nil
+		},
+		ScrubVisitLocationsFunc: func(ctx context.Context, scrub models.LocationScrub) (bool, error) {
+			scrubs[scrub.ScheduleID] = scrub
+			return true, nil
+		},
+	}
+}
+
+func TestScrubLocations_Coarsen(t *testing.T) {
+	visits := []models.Schedule{
+		visitAt("sch-001", "client-001", 1, 0.0005),  // ~56m away: verified
+		visitAt("sch-002", "client-001", 1, 0.01),    // ~1.1km away: kept for review
+		visitAt("sch-003", "client-001", 45, 0.01),   // unverified, but old enough
+		visitAt("sch-004", "client-held", 1, 0.0005), // verified, client on legal hold
+	}
+	scrubs := map[string]models.LocationScrub{}
+	repo := &memoryRetentionRepository{holds: map[string]models.LegalHold{"client-held": {ClientID: "client-held"}}}
+	policy := service.DefaultLocationPolicy()
+	policy.Mode = models.LocationCoarsen
+	svc := service.NewRetentionService(repo, newScrubRepository(visits, scrubs), service.RetentionConfig{Locations: policy, BatchSize: 2})
+
+	report, err := svc.ScrubLocations(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Scanned != 4 || report.Scrubbed != 2 || report.Skipped != 2 {
+		t.Errorf("Expected 2 of 4 visits scrubbed, got %+v", report)
+	}
+	if _, ok := scrubs["sch-002"]; ok {
+		t.Error("Expected a recent visit outside the geofence to keep its locations")
+	}
+	if _, ok := scrubs["sch-004"]; ok {
+		t.Error("Expected a visit of a client on legal hold to keep its locations")
+	}
+
+	verified := scrubs["sch-001"]
+	if verified.StartLocation == nil || verified.StartLocation.Latitude != 40.71 || verified.StartLocation.Longitude != -74.01 || verified.StartLocation.Address != "" {
+		t.Errorf("Expected the coordinates rounded to 2 places and no address, got %+v", verified.StartLocation)
+	}
+	if v := verified.EndVerification; v == nil || !v.Verified || v.DistanceMeters != 56 || v.RadiusMeters != 150 {
+		t.Errorf("Expected a verified clock-out 56m away, got %+v", v)
+	}
+	if len(verified.Fields) != 2 || verified.Actor == "" {
+		t.Errorf("Expected the scrubbed fields and actor for the access log, got %+v", verified)
+	}
+	if v := scrubs["sch-003"].StartVerification; v == nil || v.Verified {
+		t.Errorf("Expected the old visit to record its failed geofence check, got %+v", v)
+	}
+}
+
+func TestScrubLocations_VerificationOnlyAndKeep(t *testing.T) {
+	visits := []models.Schedule{visitAt("sch-001", "client-001", 1, 0.0005)}
+	scrubs := map[string]models.LocationScrub{}
+	repo := &memoryRetentionRepository{holds: map[string]models.LegalHold{}}
+	policy := service.DefaultLocationPolicy()
+
+	report, err := service.NewRetentionService(repo, newScrubRepository(visits, scrubs), service.RetentionConfig{Locations: policy}).
+		ScrubLocations(context.Background())
+	if err != nil || report.Scanned != 0 || len(scrubs) != 0 {
+		t.Fatalf("Expected the default keep mode to do nothing, got %+v, %v", report, err)
+	}
+
+	policy.Mode = models.LocationVerificationOnly
+	if _, err := service.NewRetentionService(repo, newScrubRepository(visits, scrubs), service.RetentionConfig{Locations: policy}).
+		ScrubLocations(context.Background()); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	scrub, ok := scrubs["sch-001"]
+	if !ok || scrub.StartLocation != nil || scrub.EndLocation != nil {
+		t.Fatalf("Expected the locations to be dropped, got %+v", scrub)
+	}
+	if scrub.StartVerification == nil || !scrub.StartVerification.Verified {
+		t.Errorf("Expected the verification result to be kept, got %+v", scrub.StartVerification)
+	}
+}
+
+func TestScrubLocations_OnlyAdminsAndPrivacyOfficers(t *testing.T) {
+	visits := []models.Schedule{visitAt("sch-001", "client-001", 1, 0.0005)}
+	scrubs := map[string]models.LocationScrub{}
+	repo := &memoryRetentionRepository{holds: map[string]models.LegalHold{}}
+	policy := service.DefaultLocationPolicy()
+	policy.Mode = models.LocationCoarsen
+	svc := service.NewRetentionService(repo, newScrubRepository(visits, scrubs), service.RetentionConfig{Locations: policy})
+
+	if _, err := svc.ScrubLocations(auth.WithRole(context.Background(), "caregiver")); !errors.Is(err, service.ErrForbidden) {
+		t.Errorf("Expected a caregiver not to scrub locations, got %v", err)
+	}
+	if len(scrubs) != 0 {
+		t.Fatalf("Expected nothing scrubbed, got %+v", scrubs)
+	}
+	if report, err := svc.ScrubLocations(auth.WithRole(context.Background(), auth.RolePrivacyOfficer)); err != nil || report.Scrubbed != 1 {
+		t.Errorf("Expected a privacy officer to scrub the visit, got %+v, %v", report, err)
+	}
+}
@@ -0,0 +1,198 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+type RetentionService interface {
+	// Purge applies every retention policy. With dryRun nothing is changed
+	// and the report counts what a purge would remove.
+	Purge(ctx context.Context, dryRun bool) (*models.RetentionReport, error)
+	GetLegalHolds(ctx context.Context) ([]models.LegalHold, error)
+	// PlaceLegalHold records the caller of ctx as the one who placed it.
+	PlaceLegalHold(ctx context.Context, clientID, reason string) (*models.LegalHold, error)
+	ReleaseLegalHold(ctx context.Context, clientID string) error
+	// ScrubLocations coarsens or drops the visit locations that
+	// Config.Locations no longer needs, except for clients on legal hold.
+	ScrubLocations(ctx context.Context) (*models.LocationScrubReport, error)
+}
+
+type RetentionConfig struct {
+	Policies  []models.RetentionPolicy
+	Locations LocationPolicy
+	// BatchSize caps how many rows one purge call changes, so that a large
+	// backlog is worked off in short transactions.
+	BatchSize int
+}
+
+func DefaultRetentionConfig() RetentionConfig {
+	return RetentionConfig{Locations: DefaultLocationPolicy(), BatchSize: 500}
+}
+
+type retentionService struct {
+	repo      repository.RetentionRepository
+	schedules repository.ScheduleRepository
+	config    RetentionConfig
+}
+
+func NewRetentionService(repo repository.RetentionRepository, schedules repository.ScheduleRepository, config RetentionConfig) RetentionService {
+	if config.BatchSize <= 0 {
+		config.BatchSize = DefaultRetentionConfig().BatchSize
+	}
+	return &retentionService{repo: repo, schedules: schedules, config: config}
+}
+
+func (s *retentionService) Purge(ctx context.Context, dryRun bool) (*models.RetentionReport, error) {
+	if err := checkManagesRetention(ctx); err != nil {
+		return nil, err
+	}
+	holds, err := s.repo.GetLegalHolds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get legal holds: %w", err)
+	}
+
+	now := time.Now().In(tenant.Location(ctx))
+	report := &models.RetentionReport{
+		DryRun:     dryRun,
+		RanAt:      now.UTC(),
+		LegalHolds: len(holds),
+		Classes:    make([]models.RetentionResult, 0, len(s.config.Policies)),
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	for _, policy := range s.config.Policies {
+		result := models.RetentionResult{RetentionPolicy: policy}
+		if policy.RetainDays > 0 {
+			cutoff := today.AddDate(0, 0, -policy.RetainDays)
+			result.Cutoff = &cutoff
+			if result.Affected, err = s.purgeClass(ctx, policy, cutoff, dryRun); err != nil {
+				return nil, err
+			}
+		}
+		report.Classes = append(report.Classes, result)
+	}
+	return report, nil
+}
+
+// purgeClass works off the expired rows of one class in batches.
+func (s *retentionService) purgeClass(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, dryRun bool) (int, error) {
+	if dryRun {
+		due, err := s.repo.Purge(ctx, policy, cutoff, 0, true)
+		if err != nil {
+			return 0, fmt.Errorf("service: failed to count expired %s: %w", policy.DataClass, err)
+		}
+		return due, nil
+	}
+
+	total := 0
+	for {
+		purged, err := s.repo.Purge(ctx, policy, cutoff, s.config.BatchSize, false)
+		total += purged
+		if err != nil {
+			return total, fmt.Errorf("service: failed to purge expired %s after %d rows: %w", policy.DataClass, total, err)
+		}
+		if purged < s.config.BatchSize {
+			return total, nil
+		}
+	}
+}
+
+func (s *retentionService) GetLegalHolds(ctx context.Context) ([]models.LegalHold, error) {
+	if err := checkManagesRetention(ctx); err != nil {
+		return nil, err
+	}
+	holds, err := s.repo.GetLegalHolds(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get legal holds: %w", err)
+	}
+	return holds, nil
+}
+
+func (s *retentionService) PlaceLegalHold(ctx context.Context, clientID, reason string) (*models.LegalHold, error) {
+	if err := checkManagesRetention(ctx); err != nil {
+		return nil, err
+	}
+	clientID, reason = strings.TrimSpace(clientID), strings.TrimSpace(reason)
+	if clientID == "" {
+		return nil, fmt.Errorf("%w: client_id is required", ErrInvalidInput)
+	}
+	if reason == "" {
+		return nil, fmt.Errorf("%w: a legal hold needs a reason", ErrInvalidInput)
+	}
+
+	placedBy := audit.Actor(ctx)
+	hold := models.LegalHold{ClientID: clientID, Reason: reason, PlacedBy: &placedBy, CreatedAt: time.Now().UTC()}
+	placed, err := s.repo.PlaceLegalHold(ctx, hold)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to place legal hold on client %s: %w", clientID, err)
+	}
+	return placed, nil
+}
+
+func (s *retentionService) ReleaseLegalHold(ctx context.Context, clientID string) error {
+	if err := checkManagesRetention(ctx); err != nil {
+		return err
+	}
+	if err := s.repo.ReleaseLegalHold(ctx, clientID); err != nil {
+		return fmt.Errorf("service: failed to release legal hold on client %s: %w", clientID, err)
+	}
+	return nil
+}
+
+// checkManagesRetention lets admins and privacy officers manage retention.
+// Holds, purges and scrubs apply to every client of the agency, so callers
+// limited to some branches are refused.
+func checkManagesRetention(ctx context.Context) error {
+	if branch.Restricted(ctx) {
+		return fmt.Errorf("%w: supervisors cannot manage retention", ErrForbidden)
+	}
+	if !auth.HasRole(ctx, auth.RoleAdmin, auth.RolePrivacyOfficer) {
+		return fmt.Errorf("%w: only admins and privacy officers can manage retention", ErrForbidden)
+	}
+	return nil
+}
+
+// RunRetentionPurge applies the retention policies immediately and then every
+// interval, until ctx is cancelled.
+func RunRetentionPurge(ctx context.Context, s RetentionService, tenants tenant.Store, interval time.Duration) {
+	purge := func() {
+		err := tenant.Each(ctx, tenants, func(ctx context.Context) error {
+			report, err := s.Purge(ctx, false)
+			if err != nil {
+				return err
+			}
+			for _, result := range report.Classes {
+				if result.Affected > 0 {
+					slog.InfoContext(ctx, "Purged expired data", "tenant", tenant.ID(ctx), "data_class", result.DataClass, "action", result.Action, "rows", result.Affected)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "Retention purge failed", "error", err)
+		}
+	}
+
+	purge()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			purge()
+		}
+	}
+}
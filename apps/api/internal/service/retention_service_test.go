@@ -0,0 +1,188 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+// memoryRetentionRepository holds a number of expired rows per data class and
+// records the purge calls made against it.
+type memoryRetentionRepository struct {
+	expired map[string]int
+	holds   map[string]models.LegalHold
+	calls   []purgeCall
+}
+
+type purgeCall struct {
+	dataClass string
+	cutoff    time.Time
+	limit     int
+	dryRun    bool
+}
+
+var _ repository.RetentionRepository = &memoryRetentionRepository{}
+
+func (m *memoryRetentionRepository) Purge(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, limit int, dryRun bool) (int, error) {
+	m.calls = append(m.calls, purgeCall{dataClass: policy.DataClass, cutoff: cutoff, limit: limit, dryRun: dryRun})
+	if dryRun {
+		return m.expired[policy.DataClass], nil
+	}
+	purged := min(limit, m.expired[policy.DataClass])
+	m.expired[policy.DataClass] -= purged
+	return purged, nil
+}
+
+func (m *memoryRetentionRepository) GetLegalHolds(ctx context.Context) ([]models.LegalHold, error) {
+	var holds []models.LegalHold
+	for _, hold := range m.holds {
+		holds = append(holds, hold)
+	}
+	return holds, nil
+}
+
+func (m *memoryRetentionRepository) PlaceLegalHold(ctx context.Context, hold models.LegalHold) (*models.LegalHold, error) {
+	m.holds[hold.ClientID] = hold
+	return &hold, nil
+}
+
+func (m *memoryRetentionRepository) ReleaseLegalHold(ctx context.Context, clientID string) error {
+	if _, ok := m.holds[clientID]; !ok {
+		return fmt.Errorf("legal hold on client %s %w", clientID, repository.ErrNotFound)
+	}
+	delete(m.holds, clientID)
+	return nil
+}
+
+var testPolicies = []models.RetentionPolicy{
+	{DataClass: models.DataClassGPSCoordinates, RetainDays: 90, Action: models.RetentionDelete},
+	{DataClass: models.DataClassTaskReasons, RetainDays: 0, Action: models.RetentionDelete},
+	{DataClass: models.DataClassVisitRecords, RetainDays: 2192, Action: models.RetentionAnonymize},
+}
+
+func TestRetentionPurge_DryRunChangesNothing(t *testing.T) {
+	repo := &memoryRetentionRepository{
+		expired: map[string]int{models.DataClassGPSCoordinates: 1200, models.DataClassTaskReasons: 7, models.DataClassVisitRecords: 3},
+		holds:   map[string]models.LegalHold{"client-001": {ClientID: "client-001", Reason: "Litigation"}},
+	}
+	svc := service.NewRetentionService(repo, &MockScheduleRepository{}, service.RetentionConfig{Policies: testPolicies})
+
+	report, err := svc.Purge(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !report.DryRun || report.LegalHolds != 1 || len(report.Classes) != 3 {
+		t.Fatalf("Expected a dry-run report on 3 classes and 1 hold, got %+v", report)
+	}
+	gps := report.Classes[0]
+	if gps.Affected != 1200 || gps.Cutoff == nil {
+		t.Errorf("Expected 1200 GPS rows due with a cutoff, got %+v", gps)
+	}
+	if want := time.Now().AddDate(0, 0, -90).Format("2006-01-02"); gps.Cutoff.Format("2006-01-02") != want {
+		t.Errorf("Expected the cutoff to be %s, got %s", want, gps.Cutoff)
+	}
+	if reasons := report.Classes[1]; reasons.Affected != 0 || reasons.Cutoff != nil {
+		t.Errorf("Expected a class kept forever to be skipped, got %+v", reasons)
+	}
+	for _, call := range repo.calls {
+		if !call.dryRun {
+			t.Errorf("Expected only dry-run calls, got %+v", call)
+		}
+	}
+	if repo.expired[models.DataClassGPSCoordinates] != 1200 {
+		t.Error("Expected a dry run to leave the data alone")
+	}
+}
+
+func TestRetentionPurge_WorksOffBacklogInBatches(t *testing.T) {
+	repo := &memoryRetentionRepository{
+		expired: map[string]int{models.DataClassGPSCoordinates: 1200, models.DataClassVisitRecords: 3},
+		holds:   map[string]models.LegalHold{},
+	}
+	svc := service.NewRetentionService(repo, &MockScheduleRepository{}, service.RetentionConfig{Policies: testPolicies, BatchSize: 500})
+
+	report, err := svc.Purge(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if report.Classes[0].Affected != 1200 || report.Classes[2].Affected != 3 {
+		t.Errorf("Expected every expired row purged, got %+v", report.Classes)
+	}
+
+	var gpsCalls int
+	for _, call := range repo.calls {
+		if call.dataClass == models.DataClassGPSCoordinates {
+			gpsCalls++
+			if call.limit != 500 {
+				t.Errorf("Expected batches of 500, got %d", call.limit)
+			}
+		}
+	}
+	if gpsCalls != 3 {
+		t.Errorf("Expected 3 batches for 1200 rows, got %d", gpsCalls)
+	}
+}
+
+func TestLegalHolds(t *testing.T) {
+	repo := &memoryRetentionRepository{holds: map[string]models.LegalHold{}}
+	svc := service.NewRetentionService(repo, &MockScheduleRepository{}, service.RetentionConfig{})
+	ctx := audit.WithActor(auth.WithRole(context.Background(), auth.RolePrivacyOfficer), "user:compliance-officer")
+
+	if _, err := svc.PlaceLegalHold(ctx, "client-001", "  "); !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected a hold without a reason to be rejected, got %v", err)
+	}
+	hold, err := svc.PlaceLegalHold(ctx, " client-001 ", "Pending audit")
+	if err != nil {
+		t.Fatalf("Expected the hold to be placed, got %v", err)
+	}
+	if hold.ClientID != "client-001" || hold.PlacedBy == nil || *hold.PlacedBy != "user:compliance-officer" {
+		t.Errorf("Expected the trimmed client and the caller who placed it, got %+v", hold)
+	}
+
+	if err := svc.ReleaseLegalHold(ctx, "client-001"); err != nil {
+		t.Fatalf("Expected the hold to be released, got %v", err)
+	}
+	if err := svc.ReleaseLegalHold(ctx, "client-001"); err == nil {
+		t.Error("Expected releasing a missing hold to fail")
+	}
+}
+
+func TestRetention_OnlyAdminsAndPrivacyOfficers(t *testing.T) {
+	repo := &memoryRetentionRepository{expired: map[string]int{}, holds: map[string]models.LegalHold{}}
+	svc := service.NewRetentionService(repo, &MockScheduleRepository{}, service.RetentionConfig{Policies: testPolicies})
+
+	for name, ctx := range map[string]context.Context{
+		"caregiver": auth.WithRole(context.Background(), "caregiver"),
+		"API key":   auth.WithAPIKey(context.Background(), models.APIKey{ID: "key-1", Scopes: []string{models.ScopeExportBilling}}),
+	} {
+		if _, err := svc.Purge(ctx, true); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected Purge to be forbidden, got %v", name, err)
+		}
+		if _, err := svc.GetLegalHolds(ctx); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected GetLegalHolds to be forbidden, got %v", name, err)
+		}
+		if _, err := svc.PlaceLegalHold(ctx, "client-001", "Litigation"); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected PlaceLegalHold to be forbidden, got %v", name, err)
+		}
+		if err := svc.ReleaseLegalHold(ctx, "client-001"); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected ReleaseLegalHold to be forbidden, got %v", name, err)
+		}
+	}
+	if len(repo.calls) != 0 || len(repo.holds) != 0 {
+		t.Errorf("Expected nothing changed, got %+v", repo)
+	}
+
+	for _, role := range []string{auth.RoleAdmin, auth.RolePrivacyOfficer} {
+		if _, err := svc.GetLegalHolds(auth.WithRole(context.Background(), role)); err != nil {
+			t.Errorf("Expected %s to list legal holds, got %v", role, err)
+		}
+	}
+}
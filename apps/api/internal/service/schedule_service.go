@@ -2,39 +2,133 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
 )
 
 type ScheduleService interface {
-	GetSchedules(ctx context.Context) ([]models.Schedule, error)
+	GetSchedules(ctx context.Context, query models.ScheduleListQuery) (*models.SchedulePage, error)
 	GetTodaySchedules(ctx context.Context) ([]models.Schedule, error)
 	GetScheduleByID(ctx context.Context, id string) (*models.Schedule, error)
+	CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error)
 	StartVisit(ctx context.Context, id string, latitude, longitude float64, address string) error
 	EndVisit(ctx context.Context, id string, latitude, longitude float64, address string) error
-	UpdateTaskStatus(ctx context.Context, taskID string, completed bool, reason *string) error
+	UpdateTaskStatus(ctx context.Context, taskID string, update models.TaskUpdate) error
+	UpdateTaskStatuses(ctx context.Context, scheduleID string, updates []models.TaskUpdate) ([]models.Task, error)
+	AddAdHocTask(ctx context.Context, scheduleID string, task models.Task) (*models.Task, error)
 	ResetSampleData(ctx context.Context) error
-	GetScheduleStats(ctx context.Context) (*models.ScheduleStats, error)
+	GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error)
+	RefreshDailyStats(ctx context.Context, from, to time.Time) (int, error)
+	DetectMissedVisits(ctx context.Context, since, until time.Time) (int, error)
+	CountMissedVisitsToday(ctx context.Context) (int, error)
 }
 
 type scheduleService struct {
-	repo repository.ScheduleRepository
+	repo           repository.ScheduleRepository
+	publishers     []events.Publisher
+	planner        TaskPlanner
+	clients        branch.Clients
+	taskRules      TaskRules
+	useDailyRollup bool
+}
+
+type Option func(*scheduleService)
+
+// WithPublisher registers a publisher that is notified after every successful
+// visit or task change, such as the live visit stream. Webhook deliveries do
+// not need one: they are queued by the repository with the change. It can be
+// passed more than once.
+func WithPublisher(p events.Publisher) Option {
+	return func(s *scheduleService) {
+		s.publishers = append(s.publishers, p)
+	}
+}
+
+// WithTaskPlanner makes CreateSchedule generate the new visit's tasks, usually
+// from the client's care plan.
+func WithTaskPlanner(p TaskPlanner) Option {
+	return func(s *scheduleService) {
+		s.planner = p
+	}
 }
 
-func NewScheduleService(repo repository.ScheduleRepository) ScheduleService {
-	return &scheduleService{repo: repo}
+// WithClientBranches lets supervisors create visits for the clients of their
+// branches. Without it, CreateSchedule refuses every caller limited to some
+// branches.
+func WithClientBranches(clients branch.Clients) Option {
+	return func(s *scheduleService) {
+		s.clients = clients
+	}
 }
 
-func (s *scheduleService) GetSchedules(ctx context.Context) ([]models.Schedule, error) {
-	schedules, err := s.repo.GetSchedules(ctx)
+func NewScheduleService(repo repository.ScheduleRepository, opts ...Option) ScheduleService {
+	s := &scheduleService{repo: repo, taskRules: DefaultTaskRules()}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// GetSchedules returns one page of schedules. It asks the repository for one
+// row more than the page size to find out whether another page follows.
+func (s *scheduleService) GetSchedules(ctx context.Context, query models.ScheduleListQuery) (*models.SchedulePage, error) {
+	if query.Limit <= 0 {
+		query.Limit = models.DefaultScheduleListLimit
+	}
+	if query.Limit > models.MaxScheduleListLimit {
+		query.Limit = models.MaxScheduleListLimit
+	}
+	for _, status := range query.Statuses {
+		if !models.IsValidScheduleStatus(status) {
+			return nil, fmt.Errorf("%w: unknown status %q", ErrInvalidInput, status)
+		}
+	}
+	if query.From != nil && query.To != nil && query.To.Before(*query.From) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidInput)
+	}
+	if query.Cursor != nil && query.Cursor.Descending != query.Descending {
+		return nil, fmt.Errorf("%w: cursor was issued for a different sort order", ErrInvalidInput)
+	}
+	branchIDs, err := branchFilter(ctx, query.BranchIDs)
+	if err != nil {
+		return nil, err
+	}
+	query.BranchIDs = branchIDs
+
+	fetch := query
+	fetch.Limit = query.Limit + 1
+	schedules, err := s.repo.GetSchedules(ctx, fetch)
 	if err != nil {
 		return nil, fmt.Errorf("service: failed to get all schedules: %w", err)
 	}
-	return schedules, nil
+
+	page := &models.SchedulePage{Data: schedules}
+	if len(schedules) > query.Limit {
+		page.Data = schedules[:query.Limit]
+		last := page.Data[len(page.Data)-1]
+		cursor := EncodeScheduleCursor(models.ScheduleCursor{
+			ScheduledStart: last.ScheduledStart,
+			ID:             last.ID,
+			Descending:     query.Descending,
+		})
+		page.NextCursor = &cursor
+	}
+	if page.Data == nil {
+		page.Data = []models.Schedule{}
+	}
+	return page, nil
 }
 
 func (s *scheduleService) GetTodaySchedules(ctx context.Context) ([]models.Schedule, error) {
@@ -42,17 +136,113 @@ func (s *scheduleService) GetTodaySchedules(ctx context.Context) ([]models.Sched
 	if err != nil {
 		return nil, fmt.Errorf("service: failed to get today's schedules: %w", err)
 	}
-	return schedules, nil
+	if !branch.Restricted(ctx) {
+		return schedules, nil
+	}
+	allowed := []models.Schedule{}
+	for _, schedule := range schedules {
+		if branch.Allows(ctx, stringValue(schedule.BranchID)) {
+			allowed = append(allowed, schedule)
+		}
+	}
+	return allowed, nil
 }
 
 func (s *scheduleService) GetScheduleByID(ctx context.Context, id string) (*models.Schedule, error) {
-	schedule, err := s.repo.GetScheduleByID(ctx, id)
+	schedule, err := s.getSchedule(ctx, id)
 	if err != nil {
 		return nil, fmt.Errorf("service: failed to get schedule by ID %s: %w", id, err)
 	}
 	return schedule, nil
 }
 
+// getSchedule reads a schedule the caller is about to see or change. A
+// schedule outside the caller's branches is reported as not found, like one
+// of another tenant.
+func (s *scheduleService) getSchedule(ctx context.Context, id string) (*models.Schedule, error) {
+	schedule, err := s.repo.GetScheduleByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !branch.Allows(ctx, stringValue(schedule.BranchID)) {
+		return nil, fmt.Errorf("schedule with ID %s %w", id, ErrNotFound)
+	}
+	return schedule, nil
+}
+
+// getScheduleForUpdate reads a schedule the caller is about to change past
+// any cache, so that the change is authorized and validated against the
+// schedule as it is now.
+func (s *scheduleService) getScheduleForUpdate(ctx context.Context, id string) (*models.Schedule, error) {
+	return s.getSchedule(repository.WithFreshReads(ctx), id)
+}
+
+// branchFilter validates the branches a query asked for and narrows them to
+// the caller's.
+func branchFilter(ctx context.Context, requested []string) ([]string, error) {
+	for _, id := range requested {
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, fmt.Errorf("%w: branch_id %q is not a UUID", ErrInvalidInput, id)
+		}
+	}
+	return branch.Narrow(ctx, requested)
+}
+
+func stringValue(s *string) string {
+	if s == nil {
+		return ""
+	}
+	return *s
+}
+
+// CreateSchedule validates and stores a new scheduled visit. The shift date
+// may be given as YYYY-MM-DD or in the stored "Mon, 02 Jan 2006" form.
+func (s *scheduleService) CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+	if strings.TrimSpace(schedule.ClientID) == "" || strings.TrimSpace(schedule.ClientName) == "" || strings.TrimSpace(schedule.ServiceName) == "" {
+		return nil, fmt.Errorf("%w: client_id, client_name and service_name are required", ErrInvalidInput)
+	}
+	if err := checkClient(ctx, s.clients, schedule.ClientID); err != nil {
+		return nil, err
+	}
+
+	loc := tenant.Location(ctx)
+	day, err := time.ParseInLocation(statsDateLayout, strings.TrimSpace(schedule.ShiftDate), loc)
+	if err != nil {
+		day, err = time.ParseInLocation(shiftDateLayout, strings.TrimSpace(schedule.ShiftDate), loc)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: shift_date must be YYYY-MM-DD", ErrInvalidInput)
+	}
+	schedule.ShiftDate = day.Format(shiftDateLayout)
+
+	start, startErr := scheduledTime(ctx, schedule.ShiftDate, schedule.StartTime)
+	end, endErr := scheduledTime(ctx, schedule.ShiftDate, schedule.EndTime)
+	if startErr != nil || endErr != nil {
+		return nil, fmt.Errorf("%w: start_time and end_time must be HH:MM", ErrInvalidInput)
+	}
+	if !end.After(start) {
+		return nil, fmt.Errorf("%w: end_time must be after start_time", ErrInvalidInput)
+	}
+
+	schedule.ID = uuid.NewString()
+	schedule.Status = "scheduled"
+	schedule.ScheduledStart = ""
+	schedule.VisitStart, schedule.VisitEnd = nil, nil
+	schedule.StartLocation, schedule.EndLocation = nil, nil
+	schedule.Tasks = nil
+	if s.planner != nil {
+		if schedule.Tasks, err = s.planner.PlanTasks(ctx, schedule); err != nil {
+			return nil, fmt.Errorf("service: failed to plan tasks for new schedule: %w", err)
+		}
+	}
+
+	created, err := s.repo.CreateSchedule(ctx, schedule)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to create schedule: %w", err)
+	}
+	return created, nil
+}
+
 func (s *scheduleService) StartVisit(ctx context.Context, id string, latitude, longitude float64, address string) error {
 	visitStart := time.Now()
 	startLocation := models.Location{
@@ -61,18 +251,35 @@ func (s *scheduleService) StartVisit(ctx context.Context, id string, latitude, l
 		Address:   address,
 	}
 
-	schedule, err := s.repo.GetScheduleByID(ctx, id)
+	schedule, err := s.getScheduleForUpdate(ctx, id)
 	if err != nil {
 		return fmt.Errorf("service: failed to get schedule before starting visit: %w", err)
 	}
+	ctx, err = checkIfMatch(ctx, schedule)
+	if err != nil {
+		return err
+	}
 	if schedule.Status != "scheduled" {
 		return fmt.Errorf("service: cannot start visit for schedule %s with status %s", id, schedule.Status)
 	}
 
-	err = s.repo.StartVisit(ctx, id, visitStart, startLocation)
+	event := newEvent(ctx, events.Event{
+		Type:        events.VisitStarted,
+		ScheduleID:  id,
+		ClientID:    schedule.ClientID,
+		CaregiverID: schedule.CaregiverID,
+		BranchID:    stringValue(schedule.BranchID),
+		Data:        visitData(ctx, schedule, "in_progress", &visitStart, nil),
+	})
+	err = s.repo.StartVisit(ctx, id, visitStart, startLocation, event)
+	if errors.Is(err, repository.ErrScheduleChanged) {
+		return scheduleChanged(ctx, id, "its visit was being started")
+	}
 	if err != nil {
 		return fmt.Errorf("service: failed to start visit for ID %s: %w", id, err)
 	}
+
+	s.publish(ctx, event)
 	return nil
 }
 
@@ -84,26 +291,38 @@ func (s *scheduleService) EndVisit(ctx context.Context, id string, latitude, lon
 		Address:   address,
 	}
 
-	schedule, err := s.repo.GetScheduleByID(ctx, id)
+	schedule, err := s.getScheduleForUpdate(ctx, id)
 	if err != nil {
 		return fmt.Errorf("service: failed to get schedule before ending visit: %w", err)
 	}
+	ctx, err = checkIfMatch(ctx, schedule)
+	if err != nil {
+		return err
+	}
 	if schedule.Status != "in_progress" {
 		return fmt.Errorf("service: cannot end visit for schedule %s with status %s", id, schedule.Status)
 	}
+	if outstanding := s.taskRules.outstandingTasks(schedule); len(outstanding) > 0 {
+		return &OutstandingTasksError{ScheduleID: id, TaskIDs: outstanding}
+	}
 
-	err = s.repo.EndVisit(ctx, id, visitEnd, endLocation)
+	event := newEvent(ctx, events.Event{
+		Type:        events.VisitCompleted,
+		ScheduleID:  id,
+		ClientID:    schedule.ClientID,
+		CaregiverID: schedule.CaregiverID,
+		BranchID:    stringValue(schedule.BranchID),
+		Data:        visitData(ctx, schedule, "completed", schedule.VisitStart, &visitEnd),
+	})
+	err = s.repo.EndVisit(ctx, id, visitEnd, endLocation, event)
+	if errors.Is(err, repository.ErrScheduleChanged) {
+		return scheduleChanged(ctx, id, "its visit was being ended")
+	}
 	if err != nil {
 		return fmt.Errorf("service: failed to end visit for ID %s: %w", id, err)
 	}
-	return nil
-}
 
-func (s *scheduleService) UpdateTaskStatus(ctx context.Context, taskID string, completed bool, reason *string) error {
-	err := s.repo.UpdateTaskStatus(ctx, taskID, completed, reason)
-	if err != nil {
-		return fmt.Errorf("service: failed to update task status for ID %s: %w", taskID, err)
-	}
+	s.publish(ctx, event)
 	return nil
 }
 
@@ -115,52 +334,174 @@ func (s *scheduleService) ResetSampleData(ctx context.Context) error {
 	return nil
 }
 
-func (s *scheduleService) GetScheduleStats(ctx context.Context) (*models.ScheduleStats, error) {
-	allSchedules, err := s.repo.GetSchedules(ctx)
+// DetectMissedVisits records and publishes visit.missed for every visit that
+// is still scheduled although its scheduled end fell within [since, until).
+// A visit is only reported once, however often it is checked. Only admins can
+// run it on request.
+func (s *scheduleService) DetectMissedVisits(ctx context.Context, since, until time.Time) (int, error) {
+	if branch.Restricted(ctx) {
+		return 0, fmt.Errorf("%w: supervisors cannot run missed visit detection", ErrForbidden)
+	}
+	if !auth.HasRole(ctx, auth.RoleAdmin) {
+		return 0, fmt.Errorf("%w: only admins can run missed visit detection", ErrForbidden)
+	}
+	schedules, err := s.missedVisits(ctx, since, until)
 	if err != nil {
-		return nil, fmt.Errorf("service: failed to get schedules for stats: %w", err)
+		return 0, err
 	}
 
-	totalSchedules := len(allSchedules)
-	missedSchedules := 0
-	upcomingToday := 0
-	completedToday := 0
+	missed := 0
+	for _, schedule := range schedules {
+		event := newEvent(ctx, events.Event{
+			Type:        events.VisitMissed,
+			ScheduleID:  schedule.ID,
+			ClientID:    schedule.ClientID,
+			CaregiverID: schedule.CaregiverID,
+			BranchID:    stringValue(schedule.BranchID),
+			Data:        visitData(ctx, schedule, schedule.Status, nil, nil),
+		})
+		recorded, err := s.repo.RecordMissedVisit(ctx, schedule.ID, event)
+		if err != nil {
+			return missed, fmt.Errorf("service: failed to record missed visit %s: %w", schedule.ID, err)
+		}
+		if !recorded {
+			continue
+		}
+		s.publish(ctx, event)
+		missed++
+	}
+	return missed, nil
+}
 
-	todayFormatted := time.Now().Format("Mon, 02 Jan 2006")
+// CountMissedVisitsToday counts the visits of the tenant's today that are
+// still scheduled although their scheduled end has passed. The stats only
+// count a visit as missed once its day is over.
+func (s *scheduleService) CountMissedVisitsToday(ctx context.Context) (int, error) {
+	now := time.Now().In(tenant.Location(ctx))
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	schedules, err := s.missedVisits(ctx, midnight, now)
+	if err != nil {
+		return 0, err
+	}
+	return len(schedules), nil
+}
 
-	for _, schedule := range allSchedules {
-		fmt.Printf("DEBUG: Processing schedule ID: %s, ShiftDate: '%s', Status: '%s'\n", schedule.ID, schedule.ShiftDate, schedule.Status)
+// missedVisits returns the visits that are still scheduled although their
+// scheduled end fell within [since, until).
+func (s *scheduleService) missedVisits(ctx context.Context, since, until time.Time) ([]*models.Schedule, error) {
+	// Start a day early so visits that run past midnight are still seen.
+	from := since.AddDate(0, 0, -1)
+	allSchedules, err := s.repo.GetSchedules(ctx, models.ScheduleListQuery{
+		Statuses: []string{"scheduled"},
+		From:     &from,
+		To:       &until,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get schedules for missed visit detection: %w", err)
+	}
 
-		if strings.TrimSpace(schedule.ShiftDate) == "" {
-			fmt.Printf("Warning: Skipping schedule %s due to empty ShiftDate.\n", schedule.ID)
+	var missed []*models.Schedule
+	for i := range allSchedules {
+		schedule := &allSchedules[i]
+		if schedule.Status != "scheduled" {
 			continue
 		}
+		end, err := scheduledTime(ctx, schedule.ShiftDate, schedule.EndTime)
+		if err != nil || end.Before(since) || !end.Before(until) {
+			continue
+		}
+		missed = append(missed, schedule)
+	}
+	return missed, nil
+}
+
+// RunMissedVisitMonitor checks for newly missed visits every interval until ctx
+// is cancelled. Visits that were missed before the monitor started are not reported.
+// Each tenant's window only moves on once its check succeeds, so a failing
+// tenant is checked again without holding the others back.
+func RunMissedVisitMonitor(ctx context.Context, s ScheduleService, tenants tenant.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
 
-		switch schedule.Status {
-		case "scheduled":
-			shiftDate, err := time.Parse("Mon, 02 Jan 2006", schedule.ShiftDate)
+	started := time.Now()
+	since := make(map[string]time.Time)
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			err := tenant.Each(ctx, tenants, func(ctx context.Context) error {
+				from, ok := since[tenant.ID(ctx)]
+				if !ok {
+					from = started
+				}
+				if _, err := s.DetectMissedVisits(ctx, from, now); err != nil {
+					return err
+				}
+				since[tenant.ID(ctx)] = now
+				return nil
+			})
 			if err != nil {
-				fmt.Printf("Warning: Could not parse shift date '%s' for schedule %s: %v\n", schedule.ShiftDate, schedule.ID, err)
-				continue
-			}
-			if shiftDate.Before(time.Now().Truncate(24 * time.Hour)) {
-				missedSchedules++
-			} else if schedule.ShiftDate == todayFormatted {
-				upcomingToday++
-			}
-		case "completed":
-			if schedule.VisitEnd != nil && schedule.VisitEnd.Format("Mon, 02 Jan 2006") == todayFormatted {
-				completedToday++
+				slog.WarnContext(ctx, "Missed visit detection failed", "error", err)
 			}
 		}
 	}
+}
 
-	stats := &models.ScheduleStats{
-		TotalSchedules:    totalSchedules,
-		MissedSchedules:   missedSchedules,
-		UpcomingToday:     upcomingToday,
-		CompletedToday:    completedToday,
+// newEvent fills in the ID, tenant and time of an event. Events are created
+// before their change is written, which queues them for webhook delivery.
+func newEvent(ctx context.Context, event events.Event) events.Event {
+	if event.ID == "" {
+		event.ID = uuid.NewString()
+	}
+	if event.TenantID == "" {
+		event.TenantID = tenant.ID(ctx)
+	}
+	if event.OccurredAt.IsZero() {
+		event.OccurredAt = time.Now().UTC()
 	}
+	return event
+}
+
+// publish notifies the in-process publishers of an event whose change has
+// been written.
+func (s *scheduleService) publish(ctx context.Context, event events.Event) {
+	for _, p := range s.publishers {
+		if err := p.Publish(ctx, event); err != nil {
+			slog.WarnContext(ctx, "Failed to publish event", "event_type", event.Type, "schedule_id", event.ScheduleID, "error", err)
+		}
+	}
+}
+
+// visitData is the payload of a visit event. The visit times are also given
+// rounded when the tenant has a rounding rule.
+func visitData(ctx context.Context, schedule *models.Schedule, status string, visitStart, visitEnd *time.Time) events.VisitData {
+	data := events.VisitData{
+		Status:     status,
+		VisitStart: visitStart,
+		VisitEnd:   visitEnd,
+	}
+	if start, err := scheduledTime(ctx, schedule.ShiftDate, schedule.StartTime); err == nil {
+		data.ScheduledStart = &start
+	}
+	if end, err := scheduledTime(ctx, schedule.ShiftDate, schedule.EndTime); err == nil {
+		data.ScheduledEnd = &end
+	}
+	if t, _ := tenant.FromContext(ctx); t.Rounding.IncrementMinutes > 0 {
+		round := func(v *time.Time) *time.Time {
+			if v == nil {
+				return nil
+			}
+			rounded := t.Rounding.Round(v.In(t.Location()))
+			return &rounded
+		}
+		data.RoundedVisitStart, data.RoundedVisitEnd = round(visitStart), round(visitEnd)
+	}
+	return data
+}
 
-	return stats, nil
+// scheduledTime combines a "Mon, 02 Jan 2006" shift date with an "HH:MM" clock
+// time, in the tenant's time zone.
+func scheduledTime(ctx context.Context, shiftDate, clock string) (time.Time, error) {
+	return time.ParseInLocation(shiftDateLayout+" 15:04", strings.TrimSpace(shiftDate)+" "+strings.TrimSpace(clock), tenant.Location(ctx))
 }
@@ -4,29 +4,43 @@ import (
 	"context"
 	"errors"
 	"reflect"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
 )
 
 type MockScheduleRepository struct {
-	GetSchedulesFunc      func(ctx context.Context) ([]models.Schedule, error)
-	GetTodaySchedulesFunc func(ctx context.Context) ([]models.Schedule, error)
-	GetScheduleByIDFunc   func(ctx context.Context, id string) (*models.Schedule, error)
-	StartVisitFunc        func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location) error
-	EndVisitFunc          func(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location) error
-	UpdateTaskStatusFunc  func(ctx context.Context, taskID string, completed bool, reason *string) error
-	ResetSampleDataFunc   func(ctx context.Context) error
+	GetSchedulesFunc        func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error)
+	GetTodaySchedulesFunc   func(ctx context.Context) ([]models.Schedule, error)
+	GetScheduleByIDFunc     func(ctx context.Context, id string) (*models.Schedule, error)
+	GetTaskByIDFunc         func(ctx context.Context, taskID string) (*models.Task, error)
+	CreateScheduleFunc      func(ctx context.Context, schedule models.Schedule) (*models.Schedule, error)
+	ReplacePlannedTasksFunc func(ctx context.Context, scheduleID string, tasks []models.Task) error
+	StartVisitFunc          func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error
+	EndVisitFunc            func(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error
+	UpdateTaskStatusesFunc  func(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error
+	AddTaskFunc             func(ctx context.Context, task models.Task, event events.Event) (*models.Task, error)
+	RecordMissedVisitFunc   func(ctx context.Context, id string, event events.Event) (bool, error)
+	ResetSampleDataFunc     func(ctx context.Context) error
+	GetScheduleStatsFunc    func(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error)
+	RefreshDailyStatsFunc   func(ctx context.Context, from, to time.Time) (int, error)
+	GetUnscrubbedVisitsFunc func(ctx context.Context, query models.LocationScrubQuery) ([]models.Schedule, error)
+	ScrubVisitLocationsFunc func(ctx context.Context, scrub models.LocationScrub) (bool, error)
+	PingFunc                func(ctx context.Context) error
 }
 
 var _ repository.ScheduleRepository = &MockScheduleRepository{}
 
-func (m *MockScheduleRepository) GetSchedules(ctx context.Context) ([]models.Schedule, error) {
+func (m *MockScheduleRepository) GetSchedules(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
 	if m.GetSchedulesFunc != nil {
-		return m.GetSchedulesFunc(ctx)
+		return m.GetSchedulesFunc(ctx, query)
 	}
 	return nil, errors.New("GetSchedulesFunc not set")
 }
@@ -45,25 +59,60 @@ func (m *MockScheduleRepository) GetScheduleByID(ctx context.Context, id string)
 	return nil, errors.New("GetScheduleByIDFunc not set")
 }
 
-func (m *MockScheduleRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location) error {
+func (m *MockScheduleRepository) GetTaskByID(ctx context.Context, taskID string) (*models.Task, error) {
+	if m.GetTaskByIDFunc != nil {
+		return m.GetTaskByIDFunc(ctx, taskID)
+	}
+	return nil, errors.New("GetTaskByIDFunc not set")
+}
+
+func (m *MockScheduleRepository) CreateSchedule(ctx context.Context, schedule models.Schedule) (*models.Schedule, error) {
+	if m.CreateScheduleFunc != nil {
+		return m.CreateScheduleFunc(ctx, schedule)
+	}
+	return nil, errors.New("CreateScheduleFunc not set")
+}
+
+func (m *MockScheduleRepository) ReplacePlannedTasks(ctx context.Context, scheduleID string, tasks []models.Task) error {
+	if m.ReplacePlannedTasksFunc != nil {
+		return m.ReplacePlannedTasksFunc(ctx, scheduleID, tasks)
+	}
+	return errors.New("ReplacePlannedTasksFunc not set")
+}
+
+func (m *MockScheduleRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
 	if m.StartVisitFunc != nil {
-		return m.StartVisitFunc(ctx, id, visitStart, startLocation)
+		return m.StartVisitFunc(ctx, id, visitStart, startLocation, event)
 	}
 	return errors.New("StartVisitFunc not set")
 }
 
-func (m *MockScheduleRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location) error {
+func (m *MockScheduleRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error {
 	if m.EndVisitFunc != nil {
-		return m.EndVisitFunc(ctx, id, visitEnd, endLocation)
+		return m.EndVisitFunc(ctx, id, visitEnd, endLocation, event)
 	}
 	return errors.New("EndVisitFunc not set")
 }
 
-func (m *MockScheduleRepository) UpdateTaskStatus(ctx context.Context, taskID string, completed bool, reason *string) error {
-	if m.UpdateTaskStatusFunc != nil {
-		return m.UpdateTaskStatusFunc(ctx, taskID, completed, reason)
+func (m *MockScheduleRepository) UpdateTaskStatuses(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error {
+	if m.UpdateTaskStatusesFunc != nil {
+		return m.UpdateTaskStatusesFunc(ctx, tasks, taskEvents)
 	}
-	return errors.New("UpdateTaskStatusFunc not set")
+	return errors.New("UpdateTaskStatusesFunc not set")
+}
+
+func (m *MockScheduleRepository) AddTask(ctx context.Context, task models.Task, event events.Event) (*models.Task, error) {
+	if m.AddTaskFunc != nil {
+		return m.AddTaskFunc(ctx, task, event)
+	}
+	return nil, errors.New("AddTaskFunc not set")
+}
+
+func (m *MockScheduleRepository) RecordMissedVisit(ctx context.Context, id string, event events.Event) (bool, error) {
+	if m.RecordMissedVisitFunc != nil {
+		return m.RecordMissedVisitFunc(ctx, id, event)
+	}
+	return false, errors.New("RecordMissedVisitFunc not set")
 }
 
 func (m *MockScheduleRepository) ResetSampleData(ctx context.Context) error {
@@ -73,6 +122,41 @@ func (m *MockScheduleRepository) ResetSampleData(ctx context.Context) error {
 	return errors.New("ResetSampleDataFunc not set")
 }
 
+func (m *MockScheduleRepository) GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+	if m.GetScheduleStatsFunc != nil {
+		return m.GetScheduleStatsFunc(ctx, query)
+	}
+	return nil, errors.New("GetScheduleStatsFunc not set")
+}
+
+func (m *MockScheduleRepository) RefreshDailyStats(ctx context.Context, from, to time.Time) (int, error) {
+	if m.RefreshDailyStatsFunc != nil {
+		return m.RefreshDailyStatsFunc(ctx, from, to)
+	}
+	return 0, errors.New("RefreshDailyStatsFunc not set")
+}
+
+func (m *MockScheduleRepository) GetUnscrubbedVisits(ctx context.Context, query models.LocationScrubQuery) ([]models.Schedule, error) {
+	if m.GetUnscrubbedVisitsFunc != nil {
+		return m.GetUnscrubbedVisitsFunc(ctx, query)
+	}
+	return nil, errors.New("GetUnscrubbedVisitsFunc not set")
+}
+
+func (m *MockScheduleRepository) ScrubVisitLocations(ctx context.Context, scrub models.LocationScrub) (bool, error) {
+	if m.ScrubVisitLocationsFunc != nil {
+		return m.ScrubVisitLocationsFunc(ctx, scrub)
+	}
+	return false, errors.New("ScrubVisitLocationsFunc not set")
+}
+
+func (m *MockScheduleRepository) Ping(ctx context.Context) error {
+	if m.PingFunc != nil {
+		return m.PingFunc(ctx)
+	}
+	return errors.New("PingFunc not set")
+}
+
 func TestGetSchedules_Success(t *testing.T) {
 	expectedSchedules := []models.Schedule{
 		{
@@ -100,20 +184,23 @@ func TestGetSchedules_Success(t *testing.T) {
 	}
 
 	mockRepo := &MockScheduleRepository{
-		GetSchedulesFunc: func(ctx context.Context) ([]models.Schedule, error) {
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
 			return expectedSchedules, nil
 		},
 	}
 
 	s := service.NewScheduleService(mockRepo)
 
-	schedules, err := s.GetSchedules(context.Background())
+	page, err := s.GetSchedules(context.Background(), models.ScheduleListQuery{})
 
 	if err != nil {
 		t.Fatalf("Expected no error, got %v", err)
 	}
-	if !reflect.DeepEqual(schedules, expectedSchedules) {
-		t.Errorf("Expected schedules %v, got %v", expectedSchedules, schedules)
+	if !reflect.DeepEqual(page.Data, expectedSchedules) {
+		t.Errorf("Expected schedules %v, got %v", expectedSchedules, page.Data)
+	}
+	if page.NextCursor != nil {
+		t.Errorf("Expected no next cursor on the last page, got %v", *page.NextCursor)
 	}
 }
 
@@ -121,14 +208,14 @@ func TestGetSchedules_RepositoryError(t *testing.T) {
 	repoError := errors.New("database connection failed")
 
 	mockRepo := &MockScheduleRepository{
-		GetSchedulesFunc: func(ctx context.Context) ([]models.Schedule, error) {
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
 			return nil, repoError
 		},
 	}
 
 	s := service.NewScheduleService(mockRepo)
 
-	schedules, err := s.GetSchedules(context.Background())
+	schedules, err := s.GetSchedules(context.Background(), models.ScheduleListQuery{})
 
 	if err == nil {
 		t.Fatal("Expected an error, got nil")
@@ -140,3 +227,257 @@ func TestGetSchedules_RepositoryError(t *testing.T) {
 		t.Errorf("Expected nil schedules, got %v", schedules)
 	}
 }
+
+func TestGetSchedules_Pagination(t *testing.T) {
+	all := []models.Schedule{
+		{ID: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11", ScheduledStart: "2025-01-15T09:00:00", Status: "scheduled"},
+		{ID: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12", ScheduledStart: "2025-01-15T11:00:00", Status: "scheduled"},
+		{ID: "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a13", ScheduledStart: "2025-01-15T13:00:00", Status: "scheduled"},
+	}
+
+	var queries []models.ScheduleListQuery
+	mockRepo := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			queries = append(queries, query)
+			start := 0
+			if query.Cursor != nil {
+				for i, sch := range all {
+					if sch.ID == query.Cursor.ID {
+						start = i + 1
+					}
+				}
+			}
+			end := start + query.Limit
+			if end > len(all) {
+				end = len(all)
+			}
+			return all[start:end], nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+	ctx := context.Background()
+
+	first, err := s.GetSchedules(ctx, models.ScheduleListQuery{Limit: 2, Statuses: []string{"scheduled"}})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(first.Data) != 2 || first.NextCursor == nil {
+		t.Fatalf("Expected a full first page with a cursor, got %d rows, cursor %v", len(first.Data), first.NextCursor)
+	}
+	if queries[0].Limit != 3 {
+		t.Errorf("Expected the repository to be asked for one extra row, got limit %d", queries[0].Limit)
+	}
+
+	cursor, err := service.DecodeScheduleCursor(*first.NextCursor)
+	if err != nil {
+		t.Fatalf("Expected the cursor to decode, got %v", err)
+	}
+	if cursor.ID != all[1].ID || cursor.ScheduledStart != all[1].ScheduledStart {
+		t.Errorf("Expected the cursor to point at the last row of the page, got %+v", cursor)
+	}
+
+	second, err := s.GetSchedules(ctx, models.ScheduleListQuery{Limit: 2, Cursor: cursor})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(second.Data) != 1 || second.Data[0].ID != all[2].ID || second.NextCursor != nil {
+		t.Errorf("Expected the final row and no cursor, got %+v", second)
+	}
+}
+
+func TestGetSchedules_RejectsInvalidFilters(t *testing.T) {
+	s := service.NewScheduleService(&MockScheduleRepository{})
+
+	if _, err := s.GetSchedules(context.Background(), models.ScheduleListQuery{Statuses: []string{"missing"}}); !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for an unknown status, got %v", err)
+	}
+	if _, err := service.DecodeScheduleCursor(`not-a-cursor`); !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput for a malformed cursor, got %v", err)
+	}
+}
+
+func TestDetectMissedVisits_PublishesOnlyNewlyRecordedVisits(t *testing.T) {
+	now := time.Now()
+	ended := now.Add(-30 * time.Minute)
+	schedule := func(id string) models.Schedule {
+		return models.Schedule{
+			ID: id, Status: "scheduled", ShiftDate: ended.Format("Mon, 02 Jan 2006"),
+			StartTime: ended.Add(-time.Hour).Format("15:04"), EndTime: ended.Format("15:04"),
+		}
+	}
+	mockRepo := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			return []models.Schedule{schedule("sch-001"), schedule("sch-002")}, nil
+		},
+		// sch-002 was already reported, by an earlier check or another instance.
+		RecordMissedVisitFunc: func(ctx context.Context, id string, event events.Event) (bool, error) {
+			return id == "sch-001", nil
+		},
+	}
+	var published []events.Event
+	s := service.NewScheduleService(mockRepo, service.WithPublisher(publisherFunc(func(ctx context.Context, event events.Event) error {
+		published = append(published, event)
+		return nil
+	})))
+
+	missed, err := s.DetectMissedVisits(context.Background(), now.Add(-time.Hour), now)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if missed != 1 || len(published) != 1 || published[0].ScheduleID != "sch-001" || published[0].Type != events.VisitMissed {
+		t.Errorf("Expected only sch-001 to be reported, got %d and %+v", missed, published)
+	}
+}
+
+func TestDetectMissedVisits_OnlyAdminsAndBackgroundChecks(t *testing.T) {
+	checked := 0
+	mockRepo := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			checked++
+			return nil, nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+	now := time.Now()
+
+	callers := map[string]context.Context{
+		"supervisor": supervising(branchA),
+		"API key":    auth.WithAPIKey(context.Background(), models.APIKey{ID: "key-1", Scopes: []string{models.ScopeWriteVisits}}),
+		"caregiver":  auth.WithRole(context.Background(), "caregiver"),
+	}
+	for name, ctx := range callers {
+		if _, err := s.DetectMissedVisits(ctx, now.Add(-time.Hour), now); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected DetectMissedVisits to be forbidden, got %v", name, err)
+		}
+	}
+	if checked != 0 {
+		t.Fatalf("Expected no check for refused callers, got %d", checked)
+	}
+
+	// The background monitor runs without a role.
+	for _, ctx := range []context.Context{auth.WithRole(context.Background(), auth.RoleAdmin), context.Background()} {
+		if _, err := s.DetectMissedVisits(ctx, now.Add(-time.Hour), now); err != nil {
+			t.Errorf("Expected the check to run, got %v", err)
+		}
+	}
+	if checked != 2 {
+		t.Errorf("Expected 2 checks, got %d", checked)
+	}
+}
+
+type tenantList []tenant.Tenant
+
+func (l tenantList) GetTenant(ctx context.Context, id string) (*tenant.Tenant, error) {
+	for _, t := range l {
+		if t.ID == id {
+			return &t, nil
+		}
+	}
+	return nil, tenant.ErrUnknown
+}
+
+func (l tenantList) ListTenants(ctx context.Context) ([]tenant.Tenant, error) {
+	return l, nil
+}
+
+func TestRunMissedVisitMonitor_FailingTenantDoesNotHoldOthersBack(t *testing.T) {
+	var mu sync.Mutex
+	windows := map[string][]time.Time{}
+	mockRepo := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			id := tenant.ID(ctx)
+			windows[id] = append(windows[id], *query.From)
+			if id == "failing" && len(windows[id]) == 1 {
+				return nil, errors.New("connection reset")
+			}
+			return nil, nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		service.RunMissedVisitMonitor(ctx, s, tenantList{{ID: "failing"}, {ID: "healthy"}}, 5*time.Millisecond)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		mu.Lock()
+		n := min(len(windows["failing"]), len(windows["healthy"]))
+		mu.Unlock()
+		if n >= 2 || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	failing, healthy := windows["failing"], windows["healthy"]
+	if len(failing) < 2 || len(healthy) < 2 {
+		t.Fatalf("Expected at least two checks per tenant, got %v and %v", failing, healthy)
+	}
+	if !failing[1].Equal(failing[0]) {
+		t.Errorf("Expected the failing tenant's window to be checked again, got %v then %v", failing[0], failing[1])
+	}
+	if !healthy[1].After(healthy[0]) {
+		t.Errorf("Expected the healthy tenant's window to move on, got %v then %v", healthy[0], healthy[1])
+	}
+}
+
+func TestCountMissedVisitsToday_CountsVisitsWhoseEndHasPassed(t *testing.T) {
+	now := time.Now()
+	if now.Hour() == 0 && now.Minute() < 5 {
+		t.Skip("a visit that ended minutes ago belongs to yesterday")
+	}
+	visit := func(id string, end time.Time) models.Schedule {
+		return models.Schedule{ID: id, Status: "scheduled", ShiftDate: end.Format("Mon, 02 Jan 2006"), EndTime: end.Format("15:04")}
+	}
+	mockRepo := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			return []models.Schedule{
+				visit("sch-ended", now.Add(-2*time.Minute)),
+				visit("sch-yesterday", now.AddDate(0, 0, -1)),
+				visit("sch-later", now.Add(2*time.Minute)),
+			}, nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+
+	missed, err := s.CountMissedVisitsToday(context.Background())
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if missed != 1 {
+		t.Errorf("Expected only the visit that ended today to count, got %d", missed)
+	}
+}
+
+func TestVisitChanges_ReadTheScheduleFresh(t *testing.T) {
+	var fresh []bool
+	mockRepo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) {
+			fresh = append(fresh, repository.FreshReads(ctx))
+			return &models.Schedule{ID: id, Status: "scheduled"}, nil
+		},
+		StartVisitFunc: func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+			return nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo)
+	ctx := context.Background()
+
+	if _, err := s.GetScheduleByID(ctx, "sch-001"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := s.StartVisit(ctx, "sch-001", -6.2, 106.8, "Somewhere"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !reflect.DeepEqual(fresh, []bool{false, true}) {
+		t.Errorf("Expected only the read a change is checked against to skip caches, got %v", fresh)
+	}
+}
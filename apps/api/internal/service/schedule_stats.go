@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+const (
+	shiftDateLayout = "Mon, 02 Jan 2006"
+	statsDateLayout = "2006-01-02"
+)
+
+// WithDailyStatsRollup makes GetScheduleStats read from the daily rollup table,
+// which RunDailyStatsRollup keeps current.
+func WithDailyStatsRollup(enabled bool) Option {
+	return func(s *scheduleService) {
+		s.useDailyRollup = enabled
+	}
+}
+
+// GetScheduleStats validates the query and leaves the aggregation to the
+// repository, which computes it in the database.
+func (s *scheduleService) GetScheduleStats(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+	if !models.IsValidStatsGroupBy(query.GroupBy) {
+		return nil, fmt.Errorf("%w: unsupported group_by %q", ErrInvalidInput, query.GroupBy)
+	}
+	if query.From != nil && query.To != nil && query.To.Before(*query.From) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidInput)
+	}
+	branchIDs, err := branchFilter(ctx, query.BranchIDs)
+	if err != nil {
+		return nil, err
+	}
+	query.BranchIDs = branchIDs
+	query.UseDailyRollup = s.useDailyRollup
+
+	stats, err := s.repo.GetScheduleStats(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get schedule stats: %w", err)
+	}
+
+	stats.GroupBy = query.GroupBy
+	if query.From != nil {
+		stats.From = query.From.Format(statsDateLayout)
+	}
+	if query.To != nil {
+		stats.To = query.To.Format(statsDateLayout)
+	}
+	if query.GroupBy == "" {
+		stats.Groups = nil
+	}
+	if stats.Daily == nil {
+		stats.Daily = []models.DailyStats{}
+	}
+	return stats, nil
+}
+
+func (s *scheduleService) RefreshDailyStats(ctx context.Context, from, to time.Time) (int, error) {
+	refreshed, err := s.repo.RefreshDailyStats(ctx, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("service: failed to refresh daily stats from %s to %s: %w", from.Format(statsDateLayout), to.Format(statsDateLayout), err)
+	}
+	return refreshed, nil
+}
+
+// RunDailyStatsRollup refreshes the rollup for the last lookbackDays and the
+// next 30 days immediately and then every interval, until ctx is cancelled.
+// Older days only change through late edits and can be refreshed by hand.
+func RunDailyStatsRollup(ctx context.Context, s ScheduleService, tenants tenant.Store, interval time.Duration, lookbackDays int) {
+	refresh := func() {
+		err := tenant.Each(ctx, tenants, func(ctx context.Context) error {
+			today := time.Now().In(tenant.Location(ctx))
+			from := today.AddDate(0, 0, -lookbackDays)
+			to := today.AddDate(0, 0, 30)
+			_, err := s.RefreshDailyStats(ctx, from, to)
+			return err
+		})
+		if err != nil {
+			slog.WarnContext(ctx, "Daily stats rollup failed", "error", err)
+		}
+	}
+
+	refresh()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			refresh()
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+func TestGetScheduleStats_DelegatesAggregationToRepository(t *testing.T) {
+	from := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+	to := time.Date(2025, 1, 18, 0, 0, 0, 0, time.Local)
+
+	var gotQuery models.StatsQuery
+	mockRepo := &MockScheduleRepository{
+		GetSchedulesFunc: func(ctx context.Context, query models.ScheduleListQuery) ([]models.Schedule, error) {
+			t.Fatal("GetSchedules must not be used to compute stats")
+			return nil, nil
+		},
+		GetScheduleStatsFunc: func(ctx context.Context, query models.StatsQuery) (*models.ScheduleStats, error) {
+			gotQuery = query
+			return &models.ScheduleStats{
+				StatsCounts: models.StatsCounts{TotalSchedules: 4, CompletedSchedules: 2, OnTimeRate: 0.6667},
+				Groups:      []models.StatsGroup{{Key: "client-001"}},
+			}, nil
+		},
+	}
+	s := service.NewScheduleService(mockRepo, service.WithDailyStatsRollup(true))
+
+	stats, err := s.GetScheduleStats(context.Background(), models.StatsQuery{From: &from, To: &to, GroupBy: models.StatsGroupByClient})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	if !gotQuery.UseDailyRollup || gotQuery.GroupBy != models.StatsGroupByClient || !gotQuery.From.Equal(from) {
+		t.Errorf("Unexpected repository query: %+v", gotQuery)
+	}
+	if stats.TotalSchedules != 4 || stats.OnTimeRate != 0.6667 || len(stats.Groups) != 1 {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if stats.From != "2025-01-15" || stats.To != "2025-01-18" || stats.GroupBy != "client" {
+		t.Errorf("Expected the query to be echoed back, got from=%q to=%q group_by=%q", stats.From, stats.To, stats.GroupBy)
+	}
+	if stats.Daily == nil {
+		t.Error("Expected an empty daily series rather than nil")
+	}
+}
+
+func TestGetScheduleStats_InvalidGroupBy(t *testing.T) {
+	s := service.NewScheduleService(&MockScheduleRepository{})
+
+	_, err := s.GetScheduleStats(context.Background(), models.StatsQuery{GroupBy: "region"})
+	if !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
+
+func TestGetScheduleStats_InvertedRange(t *testing.T) {
+	s := service.NewScheduleService(&MockScheduleRepository{})
+	from := time.Date(2025, 1, 18, 0, 0, 0, 0, time.Local)
+	to := time.Date(2025, 1, 15, 0, 0, 0, 0, time.Local)
+
+	_, err := s.GetScheduleStats(context.Background(), models.StatsQuery{From: &from, To: &to})
+	if !errors.Is(err, service.ErrInvalidInput) {
+		t.Errorf("Expected ErrInvalidInput, got %v", err)
+	}
+}
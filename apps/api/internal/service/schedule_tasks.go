@@ -0,0 +1,210 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+func (s *scheduleService) UpdateTaskStatus(ctx context.Context, taskID string, update models.TaskUpdate) error {
+	task, err := s.repo.GetTaskByID(ctx, taskID)
+	if err != nil {
+		return fmt.Errorf("service: failed to get task %s before updating it: %w", taskID, err)
+	}
+
+	update.TaskID = taskID
+	if _, err := s.UpdateTaskStatuses(ctx, task.ScheduleID, []models.TaskUpdate{update}); err != nil {
+		return err
+	}
+	return nil
+}
+
+// UpdateTaskStatuses applies several task updates of one visit together. All
+// updates are validated before anything is written.
+func (s *scheduleService) UpdateTaskStatuses(ctx context.Context, scheduleID string, updates []models.TaskUpdate) ([]models.Task, error) {
+	if len(updates) == 0 {
+		return nil, fmt.Errorf("%w: at least one task update is required", ErrInvalidInput)
+	}
+
+	schedule, err := s.getScheduleForUpdate(ctx, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get schedule %s before updating tasks: %w", scheduleID, err)
+	}
+	ctx, err = checkIfMatch(ctx, schedule)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := s.taskRules.checkTaskUpdateAllowed(schedule, now); err != nil {
+		return nil, err
+	}
+
+	tasks := make(map[string]models.Task, len(schedule.Tasks))
+	for _, task := range schedule.Tasks {
+		tasks[task.ID] = task
+	}
+
+	updated := make([]models.Task, 0, len(updates))
+	seen := make(map[string]bool, len(updates))
+	for _, update := range updates {
+		task, ok := tasks[update.TaskID]
+		if !ok {
+			return nil, fmt.Errorf("%w: task %q does not belong to schedule %s", ErrInvalidInput, update.TaskID, scheduleID)
+		}
+		if seen[update.TaskID] {
+			return nil, fmt.Errorf("%w: task %s is updated more than once", ErrInvalidInput, update.TaskID)
+		}
+		seen[update.TaskID] = true
+
+		if err := applyTaskUpdate(&task, update, schedule, now); err != nil {
+			return nil, err
+		}
+		updated = append(updated, task)
+	}
+
+	taskEvents := make([]events.Event, len(updated))
+	for i := range updated {
+		taskEvents[i] = taskUpdatedEvent(ctx, schedule, &updated[i])
+	}
+	err = s.repo.UpdateTaskStatuses(ctx, updated, taskEvents)
+	if errors.Is(err, repository.ErrScheduleChanged) {
+		return nil, scheduleChanged(ctx, scheduleID, "its tasks were being updated")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to update tasks of schedule %s: %w", scheduleID, err)
+	}
+
+	for _, event := range taskEvents {
+		s.publish(ctx, event)
+	}
+	return updated, nil
+}
+
+// AddAdHocTask records unplanned work done during a visit. Ad-hoc tasks are
+// never required, and follow the same update window as planned tasks.
+func (s *scheduleService) AddAdHocTask(ctx context.Context, scheduleID string, input models.Task) (*models.Task, error) {
+	description := strings.TrimSpace(input.Description)
+	if description == "" {
+		return nil, fmt.Errorf("%w: description is required", ErrInvalidInput)
+	}
+	if input.Category != nil && !models.IsValidTaskCategory(*input.Category) {
+		return nil, fmt.Errorf("%w: unknown category %q", ErrInvalidInput, *input.Category)
+	}
+
+	schedule, err := s.getScheduleForUpdate(ctx, scheduleID)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get schedule %s before adding a task: %w", scheduleID, err)
+	}
+	ctx, err = checkIfMatch(ctx, schedule)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if err := s.taskRules.checkTaskUpdateAllowed(schedule, now); err != nil {
+		return nil, err
+	}
+
+	task := models.Task{
+		ID:          uuid.NewString(),
+		ScheduleID:  scheduleID,
+		Description: description,
+		Category:    input.Category,
+		AdHoc:       true,
+	}
+	update := models.TaskUpdate{Completed: input.Completed, ReasonCode: input.ReasonCode, Reason: input.Reason}
+	if input.CompletedBy != nil {
+		update.CompletedBy = *input.CompletedBy
+	}
+	if err := applyTaskUpdate(&task, update, schedule, now); err != nil {
+		return nil, err
+	}
+
+	event := taskUpdatedEvent(ctx, schedule, &task)
+	created, err := s.repo.AddTask(ctx, task, event)
+	if errors.Is(err, repository.ErrScheduleChanged) {
+		return nil, scheduleChanged(ctx, scheduleID, "a task was being added")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to add ad-hoc task to schedule %s: %w", scheduleID, err)
+	}
+	s.publish(ctx, event)
+	return created, nil
+}
+
+// applyTaskUpdate validates an update and copies it onto the task. Tasks that
+// were not completed need a reason code; a bare free-text reason is accepted
+// as reason code "other".
+func applyTaskUpdate(task *models.Task, update models.TaskUpdate, schedule *models.Schedule, now time.Time) error {
+	var reason *string
+	if update.Reason != nil && strings.TrimSpace(*update.Reason) != "" {
+		trimmed := strings.TrimSpace(*update.Reason)
+		reason = &trimmed
+	}
+
+	if update.Completed {
+		if update.ReasonCode != nil {
+			return fmt.Errorf("%w: reason_code only applies to tasks that were not completed", ErrInvalidInput)
+		}
+		completedBy := strings.TrimSpace(update.CompletedBy)
+		if completedBy == "" {
+			completedBy = schedule.CaregiverID
+		}
+		task.Completed = true
+		task.CompletedAt = &now
+		task.CompletedBy = nil
+		if completedBy != "" {
+			task.CompletedBy = &completedBy
+		}
+		task.ReasonCode = nil
+		task.Reason = reason
+		return nil
+	}
+
+	code := update.ReasonCode
+	if code == nil {
+		if reason == nil {
+			return fmt.Errorf("%w: reason_code is required if task is not completed", ErrInvalidInput)
+		}
+		other := models.ReasonOther
+		code = &other
+	}
+	if !models.IsValidTaskReasonCode(*code) {
+		return fmt.Errorf("%w: unknown reason_code %q", ErrInvalidInput, *code)
+	}
+	if *code == models.ReasonOther && reason == nil {
+		return fmt.Errorf("%w: reason is required with reason_code %q", ErrInvalidInput, models.ReasonOther)
+	}
+
+	task.Completed = false
+	task.CompletedAt = nil
+	task.CompletedBy = nil
+	task.ReasonCode = code
+	task.Reason = reason
+	return nil
+}
+
+func taskUpdatedEvent(ctx context.Context, schedule *models.Schedule, task *models.Task) events.Event {
+	return newEvent(ctx, events.Event{
+		Type:        events.TaskUpdated,
+		ScheduleID:  schedule.ID,
+		ClientID:    schedule.ClientID,
+		CaregiverID: schedule.CaregiverID,
+		BranchID:    stringValue(schedule.BranchID),
+		TaskID:      task.ID,
+		Data: events.TaskData{
+			Completed:   task.Completed,
+			ReasonCode:  task.ReasonCode,
+			Reason:      task.Reason,
+			CompletedBy: task.CompletedBy,
+			AdHoc:       task.AdHoc,
+		},
+	})
+}
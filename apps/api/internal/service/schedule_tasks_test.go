@@ -0,0 +1,127 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+func taskTestRepository(schedule *models.Schedule, written *[]models.Task) *MockScheduleRepository {
+	return &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) { return schedule, nil },
+		UpdateTaskStatusesFunc: func(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error {
+			*written = tasks
+			return nil
+		},
+		AddTaskFunc: func(ctx context.Context, task models.Task, event events.Event) (*models.Task, error) {
+			*written = []models.Task{task}
+			return &task, nil
+		},
+	}
+}
+
+func TestUpdateTaskStatuses_RecordsCompletionMetadata(t *testing.T) {
+	schedule := inProgressSchedule(
+		models.Task{ID: "task-001", ScheduleID: "sch-001", Required: true},
+		models.Task{ID: "task-002", ScheduleID: "sch-001", Required: true},
+		models.Task{ID: "task-003", ScheduleID: "sch-001", Required: true},
+	)
+	schedule.CaregiverID = "caregiver-001"
+	var written []models.Task
+	s := service.NewScheduleService(taskTestRepository(schedule, &written))
+
+	declined := models.ReasonClientDeclined
+	note := "Client was asleep"
+	before := time.Now()
+	updated, err := s.UpdateTaskStatuses(context.Background(), "sch-001", []models.TaskUpdate{
+		{TaskID: "task-001", Completed: true},
+		{TaskID: "task-002", Completed: false, ReasonCode: &declined},
+		{TaskID: "task-003", Completed: false, Reason: &note},
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if len(written) != 3 || len(updated) != 3 {
+		t.Fatalf("Expected all three tasks in one write, got %d", len(written))
+	}
+
+	done := written[0]
+	if !done.Completed || done.CompletedAt == nil || done.CompletedAt.Before(before) {
+		t.Errorf("Expected a completion timestamp, got %+v", done)
+	}
+	if done.CompletedBy == nil || *done.CompletedBy != "caregiver-001" {
+		t.Errorf("Expected completed_by to default to the visit's caregiver, got %v", done.CompletedBy)
+	}
+	if written[1].ReasonCode == nil || *written[1].ReasonCode != models.ReasonClientDeclined || written[1].CompletedAt != nil {
+		t.Errorf("Expected the declined task to carry its reason code, got %+v", written[1])
+	}
+	if written[2].ReasonCode == nil || *written[2].ReasonCode != models.ReasonOther {
+		t.Errorf("Expected a bare reason to be recorded as %q, got %v", models.ReasonOther, written[2].ReasonCode)
+	}
+}
+
+func TestUpdateTaskStatuses_RejectsWholeBatchOnInvalidUpdate(t *testing.T) {
+	other := models.ReasonOther
+	unknown := "felt_like_it"
+	tests := []struct {
+		name    string
+		updates []models.TaskUpdate
+	}{
+		{"task of another visit", []models.TaskUpdate{{TaskID: "task-001", Completed: true}, {TaskID: "task-999", Completed: true}}},
+		{"duplicate task", []models.TaskUpdate{{TaskID: "task-001", Completed: true}, {TaskID: "task-001", Completed: true}}},
+		{"missing reason", []models.TaskUpdate{{TaskID: "task-001", Completed: false}}},
+		{"unknown reason code", []models.TaskUpdate{{TaskID: "task-001", Completed: false, ReasonCode: &unknown}}},
+		{"other without note", []models.TaskUpdate{{TaskID: "task-001", Completed: false, ReasonCode: &other}}},
+		{"empty batch", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var written []models.Task
+			schedule := inProgressSchedule(models.Task{ID: "task-001", ScheduleID: "sch-001", Required: true})
+			s := service.NewScheduleService(taskTestRepository(schedule, &written))
+
+			_, err := s.UpdateTaskStatuses(context.Background(), "sch-001", tt.updates)
+			if !errors.Is(err, service.ErrInvalidInput) {
+				t.Errorf("Expected ErrInvalidInput, got %v", err)
+			}
+			if written != nil {
+				t.Errorf("Expected nothing to be written, got %+v", written)
+			}
+		})
+	}
+}
+
+func TestAddAdHocTask(t *testing.T) {
+	var written []models.Task
+	schedule := inProgressSchedule()
+	s := service.NewScheduleService(taskTestRepository(schedule, &written))
+
+	category := models.CategoryIADLHousekeeping
+	caregiver := "caregiver-002"
+	task, err := s.AddAdHocTask(context.Background(), "sch-001", models.Task{
+		Description: "Took out the trash",
+		Category:    &category,
+		Completed:   true,
+		CompletedBy: &caregiver,
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if !task.AdHoc || task.Required || task.ScheduleID != "sch-001" || task.ID == "" {
+		t.Errorf("Expected an optional ad-hoc task on the visit, got %+v", task)
+	}
+	if task.CompletedBy == nil || *task.CompletedBy != caregiver || task.CompletedAt == nil {
+		t.Errorf("Expected completion metadata, got %+v", task)
+	}
+
+	schedule.Status = "scheduled"
+	if _, err := s.AddAdHocTask(context.Background(), "sch-001", models.Task{Description: "Too early", Completed: true}); !errors.Is(err, service.ErrConflict) {
+		t.Errorf("Expected ErrConflict before the visit starts, got %v", err)
+	}
+}
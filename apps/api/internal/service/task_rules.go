@@ -0,0 +1,83 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+)
+
+// TaskRules decide when a visit's tasks may change and whether they must be
+// resolved before the caregiver clocks out.
+type TaskRules struct {
+	// UpdateGrace is how long after clock-out task updates are still accepted,
+	// so caregivers can catch up on paperwork right after leaving.
+	UpdateGrace time.Duration
+	// RequireResolvedTasks refuses clock-out while a required task is neither
+	// completed nor explained with a reason.
+	RequireResolvedTasks bool
+}
+
+func DefaultTaskRules() TaskRules {
+	return TaskRules{
+		UpdateGrace:          30 * time.Minute,
+		RequireResolvedTasks: true,
+	}
+}
+
+// WithTaskRules replaces DefaultTaskRules.
+func WithTaskRules(rules TaskRules) Option {
+	return func(s *scheduleService) {
+		s.taskRules = rules
+	}
+}
+
+// OutstandingTasksError is returned by EndVisit while required tasks are
+// unresolved. It unwraps to ErrConflict.
+type OutstandingTasksError struct {
+	ScheduleID string
+	TaskIDs    []string
+}
+
+func (e *OutstandingTasksError) Error() string {
+	return fmt.Sprintf("service: cannot end visit for schedule %s: required tasks %s are neither completed nor given a reason",
+		e.ScheduleID, strings.Join(e.TaskIDs, ", "))
+}
+
+func (e *OutstandingTasksError) Unwrap() error {
+	return ErrConflict
+}
+
+// checkTaskUpdateAllowed accepts task updates while the visit is in progress
+// and for UpdateGrace after it ended.
+func (r TaskRules) checkTaskUpdateAllowed(schedule *models.Schedule, now time.Time) error {
+	switch schedule.Status {
+	case "in_progress":
+		return nil
+	case "completed":
+		if schedule.VisitEnd != nil && now.Sub(*schedule.VisitEnd) <= r.UpdateGrace {
+			return nil
+		}
+		return fmt.Errorf("%w: tasks of schedule %s can no longer be updated, the visit ended more than %s ago",
+			ErrConflict, schedule.ID, r.UpdateGrace)
+	default:
+		return fmt.Errorf("%w: tasks of schedule %s cannot be updated while the visit is %s",
+			ErrConflict, schedule.ID, schedule.Status)
+	}
+}
+
+// outstandingTasks lists the required tasks that block clock-out.
+func (r TaskRules) outstandingTasks(schedule *models.Schedule) []string {
+	if !r.RequireResolvedTasks {
+		return nil
+	}
+	var ids []string
+	for _, task := range schedule.Tasks {
+		if !task.Required || task.Completed || task.ReasonCode != nil || (task.Reason != nil && strings.TrimSpace(*task.Reason) != "") {
+			continue
+		}
+		ids = append(ids, task.ID)
+	}
+	return ids
+}
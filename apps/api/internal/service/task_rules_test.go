@@ -0,0 +1,108 @@
+package service_test
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+func inProgressSchedule(tasks ...models.Task) *models.Schedule {
+	start := time.Now().Add(-time.Hour)
+	return &models.Schedule{ID: "sch-001", ClientID: "client-001", Status: "in_progress", VisitStart: &start, Tasks: tasks}
+}
+
+func TestEndVisit_RefusedWhileRequiredTasksUnresolved(t *testing.T) {
+	reason := "Client declined"
+	schedule := inProgressSchedule(
+		models.Task{ID: "task-done", Required: true, Completed: true},
+		models.Task{ID: "task-open", Required: true},
+		models.Task{ID: "task-explained", Required: true, Reason: &reason},
+		models.Task{ID: "task-optional", Required: false},
+	)
+	ended := false
+	repo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) { return schedule, nil },
+		EndVisitFunc: func(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error {
+			ended = true
+			return nil
+		},
+	}
+
+	err := service.NewScheduleService(repo).EndVisit(context.Background(), "sch-001", -6.2, 106.8, "Casa Grande")
+
+	var outstanding *service.OutstandingTasksError
+	if !errors.As(err, &outstanding) {
+		t.Fatalf("Expected an OutstandingTasksError, got %v", err)
+	}
+	if !errors.Is(err, service.ErrConflict) {
+		t.Errorf("Expected the error to unwrap to ErrConflict")
+	}
+	if !reflect.DeepEqual(outstanding.TaskIDs, []string{"task-open"}) {
+		t.Errorf("Expected only task-open to be outstanding, got %v", outstanding.TaskIDs)
+	}
+	if ended {
+		t.Errorf("Expected the visit not to be ended")
+	}
+
+	// The same visit can be closed when the rule is switched off.
+	err = service.NewScheduleService(repo, service.WithTaskRules(service.TaskRules{RequireResolvedTasks: false})).
+		EndVisit(context.Background(), "sch-001", -6.2, 106.8, "Casa Grande")
+	if err != nil || !ended {
+		t.Errorf("Expected clock-out to succeed without the rule, got %v", err)
+	}
+}
+
+func TestUpdateTaskStatus_OnlyDuringVisitOrGraceWindow(t *testing.T) {
+	justEnded := time.Now().Add(-10 * time.Minute)
+	longEnded := time.Now().Add(-2 * time.Hour)
+	tasks := []models.Task{{ID: "task-001", ScheduleID: "sch-001", Required: true}}
+
+	tests := []struct {
+		name     string
+		schedule *models.Schedule
+		wantErr  bool
+	}{
+		{"not started", &models.Schedule{ID: "sch-001", Status: "scheduled", Tasks: tasks}, true},
+		{"in progress", inProgressSchedule(tasks...), false},
+		{"within grace", &models.Schedule{ID: "sch-001", Status: "completed", VisitEnd: &justEnded, Tasks: tasks}, false},
+		{"after grace", &models.Schedule{ID: "sch-001", Status: "completed", VisitEnd: &longEnded, Tasks: tasks}, true},
+		{"cancelled", &models.Schedule{ID: "sch-001", Status: "cancelled", Tasks: tasks}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			updated := false
+			repo := &MockScheduleRepository{
+				GetTaskByIDFunc: func(ctx context.Context, taskID string) (*models.Task, error) {
+					return &models.Task{ID: taskID, ScheduleID: "sch-001"}, nil
+				},
+				GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) { return tt.schedule, nil },
+				UpdateTaskStatusesFunc: func(ctx context.Context, tasks []models.Task, taskEvents []events.Event) error {
+					updated = true
+					return nil
+				},
+			}
+			s := service.NewScheduleService(repo, service.WithTaskRules(service.TaskRules{UpdateGrace: 30 * time.Minute}))
+
+			err := s.UpdateTaskStatus(context.Background(), "task-001", models.TaskUpdate{Completed: true})
+			if tt.wantErr {
+				if !errors.Is(err, service.ErrConflict) {
+					t.Errorf("Expected ErrConflict, got %v", err)
+				}
+				if updated {
+					t.Errorf("Expected the task not to be updated")
+				}
+				return
+			}
+			if err != nil || !updated {
+				t.Errorf("Expected the update to go through, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package service_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+type publisherFunc func(ctx context.Context, event events.Event) error
+
+func (f publisherFunc) Publish(ctx context.Context, event events.Event) error {
+	return f(ctx, event)
+}
+
+func TestVisitEventsUseTenantSettings(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	visitStart := time.Date(2025, 1, 15, 9, 7, 0, 0, chicago)
+	mockRepo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) {
+			return &models.Schedule{ID: id, Status: "in_progress", ShiftDate: "Wed, 15 Jan 2025", StartTime: "09:00", EndTime: "10:00", VisitStart: &visitStart}, nil
+		},
+		EndVisitFunc: func(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) error {
+			return nil
+		},
+	}
+	var published events.Event
+	s := service.NewScheduleService(mockRepo, service.WithPublisher(publisherFunc(func(ctx context.Context, event events.Event) error {
+		published = event
+		return nil
+	})))
+	ctx := tenant.WithTenant(context.Background(), tenant.Tenant{
+		ID:       "agency-a",
+		TimeZone: "America/Chicago",
+		Rounding: tenant.Rounding{IncrementMinutes: 15, Mode: tenant.RoundUp},
+	})
+
+	if err := s.EndVisit(ctx, "sch-001", 0, 0, ""); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if published.TenantID != "agency-a" {
+		t.Errorf("Expected the event to carry its tenant, got %q", published.TenantID)
+	}
+	data, _ := published.Data.(events.VisitData)
+	if data.ScheduledStart == nil || !data.ScheduledStart.Equal(time.Date(2025, 1, 15, 9, 0, 0, 0, chicago)) {
+		t.Errorf("Expected the shift to start at 09:00 in the tenant's zone, got %v", data.ScheduledStart)
+	}
+	if data.RoundedVisitStart == nil || !data.RoundedVisitStart.Equal(time.Date(2025, 1, 15, 9, 15, 0, 0, chicago)) {
+		t.Errorf("Expected the clock-in rounded up to 09:15, got %v", data.RoundedVisitStart)
+	}
+	if data.VisitStart == nil || !data.VisitStart.Equal(visitStart) {
+		t.Errorf("Expected the recorded clock-in to stay as recorded, got %v", data.VisitStart)
+	}
+	if data.RoundedVisitEnd == nil || data.RoundedVisitEnd.Minute()%15 != 0 {
+		t.Errorf("Expected the clock-out rounded to a quarter hour, got %v", data.RoundedVisitEnd)
+	}
+}
+
+func TestScrubLocations_TenantGeofenceRadius(t *testing.T) {
+	visits := []models.Schedule{visitAt("sch-001", "client-001", 1, 0.0005)} // ~56m away
+	scrubs := map[string]models.LocationScrub{}
+	policy := service.DefaultLocationPolicy()
+	policy.Mode = models.LocationCoarsen
+	svc := service.NewRetentionService(&memoryRetentionRepository{}, newScrubRepository(visits, scrubs), service.RetentionConfig{Locations: policy})
+
+	ctx := tenant.WithTenant(context.Background(), tenant.Tenant{ID: "agency-a", GeofenceRadiusMeters: 50})
+	if _, err := svc.ScrubLocations(ctx); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if _, ok := scrubs["sch-001"]; ok {
+		t.Error("Expected the tenant's 50m geofence to fail a clock-in 56m away")
+	}
+}
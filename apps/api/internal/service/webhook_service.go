@@ -0,0 +1,389 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/branch"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/webhook"
+)
+
+// WebhookService manages webhook subscriptions and delivers the outbox. The
+// deliveries themselves are queued by the schedule repository, in the same
+// transaction as the visit or task change they report.
+type WebhookService interface {
+	CreateSubscription(ctx context.Context, targetURL string, eventTypes, branchIDs []string, secret string) (*models.WebhookSubscription, error)
+	GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error)
+	DeleteSubscription(ctx context.Context, id string) error
+	GetDeadLetters(ctx context.Context) ([]models.WebhookDelivery, error)
+	RetryDelivery(ctx context.Context, id string) error
+	ProcessDueDeliveries(ctx context.Context) (int, error)
+}
+
+type WebhookConfig struct {
+	MaxAttempts    int
+	BaseBackoff    time.Duration
+	MaxBackoff     time.Duration
+	RequestTimeout time.Duration
+	BatchSize      int
+	// ClaimLease is how long a dispatch holds the deliveries it claimed
+	// before another one may take them over. By default it covers a batch
+	// of requests that all time out.
+	ClaimLease time.Duration
+	// AllowPrivateTargets lets subscriptions target loopback and private
+	// addresses, for tests and local receivers. By default they are refused.
+	AllowPrivateTargets bool
+}
+
+func DefaultWebhookConfig() WebhookConfig {
+	return WebhookConfig{
+		MaxAttempts:    8,
+		BaseBackoff:    30 * time.Second,
+		MaxBackoff:     6 * time.Hour,
+		RequestTimeout: 10 * time.Second,
+		BatchSize:      50,
+	}
+}
+
+type webhookService struct {
+	repo   repository.WebhookRepository
+	config WebhookConfig
+	client *http.Client
+}
+
+func NewWebhookService(repo repository.WebhookRepository, config WebhookConfig) WebhookService {
+	defaults := DefaultWebhookConfig()
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = defaults.MaxAttempts
+	}
+	if config.BaseBackoff <= 0 {
+		config.BaseBackoff = defaults.BaseBackoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = defaults.MaxBackoff
+	}
+	if config.RequestTimeout <= 0 {
+		config.RequestTimeout = defaults.RequestTimeout
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = defaults.BatchSize
+	}
+	if config.ClaimLease <= 0 {
+		config.ClaimLease = time.Duration(config.BatchSize) * config.RequestTimeout
+	}
+
+	return &webhookService{
+		repo:   repo,
+		config: config,
+		client: webhook.NewClient(config.RequestTimeout, config.AllowPrivateTargets),
+	}
+}
+
+// CreateSubscription subscribes targetURL to eventTypes, or to every event when
+// there are none. A subscription with branchIDs only hears about visits of
+// those branches.
+func (s *webhookService) CreateSubscription(ctx context.Context, targetURL string, eventTypes, branchIDs []string, secret string) (*models.WebhookSubscription, error) {
+	if err := checkManagesWebhooks(ctx); err != nil {
+		return nil, err
+	}
+	parsed, err := url.Parse(targetURL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: webhook URL must be an absolute http(s) URL", ErrInvalidInput)
+	}
+	if !s.config.AllowPrivateTargets {
+		if err := webhook.CheckTarget(parsed); err != nil {
+			return nil, fmt.Errorf("%w: webhook URL must be a public address", ErrInvalidInput)
+		}
+	}
+	for _, t := range eventTypes {
+		if !events.IsValidType(t) {
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidInput, t)
+		}
+	}
+	for _, id := range branchIDs {
+		if _, err := uuid.Parse(id); err != nil {
+			return nil, fmt.Errorf("%w: branch ID %q is not a UUID", ErrInvalidInput, id)
+		}
+	}
+	if len(branchIDs) == 0 {
+		branchIDs = nil
+	}
+
+	if secret == "" {
+		secret, err = generateWebhookSecret()
+		if err != nil {
+			return nil, fmt.Errorf("service: failed to generate webhook secret: %w", err)
+		}
+	}
+	if eventTypes == nil {
+		eventTypes = []string{}
+	}
+
+	subscription, err := s.repo.CreateSubscription(ctx, models.WebhookSubscription{
+		ID:        uuid.NewString(),
+		URL:       targetURL,
+		Secret:    secret,
+		Events:    eventTypes,
+		Active:    true,
+		BranchIDs: branchIDs,
+		CreatedAt: time.Now().UTC(),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to create webhook subscription: %w", err)
+	}
+	return subscription, nil
+}
+
+// GetSubscriptions lists the subscriptions of the agency to admins, and those
+// limited to their branches to supervisors.
+func (s *webhookService) GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	if !branch.Restricted(ctx) {
+		if err := checkManagesWebhooks(ctx); err != nil {
+			return nil, err
+		}
+	}
+	subscriptions, err := s.repo.GetSubscriptions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get webhook subscriptions: %w", err)
+	}
+	// Secrets are only ever shown once, when the subscription is created.
+	visible := subscriptions[:0]
+	for _, subscription := range subscriptions {
+		if subscriptionVisible(ctx, subscription) {
+			subscription.Secret = ""
+			visible = append(visible, subscription)
+		}
+	}
+	return visible, nil
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, id string) error {
+	if err := checkManagesWebhooks(ctx); err != nil {
+		return err
+	}
+	if err := s.repo.DeleteSubscription(ctx, id); err != nil {
+		return fmt.Errorf("service: failed to delete webhook subscription %s: %w", id, err)
+	}
+	return nil
+}
+
+func (s *webhookService) GetDeadLetters(ctx context.Context) ([]models.WebhookDelivery, error) {
+	if err := checkManagesWebhooks(ctx); err != nil {
+		return nil, err
+	}
+	deliveries, err := s.repo.GetDeliveriesByStatus(ctx, models.DeliveryDead)
+	if err != nil {
+		return nil, fmt.Errorf("service: failed to get dead-lettered webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+func (s *webhookService) RetryDelivery(ctx context.Context, id string) error {
+	if err := checkManagesWebhooks(ctx); err != nil {
+		return err
+	}
+	delivery, err := s.repo.GetDeliveryByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("service: failed to get webhook delivery %s: %w", id, err)
+	}
+	if delivery.Status != models.DeliveryDead {
+		return fmt.Errorf("%w: webhook delivery %s has status %s", ErrConflict, id, delivery.Status)
+	}
+
+	delivery.Status = models.DeliveryPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now().UTC()
+	if err := s.repo.UpdateDelivery(ctx, *delivery); err != nil {
+		return fmt.Errorf("service: failed to requeue webhook delivery %s: %w", id, err)
+	}
+	return nil
+}
+
+// ProcessDueDeliveries claims the pending deliveries whose retry time has come,
+// attempts them and returns how many were delivered successfully.
+func (s *webhookService) ProcessDueDeliveries(ctx context.Context) (int, error) {
+	if err := checkManagesWebhooks(ctx); err != nil {
+		return 0, err
+	}
+	due, err := s.repo.ClaimDueDeliveries(ctx, s.config.BatchSize, s.config.ClaimLease)
+	if err != nil {
+		return 0, fmt.Errorf("service: failed to claim due webhook deliveries: %w", err)
+	}
+	if len(due) == 0 {
+		return 0, nil
+	}
+
+	subscriptions, err := s.repo.GetSubscriptions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("service: failed to load webhook subscriptions: %w", err)
+	}
+	byID := make(map[string]models.WebhookSubscription, len(subscriptions))
+	for _, sub := range subscriptions {
+		byID[sub.ID] = sub
+	}
+
+	delivered := 0
+	for _, delivery := range due {
+		if ctx.Err() != nil {
+			return delivered, ctx.Err()
+		}
+
+		sub, ok := byID[delivery.SubscriptionID]
+		if !ok || !sub.Active {
+			s.markDead(&delivery, "subscription no longer active", nil)
+		} else {
+			statusCode, err := s.send(ctx, sub, delivery)
+			if err == nil {
+				deliveredAt := time.Now().UTC()
+				delivery.Status = models.DeliveryDelivered
+				delivery.Attempts++
+				delivery.DeliveredAt = &deliveredAt
+				delivery.LastError = nil
+				delivery.LastStatusCode = statusCode
+				delivered++
+			} else {
+				s.scheduleRetry(&delivery, err.Error(), statusCode)
+			}
+		}
+
+		if err := s.repo.UpdateDelivery(ctx, delivery); err != nil {
+			return delivered, fmt.Errorf("service: failed to record webhook delivery %s: %w", delivery.ID, err)
+		}
+	}
+	return delivered, nil
+}
+
+func (s *webhookService) send(ctx context.Context, sub models.WebhookSubscription, delivery models.WebhookDelivery) (*int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("failed to build request: %w", err)
+	}
+
+	timestamp := time.Now()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "evv-logger-webhooks/1.0")
+	req.Header.Set(webhook.HeaderEvent, delivery.EventType)
+	req.Header.Set(webhook.HeaderDelivery, delivery.ID)
+	req.Header.Set(webhook.HeaderTimestamp, fmt.Sprintf("%d", timestamp.Unix()))
+	req.Header.Set(webhook.HeaderSignature, webhook.Sign(sub.Secret, timestamp, delivery.Payload))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	statusCode := resp.StatusCode
+	if statusCode < 200 || statusCode > 299 {
+		return &statusCode, fmt.Errorf("receiver responded with status %d", statusCode)
+	}
+	return &statusCode, nil
+}
+
+func (s *webhookService) scheduleRetry(delivery *models.WebhookDelivery, reason string, statusCode *int) {
+	delivery.Attempts++
+	if delivery.Attempts >= s.config.MaxAttempts {
+		s.markDead(delivery, reason, statusCode)
+		return
+	}
+	delivery.Status = models.DeliveryPending
+	delivery.LastError = &reason
+	delivery.LastStatusCode = statusCode
+	delivery.NextAttemptAt = time.Now().UTC().Add(s.backoff(delivery.Attempts))
+}
+
+func (s *webhookService) markDead(delivery *models.WebhookDelivery, reason string, statusCode *int) {
+	delivery.Status = models.DeliveryDead
+	delivery.LastError = &reason
+	delivery.LastStatusCode = statusCode
+}
+
+// backoff doubles the wait after every failed attempt, capped at MaxBackoff.
+func (s *webhookService) backoff(attempts int) time.Duration {
+	wait := s.config.BaseBackoff
+	for i := 1; i < attempts; i++ {
+		wait *= 2
+		if wait >= s.config.MaxBackoff {
+			return s.config.MaxBackoff
+		}
+	}
+	return wait
+}
+
+// subscriptionVisible reports whether the caller of ctx may see sub: callers
+// limited to some branches only see the subscriptions limited to those.
+func subscriptionVisible(ctx context.Context, sub models.WebhookSubscription) bool {
+	if !branch.Restricted(ctx) {
+		return true
+	}
+	if sub.BranchIDs == nil {
+		return false
+	}
+	for _, id := range sub.BranchIDs {
+		if !branch.Allows(ctx, id) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkManagesWebhooks lets admins change subscriptions and work the outbox,
+// which holds the deliveries of every branch. API keys are let through: the
+// routes their scopes allow are the only ones they reach.
+func checkManagesWebhooks(ctx context.Context) error {
+	if branch.Restricted(ctx) {
+		return fmt.Errorf("%w: supervisors cannot manage webhooks", ErrForbidden)
+	}
+	if _, ok := auth.APIKeyFromContext(ctx); ok {
+		return nil
+	}
+	if !auth.HasRole(ctx, auth.RoleAdmin) {
+		return fmt.Errorf("%w: only admins can manage webhooks", ErrForbidden)
+	}
+	return nil
+}
+
+func generateWebhookSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// RunWebhookDispatcher drains the outbox every interval until ctx is cancelled.
+func RunWebhookDispatcher(ctx context.Context, s WebhookService, tenants tenant.Store, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := tenant.Each(ctx, tenants, func(ctx context.Context) error {
+				_, err := s.ProcessDueDeliveries(ctx)
+				return err
+			})
+			if err != nil {
+				slog.WarnContext(ctx, "Webhook dispatch failed", "error", err)
+			}
+		}
+	}
+}
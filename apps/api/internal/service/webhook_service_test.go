@@ -0,0 +1,455 @@
+package service_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/webhook"
+)
+
+// memoryWebhookRepository is an in-memory outbox used in place of Supabase.
+type memoryWebhookRepository struct {
+	mu            sync.Mutex
+	subscriptions map[string]models.WebhookSubscription
+	deliveries    map[string]models.WebhookDelivery
+}
+
+var _ repository.WebhookRepository = &memoryWebhookRepository{}
+
+func newMemoryWebhookRepository() *memoryWebhookRepository {
+	return &memoryWebhookRepository{
+		subscriptions: map[string]models.WebhookSubscription{},
+		deliveries:    map[string]models.WebhookDelivery{},
+	}
+}
+
+func (m *memoryWebhookRepository) CreateSubscription(ctx context.Context, subscription models.WebhookSubscription) (*models.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subscriptions[subscription.ID] = subscription
+	return &subscription, nil
+}
+
+func (m *memoryWebhookRepository) GetSubscriptions(ctx context.Context) ([]models.WebhookSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subscriptions []models.WebhookSubscription
+	for _, sub := range m.subscriptions {
+		subscriptions = append(subscriptions, sub)
+	}
+	return subscriptions, nil
+}
+
+func (m *memoryWebhookRepository) DeleteSubscription(ctx context.Context, id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.subscriptions[id]; !ok {
+		return fmt.Errorf("webhook subscription with ID %s %w", id, repository.ErrNotFound)
+	}
+	delete(m.subscriptions, id)
+	return nil
+}
+
+// enqueue queues event for every subscription of its branch, as the schedule
+// repository does with a visit or task change.
+func (m *memoryWebhookRepository) enqueue(t *testing.T, event events.Event) {
+	t.Helper()
+	payload, err := json.Marshal(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, sub := range m.subscriptions {
+		if sub.BranchIDs != nil && !slices.Contains(sub.BranchIDs, event.BranchID) {
+			continue
+		}
+		id := event.ID + "/" + sub.ID
+		m.deliveries[id] = models.WebhookDelivery{
+			ID: id, SubscriptionID: sub.ID, EventID: event.ID, EventType: string(event.Type), Payload: payload,
+			Status: models.DeliveryPending, NextAttemptAt: time.Now().UTC(),
+		}
+	}
+}
+
+func (m *memoryWebhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now().UTC()
+	var due []models.WebhookDelivery
+	for _, d := range m.deliveries {
+		if (d.Status == models.DeliveryPending && !d.NextAttemptAt.After(now)) ||
+			(d.Status == models.DeliverySending && !d.LockedUntil.After(now)) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	lockedUntil := now.Add(lease)
+	for i := range due {
+		due[i].Status = models.DeliverySending
+		due[i].LockedUntil = &lockedUntil
+		m.deliveries[due[i].ID] = due[i]
+	}
+	return due, nil
+}
+
+func (m *memoryWebhookRepository) GetDeliveriesByStatus(ctx context.Context, status string) ([]models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var deliveries []models.WebhookDelivery
+	for _, d := range m.deliveries {
+		if d.Status == status {
+			deliveries = append(deliveries, d)
+		}
+	}
+	return deliveries, nil
+}
+
+func (m *memoryWebhookRepository) GetDeliveryByID(ctx context.Context, id string) (*models.WebhookDelivery, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	d, ok := m.deliveries[id]
+	if !ok {
+		return nil, fmt.Errorf("webhook delivery with ID %s %w", id, repository.ErrNotFound)
+	}
+	return &d, nil
+}
+
+func (m *memoryWebhookRepository) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delivery.LockedUntil = nil
+	m.deliveries[delivery.ID] = delivery
+	return nil
+}
+
+type receivedWebhook struct {
+	eventType string
+	event     events.Event
+	verifyErr error
+}
+
+// newReceiver starts a local webhook receiver that verifies signatures with secret
+// and answers with the status codes in order, repeating the last one.
+func newReceiver(t *testing.T, secret string, statuses ...int) (*httptest.Server, func() []receivedWebhook) {
+	t.Helper()
+	var mu sync.Mutex
+	var received []receivedWebhook
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		got := receivedWebhook{eventType: r.Header.Get(webhook.HeaderEvent)}
+		got.verifyErr = webhook.Verify(secret, r.Header.Get(webhook.HeaderTimestamp), r.Header.Get(webhook.HeaderSignature), body, time.Minute)
+		json.Unmarshal(body, &got.event)
+
+		mu.Lock()
+		status := statuses[len(statuses)-1]
+		if len(received) < len(statuses) {
+			status = statuses[len(received)]
+		}
+		received = append(received, got)
+		mu.Unlock()
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []receivedWebhook {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]receivedWebhook(nil), received...)
+	}
+}
+
+func TestWebhookDelivery_SignedAndDelivered(t *testing.T) {
+	const secret = "test-secret"
+	receiver, received := newReceiver(t, secret, http.StatusOK)
+
+	repo := newMemoryWebhookRepository()
+	s := service.NewWebhookService(repo, service.WebhookConfig{AllowPrivateTargets: true})
+	ctx := context.Background()
+
+	if _, err := s.CreateSubscription(ctx, receiver.URL, []string{"visit.started"}, nil, secret); err != nil {
+		t.Fatalf("Expected no error creating subscription, got %v", err)
+	}
+	repo.enqueue(t, events.Event{ID: "evt-001", Type: events.VisitStarted, ScheduleID: "sch-001", OccurredAt: time.Now().UTC()})
+
+	delivered, err := s.ProcessDueDeliveries(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error processing deliveries, got %v", err)
+	}
+	if delivered != 1 {
+		t.Fatalf("Expected 1 delivery, got %d", delivered)
+	}
+
+	got := received()
+	if len(got) != 1 {
+		t.Fatalf("Expected receiver to be called once, got %d", len(got))
+	}
+	if got[0].verifyErr != nil {
+		t.Errorf("Expected a valid signature, got %v", got[0].verifyErr)
+	}
+	if got[0].eventType != "visit.started" || got[0].event.ScheduleID != "sch-001" {
+		t.Errorf("Unexpected delivery: %+v", got[0])
+	}
+
+	done, _ := repo.GetDeliveriesByStatus(ctx, models.DeliveryDelivered)
+	if len(done) != 1 || done[0].DeliveredAt == nil {
+		t.Errorf("Expected the delivery to be marked delivered, got %+v", done)
+	}
+}
+
+func TestWebhookDelivery_ClaimedDeliveriesWaitForTheirLease(t *testing.T) {
+	receiver, received := newReceiver(t, "secret", http.StatusOK)
+
+	repo := newMemoryWebhookRepository()
+	s := service.NewWebhookService(repo, service.WebhookConfig{AllowPrivateTargets: true})
+	ctx := context.Background()
+
+	s.CreateSubscription(ctx, receiver.URL, nil, nil, "secret")
+	repo.enqueue(t, events.Event{ID: "evt-001", Type: events.VisitStarted, ScheduleID: "sch-001"})
+
+	// Another dispatcher claimed the delivery and has not finished with it.
+	claimed, _ := repo.ClaimDueDeliveries(ctx, 10, time.Hour)
+	if len(claimed) != 1 {
+		t.Fatalf("Expected the delivery to be claimed, got %+v", claimed)
+	}
+	if delivered, _ := s.ProcessDueDeliveries(ctx); delivered != 0 || len(received()) != 0 {
+		t.Fatalf("Expected a claimed delivery not to be sent again, got %d sent", len(received()))
+	}
+
+	// It died without recording the delivery; once its lease runs out the
+	// delivery is claimed again.
+	expired := time.Now().UTC().Add(-time.Second)
+	claimed[0].LockedUntil = &expired
+	repo.mu.Lock()
+	repo.deliveries[claimed[0].ID] = claimed[0]
+	repo.mu.Unlock()
+	if delivered, err := s.ProcessDueDeliveries(ctx); delivered != 1 || err != nil {
+		t.Fatalf("Expected the expired claim to be delivered, got %d, %v", delivered, err)
+	}
+	if done, _ := repo.GetDeliveriesByStatus(ctx, models.DeliveryDelivered); len(done) != 1 || done[0].LockedUntil != nil {
+		t.Errorf("Expected the delivery delivered and released, got %+v", done)
+	}
+}
+
+func TestWebhookDelivery_RetriesThenDeadLetters(t *testing.T) {
+	receiver, received := newReceiver(t, "secret", http.StatusInternalServerError)
+
+	repo := newMemoryWebhookRepository()
+	s := service.NewWebhookService(repo, service.WebhookConfig{
+		MaxAttempts:         3,
+		BaseBackoff:         time.Millisecond,
+		MaxBackoff:          5 * time.Millisecond,
+		AllowPrivateTargets: true,
+	})
+	ctx := context.Background()
+
+	s.CreateSubscription(ctx, receiver.URL, nil, nil, "secret")
+	repo.enqueue(t, events.Event{ID: "evt-001", Type: events.VisitCompleted, ScheduleID: "sch-001"})
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if _, err := s.ProcessDueDeliveries(ctx); err != nil {
+			t.Fatalf("Expected no error processing deliveries, got %v", err)
+		}
+		if dead, _ := s.GetDeadLetters(ctx); len(dead) > 0 {
+			break
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+
+	dead, err := s.GetDeadLetters(ctx)
+	if err != nil {
+		t.Fatalf("Expected no error getting dead letters, got %v", err)
+	}
+	if len(dead) != 1 {
+		t.Fatalf("Expected 1 dead-lettered delivery, got %d", len(dead))
+	}
+	if dead[0].Attempts != 3 || dead[0].LastStatusCode == nil || *dead[0].LastStatusCode != http.StatusInternalServerError {
+		t.Errorf("Unexpected dead letter: %+v", dead[0])
+	}
+	if n := len(received()); n != 3 {
+		t.Errorf("Expected 3 delivery attempts, got %d", n)
+	}
+
+	if err := s.RetryDelivery(ctx, dead[0].ID); err != nil {
+		t.Fatalf("Expected no error retrying delivery, got %v", err)
+	}
+	requeued, _ := repo.GetDeliveryByID(ctx, dead[0].ID)
+	if requeued.Status != models.DeliveryPending || requeued.Attempts != 0 {
+		t.Errorf("Expected delivery to be requeued, got %+v", requeued)
+	}
+}
+
+func TestCreateSubscription_RefusesPrivateTargets(t *testing.T) {
+	s := service.NewWebhookService(newMemoryWebhookRepository(), service.WebhookConfig{})
+	ctx := context.Background()
+
+	for _, target := range []string{
+		"http://localhost:8080/hook",
+		"http://127.0.0.1/hook",
+		"http://[::1]/hook",
+		"http://10.0.0.5/hook",
+		"http://192.168.1.10/hook",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://metadata.google.internal/computeMetadata/v1/",
+		"http://100.100.100.200/",
+		"http://0.0.0.0/",
+	} {
+		if _, err := s.CreateSubscription(ctx, target, nil, nil, ""); !errors.Is(err, service.ErrInvalidInput) {
+			t.Errorf("%s: expected ErrInvalidInput, got %v", target, err)
+		}
+	}
+	if _, err := s.CreateSubscription(ctx, "https://payroll.example.com/evv", nil, nil, ""); err != nil {
+		t.Errorf("Expected a public target to be accepted, got %v", err)
+	}
+}
+
+func TestWebhookService_OnlyAdminsAndAPIKeysManageWebhooks(t *testing.T) {
+	repo := newMemoryWebhookRepository()
+	s := service.NewWebhookService(repo, service.WebhookConfig{AllowPrivateTargets: true})
+	repo.CreateSubscription(context.Background(), models.WebhookSubscription{ID: "sub-001", URL: "https://example.com/hook", Active: true})
+
+	for name, ctx := range map[string]context.Context{
+		"caregiver": auth.WithRole(context.Background(), "caregiver"),
+		"no role":   auth.WithRole(context.Background(), ""),
+	} {
+		if _, err := s.CreateSubscription(ctx, "https://example.com/other", nil, nil, ""); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected CreateSubscription to be forbidden, got %v", name, err)
+		}
+		if _, err := s.GetSubscriptions(ctx); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected GetSubscriptions to be forbidden, got %v", name, err)
+		}
+		if err := s.DeleteSubscription(ctx, "sub-001"); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected DeleteSubscription to be forbidden, got %v", name, err)
+		}
+		if _, err := s.GetDeadLetters(ctx); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected GetDeadLetters to be forbidden, got %v", name, err)
+		}
+		if err := s.RetryDelivery(ctx, "delivery-001"); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected RetryDelivery to be forbidden, got %v", name, err)
+		}
+		if _, err := s.ProcessDueDeliveries(ctx); !errors.Is(err, service.ErrForbidden) {
+			t.Errorf("%s: expected ProcessDueDeliveries to be forbidden, got %v", name, err)
+		}
+	}
+	if subscriptions, _ := repo.GetSubscriptions(context.Background()); len(subscriptions) != 1 {
+		t.Errorf("Expected no changes, got %+v", subscriptions)
+	}
+
+	keyCtx := auth.WithAPIKey(context.Background(), models.APIKey{ID: "key-1", Scopes: []string{models.ScopeExportBilling}})
+	if _, err := s.CreateSubscription(keyCtx, "https://example.com/payroll", nil, nil, ""); err != nil {
+		t.Errorf("Expected API keys to create subscriptions, got %v", err)
+	}
+	if _, err := s.GetSubscriptions(auth.WithRole(context.Background(), auth.RoleAdmin)); err != nil {
+		t.Errorf("Expected admins to list subscriptions, got %v", err)
+	}
+}
+
+func TestWebhookDelivery_RefusesPrivateAddressesWhenConnecting(t *testing.T) {
+	receiver, received := newReceiver(t, "secret", http.StatusOK)
+
+	// A subscription whose host name resolves to a private address once it
+	// is delivered to.
+	repo := newMemoryWebhookRepository()
+	repo.CreateSubscription(context.Background(), models.WebhookSubscription{ID: "sub-001", URL: receiver.URL, Secret: "secret", Active: true})
+	repo.enqueue(t, events.Event{ID: "evt-001", Type: events.VisitStarted, ScheduleID: "sch-001"})
+
+	s := service.NewWebhookService(repo, service.WebhookConfig{})
+	if delivered, err := s.ProcessDueDeliveries(context.Background()); err != nil || delivered != 0 {
+		t.Fatalf("Expected nothing delivered, got %d, %v", delivered, err)
+	}
+	if n := len(received()); n != 0 {
+		t.Errorf("Expected the receiver not to be called, got %d requests", n)
+	}
+}
+
+func TestWebhookDelivery_DoesNotFollowRedirects(t *testing.T) {
+	target, received := newReceiver(t, "secret", http.StatusOK)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusTemporaryRedirect))
+	t.Cleanup(redirect.Close)
+
+	repo := newMemoryWebhookRepository()
+	s := service.NewWebhookService(repo, service.WebhookConfig{AllowPrivateTargets: true})
+	ctx := context.Background()
+	s.CreateSubscription(ctx, redirect.URL, nil, nil, "secret")
+	repo.enqueue(t, events.Event{ID: "evt-001", Type: events.VisitStarted, ScheduleID: "sch-001"})
+
+	if delivered, _ := s.ProcessDueDeliveries(ctx); delivered != 0 {
+		t.Errorf("Expected a redirect not to count as delivered, got %d", delivered)
+	}
+	if n := len(received()); n != 0 {
+		t.Errorf("Expected the redirect not to be followed, got %d requests", n)
+	}
+}
+
+func TestStartVisit_QueuesEventWithTheChange(t *testing.T) {
+	var queued events.Event
+	mockRepo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) {
+			return &models.Schedule{ID: id, ClientID: "client-001", Status: "scheduled", ShiftDate: "Mon, 15 Jan 2025", StartTime: "09:00", EndTime: "10:00"}, nil
+		},
+		StartVisitFunc: func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+			queued = event
+			return nil
+		},
+	}
+	var published []events.Event
+	s := service.NewScheduleService(mockRepo, service.WithPublisher(publisherFunc(func(ctx context.Context, event events.Event) error {
+		published = append(published, event)
+		return nil
+	})))
+
+	if err := s.StartVisit(context.Background(), "sch-001", -6.2, 106.8, "Somewhere"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if queued.ID == "" || queued.Type != events.VisitStarted || queued.ClientID != "client-001" || queued.OccurredAt.IsZero() {
+		t.Errorf("Expected a visit.started event to be written with the change, got %+v", queued)
+	}
+	if len(published) != 1 || published[0].ID != queued.ID {
+		t.Errorf("Expected the same event to be published once written, got %+v", published)
+	}
+}
+
+func TestStartVisit_NotPublishedWhenTheWriteFails(t *testing.T) {
+	mockRepo := &MockScheduleRepository{
+		GetScheduleByIDFunc: func(ctx context.Context, id string) (*models.Schedule, error) {
+			return &models.Schedule{ID: id, Status: "scheduled"}, nil
+		},
+		StartVisitFunc: func(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) error {
+			return fmt.Errorf("%w: status is no longer scheduled", repository.ErrScheduleChanged)
+		},
+	}
+	published := 0
+	s := service.NewScheduleService(mockRepo, service.WithPublisher(publisherFunc(func(ctx context.Context, event events.Event) error {
+		published++
+		return nil
+	})))
+
+	if err := s.StartVisit(context.Background(), "sch-001", -6.2, 106.8, "Somewhere"); !errors.Is(err, service.ErrConflict) {
+		t.Errorf("Expected ErrConflict when the visit changed meanwhile, got %v", err)
+	}
+	if published != 0 {
+		t.Errorf("Expected nothing published, got %d events", published)
+	}
+}
@@ -0,0 +1,80 @@
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Store looks tenants up. It is not scoped to a tenant itself.
+type Store interface {
+	// GetTenant returns the tenant with id, or an error wrapping ErrUnknown.
+	GetTenant(ctx context.Context, id string) (*Tenant, error)
+	ListTenants(ctx context.Context) ([]Tenant, error)
+}
+
+// Each calls fn once for every tenant, with ctx scoped to it. A tenant whose
+// call fails does not keep the others from running; the errors are joined.
+func Each(ctx context.Context, store Store, fn func(ctx context.Context) error) error {
+	tenants, err := store.ListTenants(ctx)
+	if err != nil {
+		return fmt.Errorf("tenant: failed to list tenants: %w", err)
+	}
+	var errs []error
+	for _, t := range tenants {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err := fn(WithTenant(ctx, t)); err != nil {
+			errs = append(errs, fmt.Errorf("tenant %s: %w", t.ID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// cachedStore keeps the tenants GetTenant returned for ttl, so that resolving
+// the tenant of a request does not cost a query per request.
+type cachedStore struct {
+	next Store
+	ttl  time.Duration
+
+	mu      sync.Mutex
+	entries map[string]cachedTenant
+}
+
+type cachedTenant struct {
+	tenant    Tenant
+	expiresAt time.Time
+}
+
+// Cached returns a Store that caches the tenants of next for ttl. Changes to a
+// tenant's settings take effect once its entry expires. ListTenants is not
+// cached.
+func Cached(next Store, ttl time.Duration) Store {
+	return &cachedStore{next: next, ttl: ttl, entries: map[string]cachedTenant{}}
+}
+
+func (s *cachedStore) GetTenant(ctx context.Context, id string) (*Tenant, error) {
+	s.mu.Lock()
+	entry, ok := s.entries[id]
+	s.mu.Unlock()
+	if ok && time.Now().Before(entry.expiresAt) {
+		t := entry.tenant
+		return &t, nil
+	}
+
+	t, err := s.next.GetTenant(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	s.mu.Lock()
+	s.entries[id] = cachedTenant{tenant: *t, expiresAt: time.Now().Add(s.ttl)}
+	s.mu.Unlock()
+	return t, nil
+}
+
+func (s *cachedStore) ListTenants(ctx context.Context) ([]Tenant, error) {
+	return s.next.ListTenants(ctx)
+}
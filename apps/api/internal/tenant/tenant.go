@@ -0,0 +1,150 @@
+// Package tenant identifies the agency a request or background job acts for,
+// and carries the settings that differ between agencies. The repository client
+// scopes every query to the tenant in its context and refuses queries made
+// without one.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// DefaultID is the tenant of single-agency deployments, which owns every row
+// written before tenants existed.
+const DefaultID = "default"
+
+// ErrUnknown is returned for a tenant ID that has no tenant.
+var ErrUnknown = errors.New("tenant: unknown tenant")
+
+// Rounding modes of visit times.
+const (
+	RoundNearest = "nearest"
+	RoundUp      = "up"
+	RoundDown    = "down"
+)
+
+// Tenant is an agency. Zero settings fall back to the API's configuration.
+type Tenant struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// TimeZone is the IANA zone of the agency's shift dates and times, such as
+	// America/Chicago. Empty means the API's local zone.
+	TimeZone string `json:"time_zone,omitempty"`
+	// GeofenceRadiusMeters is how far from the client's location a clock-in or
+	// clock-out may be and still pass the geofence check.
+	GeofenceRadiusMeters int `json:"geofence_radius_meters,omitempty"`
+	// Rounding is how visit times are rounded for billing and payroll.
+	Rounding Rounding `json:"rounding"`
+}
+
+// Rounding rounds visit times to IncrementMinutes (for example 15, which with
+// RoundNearest is the usual 7-minute rule). A zero increment leaves them as
+// recorded. The recorded times themselves are never rounded.
+type Rounding struct {
+	IncrementMinutes int    `json:"increment_minutes,omitempty"`
+	Mode             string `json:"mode,omitempty"`
+}
+
+// Round rounds t to the increment, in the zone of t.
+func (r Rounding) Round(t time.Time) time.Time {
+	if r.IncrementMinutes <= 0 {
+		return t
+	}
+	increment := time.Duration(r.IncrementMinutes) * time.Minute
+	_, offset := t.Zone()
+	local := t.Add(time.Duration(offset) * time.Second)
+	truncated := local.Truncate(increment)
+	rounded := truncated
+	switch r.Mode {
+	case RoundUp:
+		if !truncated.Equal(local) {
+			rounded = truncated.Add(increment)
+		}
+	case RoundDown:
+	default:
+		if 2*local.Sub(truncated) >= increment {
+			rounded = truncated.Add(increment)
+		}
+	}
+	return t.Add(rounded.Sub(local))
+}
+
+// Validate reports settings the API cannot apply.
+func (t Tenant) Validate() error {
+	var errs []error
+	if t.TimeZone != "" {
+		if _, err := time.LoadLocation(t.TimeZone); err != nil {
+			errs = append(errs, fmt.Errorf("time_zone %q is not an IANA time zone", t.TimeZone))
+		}
+	}
+	if t.GeofenceRadiusMeters < 0 {
+		errs = append(errs, errors.New("geofence_radius_meters must not be negative"))
+	}
+	if t.Rounding.IncrementMinutes < 0 || t.Rounding.IncrementMinutes > 60 {
+		errs = append(errs, errors.New("rounding increment_minutes must be between 0 and 60"))
+	}
+	switch t.Rounding.Mode {
+	case "", RoundNearest, RoundUp, RoundDown:
+	default:
+		errs = append(errs, fmt.Errorf("rounding mode %q must be nearest, up or down", t.Rounding.Mode))
+	}
+	return errors.Join(errs...)
+}
+
+// zones caches loaded time zones by name; time.LoadLocation reads the zone
+// database on every call.
+var zones sync.Map
+
+// Location returns the tenant's time zone, or the API's local zone when it has
+// none or an invalid one.
+func (t Tenant) Location() *time.Location {
+	if t.TimeZone == "" {
+		return time.Local
+	}
+	if loc, ok := zones.Load(t.TimeZone); ok {
+		return loc.(*time.Location)
+	}
+	loc, err := time.LoadLocation(t.TimeZone)
+	if err != nil {
+		slog.Warn("Invalid tenant time zone, using the local zone", "tenant", t.ID, "time_zone", t.TimeZone)
+		return time.Local
+	}
+	zones.Store(t.TimeZone, loc)
+	return loc
+}
+
+type contextKey struct{}
+
+// WithTenant scopes ctx to t.
+func WithTenant(ctx context.Context, t Tenant) context.Context {
+	return context.WithValue(ctx, contextKey{}, t)
+}
+
+// WithID scopes ctx to the tenant id without its settings, for writes made on
+// a tenant's behalf outside of its requests.
+func WithID(ctx context.Context, id string) context.Context {
+	return WithTenant(ctx, Tenant{ID: id})
+}
+
+// FromContext returns the tenant ctx is scoped to.
+func FromContext(ctx context.Context) (Tenant, bool) {
+	t, ok := ctx.Value(contextKey{}).(Tenant)
+	return t, ok && t.ID != ""
+}
+
+// ID returns the ID of the tenant ctx is scoped to, or "" if it is not.
+func ID(ctx context.Context) string {
+	t, _ := FromContext(ctx)
+	return t.ID
+}
+
+// Location returns the time zone of the tenant ctx is scoped to, or the API's
+// local zone.
+func Location(ctx context.Context) *time.Location {
+	t, _ := FromContext(ctx)
+	return t.Location()
+}
@@ -0,0 +1,118 @@
+package tenant_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant/tenanttest"
+)
+
+func TestRounding(t *testing.T) {
+	chicago, err := time.LoadLocation("America/Chicago")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+	// Kolkata is UTC+5:30, so rounding in UTC would land on the wrong quarter.
+	kolkata, err := time.LoadLocation("Asia/Kolkata")
+	if err != nil {
+		t.Skip("time zone database not available")
+	}
+
+	cases := []struct {
+		name     string
+		rounding tenant.Rounding
+		in       time.Time
+		want     time.Time
+	}{
+		{"off", tenant.Rounding{}, time.Date(2025, 3, 4, 9, 7, 0, 0, chicago), time.Date(2025, 3, 4, 9, 7, 0, 0, chicago)},
+		{"nearest rounds down under half", tenant.Rounding{IncrementMinutes: 15, Mode: tenant.RoundNearest},
+			time.Date(2025, 3, 4, 9, 7, 29, 0, chicago), time.Date(2025, 3, 4, 9, 0, 0, 0, chicago)},
+		{"nearest rounds up at half", tenant.Rounding{IncrementMinutes: 15},
+			time.Date(2025, 3, 4, 9, 7, 30, 0, chicago), time.Date(2025, 3, 4, 9, 15, 0, 0, chicago)},
+		{"up", tenant.Rounding{IncrementMinutes: 6, Mode: tenant.RoundUp},
+			time.Date(2025, 3, 4, 9, 1, 0, 0, chicago), time.Date(2025, 3, 4, 9, 6, 0, 0, chicago)},
+		{"up keeps exact times", tenant.Rounding{IncrementMinutes: 6, Mode: tenant.RoundUp},
+			time.Date(2025, 3, 4, 9, 12, 0, 0, chicago), time.Date(2025, 3, 4, 9, 12, 0, 0, chicago)},
+		{"down", tenant.Rounding{IncrementMinutes: 15, Mode: tenant.RoundDown},
+			time.Date(2025, 3, 4, 9, 14, 0, 0, chicago), time.Date(2025, 3, 4, 9, 0, 0, 0, chicago)},
+		{"local wall clock", tenant.Rounding{IncrementMinutes: 15, Mode: tenant.RoundDown},
+			time.Date(2025, 3, 4, 9, 14, 0, 0, kolkata), time.Date(2025, 3, 4, 9, 0, 0, 0, kolkata)},
+	}
+	for _, tc := range cases {
+		if got := tc.rounding.Round(tc.in); !got.Equal(tc.want) {
+			t.Errorf("%s: expected %s, got %s", tc.name, tc.want, got)
+		}
+	}
+}
+
+func TestValidate(t *testing.T) {
+	valid := tenant.Tenant{ID: "agency-a", TimeZone: "UTC", GeofenceRadiusMeters: 200, Rounding: tenant.Rounding{IncrementMinutes: 15, Mode: tenant.RoundUp}}
+	if err := valid.Validate(); err != nil {
+		t.Errorf("Expected valid settings, got %v", err)
+	}
+	invalid := tenant.Tenant{ID: "agency-b", TimeZone: "Mars/Olympus", GeofenceRadiusMeters: -1, Rounding: tenant.Rounding{IncrementMinutes: 90, Mode: "sideways"}}
+	if err := invalid.Validate(); err == nil {
+		t.Error("Expected invalid settings to be reported")
+	}
+}
+
+func TestContext(t *testing.T) {
+	if _, ok := tenant.FromContext(context.Background()); ok {
+		t.Error("Expected a bare context to have no tenant")
+	}
+	if _, ok := tenant.FromContext(tenant.WithID(context.Background(), "")); ok {
+		t.Error("Expected an empty tenant ID not to count as a tenant")
+	}
+	ctx := tenant.WithTenant(context.Background(), tenant.Tenant{ID: "agency-a", TimeZone: "UTC"})
+	if tenant.ID(ctx) != "agency-a" || tenant.Location(ctx) != time.UTC {
+		t.Errorf("Expected agency-a in UTC, got %q in %s", tenant.ID(ctx), tenant.Location(ctx))
+	}
+}
+
+func TestEach(t *testing.T) {
+	store := tenanttest.NewStore(tenant.Tenant{ID: "agency-a"}, tenant.Tenant{ID: "agency-b"}, tenant.Tenant{ID: "agency-c"})
+	var seen []string
+	err := tenant.Each(context.Background(), store, func(ctx context.Context) error {
+		seen = append(seen, tenant.ID(ctx))
+		if tenant.ID(ctx) == "agency-b" {
+			return errors.New("boom")
+		}
+		return nil
+	})
+	if len(seen) != 3 {
+		t.Errorf("Expected a failing tenant not to stop the others, ran for %v", seen)
+	}
+	if err == nil || err.Error() != "tenant agency-b: boom" {
+		t.Errorf("Expected agency-b's error, got %v", err)
+	}
+}
+
+// countingStore counts the lookups that reach it.
+type countingStore struct {
+	tenanttest.Store
+	gets int
+}
+
+func (s *countingStore) GetTenant(ctx context.Context, id string) (*tenant.Tenant, error) {
+	s.gets++
+	return s.Store.GetTenant(ctx, id)
+}
+
+func TestCached(t *testing.T) {
+	next := &countingStore{Store: tenanttest.NewStore()}
+	store := tenant.Cached(next, time.Minute)
+	for i := 0; i < 3; i++ {
+		if _, err := store.GetTenant(context.Background(), tenant.DefaultID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.GetTenant(context.Background(), "agency-x"); !errors.Is(err, tenant.ErrUnknown) {
+		t.Errorf("Expected ErrUnknown for an unknown tenant, got %v", err)
+	}
+	if next.gets != 2 {
+		t.Errorf("Expected the default tenant to be read once, got %d lookups", next.gets)
+	}
+}
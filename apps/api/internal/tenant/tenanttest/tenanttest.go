@@ -0,0 +1,34 @@
+// Package tenanttest provides an in-memory tenant store for tests.
+package tenanttest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+)
+
+// Store holds a fixed set of tenants.
+type Store []tenant.Tenant
+
+// NewStore returns a Store of tenants, or of just the default tenant when
+// none are given.
+func NewStore(tenants ...tenant.Tenant) Store {
+	if len(tenants) == 0 {
+		return Store{{ID: tenant.DefaultID, Name: "Default agency"}}
+	}
+	return Store(tenants)
+}
+
+func (s Store) GetTenant(ctx context.Context, id string) (*tenant.Tenant, error) {
+	for _, t := range s {
+		if t.ID == id {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s", tenant.ErrUnknown, id)
+}
+
+func (s Store) ListTenants(ctx context.Context) ([]tenant.Tenant, error) {
+	return append([]tenant.Tenant(nil), s...), nil
+}
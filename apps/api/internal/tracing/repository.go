@@ -0,0 +1,362 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+)
+
+// repositorySpans starts the client spans of one repository.
+type repositorySpans struct {
+	backend string
+}
+
+func (r repositorySpans) start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return start(ctx, name, trace.SpanKindClient,
+		semconv.DBSystemPostgreSQL,
+		attribute.String("evv.repository.backend", r.backend),
+	)
+}
+
+type scheduleRepository struct {
+	repositorySpans
+	next repository.ScheduleRepository
+}
+
+// TraceScheduleRepository starts a client span for every call made to next.
+func TraceScheduleRepository(next repository.ScheduleRepository, backend string) repository.ScheduleRepository {
+	return &scheduleRepository{repositorySpans: repositorySpans{backend: backend}, next: next}
+}
+
+func (r *scheduleRepository) GetSchedules(ctx context.Context, query models.ScheduleListQuery) (schedules []models.Schedule, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.GetSchedules")
+	defer finish(span, &err)
+	return r.next.GetSchedules(ctx, query)
+}
+
+func (r *scheduleRepository) GetTodaySchedules(ctx context.Context) (schedules []models.Schedule, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.GetTodaySchedules")
+	defer finish(span, &err)
+	return r.next.GetTodaySchedules(ctx)
+}
+
+func (r *scheduleRepository) GetScheduleByID(ctx context.Context, id string) (schedule *models.Schedule, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.GetScheduleByID")
+	defer finish(span, &err)
+	return r.next.GetScheduleByID(ctx, id)
+}
+
+func (r *scheduleRepository) CreateSchedule(ctx context.Context, schedule models.Schedule) (created *models.Schedule, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.CreateSchedule")
+	defer finish(span, &err)
+	return r.next.CreateSchedule(ctx, schedule)
+}
+
+func (r *scheduleRepository) ReplacePlannedTasks(ctx context.Context, scheduleID string, tasks []models.Task) (err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.ReplacePlannedTasks")
+	defer finish(span, &err)
+	return r.next.ReplacePlannedTasks(ctx, scheduleID, tasks)
+}
+
+func (r *scheduleRepository) GetTaskByID(ctx context.Context, taskID string) (task *models.Task, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.GetTaskByID")
+	defer finish(span, &err)
+	return r.next.GetTaskByID(ctx, taskID)
+}
+
+func (r *scheduleRepository) StartVisit(ctx context.Context, id string, visitStart time.Time, startLocation models.Location, event events.Event) (err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.StartVisit")
+	defer finish(span, &err)
+	return r.next.StartVisit(ctx, id, visitStart, startLocation, event)
+}
+
+func (r *scheduleRepository) EndVisit(ctx context.Context, id string, visitEnd time.Time, endLocation models.Location, event events.Event) (err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.EndVisit")
+	defer finish(span, &err)
+	return r.next.EndVisit(ctx, id, visitEnd, endLocation, event)
+}
+
+func (r *scheduleRepository) UpdateTaskStatuses(ctx context.Context, tasks []models.Task, taskEvents []events.Event) (err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.UpdateTaskStatuses")
+	defer finish(span, &err)
+	return r.next.UpdateTaskStatuses(ctx, tasks, taskEvents)
+}
+
+func (r *scheduleRepository) AddTask(ctx context.Context, task models.Task, event events.Event) (added *models.Task, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.AddTask")
+	defer finish(span, &err)
+	return r.next.AddTask(ctx, task, event)
+}
+
+func (r *scheduleRepository) RecordMissedVisit(ctx context.Context, id string, event events.Event) (recorded bool, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.RecordMissedVisit")
+	defer finish(span, &err)
+	return r.next.RecordMissedVisit(ctx, id, event)
+}
+
+func (r *scheduleRepository) ResetSampleData(ctx context.Context) (err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.ResetSampleData")
+	defer finish(span, &err)
+	return r.next.ResetSampleData(ctx)
+}
+
+func (r *scheduleRepository) GetScheduleStats(ctx context.Context, query models.StatsQuery) (stats *models.ScheduleStats, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.GetScheduleStats")
+	defer finish(span, &err)
+	return r.next.GetScheduleStats(ctx, query)
+}
+
+func (r *scheduleRepository) RefreshDailyStats(ctx context.Context, from, to time.Time) (refreshed int, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.RefreshDailyStats")
+	defer finish(span, &err)
+	return r.next.RefreshDailyStats(ctx, from, to)
+}
+
+func (r *scheduleRepository) GetUnscrubbedVisits(ctx context.Context, query models.LocationScrubQuery) (schedules []models.Schedule, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.GetUnscrubbedVisits")
+	defer finish(span, &err)
+	return r.next.GetUnscrubbedVisits(ctx, query)
+}
+
+func (r *scheduleRepository) ScrubVisitLocations(ctx context.Context, scrub models.LocationScrub) (applied bool, err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.ScrubVisitLocations")
+	defer finish(span, &err)
+	return r.next.ScrubVisitLocations(ctx, scrub)
+}
+
+func (r *scheduleRepository) Ping(ctx context.Context) (err error) {
+	ctx, span := r.start(ctx, "ScheduleRepository.Ping")
+	defer finish(span, &err)
+	return r.next.Ping(ctx)
+}
+
+type carePlanRepository struct {
+	repositorySpans
+	next repository.CarePlanRepository
+}
+
+// TraceCarePlanRepository starts a client span for every call made to next.
+func TraceCarePlanRepository(next repository.CarePlanRepository, backend string) repository.CarePlanRepository {
+	return &carePlanRepository{repositorySpans: repositorySpans{backend: backend}, next: next}
+}
+
+func (r *carePlanRepository) CreateCarePlan(ctx context.Context, plan models.CarePlan) (created *models.CarePlan, err error) {
+	ctx, span := r.start(ctx, "CarePlanRepository.CreateCarePlan")
+	defer finish(span, &err)
+	return r.next.CreateCarePlan(ctx, plan)
+}
+
+func (r *carePlanRepository) GetCarePlanByID(ctx context.Context, id string) (plan *models.CarePlan, err error) {
+	ctx, span := r.start(ctx, "CarePlanRepository.GetCarePlanByID")
+	defer finish(span, &err)
+	return r.next.GetCarePlanByID(ctx, id)
+}
+
+func (r *carePlanRepository) GetActiveCarePlan(ctx context.Context, clientID string) (plan *models.CarePlan, err error) {
+	ctx, span := r.start(ctx, "CarePlanRepository.GetActiveCarePlan")
+	defer finish(span, &err)
+	return r.next.GetActiveCarePlan(ctx, clientID)
+}
+
+func (r *carePlanRepository) ReplaceTemplates(ctx context.Context, planID string, templates []models.TaskTemplate, updatedAt time.Time) (err error) {
+	ctx, span := r.start(ctx, "CarePlanRepository.ReplaceTemplates")
+	defer finish(span, &err)
+	return r.next.ReplaceTemplates(ctx, planID, templates, updatedAt)
+}
+
+type webhookRepository struct {
+	repositorySpans
+	next repository.WebhookRepository
+}
+
+// TraceWebhookRepository starts a client span for every call made to next.
+func TraceWebhookRepository(next repository.WebhookRepository, backend string) repository.WebhookRepository {
+	return &webhookRepository{repositorySpans: repositorySpans{backend: backend}, next: next}
+}
+
+func (r *webhookRepository) CreateSubscription(ctx context.Context, subscription models.WebhookSubscription) (created *models.WebhookSubscription, err error) {
+	ctx, span := r.start(ctx, "WebhookRepository.CreateSubscription")
+	defer finish(span, &err)
+	return r.next.CreateSubscription(ctx, subscription)
+}
+
+func (r *webhookRepository) GetSubscriptions(ctx context.Context) (subscriptions []models.WebhookSubscription, err error) {
+	ctx, span := r.start(ctx, "WebhookRepository.GetSubscriptions")
+	defer finish(span, &err)
+	return r.next.GetSubscriptions(ctx)
+}
+
+func (r *webhookRepository) DeleteSubscription(ctx context.Context, id string) (err error) {
+	ctx, span := r.start(ctx, "WebhookRepository.DeleteSubscription")
+	defer finish(span, &err)
+	return r.next.DeleteSubscription(ctx, id)
+}
+
+func (r *webhookRepository) ClaimDueDeliveries(ctx context.Context, limit int, lease time.Duration) (deliveries []models.WebhookDelivery, err error) {
+	ctx, span := r.start(ctx, "WebhookRepository.ClaimDueDeliveries")
+	defer finish(span, &err)
+	return r.next.ClaimDueDeliveries(ctx, limit, lease)
+}
+
+func (r *webhookRepository) GetDeliveriesByStatus(ctx context.Context, status string) (deliveries []models.WebhookDelivery, err error) {
+	ctx, span := r.start(ctx, "WebhookRepository.GetDeliveriesByStatus")
+	defer finish(span, &err)
+	return r.next.GetDeliveriesByStatus(ctx, status)
+}
+
+func (r *webhookRepository) GetDeliveryByID(ctx context.Context, id string) (delivery *models.WebhookDelivery, err error) {
+	ctx, span := r.start(ctx, "WebhookRepository.GetDeliveryByID")
+	defer finish(span, &err)
+	return r.next.GetDeliveryByID(ctx, id)
+}
+
+func (r *webhookRepository) UpdateDelivery(ctx context.Context, delivery models.WebhookDelivery) (err error) {
+	ctx, span := r.start(ctx, "WebhookRepository.UpdateDelivery")
+	defer finish(span, &err)
+	return r.next.UpdateDelivery(ctx, delivery)
+}
+
+type retentionRepository struct {
+	repositorySpans
+	next repository.RetentionRepository
+}
+
+// TraceRetentionRepository starts a client span for every call made to next.
+func TraceRetentionRepository(next repository.RetentionRepository, backend string) repository.RetentionRepository {
+	return &retentionRepository{repositorySpans: repositorySpans{backend: backend}, next: next}
+}
+
+func (r *retentionRepository) Purge(ctx context.Context, policy models.RetentionPolicy, cutoff time.Time, limit int, dryRun bool) (affected int, err error) {
+	ctx, span := r.start(ctx, "RetentionRepository.Purge")
+	defer finish(span, &err)
+	return r.next.Purge(ctx, policy, cutoff, limit, dryRun)
+}
+
+func (r *retentionRepository) GetLegalHolds(ctx context.Context) (holds []models.LegalHold, err error) {
+	ctx, span := r.start(ctx, "RetentionRepository.GetLegalHolds")
+	defer finish(span, &err)
+	return r.next.GetLegalHolds(ctx)
+}
+
+func (r *retentionRepository) PlaceLegalHold(ctx context.Context, hold models.LegalHold) (placed *models.LegalHold, err error) {
+	ctx, span := r.start(ctx, "RetentionRepository.PlaceLegalHold")
+	defer finish(span, &err)
+	return r.next.PlaceLegalHold(ctx, hold)
+}
+
+func (r *retentionRepository) ReleaseLegalHold(ctx context.Context, clientID string) (err error) {
+	ctx, span := r.start(ctx, "RetentionRepository.ReleaseLegalHold")
+	defer finish(span, &err)
+	return r.next.ReleaseLegalHold(ctx, clientID)
+}
+
+type branchRepository struct {
+	repositorySpans
+	next repository.BranchRepository
+}
+
+// TraceBranchRepository starts a client span for every call made to next.
+func TraceBranchRepository(next repository.BranchRepository, backend string) repository.BranchRepository {
+	return &branchRepository{repositorySpans: repositorySpans{backend: backend}, next: next}
+}
+
+func (r *branchRepository) GetRegions(ctx context.Context) (regions []models.Region, err error) {
+	ctx, span := r.start(ctx, "BranchRepository.GetRegions")
+	defer finish(span, &err)
+	return r.next.GetRegions(ctx)
+}
+
+func (r *branchRepository) CreateRegion(ctx context.Context, region models.Region) (created *models.Region, err error) {
+	ctx, span := r.start(ctx, "BranchRepository.CreateRegion")
+	defer finish(span, &err)
+	return r.next.CreateRegion(ctx, region)
+}
+
+func (r *branchRepository) GetBranches(ctx context.Context, regionID string) (branches []models.Branch, err error) {
+	ctx, span := r.start(ctx, "BranchRepository.GetBranches")
+	defer finish(span, &err)
+	return r.next.GetBranches(ctx, regionID)
+}
+
+func (r *branchRepository) GetBranchByID(ctx context.Context, id string) (branch *models.Branch, err error) {
+	ctx, span := r.start(ctx, "BranchRepository.GetBranchByID")
+	defer finish(span, &err)
+	return r.next.GetBranchByID(ctx, id)
+}
+
+func (r *branchRepository) CreateBranch(ctx context.Context, branch models.Branch) (created *models.Branch, err error) {
+	ctx, span := r.start(ctx, "BranchRepository.CreateBranch")
+	defer finish(span, &err)
+	return r.next.CreateBranch(ctx, branch)
+}
+
+func (r *branchRepository) AssignMember(ctx context.Context, branchID, kind, memberID string) (err error) {
+	ctx, span := r.start(ctx, "BranchRepository.AssignMember")
+	defer finish(span, &err)
+	return r.next.AssignMember(ctx, branchID, kind, memberID)
+}
+
+func (r *branchRepository) UnassignMember(ctx context.Context, branchID, kind, memberID string) (err error) {
+	ctx, span := r.start(ctx, "BranchRepository.UnassignMember")
+	defer finish(span, &err)
+	return r.next.UnassignMember(ctx, branchID, kind, memberID)
+}
+
+func (r *branchRepository) SupervisedBranchIDs(ctx context.Context, userID string) (ids []string, err error) {
+	ctx, span := r.start(ctx, "BranchRepository.SupervisedBranchIDs")
+	defer finish(span, &err)
+	return r.next.SupervisedBranchIDs(ctx, userID)
+}
+
+func (r *branchRepository) ClientBranchID(ctx context.Context, clientID string) (id string, err error) {
+	ctx, span := r.start(ctx, "BranchRepository.ClientBranchID")
+	defer finish(span, &err)
+	return r.next.ClientBranchID(ctx, clientID)
+}
+
+type apiKeyRepository struct {
+	repositorySpans
+	next repository.APIKeyRepository
+}
+
+// TraceAPIKeyRepository starts a client span for every call made to next.
+func TraceAPIKeyRepository(next repository.APIKeyRepository, backend string) repository.APIKeyRepository {
+	return &apiKeyRepository{repositorySpans: repositorySpans{backend: backend}, next: next}
+}
+
+func (r *apiKeyRepository) GetAPIKeys(ctx context.Context) (keys []models.APIKey, err error) {
+	ctx, span := r.start(ctx, "APIKeyRepository.GetAPIKeys")
+	defer finish(span, &err)
+	return r.next.GetAPIKeys(ctx)
+}
+
+func (r *apiKeyRepository) CreateAPIKey(ctx context.Context, key models.APIKey) (created *models.APIKey, err error) {
+	ctx, span := r.start(ctx, "APIKeyRepository.CreateAPIKey")
+	defer finish(span, &err)
+	return r.next.CreateAPIKey(ctx, key)
+}
+
+func (r *apiKeyRepository) RevokeAPIKey(ctx context.Context, id string, revokedAt time.Time) (err error) {
+	ctx, span := r.start(ctx, "APIKeyRepository.RevokeAPIKey")
+	defer finish(span, &err)
+	return r.next.RevokeAPIKey(ctx, id, revokedAt)
+}
+
+func (r *apiKeyRepository) APIKeyByHash(ctx context.Context, hash string) (key *models.APIKey, err error) {
+	ctx, span := r.start(ctx, "APIKeyRepository.APIKeyByHash")
+	defer finish(span, &err)
+	return r.next.APIKeyByHash(ctx, hash)
+}
+
+func (r *apiKeyRepository) TouchAPIKey(ctx context.Context, id string, usedAt time.Time) (err error) {
+	ctx, span := r.start(ctx, "APIKeyRepository.TouchAPIKey")
+	defer finish(span, &err)
+	return r.next.TouchAPIKey(ctx, id, usedAt)
+}
@@ -0,0 +1,319 @@
+package tracing
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+)
+
+// serviceSpans starts the internal spans of one service.
+type serviceSpans struct{}
+
+func (serviceSpans) start(ctx context.Context, name string) (context.Context, trace.Span) {
+	return start(ctx, name, trace.SpanKindInternal)
+}
+
+type scheduleService struct {
+	serviceSpans
+	next service.ScheduleService
+}
+
+// TraceScheduleService starts a span for every call made to next.
+func TraceScheduleService(next service.ScheduleService) service.ScheduleService {
+	return &scheduleService{next: next}
+}
+
+func (s *scheduleService) GetSchedules(ctx context.Context, query models.ScheduleListQuery) (page *models.SchedulePage, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.GetSchedules")
+	defer finish(span, &err)
+	return s.next.GetSchedules(ctx, query)
+}
+
+func (s *scheduleService) GetTodaySchedules(ctx context.Context) (schedules []models.Schedule, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.GetTodaySchedules")
+	defer finish(span, &err)
+	return s.next.GetTodaySchedules(ctx)
+}
+
+func (s *scheduleService) GetScheduleByID(ctx context.Context, id string) (schedule *models.Schedule, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.GetScheduleByID")
+	defer finish(span, &err)
+	return s.next.GetScheduleByID(ctx, id)
+}
+
+func (s *scheduleService) CreateSchedule(ctx context.Context, schedule models.Schedule) (created *models.Schedule, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.CreateSchedule")
+	defer finish(span, &err)
+	return s.next.CreateSchedule(ctx, schedule)
+}
+
+func (s *scheduleService) StartVisit(ctx context.Context, id string, latitude, longitude float64, address string) (err error) {
+	ctx, span := s.start(ctx, "ScheduleService.StartVisit")
+	defer finish(span, &err)
+	return s.next.StartVisit(ctx, id, latitude, longitude, address)
+}
+
+func (s *scheduleService) EndVisit(ctx context.Context, id string, latitude, longitude float64, address string) (err error) {
+	ctx, span := s.start(ctx, "ScheduleService.EndVisit")
+	defer finish(span, &err)
+	return s.next.EndVisit(ctx, id, latitude, longitude, address)
+}
+
+func (s *scheduleService) UpdateTaskStatus(ctx context.Context, taskID string, update models.TaskUpdate) (err error) {
+	ctx, span := s.start(ctx, "ScheduleService.UpdateTaskStatus")
+	defer finish(span, &err)
+	return s.next.UpdateTaskStatus(ctx, taskID, update)
+}
+
+func (s *scheduleService) UpdateTaskStatuses(ctx context.Context, scheduleID string, updates []models.TaskUpdate) (tasks []models.Task, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.UpdateTaskStatuses")
+	defer finish(span, &err)
+	return s.next.UpdateTaskStatuses(ctx, scheduleID, updates)
+}
+
+func (s *scheduleService) AddAdHocTask(ctx context.Context, scheduleID string, task models.Task) (added *models.Task, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.AddAdHocTask")
+	defer finish(span, &err)
+	return s.next.AddAdHocTask(ctx, scheduleID, task)
+}
+
+func (s *scheduleService) ResetSampleData(ctx context.Context) (err error) {
+	ctx, span := s.start(ctx, "ScheduleService.ResetSampleData")
+	defer finish(span, &err)
+	return s.next.ResetSampleData(ctx)
+}
+
+func (s *scheduleService) GetScheduleStats(ctx context.Context, query models.StatsQuery) (stats *models.ScheduleStats, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.GetScheduleStats")
+	defer finish(span, &err)
+	return s.next.GetScheduleStats(ctx, query)
+}
+
+func (s *scheduleService) RefreshDailyStats(ctx context.Context, from, to time.Time) (refreshed int, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.RefreshDailyStats")
+	defer finish(span, &err)
+	return s.next.RefreshDailyStats(ctx, from, to)
+}
+
+func (s *scheduleService) DetectMissedVisits(ctx context.Context, since, until time.Time) (missed int, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.DetectMissedVisits")
+	defer finish(span, &err)
+	return s.next.DetectMissedVisits(ctx, since, until)
+}
+
+func (s *scheduleService) CountMissedVisitsToday(ctx context.Context) (missed int, err error) {
+	ctx, span := s.start(ctx, "ScheduleService.CountMissedVisitsToday")
+	defer finish(span, &err)
+	return s.next.CountMissedVisitsToday(ctx)
+}
+
+type carePlanService struct {
+	serviceSpans
+	next service.CarePlanService
+}
+
+// TraceCarePlanService starts a span for every call made to next, including
+// the task planning the schedule service asks it for.
+func TraceCarePlanService(next service.CarePlanService) service.CarePlanService {
+	return &carePlanService{next: next}
+}
+
+func (s *carePlanService) PlanTasks(ctx context.Context, schedule models.Schedule) (tasks []models.Task, err error) {
+	ctx, span := s.start(ctx, "CarePlanService.PlanTasks")
+	defer finish(span, &err)
+	return s.next.PlanTasks(ctx, schedule)
+}
+
+func (s *carePlanService) CreateCarePlan(ctx context.Context, plan models.CarePlan) (created *models.CarePlan, err error) {
+	ctx, span := s.start(ctx, "CarePlanService.CreateCarePlan")
+	defer finish(span, &err)
+	return s.next.CreateCarePlan(ctx, plan)
+}
+
+func (s *carePlanService) GetCarePlan(ctx context.Context, id string) (plan *models.CarePlan, err error) {
+	ctx, span := s.start(ctx, "CarePlanService.GetCarePlan")
+	defer finish(span, &err)
+	return s.next.GetCarePlan(ctx, id)
+}
+
+func (s *carePlanService) GetActiveCarePlan(ctx context.Context, clientID string) (plan *models.CarePlan, err error) {
+	ctx, span := s.start(ctx, "CarePlanService.GetActiveCarePlan")
+	defer finish(span, &err)
+	return s.next.GetActiveCarePlan(ctx, clientID)
+}
+
+func (s *carePlanService) ReplaceTemplates(ctx context.Context, id string, templates []models.TaskTemplate) (plan *models.CarePlan, err error) {
+	ctx, span := s.start(ctx, "CarePlanService.ReplaceTemplates")
+	defer finish(span, &err)
+	return s.next.ReplaceTemplates(ctx, id, templates)
+}
+
+type webhookService struct {
+	serviceSpans
+	next service.WebhookService
+}
+
+// TraceWebhookService starts a span for every call made to next.
+func TraceWebhookService(next service.WebhookService) service.WebhookService {
+	return &webhookService{next: next}
+}
+
+func (s *webhookService) CreateSubscription(ctx context.Context, targetURL string, eventTypes, branchIDs []string, secret string) (subscription *models.WebhookSubscription, err error) {
+	ctx, span := s.start(ctx, "WebhookService.CreateSubscription")
+	defer finish(span, &err)
+	return s.next.CreateSubscription(ctx, targetURL, eventTypes, branchIDs, secret)
+}
+
+func (s *webhookService) GetSubscriptions(ctx context.Context) (subscriptions []models.WebhookSubscription, err error) {
+	ctx, span := s.start(ctx, "WebhookService.GetSubscriptions")
+	defer finish(span, &err)
+	return s.next.GetSubscriptions(ctx)
+}
+
+func (s *webhookService) DeleteSubscription(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "WebhookService.DeleteSubscription")
+	defer finish(span, &err)
+	return s.next.DeleteSubscription(ctx, id)
+}
+
+func (s *webhookService) GetDeadLetters(ctx context.Context) (deliveries []models.WebhookDelivery, err error) {
+	ctx, span := s.start(ctx, "WebhookService.GetDeadLetters")
+	defer finish(span, &err)
+	return s.next.GetDeadLetters(ctx)
+}
+
+func (s *webhookService) RetryDelivery(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "WebhookService.RetryDelivery")
+	defer finish(span, &err)
+	return s.next.RetryDelivery(ctx, id)
+}
+
+func (s *webhookService) ProcessDueDeliveries(ctx context.Context) (processed int, err error) {
+	ctx, span := s.start(ctx, "WebhookService.ProcessDueDeliveries")
+	defer finish(span, &err)
+	return s.next.ProcessDueDeliveries(ctx)
+}
+
+type retentionService struct {
+	serviceSpans
+	next service.RetentionService
+}
+
+// TraceRetentionService starts a span for every call made to next.
+func TraceRetentionService(next service.RetentionService) service.RetentionService {
+	return &retentionService{next: next}
+}
+
+func (s *retentionService) Purge(ctx context.Context, dryRun bool) (report *models.RetentionReport, err error) {
+	ctx, span := s.start(ctx, "RetentionService.Purge")
+	defer finish(span, &err)
+	return s.next.Purge(ctx, dryRun)
+}
+
+func (s *retentionService) GetLegalHolds(ctx context.Context) (holds []models.LegalHold, err error) {
+	ctx, span := s.start(ctx, "RetentionService.GetLegalHolds")
+	defer finish(span, &err)
+	return s.next.GetLegalHolds(ctx)
+}
+
+func (s *retentionService) PlaceLegalHold(ctx context.Context, clientID, reason string) (hold *models.LegalHold, err error) {
+	ctx, span := s.start(ctx, "RetentionService.PlaceLegalHold")
+	defer finish(span, &err)
+	return s.next.PlaceLegalHold(ctx, clientID, reason)
+}
+
+func (s *retentionService) ReleaseLegalHold(ctx context.Context, clientID string) (err error) {
+	ctx, span := s.start(ctx, "RetentionService.ReleaseLegalHold")
+	defer finish(span, &err)
+	return s.next.ReleaseLegalHold(ctx, clientID)
+}
+
+func (s *retentionService) ScrubLocations(ctx context.Context) (report *models.LocationScrubReport, err error) {
+	ctx, span := s.start(ctx, "RetentionService.ScrubLocations")
+	defer finish(span, &err)
+	return s.next.ScrubLocations(ctx)
+}
+
+type branchService struct {
+	serviceSpans
+	next service.BranchService
+}
+
+// TraceBranchService starts a span for every call made to next.
+func TraceBranchService(next service.BranchService) service.BranchService {
+	return &branchService{next: next}
+}
+
+func (s *branchService) GetRegions(ctx context.Context) (regions []models.Region, err error) {
+	ctx, span := s.start(ctx, "BranchService.GetRegions")
+	defer finish(span, &err)
+	return s.next.GetRegions(ctx)
+}
+
+func (s *branchService) CreateRegion(ctx context.Context, name string) (region *models.Region, err error) {
+	ctx, span := s.start(ctx, "BranchService.CreateRegion")
+	defer finish(span, &err)
+	return s.next.CreateRegion(ctx, name)
+}
+
+func (s *branchService) GetBranches(ctx context.Context, regionID string) (branches []models.Branch, err error) {
+	ctx, span := s.start(ctx, "BranchService.GetBranches")
+	defer finish(span, &err)
+	return s.next.GetBranches(ctx, regionID)
+}
+
+func (s *branchService) GetBranch(ctx context.Context, id string) (branch *models.Branch, err error) {
+	ctx, span := s.start(ctx, "BranchService.GetBranch")
+	defer finish(span, &err)
+	return s.next.GetBranch(ctx, id)
+}
+
+func (s *branchService) CreateBranch(ctx context.Context, name string, regionID *string) (branch *models.Branch, err error) {
+	ctx, span := s.start(ctx, "BranchService.CreateBranch")
+	defer finish(span, &err)
+	return s.next.CreateBranch(ctx, name, regionID)
+}
+
+func (s *branchService) AssignMember(ctx context.Context, branchID, kind, memberID string) (err error) {
+	ctx, span := s.start(ctx, "BranchService.AssignMember")
+	defer finish(span, &err)
+	return s.next.AssignMember(ctx, branchID, kind, memberID)
+}
+
+func (s *branchService) UnassignMember(ctx context.Context, branchID, kind, memberID string) (err error) {
+	ctx, span := s.start(ctx, "BranchService.UnassignMember")
+	defer finish(span, &err)
+	return s.next.UnassignMember(ctx, branchID, kind, memberID)
+}
+
+type apiKeyService struct {
+	serviceSpans
+	next service.APIKeyService
+}
+
+// TraceAPIKeyService starts a span for every call made to next.
+func TraceAPIKeyService(next service.APIKeyService) service.APIKeyService {
+	return &apiKeyService{next: next}
+}
+
+func (s *apiKeyService) GetAPIKeys(ctx context.Context) (keys []models.APIKey, err error) {
+	ctx, span := s.start(ctx, "APIKeyService.GetAPIKeys")
+	defer finish(span, &err)
+	return s.next.GetAPIKeys(ctx)
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, key models.APIKey) (created *models.APIKey, err error) {
+	ctx, span := s.start(ctx, "APIKeyService.CreateAPIKey")
+	defer finish(span, &err)
+	return s.next.CreateAPIKey(ctx, key)
+}
+
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, id string) (err error) {
+	ctx, span := s.start(ctx, "APIKeyService.RevokeAPIKey")
+	defer finish(span, &err)
+	return s.next.RevokeAPIKey(ctx, id)
+}
@@ -0,0 +1,97 @@
+// Package tracing sets up OpenTelemetry tracing and wraps the services and
+// repositories so that each call gets a span. Together with the HTTP span
+// started by the server, a request's trace shows where its time goes.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// InstrumentationName names the tracer the API's spans are created with.
+const InstrumentationName = "github.com/forddyce/mini-evv-logger/apps/api"
+
+// ServiceName is reported unless OTEL_SERVICE_NAME says otherwise.
+const ServiceName = "evv-logger-api"
+
+// Exporters accepted by Setup, named as in OTEL_TRACES_EXPORTER.
+const (
+	ExporterNone    = "none"
+	ExporterConsole = "console"
+	ExporterOTLP    = "otlp"
+)
+
+// Setup installs W3C trace context propagation and, unless exporter is "none"
+// or empty, a global tracer provider that sends spans to stdout ("console") or
+// over OTLP/HTTP ("otlp", configured by the standard OTEL_EXPORTER_OTLP_*
+// variables). The returned function flushes and stops the provider.
+func Setup(ctx context.Context, exporter string) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	var spanExporter sdktrace.SpanExporter
+	var err error
+	switch exporter {
+	case "", ExporterNone:
+		return func(context.Context) error { return nil }, nil
+	case ExporterConsole:
+		spanExporter, err = stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+	case ExporterOTLP:
+		spanExporter, err = otlptracehttp.New(ctx)
+	default:
+		return nil, fmt.Errorf("tracing: unsupported exporter %q", exporter)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("tracing: failed to create %s exporter: %w", exporter, err)
+	}
+
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName(ServiceName)),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("tracing: failed to build resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(res),
+	)
+	otel.SetTracerProvider(provider)
+	return provider.Shutdown, nil
+}
+
+// Tracer returns the API's tracer from the global provider.
+func Tracer() trace.Tracer {
+	return otel.Tracer(InstrumentationName)
+}
+
+// start begins a span for one service or repository call.
+func start(ctx context.Context, name string, kind trace.SpanKind, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+}
+
+// finish is deferred with a pointer to the call's error, which it records on
+// the span before ending it.
+func finish(span trace.Span, err *error) {
+	if *err != nil {
+		span.RecordError(*err)
+		span.SetStatus(codes.Error, (*err).Error())
+	}
+	span.End()
+}
@@ -0,0 +1,88 @@
+package tracing_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/models"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tracing"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tracing/tracingtest"
+)
+
+// carePlanRepo answers lookups with plan, or fails them with err.
+type carePlanRepo struct {
+	repository.CarePlanRepository
+	plan *models.CarePlan
+	err  error
+}
+
+func (r carePlanRepo) GetCarePlanByID(ctx context.Context, id string) (*models.CarePlan, error) {
+	return r.plan, r.err
+}
+
+func tracedCarePlanService(repo carePlanRepo) service.CarePlanService {
+	return tracing.TraceCarePlanService(service.NewCarePlanService(
+		tracing.TraceCarePlanRepository(repo, "fake"),
+		nil, nil,
+	))
+}
+
+func TestSpansNestFromServiceToRepository(t *testing.T) {
+	recorder := tracingtest.Install(t)
+
+	svc := tracedCarePlanService(carePlanRepo{plan: &models.CarePlan{ID: "plan-1"}})
+	if _, err := svc.GetCarePlan(context.Background(), "plan-1"); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	want := "CarePlanService.GetCarePlan\n" +
+		"  CarePlanRepository.GetCarePlanByID\n"
+	if got := recorder.Tree(); got != want {
+		t.Errorf("Expected span tree\n%s\ngot\n%s", want, got)
+	}
+
+	for _, span := range recorder.Ended() {
+		if span.Name() == "CarePlanRepository.GetCarePlanByID" && span.SpanKind() != trace.SpanKindClient {
+			t.Errorf("Expected the repository span to be a client span, got %v", span.SpanKind())
+		}
+	}
+}
+
+func TestSpansRecordErrors(t *testing.T) {
+	recorder := tracingtest.Install(t)
+
+	svc := tracedCarePlanService(carePlanRepo{err: errors.New("connection refused")})
+	if _, err := svc.GetCarePlan(context.Background(), "plan-1"); err == nil {
+		t.Fatal("Expected an error")
+	}
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(spans))
+	}
+	for _, span := range spans {
+		if span.Status().Code != codes.Error || len(span.Events()) == 0 {
+			t.Errorf("Expected %s to record the error, got status %v", span.Name(), span.Status())
+		}
+	}
+}
+
+func TestSetupRejectsUnknownExporter(t *testing.T) {
+	if _, err := tracing.Setup(context.Background(), "zipkin"); err == nil {
+		t.Error("Expected an error for an unsupported exporter")
+	}
+
+	shutdown, err := tracing.Setup(context.Background(), tracing.ExporterNone)
+	if err != nil {
+		t.Fatalf("Expected tracing to be disabled without error, got %v", err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Errorf("Expected shutdown to succeed, got %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+// Package tracingtest records spans in memory so tests can assert the shape
+// of a trace.
+package tracingtest
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Recorder collects the spans ended while it is installed.
+type Recorder struct {
+	*tracetest.SpanRecorder
+}
+
+// Install makes a recording tracer provider the global one until the test
+// ends. Tests using it must not run in parallel.
+func Install(t testing.TB) *Recorder {
+	t.Helper()
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+	t.Cleanup(func() {
+		otel.SetTracerProvider(previous)
+		provider.Shutdown(context.Background())
+	})
+	return &Recorder{SpanRecorder: recorder}
+}
+
+// Tree renders the ended spans as an indented tree, children in start order,
+// one span name per line:
+//
+//	GET /api/schedules
+//	  ScheduleService.GetSchedules
+//	    ScheduleRepository.GetSchedules
+func (r *Recorder) Tree() string {
+	spans := r.Ended()
+	sort.SliceStable(spans, func(i, j int) bool {
+		return spans[i].StartTime().Before(spans[j].StartTime())
+	})
+
+	known := make(map[trace.SpanID]bool, len(spans))
+	for _, span := range spans {
+		known[span.SpanContext().SpanID()] = true
+	}
+	children := make(map[trace.SpanID][]sdktrace.ReadOnlySpan)
+	var roots []sdktrace.ReadOnlySpan
+	for _, span := range spans {
+		if parent := span.Parent().SpanID(); known[parent] {
+			children[parent] = append(children[parent], span)
+		} else {
+			roots = append(roots, span)
+		}
+	}
+
+	var b strings.Builder
+	var write func(span sdktrace.ReadOnlySpan, depth int)
+	write = func(span sdktrace.ReadOnlySpan, depth int) {
+		b.WriteString(strings.Repeat("  ", depth))
+		b.WriteString(span.Name())
+		b.WriteString("\n")
+		for _, child := range children[span.SpanContext().SpanID()] {
+			write(child, depth+1)
+		}
+	}
+	for _, root := range roots {
+		write(root, 0)
+	}
+	return b.String()
+}
@@ -0,0 +1,60 @@
+package webhook
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	HeaderEvent     = "X-EVV-Event"
+	HeaderDelivery  = "X-EVV-Delivery"
+	HeaderTimestamp = "X-EVV-Timestamp"
+	HeaderSignature = "X-EVV-Signature"
+
+	signaturePrefix = "sha256="
+)
+
+// Sign returns the X-EVV-Signature value for a payload. The timestamp is part of
+// the signed message so receivers can reject replayed deliveries.
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp.Unix(), 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return signaturePrefix + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a delivery received with the given timestamp and signature headers.
+// A zero tolerance disables the timestamp freshness check.
+func Verify(secret, timestampHeader, signatureHeader string, body []byte, tolerance time.Duration) error {
+	unix, err := strconv.ParseInt(timestampHeader, 10, 64)
+	if err != nil {
+		return fmt.Errorf("webhook: invalid timestamp %q", timestampHeader)
+	}
+	timestamp := time.Unix(unix, 0)
+
+	if tolerance > 0 {
+		age := time.Since(timestamp)
+		if age < 0 {
+			age = -age
+		}
+		if age > tolerance {
+			return fmt.Errorf("webhook: timestamp outside tolerance of %s", tolerance)
+		}
+	}
+
+	if !strings.HasPrefix(signatureHeader, signaturePrefix) {
+		return fmt.Errorf("webhook: unsupported signature format")
+	}
+
+	expected := Sign(secret, timestamp, body)
+	if !hmac.Equal([]byte(expected), []byte(signatureHeader)) {
+		return fmt.Errorf("webhook: signature mismatch")
+	}
+	return nil
+}
@@ -0,0 +1,30 @@
+-- API keys of other systems, such as payroll and billing, that call the API
+-- without a user login. Only a SHA-256 hash of each key is stored; the key is
+-- shown once, when it is created. The API looks keys up by hash before it
+-- knows the tenant, so it filters this table on tenant_id itself rather than
+-- through the tenant scoping of the other tables.
+CREATE TABLE IF NOT EXISTS public.api_keys (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id text NOT NULL REFERENCES public.tenants(id),
+    name text NOT NULL,
+    prefix text NOT NULL,                               -- First characters of the key, to tell keys apart
+    key_hash text NOT NULL UNIQUE,
+    scopes text[] NOT NULL,
+    rate_limit_per_minute integer NOT NULL DEFAULT 0,   -- 0 means the API's API_KEY_RATE_LIMIT
+    expires_at timestamptz,                             -- NULL never expires
+    last_used_at timestamptz,
+    revoked_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CHECK (scopes <@ ARRAY['read:schedules', 'write:visits', 'export:billing']::text[] AND cardinality(scopes) > 0),
+    CHECK (rate_limit_per_minute >= 0)
+);
+
+CREATE INDEX IF NOT EXISTS api_keys_tenant_created_at_idx ON public.api_keys (tenant_id, created_at);
+
+DROP TRIGGER IF EXISTS api_keys_tenant_id_immutable ON public.api_keys;
+CREATE TRIGGER api_keys_tenant_id_immutable BEFORE UPDATE OF tenant_id ON public.api_keys
+    FOR EACH ROW EXECUTE FUNCTION public.tenant_id_immutable();
+
+-- No public policies: only the service role (which bypasses RLS) may read or
+-- write keys.
+ALTER TABLE public.api_keys ENABLE ROW LEVEL SECURITY;
@@ -0,0 +1,319 @@
+-- Branch offices and service regions. Each client belongs to at most one
+-- branch, and its visits belong to that branch: schedules.branch_id is kept in
+-- sync with client_branches by the triggers below, so that listings and
+-- statistics can filter on it. Caregivers and supervisors (Supabase user IDs)
+-- can be assigned to several branches. The API limits supervisors to the
+-- branches in branch_supervisors.
+CREATE TABLE IF NOT EXISTS public.regions (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id),
+    name text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (tenant_id, id)
+);
+
+CREATE TABLE IF NOT EXISTS public.branches (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id),
+    region_id uuid,
+    name text NOT NULL,
+    created_at timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (tenant_id, id),
+    FOREIGN KEY (tenant_id, region_id) REFERENCES public.regions (tenant_id, id)
+);
+
+CREATE INDEX IF NOT EXISTS branches_tenant_region_idx ON public.branches (tenant_id, region_id);
+
+CREATE TABLE IF NOT EXISTS public.client_branches (
+    tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id),
+    client_id text NOT NULL,
+    branch_id uuid NOT NULL,
+    PRIMARY KEY (tenant_id, client_id),
+    FOREIGN KEY (tenant_id, branch_id) REFERENCES public.branches (tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS public.caregiver_branches (
+    tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id),
+    caregiver_id text NOT NULL,
+    branch_id uuid NOT NULL,
+    PRIMARY KEY (tenant_id, caregiver_id, branch_id),
+    FOREIGN KEY (tenant_id, branch_id) REFERENCES public.branches (tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS public.branch_supervisors (
+    tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id),
+    user_id text NOT NULL, -- sub claim of the supervisor's access token
+    branch_id uuid NOT NULL,
+    PRIMARY KEY (tenant_id, user_id, branch_id),
+    FOREIGN KEY (tenant_id, branch_id) REFERENCES public.branches (tenant_id, id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS client_branches_branch_idx ON public.client_branches (tenant_id, branch_id);
+CREATE INDEX IF NOT EXISTS caregiver_branches_branch_idx ON public.caregiver_branches (tenant_id, branch_id);
+CREATE INDEX IF NOT EXISTS branch_supervisors_branch_idx ON public.branch_supervisors (tenant_id, branch_id);
+
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS branch_id uuid;
+CREATE INDEX IF NOT EXISTS schedules_tenant_branch_scheduled_start_idx ON public.schedules (tenant_id, branch_id, scheduled_start, id);
+
+-- A visit belongs to its client's branch when it is created or moved to
+-- another client.
+CREATE OR REPLACE FUNCTION public.set_schedule_branch()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    NEW.branch_id := (
+        SELECT cb.branch_id FROM public.client_branches cb
+        WHERE cb.tenant_id = NEW.tenant_id AND cb.client_id = NEW.client_id
+    );
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS schedules_set_branch ON public.schedules;
+CREATE TRIGGER schedules_set_branch
+    BEFORE INSERT OR UPDATE OF client_id ON public.schedules
+    FOR EACH ROW EXECUTE FUNCTION public.set_schedule_branch();
+
+-- Assigning, moving or unassigning a client moves its visits along.
+CREATE OR REPLACE FUNCTION public.sync_client_schedules_branch()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE public.schedules SET branch_id = NULL
+        WHERE tenant_id = OLD.tenant_id AND client_id = OLD.client_id;
+    END IF;
+    IF TG_OP IN ('INSERT', 'UPDATE') THEN
+        UPDATE public.schedules SET branch_id = NEW.branch_id
+        WHERE tenant_id = NEW.tenant_id AND client_id = NEW.client_id;
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS client_branches_sync_schedules ON public.client_branches;
+CREATE TRIGGER client_branches_sync_schedules
+    AFTER INSERT OR UPDATE OR DELETE ON public.client_branches
+    FOR EACH ROW EXECUTE FUNCTION public.sync_client_schedules_branch();
+
+-- Existing visits of clients assigned before this file ran.
+UPDATE public.schedules s SET branch_id = cb.branch_id
+FROM public.client_branches cb
+WHERE cb.tenant_id = s.tenant_id AND cb.client_id = s.client_id
+  AND s.branch_id IS DISTINCT FROM cb.branch_id;
+
+DO $$
+DECLARE
+    t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['regions', 'branches', 'client_branches', 'caregiver_branches', 'branch_supervisors']
+    LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS %I ON public.%I', t || '_tenant_id_immutable', t);
+        EXECUTE format('CREATE TRIGGER %I BEFORE UPDATE OF tenant_id ON public.%I
+                        FOR EACH ROW EXECUTE FUNCTION public.tenant_id_immutable()', t || '_tenant_id_immutable', t);
+    END LOOP;
+END;
+$$;
+
+ALTER TABLE public.regions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public.branches ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public.client_branches ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public.caregiver_branches ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public.branch_supervisors ENABLE ROW LEVEL SECURITY;
+
+DROP POLICY IF EXISTS "Tenant members read their tenant's rows" ON public.regions;
+CREATE POLICY "Tenant members read their tenant's rows" ON public.regions
+  FOR SELECT USING (tenant_id = public.request_tenant_id());
+DROP POLICY IF EXISTS "Tenant members read their tenant's rows" ON public.branches;
+CREATE POLICY "Tenant members read their tenant's rows" ON public.branches
+  FOR SELECT USING (tenant_id = public.request_tenant_id());
+
+-- The statistics functions of tenants.sql, with an optional p_branch_ids
+-- filter: NULL counts every visit, an array only the visits of those
+-- branches. The daily rollup is not kept per branch, so branch-filtered
+-- statistics always read the live tables.
+DROP FUNCTION IF EXISTS public.schedule_stats(text, date, date, text, date, integer, boolean);
+DROP FUNCTION IF EXISTS public.schedule_stats_sums(text, date, date, date, integer, text);
+DROP FUNCTION IF EXISTS public.schedule_visit_facts(text, date, date, integer);
+
+CREATE OR REPLACE FUNCTION public.schedule_visit_facts(
+    p_tenant_id text,
+    p_from date,
+    p_to date,
+    p_utc_offset_minutes integer DEFAULT 0,
+    p_branch_ids uuid[] DEFAULT NULL
+)
+RETURNS TABLE (
+    schedule_id uuid,
+    shift_day date,
+    status text,
+    client_id text,
+    caregiver_id text,
+    service_name text,
+    started boolean,
+    on_time boolean,
+    visit_minutes double precision,
+    tasks bigint,
+    completed_tasks bigint,
+    visit_end_day date
+)
+LANGUAGE sql STABLE AS $$
+    WITH visits AS (
+        SELECT s.*, to_date(s.shift_date, 'Dy, DD Mon YYYY') AS shift_day
+        FROM public.schedules s
+        WHERE s.tenant_id = p_tenant_id
+          AND (p_branch_ids IS NULL OR s.branch_id = ANY (p_branch_ids))
+    ),
+    task_counts AS (
+        SELECT t.schedule_id, count(*) AS tasks, count(*) FILTER (WHERE t.completed) AS completed_tasks
+        FROM public.tasks t
+        WHERE t.tenant_id = p_tenant_id
+        GROUP BY t.schedule_id
+    )
+    SELECT
+        v.id,
+        v.shift_day,
+        v.status,
+        v.client_id,
+        v.caregiver_id,
+        v.service_name,
+        v.visit_start IS NOT NULL,
+        -- On time: clocked in no later than 15 minutes after the scheduled start.
+        v.visit_start IS NOT NULL AND (v.visit_start AT TIME ZONE 'UTC')
+            <= v.shift_day + v.start_time::time - make_interval(mins => p_utc_offset_minutes) + interval '15 minutes',
+        CASE WHEN v.visit_end > v.visit_start THEN extract(epoch FROM v.visit_end - v.visit_start) / 60 END,
+        coalesce(tc.tasks, 0),
+        coalesce(tc.completed_tasks, 0),
+        ((v.visit_end AT TIME ZONE 'UTC') + make_interval(mins => p_utc_offset_minutes))::date
+    FROM visits v
+    LEFT JOIN task_counts tc ON tc.schedule_id = v.id
+    WHERE (p_from IS NULL OR v.shift_day >= p_from)
+      AND (p_to IS NULL OR v.shift_day <= p_to);
+$$;
+
+CREATE OR REPLACE FUNCTION public.schedule_stats_sums(
+    p_tenant_id text,
+    p_from date,
+    p_to date,
+    p_today date,
+    p_utc_offset_minutes integer,
+    p_group_by text,
+    p_branch_ids uuid[] DEFAULT NULL
+)
+RETURNS TABLE (
+    group_key text,
+    total bigint,
+    completed bigint,
+    scheduled bigint,
+    in_progress bigint,
+    cancelled bigint,
+    missed bigint,
+    started bigint,
+    on_time bigint,
+    timed_visits bigint,
+    visit_minutes double precision,
+    tasks bigint,
+    completed_tasks bigint
+)
+LANGUAGE sql STABLE AS $$
+    SELECT
+        CASE p_group_by
+            WHEN 'day' THEN to_char(f.shift_day, 'YYYY-MM-DD')
+            WHEN 'client' THEN f.client_id
+            WHEN 'caregiver' THEN coalesce(f.caregiver_id, '')
+            WHEN 'service' THEN f.service_name
+        END AS group_key,
+        count(*),
+        count(*) FILTER (WHERE f.status = 'completed'),
+        count(*) FILTER (WHERE f.status = 'scheduled'),
+        count(*) FILTER (WHERE f.status = 'in_progress'),
+        count(*) FILTER (WHERE f.status = 'cancelled'),
+        count(*) FILTER (WHERE f.status = 'scheduled' AND f.shift_day < p_today),
+        count(*) FILTER (WHERE f.started),
+        count(*) FILTER (WHERE f.on_time),
+        count(f.visit_minutes),
+        coalesce(sum(f.visit_minutes), 0),
+        coalesce(sum(f.tasks), 0)::bigint,
+        coalesce(sum(f.completed_tasks), 0)::bigint
+    FROM public.schedule_visit_facts(p_tenant_id, p_from, p_to, p_utc_offset_minutes, p_branch_ids) f
+    GROUP BY 1;
+$$;
+
+CREATE OR REPLACE FUNCTION public.schedule_stats(
+    p_tenant_id text,
+    p_from date,
+    p_to date,
+    p_group_by text,
+    p_today date,
+    p_utc_offset_minutes integer DEFAULT 0,
+    p_use_rollup boolean DEFAULT false,
+    p_branch_ids uuid[] DEFAULT NULL
+)
+RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH daily AS (
+        SELECT group_key::date AS day, total, completed, scheduled, in_progress, cancelled, missed,
+               started, on_time, timed_visits, visit_minutes, tasks, completed_tasks
+        FROM public.schedule_stats_sums(p_tenant_id, p_from, p_to, p_today, p_utc_offset_minutes, 'day', p_branch_ids)
+        WHERE NOT p_use_rollup OR p_branch_ids IS NOT NULL
+        UNION ALL
+        SELECT day, total, completed, scheduled, in_progress, cancelled, missed,
+               started, on_time, timed_visits, visit_minutes, tasks, completed_tasks
+        FROM public.schedule_daily_stats
+        WHERE p_use_rollup AND p_branch_ids IS NULL
+          AND tenant_id = p_tenant_id
+          AND (p_from IS NULL OR day >= p_from)
+          AND (p_to IS NULL OR day <= p_to)
+    ),
+    days AS (
+        -- Zero-fill bounded ranges (up to a year) so charts get a continuous axis.
+        SELECT d::date AS day
+        FROM generate_series(p_from, p_to, interval '1 day') d
+        WHERE p_from IS NOT NULL AND p_to IS NOT NULL AND p_to - p_from < 366
+        UNION
+        SELECT day FROM daily
+    ),
+    groups AS (
+        SELECT *
+        FROM public.schedule_stats_sums(p_tenant_id, p_from, p_to, p_today, p_utc_offset_minutes, p_group_by, p_branch_ids)
+        WHERE p_group_by IN ('day', 'client', 'caregiver', 'service')
+    ),
+    today AS (
+        SELECT count(*) FILTER (WHERE status = 'scheduled' AND shift_day = p_today) AS upcoming,
+               count(*) FILTER (WHERE status = 'completed' AND visit_end_day = p_today) AS completed
+        FROM public.schedule_visit_facts(p_tenant_id, p_from, p_to, p_utc_offset_minutes, p_branch_ids)
+    )
+    SELECT (
+        public.stats_counts_json(
+            (SELECT sum(total)::bigint FROM daily), (SELECT sum(completed)::bigint FROM daily),
+            (SELECT sum(scheduled)::bigint FROM daily), (SELECT sum(in_progress)::bigint FROM daily),
+            (SELECT sum(cancelled)::bigint FROM daily), (SELECT sum(missed)::bigint FROM daily),
+            (SELECT sum(started)::bigint FROM daily), (SELECT sum(on_time)::bigint FROM daily),
+            (SELECT sum(timed_visits)::bigint FROM daily), (SELECT sum(visit_minutes) FROM daily),
+            (SELECT sum(tasks)::bigint FROM daily), (SELECT sum(completed_tasks)::bigint FROM daily)
+        )
+        || jsonb_build_object(
+            'upcomingToday', (SELECT upcoming FROM today),
+            'completedToday', (SELECT completed FROM today),
+            'groups', coalesce((
+                SELECT jsonb_agg(
+                    jsonb_build_object('key', g.group_key)
+                    || public.stats_counts_json(g.total, g.completed, g.scheduled, g.in_progress, g.cancelled, g.missed,
+                                                g.started, g.on_time, g.timed_visits, g.visit_minutes, g.tasks, g.completed_tasks)
+                    ORDER BY g.group_key)
+                FROM groups g
+            ), '[]'::jsonb),
+            'daily', coalesce((
+                SELECT jsonb_agg(
+                    jsonb_build_object('date', to_char(days.day, 'YYYY-MM-DD'))
+                    || public.stats_counts_json(d.total, d.completed, d.scheduled, d.in_progress, d.cancelled, d.missed,
+                                                d.started, d.on_time, d.timed_visits, d.visit_minutes, d.tasks, d.completed_tasks)
+                    ORDER BY days.day)
+                FROM days
+                LEFT JOIN daily d ON d.day = days.day
+            ), '[]'::jsonb)
+        )
+    )::json;
+$$;
@@ -0,0 +1,36 @@
+CREATE TABLE public.care_plans (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    client_id text NOT NULL,
+    name text NOT NULL,
+    active boolean NOT NULL DEFAULT TRUE, -- Only the active plan is used to plan new visits
+    created_at timestamptz NOT NULL DEFAULT now(),
+    updated_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- A client has at most one active care plan
+CREATE UNIQUE INDEX care_plans_active_client_idx ON public.care_plans (client_id) WHERE active;
+
+CREATE TABLE public.care_plan_task_templates (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    care_plan_id uuid NOT NULL REFERENCES public.care_plans(id) ON DELETE CASCADE,
+    description text NOT NULL,
+    category text NOT NULL, -- ADL/IADL code, e.g. 'adl.bathing', 'iadl.meal_preparation'
+    frequency text NOT NULL DEFAULT 'every_visit', -- 'every_visit', 'mon_wed_fri', 'weekly'
+    weekday text, -- e.g. 'monday'; weekly templates only
+    required boolean NOT NULL DEFAULT TRUE,
+    position integer NOT NULL DEFAULT 0,
+    CHECK (frequency IN ('every_visit', 'mon_wed_fri', 'weekly')),
+    CHECK ((frequency = 'weekly') = (weekday IS NOT NULL))
+);
+
+CREATE INDEX care_plan_task_templates_plan_idx ON public.care_plan_task_templates (care_plan_id, position);
+
+ALTER TABLE public.care_plans ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public.care_plan_task_templates ENABLE ROW LEVEL SECURITY;
+
+-- Enable read access for all users (for demo); writes go through the API's service role
+CREATE POLICY "Enable read access for all users" ON public.care_plans
+  FOR SELECT USING (true);
+
+CREATE POLICY "Enable read access for all users" ON public.care_plan_task_templates
+  FOR SELECT USING (true);
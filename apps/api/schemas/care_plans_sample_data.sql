@@ -0,0 +1,10 @@
+INSERT INTO public.care_plans (id, client_id, name, active)
+VALUES
+('c0eebc99-9c0b-4ef8-bb6d-6bb9bd380c11', 'client-001', 'Personal care and home support', TRUE);
+
+INSERT INTO public.care_plan_task_templates (care_plan_id, description, category, frequency, weekday, required, position)
+VALUES
+('c0eebc99-9c0b-4ef8-bb6d-6bb9bd380c11', 'Assist with bathing.', 'adl.bathing', 'every_visit', NULL, TRUE, 0),
+('c0eebc99-9c0b-4ef8-bb6d-6bb9bd380c11', 'Medication assistance.', 'iadl.medication', 'every_visit', NULL, TRUE, 1),
+('c0eebc99-9c0b-4ef8-bb6d-6bb9bd380c11', 'Do the laundry.', 'iadl.laundry', 'mon_wed_fri', NULL, FALSE, 2),
+('c0eebc99-9c0b-4ef8-bb6d-6bb9bd380c11', 'Grocery shopping.', 'iadl.shopping', 'weekly', 'thursday', FALSE, 3);
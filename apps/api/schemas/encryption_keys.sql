@@ -0,0 +1,23 @@
+-- Per-tenant data keys for the encrypted schedule fields (client_name,
+-- service_notes and the location columns). Each key is stored wrapped
+-- (AES-GCM encrypted) by a master key that only exists in the API's local
+-- keyfile, so this table alone cannot decrypt anything.
+CREATE TABLE public.encryption_keys (
+    id text PRIMARY KEY,
+    tenant_id text NOT NULL,
+    master_key_id text NOT NULL, -- Keyfile master key the data key is wrapped with
+    wrapped_key text NOT NULL,
+    status text NOT NULL DEFAULT 'active', -- 'active', 'retired'; retired keys only decrypt
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- At most one key per tenant encrypts new values.
+CREATE UNIQUE INDEX encryption_keys_active_tenant_idx ON public.encryption_keys (tenant_id) WHERE status = 'active';
+
+-- No public policies: only the service role (which bypasses RLS) may read or
+-- write keys.
+ALTER TABLE public.encryption_keys ENABLE ROW LEVEL SECURITY;
+
+-- For databases created before the schedules blind index was added.
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS client_name_bidx text;
+CREATE INDEX IF NOT EXISTS schedules_client_name_bidx_idx ON public.schedules (client_name_bidx);
@@ -0,0 +1,56 @@
+-- Location precision: once a completed visit is verified against the geofence
+-- or old enough, the API coarsens or drops its clock-in and clock-out
+-- coordinates and keeps only the verification result and distance.
+-- tenants.sql replaces scrub_visit_locations with a version scoped to one
+-- tenant.
+
+-- For databases created before location precision was added.
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS start_verification jsonb;
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS end_verification jsonb;
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS locations_scrubbed_at timestamptz;
+ALTER TABLE public.phi_access_log ADD COLUMN IF NOT EXISTS action text NOT NULL DEFAULT 'read';
+
+CREATE INDEX IF NOT EXISTS schedules_unscrubbed_id_idx ON public.schedules (id)
+    WHERE status = 'completed' AND locations_scrubbed_at IS NULL;
+
+-- Replaces the visit locations of a completed schedule with the scrubbed
+-- values computed by the API (encrypted like the originals), and records the
+-- scrub in the access log in the same transaction. Returns false, changing
+-- nothing, if the visit is not completed, was already scrubbed or its client
+-- is on legal hold.
+CREATE OR REPLACE FUNCTION public.scrub_visit_locations(
+    p_schedule_id uuid,
+    p_start_location jsonb,
+    p_end_location jsonb,
+    p_start_verification jsonb,
+    p_end_verification jsonb,
+    p_fields text[],
+    p_actor text
+)
+RETURNS boolean
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    scrubbed_client text;
+BEGIN
+    UPDATE public.schedules SET
+        start_location = p_start_location,
+        end_location = p_end_location,
+        start_verification = p_start_verification,
+        end_verification = p_end_verification,
+        locations_scrubbed_at = now()
+    WHERE id = p_schedule_id
+      AND status = 'completed'
+      AND locations_scrubbed_at IS NULL
+      AND client_id NOT IN (SELECT client_id FROM public.legal_holds)
+    RETURNING client_id INTO scrubbed_client;
+
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+
+    INSERT INTO public.phi_access_log (occurred_at, actor, purpose, method, route, action, client_ids, schedule_ids, fields)
+    VALUES (now(), p_actor, 'data-minimization', '', '', 'scrub', ARRAY[scrubbed_client], ARRAY[p_schedule_id::text], p_fields);
+    RETURN true;
+END;
+$$;
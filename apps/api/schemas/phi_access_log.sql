@@ -0,0 +1,46 @@
+-- Who was shown which clients' PHI, written by the API after every read
+-- response that contained PHI, and which PHI the API scrubbed to keep less of
+-- it. Rows can be added but never changed or removed,
+-- except by the retention purge in retention.sql.
+CREATE TABLE public.phi_access_log (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    occurred_at timestamptz NOT NULL,
+    actor text NOT NULL,          -- X-Actor-ID of the caller, or 'anonymous'
+    purpose text NOT NULL,        -- X-Purpose-Of-Use, e.g. 'TREAT', or 'unspecified'
+    request_id text,
+    method text NOT NULL,
+    route text NOT NULL,          -- Route template, e.g. '/api/schedules/{id}'
+    client_ids text[] NOT NULL DEFAULT '{}',
+    schedule_ids text[] NOT NULL DEFAULT '{}',
+    fields text[] NOT NULL DEFAULT '{}', -- PHI fields in the response, e.g. 'client_name'
+    action text NOT NULL DEFAULT 'read', -- 'read', or 'scrub' when the fields were coarsened or removed
+    recorded_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX phi_access_log_client_ids_idx ON public.phi_access_log USING gin (client_ids);
+CREATE INDEX phi_access_log_occurred_at_idx ON public.phi_access_log (occurred_at);
+
+CREATE OR REPLACE FUNCTION public.phi_access_log_append_only()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    -- retention_purge (retention.sql) turns this on for its own transaction.
+    IF TG_OP = 'DELETE' AND current_setting('evv.retention_purge', true) = 'on' THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'phi_access_log is append-only';
+END;
+$$;
+
+CREATE TRIGGER phi_access_log_append_only
+    BEFORE UPDATE OR DELETE ON public.phi_access_log
+    FOR EACH ROW EXECUTE FUNCTION public.phi_access_log_append_only();
+
+CREATE TRIGGER phi_access_log_no_truncate
+    BEFORE TRUNCATE ON public.phi_access_log
+    FOR EACH STATEMENT EXECUTE FUNCTION public.phi_access_log_append_only();
+
+-- No public policies: only the service role (which bypasses RLS) may read or
+-- append records.
+ALTER TABLE public.phi_access_log ENABLE ROW LEVEL SECURITY;
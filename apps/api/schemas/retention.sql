@@ -0,0 +1,133 @@
+-- Retention: clients under legal hold are exempt from every purge, and
+-- retention_purge removes or anonymizes the data of one data class that is
+-- older than a cutoff. The API calls it per class with the configured policy.
+-- tenants.sql replaces retention_purge with a version scoped to one tenant.
+CREATE TABLE public.legal_holds (
+    client_id text PRIMARY KEY,
+    reason text NOT NULL,
+    placed_by text,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- No public policies: only the service role (which bypasses RLS) may manage holds.
+ALTER TABLE public.legal_holds ENABLE ROW LEVEL SECURITY;
+
+-- For databases created before anonymization was added.
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS anonymized_at timestamptz;
+
+-- For databases created before retention was added: the access log stays
+-- append-only, except for deletes made by retention_purge.
+CREATE OR REPLACE FUNCTION public.phi_access_log_append_only()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF TG_OP = 'DELETE' AND current_setting('evv.retention_purge', true) = 'on' THEN
+        RETURN OLD;
+    END IF;
+    RAISE EXCEPTION 'phi_access_log is append-only';
+END;
+$$;
+
+-- Purges at most p_limit rows of p_data_class whose visit (or, for audit
+-- logs, access) is older than p_cutoff and returns how many it purged. With
+-- p_dry_run it changes nothing and returns how many rows are due.
+--   visit_records    'delete' removes schedules and their tasks; 'anonymize'
+--                    strips client identity, locations, notes and task reasons
+--   gps_coordinates  clears start_location and end_location
+--   task_reasons     clears the free-text reason of tasks
+--   audit_logs       removes phi_access_log rows
+CREATE OR REPLACE FUNCTION public.retention_purge(
+    p_data_class text,
+    p_action text,
+    p_cutoff timestamp,
+    p_limit integer,
+    p_dry_run boolean
+)
+RETURNS integer
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    held text[] := ARRAY(SELECT client_id FROM public.legal_holds);
+    affected integer;
+BEGIN
+    IF p_data_class = 'visit_records' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.schedules s
+            WHERE s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+              AND (p_action = 'delete' OR s.anonymized_at IS NULL);
+        ELSIF p_action = 'delete' THEN
+            DELETE FROM public.schedules WHERE id IN (
+                SELECT s.id FROM public.schedules s
+                WHERE s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+        ELSIF p_action = 'anonymize' THEN
+            WITH anonymized AS (
+                UPDATE public.schedules SET
+                    client_id = 'anonymized', client_name = '', client_name_bidx = NULL, client_avatar = NULL,
+                    location = '{}'::jsonb, start_location = NULL, end_location = NULL, service_notes = NULL,
+                    anonymized_at = now()
+                WHERE id IN (
+                    SELECT s.id FROM public.schedules s
+                    WHERE s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held)) AND s.anonymized_at IS NULL
+                    LIMIT p_limit)
+                RETURNING id
+            ), cleared AS (
+                UPDATE public.tasks SET reason = NULL, completed_by = NULL
+                WHERE schedule_id IN (SELECT id FROM anonymized)
+            )
+            SELECT count(*) INTO affected FROM anonymized;
+        ELSE
+            RAISE EXCEPTION 'unknown retention action % for %', p_action, p_data_class;
+        END IF;
+
+    ELSIF p_data_class = 'gps_coordinates' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.schedules s
+            WHERE s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+              AND (s.start_location IS NOT NULL OR s.end_location IS NOT NULL);
+        ELSE
+            UPDATE public.schedules SET start_location = NULL, end_location = NULL
+            WHERE id IN (
+                SELECT s.id FROM public.schedules s
+                WHERE s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+                  AND (s.start_location IS NOT NULL OR s.end_location IS NOT NULL)
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+        END IF;
+
+    ELSIF p_data_class = 'task_reasons' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.tasks t JOIN public.schedules s ON s.id = t.schedule_id
+            WHERE s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held)) AND t.reason IS NOT NULL;
+        ELSE
+            UPDATE public.tasks SET reason = NULL
+            WHERE id IN (
+                SELECT t.id FROM public.tasks t JOIN public.schedules s ON s.id = t.schedule_id
+                WHERE s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held)) AND t.reason IS NOT NULL
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+        END IF;
+
+    ELSIF p_data_class = 'audit_logs' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.phi_access_log l
+            WHERE l.occurred_at < p_cutoff AND NOT (l.client_ids && held);
+        ELSE
+            PERFORM set_config('evv.retention_purge', 'on', true);
+            DELETE FROM public.phi_access_log WHERE id IN (
+                SELECT l.id FROM public.phi_access_log l
+                WHERE l.occurred_at < p_cutoff AND NOT (l.client_ids && held)
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+            PERFORM set_config('evv.retention_purge', 'off', true);
+        END IF;
+
+    ELSE
+        RAISE EXCEPTION 'unknown data class %', p_data_class;
+    END IF;
+
+    RETURN affected;
+END;
+$$;
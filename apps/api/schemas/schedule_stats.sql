@@ -0,0 +1,236 @@
+-- Statistics are aggregated in the database so the API never downloads every
+-- schedule and task just to count them. The API calls public.schedule_stats
+-- through PostgREST (POST /rest/v1/rpc/schedule_stats).
+--
+-- Times: shift_date/start_time are local wall-clock values, visit_start/visit_end
+-- are timestamptz. p_utc_offset_minutes is the API's local UTC offset so both
+-- can be compared, and p_today is the API's local date.
+--
+-- tenants.sql replaces these functions with versions that take the tenant as
+-- p_tenant_id; run it after this file.
+
+-- One row per schedule with everything the statistics need.
+CREATE OR REPLACE FUNCTION public.schedule_visit_facts(p_from date, p_to date, p_utc_offset_minutes integer DEFAULT 0)
+RETURNS TABLE (
+    schedule_id uuid,
+    shift_day date,
+    status text,
+    client_id text,
+    caregiver_id text,
+    service_name text,
+    started boolean,
+    on_time boolean,
+    visit_minutes double precision,
+    tasks bigint,
+    completed_tasks bigint,
+    visit_end_day date
+)
+LANGUAGE sql STABLE AS $$
+    WITH visits AS (
+        SELECT s.*, to_date(s.shift_date, 'Dy, DD Mon YYYY') AS shift_day
+        FROM public.schedules s
+    ),
+    task_counts AS (
+        SELECT t.schedule_id, count(*) AS tasks, count(*) FILTER (WHERE t.completed) AS completed_tasks
+        FROM public.tasks t
+        GROUP BY t.schedule_id
+    )
+    SELECT
+        v.id,
+        v.shift_day,
+        v.status,
+        v.client_id,
+        v.caregiver_id,
+        v.service_name,
+        v.visit_start IS NOT NULL,
+        -- On time: clocked in no later than 15 minutes after the scheduled start.
+        v.visit_start IS NOT NULL AND (v.visit_start AT TIME ZONE 'UTC')
+            <= v.shift_day + v.start_time::time - make_interval(mins => p_utc_offset_minutes) + interval '15 minutes',
+        CASE WHEN v.visit_end > v.visit_start THEN extract(epoch FROM v.visit_end - v.visit_start) / 60 END,
+        coalesce(tc.tasks, 0),
+        coalesce(tc.completed_tasks, 0),
+        ((v.visit_end AT TIME ZONE 'UTC') + make_interval(mins => p_utc_offset_minutes))::date
+    FROM visits v
+    LEFT JOIN task_counts tc ON tc.schedule_id = v.id
+    WHERE (p_from IS NULL OR v.shift_day >= p_from)
+      AND (p_to IS NULL OR v.shift_day <= p_to);
+$$;
+
+-- Raw sums per group. p_group_by is 'day', 'client', 'caregiver' or 'service'.
+CREATE OR REPLACE FUNCTION public.schedule_stats_sums(p_from date, p_to date, p_today date, p_utc_offset_minutes integer, p_group_by text)
+RETURNS TABLE (
+    group_key text,
+    total bigint,
+    completed bigint,
+    scheduled bigint,
+    in_progress bigint,
+    cancelled bigint,
+    missed bigint,
+    started bigint,
+    on_time bigint,
+    timed_visits bigint,
+    visit_minutes double precision,
+    tasks bigint,
+    completed_tasks bigint
+)
+LANGUAGE sql STABLE AS $$
+    SELECT
+        CASE p_group_by
+            WHEN 'day' THEN to_char(f.shift_day, 'YYYY-MM-DD')
+            WHEN 'client' THEN f.client_id
+            WHEN 'caregiver' THEN coalesce(f.caregiver_id, '')
+            WHEN 'service' THEN f.service_name
+        END AS group_key,
+        count(*),
+        count(*) FILTER (WHERE f.status = 'completed'),
+        count(*) FILTER (WHERE f.status = 'scheduled'),
+        count(*) FILTER (WHERE f.status = 'in_progress'),
+        count(*) FILTER (WHERE f.status = 'cancelled'),
+        count(*) FILTER (WHERE f.status = 'scheduled' AND f.shift_day < p_today),
+        count(*) FILTER (WHERE f.started),
+        count(*) FILTER (WHERE f.on_time),
+        count(f.visit_minutes),
+        coalesce(sum(f.visit_minutes), 0),
+        coalesce(sum(f.tasks), 0)::bigint,
+        coalesce(sum(f.completed_tasks), 0)::bigint
+    FROM public.schedule_visit_facts(p_from, p_to, p_utc_offset_minutes) f
+    GROUP BY 1;
+$$;
+
+-- Turns raw sums into the JSON shape of models.StatsCounts.
+CREATE OR REPLACE FUNCTION public.stats_counts_json(
+    p_total bigint, p_completed bigint, p_scheduled bigint, p_in_progress bigint, p_cancelled bigint, p_missed bigint,
+    p_started bigint, p_on_time bigint, p_timed_visits bigint, p_visit_minutes double precision, p_tasks bigint, p_completed_tasks bigint
+)
+RETURNS jsonb
+LANGUAGE sql IMMUTABLE AS $$
+    SELECT jsonb_build_object(
+        'totalSchedules', coalesce(p_total, 0),
+        'completedSchedules', coalesce(p_completed, 0),
+        'scheduledSchedules', coalesce(p_scheduled, 0),
+        'inProgressSchedules', coalesce(p_in_progress, 0),
+        'cancelledSchedules', coalesce(p_cancelled, 0),
+        'missedSchedules', coalesce(p_missed, 0),
+        'onTimeRate', CASE WHEN coalesce(p_started, 0) = 0 THEN 0 ELSE round(p_on_time::numeric / p_started, 4) END,
+        'averageVisitMinutes', CASE WHEN coalesce(p_timed_visits, 0) = 0 THEN 0 ELSE round((p_visit_minutes / p_timed_visits)::numeric, 1) END,
+        'taskCompletionRate', CASE WHEN coalesce(p_tasks, 0) = 0 THEN 0 ELSE round(p_completed_tasks::numeric / p_tasks, 4) END
+    );
+$$;
+
+-- Optional daily rollup. When the API runs with STATS_DAILY_ROLLUP=true it reads
+-- the overall counts and the daily series from here, and its background worker
+-- keeps recent days current through refresh_schedule_daily_stats. Without the
+-- local worker (e.g. on Vercel), schedule the refresh with pg_cron instead.
+CREATE TABLE IF NOT EXISTS public.schedule_daily_stats (
+    day date PRIMARY KEY,
+    total bigint NOT NULL DEFAULT 0,
+    completed bigint NOT NULL DEFAULT 0,
+    scheduled bigint NOT NULL DEFAULT 0,
+    in_progress bigint NOT NULL DEFAULT 0,
+    cancelled bigint NOT NULL DEFAULT 0,
+    missed bigint NOT NULL DEFAULT 0,
+    started bigint NOT NULL DEFAULT 0,
+    on_time bigint NOT NULL DEFAULT 0,
+    timed_visits bigint NOT NULL DEFAULT 0,
+    visit_minutes double precision NOT NULL DEFAULT 0,
+    tasks bigint NOT NULL DEFAULT 0,
+    completed_tasks bigint NOT NULL DEFAULT 0,
+    refreshed_at timestamptz NOT NULL DEFAULT now()
+);
+
+ALTER TABLE public.schedule_daily_stats ENABLE ROW LEVEL SECURITY;
+
+CREATE OR REPLACE FUNCTION public.refresh_schedule_daily_stats(p_from date, p_to date, p_today date, p_utc_offset_minutes integer DEFAULT 0)
+RETURNS integer
+LANGUAGE plpgsql VOLATILE AS $$
+DECLARE
+    refreshed integer;
+BEGIN
+    DELETE FROM public.schedule_daily_stats WHERE day BETWEEN p_from AND p_to;
+
+    INSERT INTO public.schedule_daily_stats (day, total, completed, scheduled, in_progress, cancelled, missed,
+                                             started, on_time, timed_visits, visit_minutes, tasks, completed_tasks, refreshed_at)
+    SELECT s.group_key::date, s.total, s.completed, s.scheduled, s.in_progress, s.cancelled, s.missed,
+           s.started, s.on_time, s.timed_visits, s.visit_minutes, s.tasks, s.completed_tasks, now()
+    FROM public.schedule_stats_sums(p_from, p_to, p_today, p_utc_offset_minutes, 'day') s;
+
+    GET DIAGNOSTICS refreshed = ROW_COUNT;
+    RETURN refreshed;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.schedule_stats(
+    p_from date,
+    p_to date,
+    p_group_by text,
+    p_today date,
+    p_utc_offset_minutes integer DEFAULT 0,
+    p_use_rollup boolean DEFAULT false
+)
+RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH daily AS (
+        SELECT group_key::date AS day, total, completed, scheduled, in_progress, cancelled, missed,
+               started, on_time, timed_visits, visit_minutes, tasks, completed_tasks
+        FROM public.schedule_stats_sums(p_from, p_to, p_today, p_utc_offset_minutes, 'day')
+        WHERE NOT p_use_rollup
+        UNION ALL
+        SELECT day, total, completed, scheduled, in_progress, cancelled, missed,
+               started, on_time, timed_visits, visit_minutes, tasks, completed_tasks
+        FROM public.schedule_daily_stats
+        WHERE p_use_rollup
+          AND (p_from IS NULL OR day >= p_from)
+          AND (p_to IS NULL OR day <= p_to)
+    ),
+    days AS (
+        -- Zero-fill bounded ranges (up to a year) so charts get a continuous axis.
+        SELECT d::date AS day
+        FROM generate_series(p_from, p_to, interval '1 day') d
+        WHERE p_from IS NOT NULL AND p_to IS NOT NULL AND p_to - p_from < 366
+        UNION
+        SELECT day FROM daily
+    ),
+    groups AS (
+        SELECT *
+        FROM public.schedule_stats_sums(p_from, p_to, p_today, p_utc_offset_minutes, p_group_by)
+        WHERE p_group_by IN ('day', 'client', 'caregiver', 'service')
+    ),
+    today AS (
+        SELECT count(*) FILTER (WHERE status = 'scheduled' AND shift_day = p_today) AS upcoming,
+               count(*) FILTER (WHERE status = 'completed' AND visit_end_day = p_today) AS completed
+        FROM public.schedule_visit_facts(p_from, p_to, p_utc_offset_minutes)
+    )
+    SELECT (
+        public.stats_counts_json(
+            (SELECT sum(total)::bigint FROM daily), (SELECT sum(completed)::bigint FROM daily),
+            (SELECT sum(scheduled)::bigint FROM daily), (SELECT sum(in_progress)::bigint FROM daily),
+            (SELECT sum(cancelled)::bigint FROM daily), (SELECT sum(missed)::bigint FROM daily),
+            (SELECT sum(started)::bigint FROM daily), (SELECT sum(on_time)::bigint FROM daily),
+            (SELECT sum(timed_visits)::bigint FROM daily), (SELECT sum(visit_minutes) FROM daily),
+            (SELECT sum(tasks)::bigint FROM daily), (SELECT sum(completed_tasks)::bigint FROM daily)
+        )
+        || jsonb_build_object(
+            'upcomingToday', (SELECT upcoming FROM today),
+            'completedToday', (SELECT completed FROM today),
+            'groups', coalesce((
+                SELECT jsonb_agg(
+                    jsonb_build_object('key', g.group_key)
+                    || public.stats_counts_json(g.total, g.completed, g.scheduled, g.in_progress, g.cancelled, g.missed,
+                                                g.started, g.on_time, g.timed_visits, g.visit_minutes, g.tasks, g.completed_tasks)
+                    ORDER BY g.group_key)
+                FROM groups g
+            ), '[]'::jsonb),
+            'daily', coalesce((
+                SELECT jsonb_agg(
+                    jsonb_build_object('date', to_char(days.day, 'YYYY-MM-DD'))
+                    || public.stats_counts_json(d.total, d.completed, d.scheduled, d.in_progress, d.cancelled, d.missed,
+                                                d.started, d.on_time, d.timed_visits, d.visit_minutes, d.tasks, d.completed_tasks)
+                    ORDER BY days.day)
+                FROM days
+                LEFT JOIN daily d ON d.day = days.day
+            ), '[]'::jsonb)
+        )
+    )::json;
+$$;
+
+CREATE INDEX IF NOT EXISTS tasks_schedule_id_idx ON public.tasks (schedule_id);
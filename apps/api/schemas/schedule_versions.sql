@@ -0,0 +1,47 @@
+-- Schedule versions: every change to a schedule or its tasks bumps the
+-- schedule's version. The API's visit and task changes made with If-Match
+-- are written only if the version is still the one they were checked
+-- against, so two writers holding the same ETag cannot both succeed. Run
+-- after tenants.sql.
+
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS version bigint NOT NULL DEFAULT 1;
+
+CREATE OR REPLACE FUNCTION public.bump_schedule_version()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.version IS NOT DISTINCT FROM OLD.version THEN
+        NEW.version := OLD.version + 1;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS schedules_bump_version ON public.schedules;
+CREATE TRIGGER schedules_bump_version
+    BEFORE UPDATE ON public.schedules
+    FOR EACH ROW EXECUTE FUNCTION public.bump_schedule_version();
+
+-- Tasks are part of their schedule's representation, and of its ETag.
+CREATE OR REPLACE FUNCTION public.bump_task_schedule_version()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF TG_OP IN ('UPDATE', 'DELETE') THEN
+        UPDATE public.schedules SET version = version + 1
+        WHERE tenant_id = OLD.tenant_id AND id = OLD.schedule_id;
+    END IF;
+    IF TG_OP = 'INSERT' OR (TG_OP = 'UPDATE' AND NEW.schedule_id IS DISTINCT FROM OLD.schedule_id) THEN
+        UPDATE public.schedules SET version = version + 1
+        WHERE tenant_id = NEW.tenant_id AND id = NEW.schedule_id;
+    END IF;
+    RETURN NULL;
+END;
+$$;
+
+DROP TRIGGER IF EXISTS tasks_bump_schedule_version ON public.tasks;
+CREATE TRIGGER tasks_bump_schedule_version
+    AFTER INSERT OR UPDATE OR DELETE ON public.tasks
+    FOR EACH ROW EXECUTE FUNCTION public.bump_task_schedule_version();
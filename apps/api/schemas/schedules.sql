@@ -1,10 +1,12 @@
 CREATE TABLE public.schedules (
     id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
     client_id text NOT NULL,
-    client_name text NOT NULL,
+    client_name text NOT NULL, -- Encrypted when ENCRYPTION_KEYFILE is set, see encryption_keys.sql
+    client_name_bidx text,     -- Blind index of client_name for exact-match lookups
     client_avatar text,
+    caregiver_id text, -- Caregiver assigned to the visit
     service_name text NOT NULL,
-    location jsonb NOT NULL, -- Stores Latitude, Longitude, Address as JSON
+    location jsonb NOT NULL, -- Stores Latitude, Longitude, Address as JSON, or a JSON string of its ciphertext
     shift_date text NOT NULL, -- e.g., "Mon, 15 Jan 2025"
     start_time text NOT NULL, -- e.g., "09:00"
     end_time text NOT NULL,   -- e.g., "10:00"
@@ -13,9 +15,35 @@ CREATE TABLE public.schedules (
     visit_end timestamptz,   -- Actual clock-out timestamp
     start_location jsonb,    -- Location at clock-in (JSONB)
     end_location jsonb,      -- Location at clock-out (JSONB)
-    service_notes text
+    service_notes text,
+    scheduled_start timestamp NOT NULL, -- Derived from shift_date + start_time by trigger; used for sorting and keyset pagination
+    anonymized_at timestamptz, -- Set when retention stripped the client's identity, see retention.sql
+    start_verification jsonb,  -- Geofence result kept when start_location is scrubbed, see location_precision.sql
+    end_verification jsonb,    -- Geofence result kept when end_location is scrubbed
+    locations_scrubbed_at timestamptz
 );
 
+CREATE INDEX schedules_caregiver_id_idx ON public.schedules (caregiver_id);
+CREATE INDEX schedules_client_id_idx ON public.schedules (client_id);
+CREATE INDEX schedules_client_name_bidx_idx ON public.schedules (client_name_bidx);
+CREATE INDEX schedules_status_idx ON public.schedules (status);
+CREATE INDEX schedules_scheduled_start_id_idx ON public.schedules (scheduled_start, id);
+
+-- Keep scheduled_start in sync with the display-formatted shift_date/start_time columns
+CREATE OR REPLACE FUNCTION public.set_schedule_scheduled_start()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    NEW.scheduled_start := to_date(NEW.shift_date, 'Dy, DD Mon YYYY') + NEW.start_time::time;
+    RETURN NEW;
+END;
+$$;
+
+CREATE TRIGGER schedules_set_scheduled_start
+    BEFORE INSERT OR UPDATE OF shift_date, start_time ON public.schedules
+    FOR EACH ROW EXECUTE FUNCTION public.set_schedule_scheduled_start();
+
 -- Optional: Add RLS policy for public read access (for demo)
 -- For production, you'd want more granular policies based on user roles.
 ALTER TABLE public.schedules ENABLE ROW LEVEL SECURITY;
@@ -1,7 +1,7 @@
-INSERT INTO public.schedules (id, client_id, client_name, client_avatar, service_name, location, shift_date, start_time, end_time, status, service_notes)
+INSERT INTO public.schedules (id, client_id, client_name, client_avatar, caregiver_id, service_name, location, shift_date, start_time, end_time, status, service_notes)
 VALUES
-('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11', 'client-001', 'Melisa Adam', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=MA', 'Service Name A', '{"latitude": -6.2088, "longitude": 106.8456, "address": "Casa Grande Apartment"}', 'Mon, 15 Jan 2025', '09:00', '10:00', 'scheduled', 'Initial consultation and assessment.'),
-('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12', 'client-002', 'John Doe', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=JD', 'Service Name B', '{"latitude": -6.2100, "longitude": 106.8500, "address": "123 Main St, Anytown"}', 'Mon, 15 Jan 2025', '11:00', '12:00', 'scheduled', 'Follow-up visit for therapy.'),
-('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a13', 'client-003', 'Jane Smith', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=JS', 'Service Name C', '{"latitude": -6.2120, "longitude": 106.8550, "address": "456 Oak Ave, Othercity"}', 'Mon, 15 Jan 2025', '13:00', '14:00', 'scheduled', 'Medication assistance and daily check-in.'),
-('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a14', 'client-004', 'Emily White', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=EW', 'Service Name D', '{"latitude": -6.2140, "longitude": 106.8600, "address": "789 Pine Ln, Somewhere"}', 'Mon, 15 Jan 2025', '15:00', '16:00', 'completed', 'Routine health check and meal preparation.'),
-('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a15', 'client-005', 'David Green', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=DG', 'Service Name E', '{"latitude": -6.2160, "longitude": 106.8650, "address": "101 Elm Rd, Nowhere"}', 'Mon, 15 Jan 2025', '17:00', '18:00', 'cancelled', 'Client cancelled due to personal reasons.');
+('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11', 'client-001', 'Melisa Adam', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=MA', 'caregiver-001', 'Service Name A', '{"latitude": -6.2088, "longitude": 106.8456, "address": "Casa Grande Apartment"}', 'Mon, 15 Jan 2025', '09:00', '10:00', 'scheduled', 'Initial consultation and assessment.'),
+('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a12', 'client-002', 'John Doe', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=JD', 'caregiver-001', 'Service Name B', '{"latitude": -6.2100, "longitude": 106.8500, "address": "123 Main St, Anytown"}', 'Mon, 15 Jan 2025', '11:00', '12:00', 'scheduled', 'Follow-up visit for therapy.'),
+('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a13', 'client-003', 'Jane Smith', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=JS', 'caregiver-002', 'Service Name C', '{"latitude": -6.2120, "longitude": 106.8550, "address": "456 Oak Ave, Othercity"}', 'Mon, 15 Jan 2025', '13:00', '14:00', 'scheduled', 'Medication assistance and daily check-in.'),
+('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a14', 'client-004', 'Emily White', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=EW', 'caregiver-001', 'Service Name D', '{"latitude": -6.2140, "longitude": 106.8600, "address": "789 Pine Ln, Somewhere"}', 'Mon, 15 Jan 2025', '15:00', '16:00', 'completed', 'Routine health check and meal preparation.'),
+('a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a15', 'client-005', 'David Green', 'https://placehold.co/48x48/E0E7FF/4F46E5?text=DG', 'caregiver-002', 'Service Name E', '{"latitude": -6.2160, "longitude": 106.8650, "address": "101 Elm Rd, Nowhere"}', 'Mon, 15 Jan 2025', '17:00', '18:00', 'cancelled', 'Client cancelled due to personal reasons.');
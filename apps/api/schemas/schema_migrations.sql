@@ -0,0 +1,34 @@
+-- Records which schema changes have been applied. Run this file after the other
+-- schema files, and again whenever a new version is added below. /readyz reports
+-- the API as not ready until the version the code expects
+-- (repository.RequiredSchemaVersion) is present.
+CREATE TABLE IF NOT EXISTS public.schema_migrations (
+    version integer PRIMARY KEY,
+    description text NOT NULL,
+    applied_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Only the service role (which bypasses RLS) needs to read it.
+ALTER TABLE public.schema_migrations ENABLE ROW LEVEL SECURITY;
+
+INSERT INTO public.schema_migrations (version, description) VALUES
+    (1, 'schedules and tasks'),
+    (2, 'webhook subscriptions and delivery outbox'),
+    (3, 'schedule statistics functions and daily rollup'),
+    (4, 'scheduled_start column for schedule pagination'),
+    (5, 'care plans and task templates'),
+    (6, 'task completion metadata and ad-hoc tasks'),
+    (7, 'encryption keys and client name blind index'),
+    (8, 'append-only PHI access log'),
+    (9, 'retention purge and legal holds'),
+    (10, 'visit location precision reduction'),
+    (11, 'tenants and tenant isolation'),
+    (12, 'branches and regions'),
+    (13, 'API keys'),
+    (14, 'transactional webhook outbox'),
+    (15, 'missed visit notification marker'),
+    (16, 'schedule versions for conditional writes'),
+    (17, 'branch-scoped webhook subscriptions'),
+    (18, 'webhook delivery claims'),
+    (19, 'task events queued only for saved tasks')
+ON CONFLICT (version) DO NOTHING;
@@ -3,8 +3,16 @@ CREATE TABLE public.tasks (
     schedule_id uuid NOT NULL REFERENCES public.schedules(id) ON DELETE CASCADE, -- Foreign key to schedules
     description text NOT NULL,
     completed boolean NOT NULL DEFAULT FALSE,
+    completed_at timestamptz, -- When the task was marked completed
+    completed_by text, -- Caregiver who completed the task
+    reason_code text, -- Why the task was not completed
     reason text, -- Optional reason if not completed
-    created_at timestamptz DEFAULT now()
+    category text, -- ADL/IADL code copied from the care plan template
+    required boolean NOT NULL DEFAULT TRUE,
+    template_id uuid, -- care_plan_task_templates.id the task was generated from; no FK so the task survives template edits
+    ad_hoc boolean NOT NULL DEFAULT FALSE, -- Unplanned work logged during the visit
+    created_at timestamptz DEFAULT now(),
+    CHECK (reason_code IN ('client_declined', 'client_unavailable', 'not_needed', 'insufficient_time', 'unsafe_conditions', 'supplies_unavailable', 'other'))
 );
 
 -- Optional: Add RLS policy for public read access (for demo)
@@ -0,0 +1,466 @@
+-- Tenants: every agency's data lives in the same tables, told apart by a
+-- tenant_id column. The API scopes every query it makes to the caller's
+-- tenant (a tenant_id filter on reads and writes, p_tenant_id on functions),
+-- and the policies below do the same for clients that read with a user's
+-- Supabase token. Rows written before tenants existed belong to 'default'.
+CREATE TABLE IF NOT EXISTS public.tenants (
+    id text PRIMARY KEY, -- The tenant_id claim of the agency's access tokens
+    name text NOT NULL,
+    time_zone text,                                     -- IANA zone of shift dates and times; NULL means the API's zone
+    geofence_radius_meters integer NOT NULL DEFAULT 0,  -- 0 means the API's LOCATION_GEOFENCE_RADIUS_METERS
+    rounding_increment_minutes integer NOT NULL DEFAULT 0, -- 0 leaves visit times as recorded
+    rounding_mode text NOT NULL DEFAULT 'nearest',     -- 'nearest', 'up', 'down'
+    created_at timestamptz NOT NULL DEFAULT now(),
+    CHECK (geofence_radius_meters >= 0),
+    CHECK (rounding_increment_minutes BETWEEN 0 AND 60),
+    CHECK (rounding_mode IN ('nearest', 'up', 'down'))
+);
+
+INSERT INTO public.tenants (id, name) VALUES ('default', 'Default agency')
+ON CONFLICT (id) DO NOTHING;
+
+-- No public policies: only the service role (which bypasses RLS) may read or
+-- change tenants.
+ALTER TABLE public.tenants ENABLE ROW LEVEL SECURITY;
+
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.tasks ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.care_plans ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.care_plan_task_templates ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.webhook_subscriptions ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.webhook_deliveries ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.phi_access_log ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.legal_holds ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+ALTER TABLE public.schedule_daily_stats ADD COLUMN IF NOT EXISTS tenant_id text NOT NULL DEFAULT 'default' REFERENCES public.tenants(id);
+
+CREATE INDEX IF NOT EXISTS schedules_tenant_scheduled_start_id_idx ON public.schedules (tenant_id, scheduled_start, id);
+CREATE INDEX IF NOT EXISTS tasks_tenant_id_idx ON public.tasks (tenant_id);
+CREATE INDEX IF NOT EXISTS care_plans_tenant_id_idx ON public.care_plans (tenant_id);
+CREATE INDEX IF NOT EXISTS care_plan_task_templates_tenant_id_idx ON public.care_plan_task_templates (tenant_id);
+CREATE INDEX IF NOT EXISTS webhook_subscriptions_tenant_id_idx ON public.webhook_subscriptions (tenant_id);
+CREATE INDEX IF NOT EXISTS webhook_deliveries_tenant_due_idx ON public.webhook_deliveries (tenant_id, next_attempt_at) WHERE status = 'pending';
+CREATE INDEX IF NOT EXISTS phi_access_log_tenant_occurred_at_idx ON public.phi_access_log (tenant_id, occurred_at);
+
+-- Client IDs are only unique within an agency.
+ALTER TABLE public.legal_holds DROP CONSTRAINT IF EXISTS legal_holds_pkey;
+ALTER TABLE public.legal_holds ADD CONSTRAINT legal_holds_pkey PRIMARY KEY (tenant_id, client_id);
+
+ALTER TABLE public.schedule_daily_stats DROP CONSTRAINT IF EXISTS schedule_daily_stats_pkey;
+ALTER TABLE public.schedule_daily_stats ADD CONSTRAINT schedule_daily_stats_pkey PRIMARY KEY (tenant_id, day);
+
+DROP INDEX IF EXISTS public.care_plans_active_client_idx;
+CREATE UNIQUE INDEX care_plans_active_client_idx ON public.care_plans (tenant_id, client_id) WHERE active;
+
+-- A child row belongs to its parent's tenant.
+CREATE UNIQUE INDEX IF NOT EXISTS schedules_tenant_id_id_idx ON public.schedules (tenant_id, id);
+CREATE UNIQUE INDEX IF NOT EXISTS care_plans_tenant_id_id_idx ON public.care_plans (tenant_id, id);
+CREATE UNIQUE INDEX IF NOT EXISTS webhook_subscriptions_tenant_id_id_idx ON public.webhook_subscriptions (tenant_id, id);
+
+ALTER TABLE public.tasks DROP CONSTRAINT IF EXISTS tasks_schedule_tenant_fkey;
+ALTER TABLE public.tasks ADD CONSTRAINT tasks_schedule_tenant_fkey
+    FOREIGN KEY (tenant_id, schedule_id) REFERENCES public.schedules (tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE public.care_plan_task_templates DROP CONSTRAINT IF EXISTS care_plan_task_templates_plan_tenant_fkey;
+ALTER TABLE public.care_plan_task_templates ADD CONSTRAINT care_plan_task_templates_plan_tenant_fkey
+    FOREIGN KEY (tenant_id, care_plan_id) REFERENCES public.care_plans (tenant_id, id) ON DELETE CASCADE;
+
+ALTER TABLE public.webhook_deliveries DROP CONSTRAINT IF EXISTS webhook_deliveries_subscription_tenant_fkey;
+ALTER TABLE public.webhook_deliveries ADD CONSTRAINT webhook_deliveries_subscription_tenant_fkey
+    FOREIGN KEY (tenant_id, subscription_id) REFERENCES public.webhook_subscriptions (tenant_id, id) ON DELETE CASCADE;
+
+-- Rows never move between tenants.
+CREATE OR REPLACE FUNCTION public.tenant_id_immutable()
+RETURNS trigger
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    IF NEW.tenant_id IS DISTINCT FROM OLD.tenant_id THEN
+        RAISE EXCEPTION '%.tenant_id cannot be changed', TG_TABLE_NAME;
+    END IF;
+    RETURN NEW;
+END;
+$$;
+
+DO $$
+DECLARE
+    t text;
+BEGIN
+    FOREACH t IN ARRAY ARRAY['schedules', 'tasks', 'care_plans', 'care_plan_task_templates',
+                             'webhook_subscriptions', 'webhook_deliveries', 'legal_holds']
+    LOOP
+        EXECUTE format('DROP TRIGGER IF EXISTS %I ON public.%I', t || '_tenant_id_immutable', t);
+        EXECUTE format('CREATE TRIGGER %I BEFORE UPDATE OF tenant_id ON public.%I
+                        FOR EACH ROW EXECUTE FUNCTION public.tenant_id_immutable()', t || '_tenant_id_immutable', t);
+    END LOOP;
+END;
+$$;
+
+-- The tenant of the Supabase user making the request, from the same claims
+-- the API reads.
+CREATE OR REPLACE FUNCTION public.request_tenant_id()
+RETURNS text
+LANGUAGE sql STABLE AS $$
+    SELECT coalesce(
+        nullif(current_setting('request.jwt.claims', true), '')::jsonb ->> 'tenant_id',
+        nullif(current_setting('request.jwt.claims', true), '')::jsonb -> 'app_metadata' ->> 'tenant_id'
+    );
+$$;
+
+-- The demo policies of schedules.sql, tasks.sql and care_plans.sql let
+-- anyone read every row; limit them to the reader's own tenant.
+DROP POLICY IF EXISTS "Enable read access for all users" ON public.schedules;
+DROP POLICY IF EXISTS "Enable insert for authenticated users" ON public.schedules;
+DROP POLICY IF EXISTS "Enable update for authenticated users" ON public.schedules;
+DROP POLICY IF EXISTS "Enable read access for all users" ON public.tasks;
+DROP POLICY IF EXISTS "Enable insert for authenticated users" ON public.tasks;
+DROP POLICY IF EXISTS "Enable update for authenticated users" ON public.tasks;
+DROP POLICY IF EXISTS "Enable read access for all users" ON public.care_plans;
+DROP POLICY IF EXISTS "Enable read access for all users" ON public.care_plan_task_templates;
+
+DROP POLICY IF EXISTS "Tenant members read their tenant's rows" ON public.schedules;
+CREATE POLICY "Tenant members read their tenant's rows" ON public.schedules
+  FOR SELECT USING (tenant_id = public.request_tenant_id());
+DROP POLICY IF EXISTS "Tenant members read their tenant's rows" ON public.tasks;
+CREATE POLICY "Tenant members read their tenant's rows" ON public.tasks
+  FOR SELECT USING (tenant_id = public.request_tenant_id());
+DROP POLICY IF EXISTS "Tenant members read their tenant's rows" ON public.care_plans;
+CREATE POLICY "Tenant members read their tenant's rows" ON public.care_plans
+  FOR SELECT USING (tenant_id = public.request_tenant_id());
+DROP POLICY IF EXISTS "Tenant members read their tenant's rows" ON public.care_plan_task_templates;
+CREATE POLICY "Tenant members read their tenant's rows" ON public.care_plan_task_templates
+  FOR SELECT USING (tenant_id = public.request_tenant_id());
+
+-- Tenant-scoped versions of the functions of schedule_stats.sql,
+-- retention.sql and location_precision.sql. Each takes the tenant as
+-- p_tenant_id, which the API always sets, and only reads and changes that
+-- tenant's rows. The versions without it are dropped so a call cannot fall
+-- back to every tenant's data. branches.sql in turn replaces the statistics
+-- functions with versions that can filter by branch.
+DROP FUNCTION IF EXISTS public.schedule_stats(date, date, text, date, integer, boolean);
+DROP FUNCTION IF EXISTS public.refresh_schedule_daily_stats(date, date, date, integer);
+DROP FUNCTION IF EXISTS public.schedule_stats_sums(date, date, date, integer, text);
+DROP FUNCTION IF EXISTS public.schedule_visit_facts(date, date, integer);
+DROP FUNCTION IF EXISTS public.retention_purge(text, text, timestamp, integer, boolean);
+DROP FUNCTION IF EXISTS public.scrub_visit_locations(uuid, jsonb, jsonb, jsonb, jsonb, text[], text);
+
+CREATE OR REPLACE FUNCTION public.schedule_visit_facts(p_tenant_id text, p_from date, p_to date, p_utc_offset_minutes integer DEFAULT 0)
+RETURNS TABLE (
+    schedule_id uuid,
+    shift_day date,
+    status text,
+    client_id text,
+    caregiver_id text,
+    service_name text,
+    started boolean,
+    on_time boolean,
+    visit_minutes double precision,
+    tasks bigint,
+    completed_tasks bigint,
+    visit_end_day date
+)
+LANGUAGE sql STABLE AS $$
+    WITH visits AS (
+        SELECT s.*, to_date(s.shift_date, 'Dy, DD Mon YYYY') AS shift_day
+        FROM public.schedules s
+        WHERE s.tenant_id = p_tenant_id
+    ),
+    task_counts AS (
+        SELECT t.schedule_id, count(*) AS tasks, count(*) FILTER (WHERE t.completed) AS completed_tasks
+        FROM public.tasks t
+        WHERE t.tenant_id = p_tenant_id
+        GROUP BY t.schedule_id
+    )
+    SELECT
+        v.id,
+        v.shift_day,
+        v.status,
+        v.client_id,
+        v.caregiver_id,
+        v.service_name,
+        v.visit_start IS NOT NULL,
+        -- On time: clocked in no later than 15 minutes after the scheduled start.
+        v.visit_start IS NOT NULL AND (v.visit_start AT TIME ZONE 'UTC')
+            <= v.shift_day + v.start_time::time - make_interval(mins => p_utc_offset_minutes) + interval '15 minutes',
+        CASE WHEN v.visit_end > v.visit_start THEN extract(epoch FROM v.visit_end - v.visit_start) / 60 END,
+        coalesce(tc.tasks, 0),
+        coalesce(tc.completed_tasks, 0),
+        ((v.visit_end AT TIME ZONE 'UTC') + make_interval(mins => p_utc_offset_minutes))::date
+    FROM visits v
+    LEFT JOIN task_counts tc ON tc.schedule_id = v.id
+    WHERE (p_from IS NULL OR v.shift_day >= p_from)
+      AND (p_to IS NULL OR v.shift_day <= p_to);
+$$;
+
+CREATE OR REPLACE FUNCTION public.schedule_stats_sums(p_tenant_id text, p_from date, p_to date, p_today date, p_utc_offset_minutes integer, p_group_by text)
+RETURNS TABLE (
+    group_key text,
+    total bigint,
+    completed bigint,
+    scheduled bigint,
+    in_progress bigint,
+    cancelled bigint,
+    missed bigint,
+    started bigint,
+    on_time bigint,
+    timed_visits bigint,
+    visit_minutes double precision,
+    tasks bigint,
+    completed_tasks bigint
+)
+LANGUAGE sql STABLE AS $$
+    SELECT
+        CASE p_group_by
+            WHEN 'day' THEN to_char(f.shift_day, 'YYYY-MM-DD')
+            WHEN 'client' THEN f.client_id
+            WHEN 'caregiver' THEN coalesce(f.caregiver_id, '')
+            WHEN 'service' THEN f.service_name
+        END AS group_key,
+        count(*),
+        count(*) FILTER (WHERE f.status = 'completed'),
+        count(*) FILTER (WHERE f.status = 'scheduled'),
+        count(*) FILTER (WHERE f.status = 'in_progress'),
+        count(*) FILTER (WHERE f.status = 'cancelled'),
+        count(*) FILTER (WHERE f.status = 'scheduled' AND f.shift_day < p_today),
+        count(*) FILTER (WHERE f.started),
+        count(*) FILTER (WHERE f.on_time),
+        count(f.visit_minutes),
+        coalesce(sum(f.visit_minutes), 0),
+        coalesce(sum(f.tasks), 0)::bigint,
+        coalesce(sum(f.completed_tasks), 0)::bigint
+    FROM public.schedule_visit_facts(p_tenant_id, p_from, p_to, p_utc_offset_minutes) f
+    GROUP BY 1;
+$$;
+
+-- With pg_cron, schedule one refresh per tenant.
+CREATE OR REPLACE FUNCTION public.refresh_schedule_daily_stats(p_tenant_id text, p_from date, p_to date, p_today date, p_utc_offset_minutes integer DEFAULT 0)
+RETURNS integer
+LANGUAGE plpgsql VOLATILE AS $$
+DECLARE
+    refreshed integer;
+BEGIN
+    DELETE FROM public.schedule_daily_stats WHERE tenant_id = p_tenant_id AND day BETWEEN p_from AND p_to;
+
+    INSERT INTO public.schedule_daily_stats (tenant_id, day, total, completed, scheduled, in_progress, cancelled, missed,
+                                             started, on_time, timed_visits, visit_minutes, tasks, completed_tasks, refreshed_at)
+    SELECT p_tenant_id, s.group_key::date, s.total, s.completed, s.scheduled, s.in_progress, s.cancelled, s.missed,
+           s.started, s.on_time, s.timed_visits, s.visit_minutes, s.tasks, s.completed_tasks, now()
+    FROM public.schedule_stats_sums(p_tenant_id, p_from, p_to, p_today, p_utc_offset_minutes, 'day') s;
+
+    GET DIAGNOSTICS refreshed = ROW_COUNT;
+    RETURN refreshed;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.schedule_stats(
+    p_tenant_id text,
+    p_from date,
+    p_to date,
+    p_group_by text,
+    p_today date,
+    p_utc_offset_minutes integer DEFAULT 0,
+    p_use_rollup boolean DEFAULT false
+)
+RETURNS json
+LANGUAGE sql STABLE AS $$
+    WITH daily AS (
+        SELECT group_key::date AS day, total, completed, scheduled, in_progress, cancelled, missed,
+               started, on_time, timed_visits, visit_minutes, tasks, completed_tasks
+        FROM public.schedule_stats_sums(p_tenant_id, p_from, p_to, p_today, p_utc_offset_minutes, 'day')
+        WHERE NOT p_use_rollup
+        UNION ALL
+        SELECT day, total, completed, scheduled, in_progress, cancelled, missed,
+               started, on_time, timed_visits, visit_minutes, tasks, completed_tasks
+        FROM public.schedule_daily_stats
+        WHERE p_use_rollup
+          AND tenant_id = p_tenant_id
+          AND (p_from IS NULL OR day >= p_from)
+          AND (p_to IS NULL OR day <= p_to)
+    ),
+    days AS (
+        -- Zero-fill bounded ranges (up to a year) so charts get a continuous axis.
+        SELECT d::date AS day
+        FROM generate_series(p_from, p_to, interval '1 day') d
+        WHERE p_from IS NOT NULL AND p_to IS NOT NULL AND p_to - p_from < 366
+        UNION
+        SELECT day FROM daily
+    ),
+    groups AS (
+        SELECT *
+        FROM public.schedule_stats_sums(p_tenant_id, p_from, p_to, p_today, p_utc_offset_minutes, p_group_by)
+        WHERE p_group_by IN ('day', 'client', 'caregiver', 'service')
+    ),
+    today AS (
+        SELECT count(*) FILTER (WHERE status = 'scheduled' AND shift_day = p_today) AS upcoming,
+               count(*) FILTER (WHERE status = 'completed' AND visit_end_day = p_today) AS completed
+        FROM public.schedule_visit_facts(p_tenant_id, p_from, p_to, p_utc_offset_minutes)
+    )
+    SELECT (
+        public.stats_counts_json(
+            (SELECT sum(total)::bigint FROM daily), (SELECT sum(completed)::bigint FROM daily),
+            (SELECT sum(scheduled)::bigint FROM daily), (SELECT sum(in_progress)::bigint FROM daily),
+            (SELECT sum(cancelled)::bigint FROM daily), (SELECT sum(missed)::bigint FROM daily),
+            (SELECT sum(started)::bigint FROM daily), (SELECT sum(on_time)::bigint FROM daily),
+            (SELECT sum(timed_visits)::bigint FROM daily), (SELECT sum(visit_minutes) FROM daily),
+            (SELECT sum(tasks)::bigint FROM daily), (SELECT sum(completed_tasks)::bigint FROM daily)
+        )
+        || jsonb_build_object(
+            'upcomingToday', (SELECT upcoming FROM today),
+            'completedToday', (SELECT completed FROM today),
+            'groups', coalesce((
+                SELECT jsonb_agg(
+                    jsonb_build_object('key', g.group_key)
+                    || public.stats_counts_json(g.total, g.completed, g.scheduled, g.in_progress, g.cancelled, g.missed,
+                                                g.started, g.on_time, g.timed_visits, g.visit_minutes, g.tasks, g.completed_tasks)
+                    ORDER BY g.group_key)
+                FROM groups g
+            ), '[]'::jsonb),
+            'daily', coalesce((
+                SELECT jsonb_agg(
+                    jsonb_build_object('date', to_char(days.day, 'YYYY-MM-DD'))
+                    || public.stats_counts_json(d.total, d.completed, d.scheduled, d.in_progress, d.cancelled, d.missed,
+                                                d.started, d.on_time, d.timed_visits, d.visit_minutes, d.tasks, d.completed_tasks)
+                    ORDER BY days.day)
+                FROM days
+                LEFT JOIN daily d ON d.day = days.day
+            ), '[]'::jsonb)
+        )
+    )::json;
+$$;
+
+CREATE OR REPLACE FUNCTION public.retention_purge(
+    p_tenant_id text,
+    p_data_class text,
+    p_action text,
+    p_cutoff timestamp,
+    p_limit integer,
+    p_dry_run boolean
+)
+RETURNS integer
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    held text[] := ARRAY(SELECT client_id FROM public.legal_holds WHERE tenant_id = p_tenant_id);
+    affected integer;
+BEGIN
+    IF p_data_class = 'visit_records' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.schedules s
+            WHERE s.tenant_id = p_tenant_id AND s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+              AND (p_action = 'delete' OR s.anonymized_at IS NULL);
+        ELSIF p_action = 'delete' THEN
+            DELETE FROM public.schedules WHERE id IN (
+                SELECT s.id FROM public.schedules s
+                WHERE s.tenant_id = p_tenant_id AND s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+        ELSIF p_action = 'anonymize' THEN
+            WITH anonymized AS (
+                UPDATE public.schedules SET
+                    client_id = 'anonymized', client_name = '', client_name_bidx = NULL, client_avatar = NULL,
+                    location = '{}'::jsonb, start_location = NULL, end_location = NULL, service_notes = NULL,
+                    anonymized_at = now()
+                WHERE id IN (
+                    SELECT s.id FROM public.schedules s
+                    WHERE s.tenant_id = p_tenant_id AND s.scheduled_start < p_cutoff
+                      AND NOT (s.client_id = ANY (held)) AND s.anonymized_at IS NULL
+                    LIMIT p_limit)
+                RETURNING id
+            ), cleared AS (
+                UPDATE public.tasks SET reason = NULL, completed_by = NULL
+                WHERE schedule_id IN (SELECT id FROM anonymized)
+            )
+            SELECT count(*) INTO affected FROM anonymized;
+        ELSE
+            RAISE EXCEPTION 'unknown retention action % for %', p_action, p_data_class;
+        END IF;
+
+    ELSIF p_data_class = 'gps_coordinates' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.schedules s
+            WHERE s.tenant_id = p_tenant_id AND s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+              AND (s.start_location IS NOT NULL OR s.end_location IS NOT NULL);
+        ELSE
+            UPDATE public.schedules SET start_location = NULL, end_location = NULL
+            WHERE id IN (
+                SELECT s.id FROM public.schedules s
+                WHERE s.tenant_id = p_tenant_id AND s.scheduled_start < p_cutoff AND NOT (s.client_id = ANY (held))
+                  AND (s.start_location IS NOT NULL OR s.end_location IS NOT NULL)
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+        END IF;
+
+    ELSIF p_data_class = 'task_reasons' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.tasks t JOIN public.schedules s ON s.id = t.schedule_id
+            WHERE s.tenant_id = p_tenant_id AND s.scheduled_start < p_cutoff
+              AND NOT (s.client_id = ANY (held)) AND t.reason IS NOT NULL;
+        ELSE
+            UPDATE public.tasks SET reason = NULL
+            WHERE id IN (
+                SELECT t.id FROM public.tasks t JOIN public.schedules s ON s.id = t.schedule_id
+                WHERE s.tenant_id = p_tenant_id AND s.scheduled_start < p_cutoff
+                  AND NOT (s.client_id = ANY (held)) AND t.reason IS NOT NULL
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+        END IF;
+
+    ELSIF p_data_class = 'audit_logs' THEN
+        IF p_dry_run THEN
+            SELECT count(*) INTO affected FROM public.phi_access_log l
+            WHERE l.tenant_id = p_tenant_id AND l.occurred_at < p_cutoff AND NOT (l.client_ids && held);
+        ELSE
+            PERFORM set_config('evv.retention_purge', 'on', true);
+            DELETE FROM public.phi_access_log WHERE id IN (
+                SELECT l.id FROM public.phi_access_log l
+                WHERE l.tenant_id = p_tenant_id AND l.occurred_at < p_cutoff AND NOT (l.client_ids && held)
+                LIMIT p_limit);
+            GET DIAGNOSTICS affected = ROW_COUNT;
+            PERFORM set_config('evv.retention_purge', 'off', true);
+        END IF;
+
+    ELSE
+        RAISE EXCEPTION 'unknown data class %', p_data_class;
+    END IF;
+
+    RETURN affected;
+END;
+$$;
+
+CREATE OR REPLACE FUNCTION public.scrub_visit_locations(
+    p_tenant_id text,
+    p_schedule_id uuid,
+    p_start_location jsonb,
+    p_end_location jsonb,
+    p_start_verification jsonb,
+    p_end_verification jsonb,
+    p_fields text[],
+    p_actor text
+)
+RETURNS boolean
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    scrubbed_client text;
+BEGIN
+    UPDATE public.schedules SET
+        start_location = p_start_location,
+        end_location = p_end_location,
+        start_verification = p_start_verification,
+        end_verification = p_end_verification,
+        locations_scrubbed_at = now()
+    WHERE id = p_schedule_id
+      AND tenant_id = p_tenant_id
+      AND status = 'completed'
+      AND locations_scrubbed_at IS NULL
+      AND client_id NOT IN (SELECT client_id FROM public.legal_holds WHERE tenant_id = p_tenant_id)
+    RETURNING client_id INTO scrubbed_client;
+
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+
+    INSERT INTO public.phi_access_log (tenant_id, occurred_at, actor, purpose, method, route, action, client_ids, schedule_ids, fields)
+    VALUES (p_tenant_id, now(), p_actor, 'data-minimization', '', '', 'scrub', ARRAY[scrubbed_client], ARRAY[p_schedule_id::text], p_fields);
+    RETURN true;
+END;
+$$;
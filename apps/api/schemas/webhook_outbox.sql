@@ -0,0 +1,169 @@
+-- Transactional webhook outbox: the API writes visit and task changes through
+-- the functions below, which queue the change's webhook deliveries in the
+-- same transaction. An event is queued if and only if its change is
+-- committed. Run after tenants.sql; every function takes the tenant as
+-- p_tenant_id, like the others.
+
+-- Subscriptions created by supervisors only receive the events of their
+-- branches. NULL means every branch.
+ALTER TABLE public.webhook_subscriptions ADD COLUMN IF NOT EXISTS branch_ids uuid[];
+
+-- Queues p_event, an event as the API sends it, for every active
+-- subscription of the tenant that wants its type and its branch.
+CREATE OR REPLACE FUNCTION public.enqueue_webhook_event(p_tenant_id text, p_event jsonb)
+RETURNS void
+LANGUAGE sql
+AS $$
+    INSERT INTO public.webhook_deliveries (tenant_id, subscription_id, event_id, event_type, payload)
+    SELECT p_tenant_id, s.id, (p_event->>'id')::uuid, p_event->>'type', p_event
+    FROM public.webhook_subscriptions s
+    WHERE s.tenant_id = p_tenant_id
+      AND s.active
+      AND (s.events = '{}' OR p_event->>'type' = ANY (s.events))
+      AND (s.branch_ids IS NULL OR p_event->>'branch_id' = ANY (s.branch_ids::text[]));
+$$;
+
+-- Moves a visit from p_from_status to p_to_status and queues p_event.
+-- 'in_progress' records the clock-in time and location, 'completed' the
+-- clock-out. Returns false, changing nothing, if the visit's status is no
+-- longer p_from_status or, when p_if_version is set, the schedule is no
+-- longer at that version (see schedule_versions.sql).
+DROP FUNCTION IF EXISTS public.record_visit_change(text, uuid, text, text, timestamptz, jsonb, jsonb);
+CREATE OR REPLACE FUNCTION public.record_visit_change(
+    p_tenant_id text,
+    p_schedule_id uuid,
+    p_from_status text,
+    p_to_status text,
+    p_at timestamptz,
+    p_location jsonb,
+    p_event jsonb,
+    p_if_version bigint
+)
+RETURNS boolean
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    UPDATE public.schedules SET
+        status = p_to_status,
+        visit_start = CASE WHEN p_to_status = 'in_progress' THEN p_at ELSE visit_start END,
+        start_location = CASE WHEN p_to_status = 'in_progress' THEN p_location ELSE start_location END,
+        visit_end = CASE WHEN p_to_status = 'completed' THEN p_at ELSE visit_end END,
+        end_location = CASE WHEN p_to_status = 'completed' THEN p_location ELSE end_location END
+    WHERE tenant_id = p_tenant_id AND id = p_schedule_id AND status = p_from_status
+      AND (p_if_version IS NULL OR version = p_if_version);
+
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+
+    PERFORM public.enqueue_webhook_event(p_tenant_id, p_event);
+    RETURN true;
+END;
+$$;
+
+-- Inserts p_tasks, task rows of schedule p_schedule_id as JSON, or updates
+-- the completion columns of those that exist, and queues the events of
+-- p_events whose task_id is a task it saved. A task of another schedule or
+-- tenant with the same id is neither changed nor reported. Returns the saved
+-- tasks, or no rows, saving nothing, if p_if_version is set and the schedule
+-- is no longer at that version.
+DROP FUNCTION IF EXISTS public.save_visit_tasks(text, jsonb, jsonb);
+CREATE OR REPLACE FUNCTION public.save_visit_tasks(
+    p_tenant_id text,
+    p_schedule_id uuid,
+    p_if_version bigint,
+    p_tasks jsonb,
+    p_events jsonb
+)
+RETURNS SETOF public.tasks
+LANGUAGE plpgsql
+AS $$
+DECLARE
+    v_task public.tasks;
+BEGIN
+    IF p_if_version IS NOT NULL THEN
+        PERFORM 1 FROM public.schedules
+        WHERE tenant_id = p_tenant_id AND id = p_schedule_id AND version = p_if_version
+        FOR UPDATE;
+        IF NOT FOUND THEN
+            RETURN;
+        END IF;
+    END IF;
+
+    FOR v_task IN
+        INSERT INTO public.tasks AS t (id, tenant_id, schedule_id, description, completed, completed_at, completed_by,
+                                       reason_code, reason, category, required, template_id, ad_hoc)
+        SELECT r.id, p_tenant_id, r.schedule_id, r.description, r.completed, r.completed_at, r.completed_by,
+               r.reason_code, r.reason, r.category, r.required, r.template_id, r.ad_hoc
+        FROM jsonb_populate_recordset(NULL::public.tasks, p_tasks) AS r
+        WHERE r.schedule_id = p_schedule_id
+        ON CONFLICT (id) DO UPDATE SET
+            completed = EXCLUDED.completed,
+            completed_at = EXCLUDED.completed_at,
+            completed_by = EXCLUDED.completed_by,
+            reason_code = EXCLUDED.reason_code,
+            reason = EXCLUDED.reason
+        WHERE t.tenant_id = p_tenant_id AND t.schedule_id = p_schedule_id
+        RETURNING t.*
+    LOOP
+        PERFORM public.enqueue_webhook_event(p_tenant_id, e)
+        FROM jsonb_array_elements(p_events) AS e
+        WHERE e->>'task_id' = v_task.id::text;
+        RETURN NEXT v_task;
+    END LOOP;
+END;
+$$;
+
+-- Set once a visit's visit.missed event has been queued, so that it is
+-- queued once however often, and by however many instances, the visit is
+-- found missed.
+ALTER TABLE public.schedules ADD COLUMN IF NOT EXISTS missed_notified_at timestamptz;
+
+-- Marks a visit as missed and queues p_event, a visit.missed event. Returns
+-- false, queuing nothing, if the visit has been started or cancelled since
+-- it was found missed, or was already marked.
+CREATE OR REPLACE FUNCTION public.record_missed_visit(p_tenant_id text, p_schedule_id uuid, p_event jsonb)
+RETURNS boolean
+LANGUAGE plpgsql
+AS $$
+BEGIN
+    UPDATE public.schedules SET missed_notified_at = now()
+    WHERE tenant_id = p_tenant_id AND id = p_schedule_id AND status = 'scheduled' AND missed_notified_at IS NULL;
+
+    IF NOT FOUND THEN
+        RETURN false;
+    END IF;
+
+    PERFORM public.enqueue_webhook_event(p_tenant_id, p_event);
+    RETURN true;
+END;
+$$;
+
+-- A dispatcher claims the deliveries it is about to send: they are 'sending'
+-- until locked_until, and are claimed again after that if the dispatcher
+-- stopped before recording them.
+ALTER TABLE public.webhook_deliveries ADD COLUMN IF NOT EXISTS locked_until timestamptz;
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_tenant_sending_idx ON public.webhook_deliveries (tenant_id, locked_until) WHERE status = 'sending';
+
+-- Claims up to p_limit deliveries that are due, or whose claim ran out, for
+-- p_lease_seconds and returns them. Rows another dispatcher is claiming at the
+-- same time are skipped, so no delivery is handed to two dispatchers.
+CREATE OR REPLACE FUNCTION public.claim_webhook_deliveries(p_tenant_id text, p_limit integer, p_lease_seconds integer)
+RETURNS SETOF public.webhook_deliveries
+LANGUAGE sql
+AS $$
+    UPDATE public.webhook_deliveries d SET
+        status = 'sending',
+        locked_until = now() + make_interval(secs => p_lease_seconds)
+    WHERE d.id IN (
+        SELECT id FROM public.webhook_deliveries
+        WHERE tenant_id = p_tenant_id
+          AND ((status = 'pending' AND next_attempt_at <= now())
+            OR (status = 'sending' AND locked_until <= now()))
+        ORDER BY next_attempt_at
+        LIMIT p_limit
+        FOR UPDATE SKIP LOCKED
+    )
+    RETURNING d.*;
+$$;
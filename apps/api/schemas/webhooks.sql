@@ -0,0 +1,33 @@
+CREATE TABLE public.webhook_subscriptions (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    url text NOT NULL,
+    secret text NOT NULL, -- HMAC-SHA256 signing secret, only returned on creation
+    events text[] NOT NULL DEFAULT '{}', -- Empty means every event type
+    active boolean NOT NULL DEFAULT TRUE,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+-- Outbox: one row per (event, subscription). Rows are retried with exponential
+-- backoff and end up as 'delivered' or 'dead' (the dead-letter view).
+CREATE TABLE public.webhook_deliveries (
+    id uuid PRIMARY KEY DEFAULT gen_random_uuid(),
+    subscription_id uuid NOT NULL REFERENCES public.webhook_subscriptions(id) ON DELETE CASCADE,
+    event_id uuid NOT NULL,
+    event_type text NOT NULL, -- 'visit.started', 'visit.completed', 'task.updated', 'visit.missed'
+    payload jsonb NOT NULL,
+    status text NOT NULL DEFAULT 'pending', -- 'pending', 'sending' (see webhook_outbox.sql), 'delivered', 'dead'
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamptz NOT NULL DEFAULT now(),
+    last_error text,
+    last_status_code integer,
+    delivered_at timestamptz,
+    created_at timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE INDEX webhook_deliveries_due_idx ON public.webhook_deliveries (next_attempt_at) WHERE status = 'pending';
+CREATE INDEX webhook_deliveries_status_idx ON public.webhook_deliveries (status);
+
+-- No public policies: subscriptions hold signing secrets, so only the service
+-- role (which bypasses RLS) may read or write these tables.
+ALTER TABLE public.webhook_subscriptions ENABLE ROW LEVEL SECURITY;
+ALTER TABLE public.webhook_deliveries ENABLE ROW LEVEL SECURITY;
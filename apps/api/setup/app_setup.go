@@ -1,41 +1,236 @@
 package setup
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
+	"time"
 
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/audit"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/cache"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/config"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/encryption"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/events"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/handler"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/health"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/logging"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/metrics"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/repository"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/server"
 	"github.com/forddyce/mini-evv-logger/apps/api/internal/service"
-	"github.com/supabase-community/supabase-go"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tenant"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/tracing"
 )
 
-var AppHandler *handler.ScheduleHandler
+// App is the wired application shared by the local server and the Vercel
+// function. Handler serves every route; the services and tenants are exposed
+// so the local server can run the background workers for every tenant.
+type App struct {
+	Handler          *server.Server
+	ScheduleService  service.ScheduleService
+	WebhookService   service.WebhookService
+	RetentionService service.RetentionService
+	Tenants          tenant.Store
+	Config           config.Config
 
-func SetupApp() error {
-	supabaseURL := os.Getenv("SUPABASE_URL")
-	supabaseServiceRoleKey := os.Getenv("SUPABASE_SERVICE_ROLE_KEY")
+	streams         *handler.StreamHandler
+	accessLog       *audit.Recorder
+	shutdownTracing func(context.Context) error
+}
+
+// CloseStreams ends the open visit streams so that a shutting down server does
+// not wait for them. Clients reconnect with Last-Event-ID.
+func (a *App) CloseStreams() {
+	a.streams.Close()
+}
 
-	if supabaseURL == "" || supabaseServiceRoleKey == "" {
-		return fmt.Errorf("SUPABASE_URL or SUPABASE_SERVICE_ROLE_KEY environment variables are not set")
+// Close writes the queued PHI access records and flushes the spans that have
+// not been exported yet.
+func (a *App) Close(ctx context.Context) error {
+	var err error
+	if a.accessLog != nil {
+		err = a.accessLog.Close(ctx)
 	}
+	return errors.Join(err, a.shutdownTracing(ctx))
+}
 
-	client, err := supabase.NewClient(supabaseURL, supabaseServiceRoleKey, nil)
+// NewClient returns the Supabase client the repositories share.
+func NewClient(cfg config.Supabase) (*repository.Client, error) {
+	client, err := repository.NewClient(cfg.URL, cfg.ServiceRoleKey, repository.ClientConfig{
+		MaxAttempts:      cfg.MaxAttempts,
+		BaseBackoff:      cfg.BaseBackoff,
+		MaxBackoff:       cfg.MaxBackoff,
+		BreakerThreshold: cfg.BreakerThreshold,
+		BreakerCooldown:  cfg.BreakerCooldown,
+	})
 	if err != nil {
-		return fmt.Errorf("failed to create Supabase client: %w", err)
+		return nil, fmt.Errorf("failed to create Supabase client: %w", err)
 	}
-	fmt.Println("Supabase client initialized by setup package.")
-
-	scheduleRepo := repository.NewScheduleRepository(client)
-	scheduleService := service.NewScheduleService(scheduleRepo)
-	AppHandler = handler.NewScheduleHandler(scheduleService)
+	return client, nil
+}
 
-	return nil
+// NewKeyring loads the encryption keyfile. It returns nil, which leaves the
+// PHI columns unencrypted, when no keyfile is configured.
+func NewKeyring(cfg config.Encryption, client *repository.Client) (*encryption.Keyring, error) {
+	if cfg.KeyFile == "" {
+		return nil, nil
+	}
+	keyfile, err := encryption.LoadKeyfile(cfg.KeyFile)
+	if err != nil {
+		return nil, err
+	}
+	slog.Info("Field encryption enabled", "master_key", keyfile.ActiveMasterKey)
+	return encryption.NewKeyring(keyfile, repository.NewKeyRepository(client)), nil
 }
 
-func init() {
-	if err := SetupApp(); err != nil {
-		log.Printf("Error during app setup: %v", err)
+// NewApp wires the repositories, services and handlers from a loaded config.
+func NewApp(cfg config.Config) (*App, error) {
+	configureLogging(cfg.Log)
+
+	client, err := NewClient(cfg.Supabase)
+	if err != nil {
+		return nil, err
 	}
+	slog.Info("Supabase client initialized")
+
+	keyring, err := NewKeyring(cfg.Encryption, client)
+	if err != nil {
+		return nil, err
+	}
+
+	shutdownTracing, err := tracing.Setup(context.Background(), cfg.Tracing.Exporter)
+	if err != nil {
+		return nil, err
+	}
+
+	// Each repository call is traced and then measured on its way to Supabase.
+	// Schedule reads served from the cache skip both.
+	appMetrics := metrics.New()
+	webhookRepo := tracing.TraceWebhookRepository(
+		metrics.InstrumentWebhookRepository(repository.NewWebhookRepository(client), appMetrics, metrics.BackendSupabase),
+		metrics.BackendSupabase)
+	scheduleRepo := tracing.TraceScheduleRepository(
+		metrics.InstrumentScheduleRepository(repository.NewScheduleRepository(client, keyring), appMetrics, metrics.BackendSupabase),
+		metrics.BackendSupabase)
+	carePlanRepo := tracing.TraceCarePlanRepository(
+		metrics.InstrumentCarePlanRepository(repository.NewCarePlanRepository(client), appMetrics, metrics.BackendSupabase),
+		metrics.BackendSupabase)
+	retentionRepo := tracing.TraceRetentionRepository(
+		metrics.InstrumentRetentionRepository(repository.NewRetentionRepository(client), appMetrics, metrics.BackendSupabase),
+		metrics.BackendSupabase)
+	branchRepo := tracing.TraceBranchRepository(
+		metrics.InstrumentBranchRepository(repository.NewBranchRepository(client), appMetrics, metrics.BackendSupabase),
+		metrics.BackendSupabase)
+	apiKeyRepo := tracing.TraceAPIKeyRepository(
+		metrics.InstrumentAPIKeyRepository(repository.NewAPIKeyRepository(client), appMetrics, metrics.BackendSupabase),
+		metrics.BackendSupabase)
+	if cfg.Cache.Enabled {
+		// Purges and client moves change schedules in the database, behind the
+		// cached repository's back.
+		cached := cache.WrapScheduleRepository(scheduleRepo, cache.NewLRU(cfg.Cache.MaxEntries), cfg.Cache.TTL)
+		scheduleRepo = cached
+		retentionRepo = cache.InvalidateOnPurge(retentionRepo, cached)
+		branchRepo = cache.InvalidateOnClientMove(branchRepo, cached)
+	}
+
+	webhookService := tracing.TraceWebhookService(service.NewWebhookService(webhookRepo, service.DefaultWebhookConfig()))
+	carePlanService := tracing.TraceCarePlanService(service.NewCarePlanService(carePlanRepo, scheduleRepo, branchRepo))
+	retentionService := tracing.TraceRetentionService(service.NewRetentionService(retentionRepo, scheduleRepo, service.RetentionConfig{
+		Policies: cfg.Retention.Policies(),
+		Locations: service.LocationPolicy{
+			Mode:                 cfg.Locations.Mode,
+			Decimals:             cfg.Locations.Decimals,
+			AfterVerified:        cfg.Locations.AfterVerified,
+			AfterDays:            cfg.Locations.AfterDays,
+			GeofenceRadiusMeters: float64(cfg.Locations.GeofenceRadiusMeters),
+		},
+	}))
+	branchService := tracing.TraceBranchService(service.NewBranchService(branchRepo))
+	apiKeyService := tracing.TraceAPIKeyService(service.NewAPIKeyService(apiKeyRepo))
+	bus := events.NewBus(1024)
+	scheduleService := tracing.TraceScheduleService(service.NewScheduleService(scheduleRepo,
+		service.WithPublisher(bus),
+		service.WithDailyStatsRollup(cfg.Stats.DailyRollup),
+		service.WithTaskRules(service.TaskRules{
+			UpdateGrace:          cfg.Tasks.UpdateGrace,
+			RequireResolvedTasks: cfg.Tasks.RequireResolved,
+		}),
+		service.WithTaskPlanner(carePlanService),
+		service.WithClientBranches(branchRepo),
+	))
+
+	tenants := tenant.Cached(repository.NewTenantRepository(client), cfg.Auth.TenantCacheTTL)
+	appMetrics.MustRegister(metrics.NewVisitCollector(scheduleService, tenants))
+	if cfg.Auth.JWTSecret == "" {
+		slog.Warn("No JWT secret configured, serving every request as the default tenant")
+	}
+
+	// The readiness probe acts for the default tenant, which always exists.
+	migrationRepo := repository.NewMigrationRepository(client)
+	checker := health.NewChecker(3*time.Second,
+		health.Check{Name: "supabase", Run: func(ctx context.Context) error {
+			return scheduleRepo.Ping(tenant.WithID(ctx, tenant.DefaultID))
+		}},
+		health.Check{Name: "migrations", Run: func(ctx context.Context) error {
+			version, err := migrationRepo.SchemaVersion(ctx)
+			if err != nil {
+				return err
+			}
+			if version < repository.RequiredSchemaVersion {
+				return fmt.Errorf("schema version %d is behind %d, apply schemas/schema_migrations.sql", version, repository.RequiredSchemaVersion)
+			}
+			return nil
+		}},
+	)
+
+	streamHandler := handler.NewStreamHandler(bus)
+
+	auditStore := repository.NewAuditRepository(client)
+	var accessLog *audit.Recorder
+	if cfg.Audit.Enabled {
+		accessLog = audit.NewRecorder(auditStore, audit.RecorderConfig{
+			BufferSize:    cfg.Audit.BufferSize,
+			FlushInterval: cfg.Audit.FlushInterval,
+			Synchronous:   cfg.Audit.Synchronous,
+		})
+	}
+
+	return &App{
+		Handler: server.New(server.Handlers{
+			Schedules: handler.NewScheduleHandler(scheduleService),
+			CarePlans: handler.NewCarePlanHandler(carePlanService),
+			Webhooks:  handler.NewWebhookHandler(webhookService),
+			Stream:    streamHandler,
+			Health:    handler.NewHealthHandler(checker),
+			Audit:     handler.NewAuditHandler(auditStore),
+			Retention: handler.NewRetentionHandler(retentionService),
+			Branches:  handler.NewBranchHandler(branchService),
+			APIKeys:   handler.NewAPIKeyHandler(apiKeyService),
+			Auth: auth.NewAuthenticator(cfg.Auth.JWTSecret, tenants, branchRepo,
+				auth.WithAPIKeys(apiKeyRepo, cfg.Auth.APIKeyRateLimit)),
+			AccessLog:    accessLog,
+			Metrics:      appMetrics,
+			MetricsToken: cfg.Server.MetricsToken,
+		}, server.Config{
+			AllowedOrigins: cfg.Server.AllowedOrigins,
+			MaxBodyBytes:   cfg.Server.MaxBodyBytes,
+		}),
+		ScheduleService:  scheduleService,
+		WebhookService:   webhookService,
+		RetentionService: retentionService,
+		Tenants:          tenants,
+		Config:           cfg,
+		streams:          streamHandler,
+		accessLog:        accessLog,
+		shutdownTracing:  shutdownTracing,
+	}, nil
+}
+
+// configureLogging makes the redacting JSON logger the default.
+func configureLogging(cfg config.Log) {
+	level, _ := logging.ParseLevel(cfg.Level) // Checked by config.Validate.
+	slog.SetDefault(logging.New(os.Stdout, level))
 }
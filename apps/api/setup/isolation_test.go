@@ -0,0 +1,436 @@
+package setup_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/auth"
+	"github.com/forddyce/mini-evv-logger/apps/api/internal/config"
+	"github.com/forddyce/mini-evv-logger/apps/api/setup"
+)
+
+const jwtSecret = "isolation-test-secret-of-32-characters"
+
+// Agency A's data. The markers are PHI no response to agency B may contain.
+const (
+	scheduleA = "a0eebc99-9c0b-4ef8-bb6d-6bb9bd380a11" // One of the sample schedules /reset resets.
+	taskA     = "task-a-1"
+	planA     = "plan-a-1"
+	clientA   = "client-a-1"
+	webhookA  = "webhook-a-1"
+	deliveryA = "delivery-a-1"
+)
+
+var markersA = []string{"Alpha Secret", "1 Alpha Street", "alpha-notes", "https://alpha.example.com", "alpha-hold"}
+
+// request is what the API sent the fake PostgREST.
+type request struct {
+	Method, Table, Filter, Body string
+}
+
+// fakePostgREST keeps rows in memory and honors eq and in filters, which is
+// enough for tenant_id=eq.<tenant> to decide what each request can see.
+type fakePostgREST struct {
+	*httptest.Server
+	mu       sync.Mutex
+	tables   map[string][]map[string]interface{}
+	requests []request
+}
+
+func newFakePostgREST(t *testing.T) *fakePostgREST {
+	t.Helper()
+	f := &fakePostgREST{tables: map[string][]map[string]interface{}{
+		"tenants": {
+			{"id": "agency-a", "name": "Agency A", "time_zone": "UTC"},
+			{"id": "agency-b", "name": "Agency B", "time_zone": "UTC"},
+		},
+		"schema_migrations": {{"version": 99}},
+		"schedules": {{
+			"id": scheduleA, "tenant_id": "agency-a", "client_id": clientA, "client_name": "Alpha Secret",
+			"caregiver_id": "caregiver-a", "service_name": "Personal care", "status": "in_progress",
+			"location":   map[string]interface{}{"latitude": 1.5, "longitude": 2.5, "address": "1 Alpha Street"},
+			"shift_date": "Mon, 15 Jan 2025", "start_time": "09:00", "end_time": "10:00",
+			"visit_start": "2025-01-15T09:01:00Z", "service_notes": "alpha-notes",
+		}},
+		"tasks": {{
+			"id": taskA, "tenant_id": "agency-a", "schedule_id": scheduleA, "description": "Give alpha-notes medication",
+			"completed": false, "required": true,
+		}},
+		"care_plans": {{
+			"id": planA, "tenant_id": "agency-a", "client_id": clientA, "name": "Alpha Secret plan", "active": true,
+		}},
+		"care_plan_task_templates": {{
+			"id": "template-a-1", "tenant_id": "agency-a", "care_plan_id": planA, "description": "alpha-notes", "category": "adl.bathing",
+		}},
+		"webhook_subscriptions": {{
+			"id": webhookA, "tenant_id": "agency-a", "url": "https://alpha.example.com/hook", "secret": "alpha-secret", "active": true,
+		}},
+		"webhook_deliveries": {{
+			"id": deliveryA, "tenant_id": "agency-a", "subscription_id": webhookA, "event_type": "visit.started",
+			"payload": map[string]interface{}{"client_name": "Alpha Secret"}, "status": "dead", "attempts": 8,
+			"next_attempt_at": "2025-01-15T09:00:00Z",
+		}},
+		"legal_holds": {{
+			"tenant_id": "agency-a", "client_id": clientA, "reason": "alpha-hold",
+		}},
+		"phi_access_log": {{
+			"id": "access-a-1", "tenant_id": "agency-a", "actor": "user:alpha", "client_ids": []string{clientA},
+			"fields": []string{"client_name"}, "route": "/api/schedules/{id}", "action": "read",
+		}},
+	}}
+	f.Server = httptest.NewServer(http.HandlerFunc(f.serve))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func (f *fakePostgREST) serve(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	table := strings.TrimPrefix(r.URL.Path, "/rest/v1/")
+	body, _ := io.ReadAll(r.Body)
+	f.requests = append(f.requests, request{r.Method, table, r.URL.Query().Get("tenant_id"), string(body)})
+	w.Header().Set("Content-Type", "application/json")
+
+	if strings.HasPrefix(table, "rpc/") {
+		w.Write([]byte(`[]`))
+		return
+	}
+	switch r.Method {
+	case http.MethodPost:
+		var rows []map[string]interface{}
+		if err := json.Unmarshal(body, &rows); err != nil {
+			var row map[string]interface{}
+			json.Unmarshal(body, &row)
+			rows = []map[string]interface{}{row}
+		}
+		for _, row := range rows {
+			if row["id"] == nil {
+				row["id"] = fmt.Sprintf("%s-%d", table, len(f.tables[table])+1)
+			}
+			f.tables[table] = append(f.tables[table], row)
+		}
+		json.NewEncoder(w).Encode(rows)
+	case http.MethodPatch:
+		var update map[string]interface{}
+		json.Unmarshal(body, &update)
+		matched := f.match(table, r)
+		for _, row := range matched {
+			for column, value := range update {
+				row[column] = value
+			}
+		}
+		json.NewEncoder(w).Encode(matched)
+	case http.MethodDelete:
+		matched := f.match(table, r)
+		var kept []map[string]interface{}
+		for _, row := range f.tables[table] {
+			if !contains(matched, row) {
+				kept = append(kept, row)
+			}
+		}
+		f.tables[table] = kept
+		json.NewEncoder(w).Encode(matched)
+	default:
+		json.NewEncoder(w).Encode(f.match(table, r))
+	}
+}
+
+// match returns the rows of table that pass the eq and in filters of r.
+func (f *fakePostgREST) match(table string, r *http.Request) []map[string]interface{} {
+	matched := []map[string]interface{}{}
+rows:
+	for _, row := range f.tables[table] {
+		for column, values := range r.URL.Query() {
+			op, want, ok := strings.Cut(values[0], ".")
+			if !ok {
+				continue
+			}
+			got := fmt.Sprint(row[column])
+			switch op {
+			case "eq":
+				if got != want {
+					continue rows
+				}
+			case "in":
+				if !strings.Contains(","+strings.Trim(want, "()")+",", ","+got+",") {
+					continue rows
+				}
+			}
+		}
+		matched = append(matched, row)
+	}
+	return matched
+}
+
+func contains(rows []map[string]interface{}, row map[string]interface{}) bool {
+	for _, r := range rows {
+		if reflect.ValueOf(r).Pointer() == reflect.ValueOf(row).Pointer() {
+			return true
+		}
+	}
+	return false
+}
+
+// snapshot returns a copy of every row of tenantID.
+func (f *fakePostgREST) snapshot(tenantID string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	owned := map[string][]map[string]interface{}{}
+	for table, rows := range f.tables {
+		for _, row := range rows {
+			if row["tenant_id"] == tenantID {
+				owned[table] = append(owned[table], row)
+			}
+		}
+	}
+	data, _ := json.Marshal(owned)
+	return string(data)
+}
+
+func newApp(t *testing.T, supabaseURL string) *setup.App {
+	t.Helper()
+	t.Setenv("SUPABASE_URL", supabaseURL)
+	t.Setenv("SUPABASE_SERVICE_ROLE_KEY", "test-key")
+	t.Setenv("SUPABASE_MAX_ATTEMPTS", "1")
+	t.Setenv("SUPABASE_JWT_SECRET", jwtSecret)
+
+	cfg, err := config.Load("")
+	if err != nil {
+		t.Fatalf("Expected the config to load, got %v", err)
+	}
+	app, err := setup.NewApp(cfg)
+	if err != nil {
+		t.Fatalf("Expected the app to build, got %v", err)
+	}
+	return app
+}
+
+// bearer returns the Authorization header of an admin of tenantID, who may
+// call every route of its own agency.
+func bearer(t *testing.T, tenantID string) string {
+	t.Helper()
+	return bearerAs(t, tenantID, auth.RoleAdmin)
+}
+
+// bearerAs returns the Authorization header of a user of tenantID with role.
+func bearerAs(t *testing.T, tenantID, role string) string {
+	t.Helper()
+	claims := auth.Claims{Subject: "user-" + tenantID, ExpiresAt: time.Now().Add(time.Hour).Unix()}
+	claims.AppMetadata.TenantID = tenantID
+	claims.AppMetadata.Role = role
+	token, err := auth.SignToken(claims, []byte(jwtSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return "Bearer " + token
+}
+
+// targets fills a route's path variables with agency A's IDs.
+var targets = strings.NewReplacer(
+	"/schedules/{id}", "/schedules/"+scheduleA,
+	"/tasks/{taskId}", "/tasks/"+taskA,
+	"/care-plans/{id}", "/care-plans/"+planA,
+	"/clients/{clientId}", "/clients/"+clientA,
+	"/webhooks/deliveries/{id}", "/webhooks/deliveries/"+deliveryA,
+	"/webhooks/{id}", "/webhooks/"+webhookA,
+	"/holds/{clientId}", "/holds/"+clientA,
+)
+
+// queries and bodies make each request valid, so that it reaches Supabase
+// rather than being refused by the handler.
+var queries = map[string]string{
+	"GET /api/schedules":        "?client_id=" + clientA,
+	"GET /api/audit/access":     "?client_id=" + clientA,
+	"GET /api/schedules/stats":  "?client_id=" + clientA,
+	"POST /api/retention/purge": "?dry_run=false",
+}
+
+var bodies = map[string]string{
+	"POST /api/schedules": `{"client_id": "` + clientA + `", "client_name": "Beta", "service_name": "Care",
+		"location": {"latitude": 1, "longitude": 2, "address": "2 Beta Road"}, "shift_date": "2025-01-16", "start_time": "09:00", "end_time": "10:00"}`,
+	"POST /api/schedules/{id}/start":       `{"latitude": 1.5, "longitude": 2.5, "address": "Beta"}`,
+	"POST /api/schedules/{id}/end":         `{"latitude": 1.5, "longitude": 2.5, "address": "Beta"}`,
+	"POST /api/schedules/{id}/tasks":       `{"description": "Beta task"}`,
+	"POST /api/schedules/{id}/tasks:batch": `{"updates": [{"task_id": "` + taskA + `", "completed": true}]}`,
+	"POST /api/tasks/{taskId}/update":      `{"completed": true}`,
+	"POST /api/care-plans":                 `{"client_id": "` + clientA + `", "name": "Beta plan", "templates": [{"description": "Bathing", "category": "adl.bathing"}]}`,
+	"PUT /api/care-plans/{id}/templates":   `{"templates": [{"description": "Bathing", "category": "adl.bathing"}]}`,
+	"POST /api/webhooks":                   `{"url": "https://beta.example.com/hook", "events": []}`,
+	"POST /api/retention/holds":            `{"client_id": "` + clientA + `", "reason": "beta-hold"}`,
+}
+
+func serve(app *setup.App, authorization, method, path, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	rec := httptest.NewRecorder()
+	app.Handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// TestTenantIsolation calls every /api route as agency B, aimed at agency A's
+// data, and checks that none of them reads or changes it. The visit stream is
+// left out; the bus test covers its tenant filter.
+func TestTenantIsolation(t *testing.T) {
+	fake := newFakePostgREST(t)
+	app := newApp(t, fake.URL)
+	before := fake.snapshot("agency-a")
+	tokenB := bearer(t, "agency-b")
+
+	for _, route := range app.Handler.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") || route.Path == "/api/stream/visits" {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		body := bodies[key]
+		if body == "" {
+			body = "{}"
+		}
+		rec := serve(app, tokenB, route.Method, targets.Replace(route.Path)+queries[key], body)
+		for _, marker := range markersA {
+			if strings.Contains(rec.Body.String(), marker) {
+				t.Errorf("%s: agency B was shown agency A's %q: %s", key, marker, rec.Body.String())
+			}
+		}
+		if rec.Code == http.StatusUnauthorized || rec.Code == http.StatusForbidden {
+			t.Errorf("%s: expected agency B's token to be accepted, got %d", key, rec.Code)
+		}
+	}
+	if err := app.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if after := fake.snapshot("agency-a"); after != before {
+		t.Errorf("Expected agency A's rows to be unchanged\nbefore %s\nafter  %s", before, after)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	if len(fake.requests) == 0 {
+		t.Fatal("Expected the routes to reach Supabase")
+	}
+	for _, req := range fake.requests {
+		switch {
+		case req.Table == "tenants" || req.Table == "schema_migrations":
+		case strings.HasPrefix(req.Table, "rpc/"):
+			if !strings.Contains(req.Body, `"p_tenant_id":"agency-b"`) {
+				t.Errorf("Expected %s to be called for agency B, got %s", req.Table, req.Body)
+			}
+		case req.Method == http.MethodPost:
+			if !strings.Contains(req.Body, `"tenant_id":"agency-b"`) || strings.Contains(req.Body, `"tenant_id":"agency-a"`) {
+				t.Errorf("Expected rows inserted into %s to belong to agency B, got %s", req.Table, req.Body)
+			}
+		default:
+			if req.Filter != "eq.agency-b" {
+				t.Errorf("Expected %s %s to be filtered to agency B, got tenant_id=%q", req.Method, req.Table, req.Filter)
+			}
+			if req.Method == http.MethodPatch && !strings.Contains(req.Body, `"tenant_id":"agency-b"`) {
+				t.Errorf("Expected updates of %s to keep rows in agency B, got %s", req.Table, req.Body)
+			}
+		}
+	}
+}
+
+// TestTenantIsolationSeesOwnData checks the test's premise: agency A's token
+// does reach agency A's data through the same fake.
+func TestTenantIsolationSeesOwnData(t *testing.T) {
+	fake := newFakePostgREST(t)
+	app := newApp(t, fake.URL)
+
+	rec := serve(app, bearer(t, "agency-a"), http.MethodGet, "/api/schedules/"+scheduleA, "")
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "Alpha Secret") {
+		t.Errorf("Expected agency A to read its schedule, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(app, bearer(t, "agency-b"), http.MethodGet, "/api/schedules/"+scheduleA, ""); rec.Code != http.StatusNotFound {
+		t.Errorf("Expected agency A's schedule not to exist for agency B, got %d: %s", rec.Code, rec.Body.String())
+	}
+	if rec := serve(app, "", http.MethodGet, "/api/schedules/"+scheduleA, ""); rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected a request without a token to be refused, got %d", rec.Code)
+	}
+	if rec := serve(app, bearer(t, "agency-x"), http.MethodGet, "/api/schedules/"+scheduleA, ""); rec.Code != http.StatusForbidden {
+		t.Errorf("Expected a token of an unknown tenant to be refused, got %d", rec.Code)
+	}
+	app.Close(context.Background())
+}
+
+// TestAdminRoutesRefuseCaregivers checks that API keys and the access log are
+// closed to users without the roles they need, within their own agency.
+func TestAdminRoutesRefuseCaregivers(t *testing.T) {
+	fake := newFakePostgREST(t)
+	app := newApp(t, fake.URL)
+	defer app.Close(context.Background())
+	caregiver := bearerAs(t, "agency-a", "caregiver")
+
+	requests := []struct{ method, path, body string }{
+		{http.MethodGet, "/api/api-keys", ""},
+		{http.MethodPost, "/api/api-keys", `{"name": "Payroll", "scopes": ["read:schedules"]}`},
+		{http.MethodDelete, "/api/api-keys/key-1", ""},
+		{http.MethodGet, "/api/audit/access?client_id=" + clientA, ""},
+		{http.MethodPost, "/api/branches", `{"name": "East"}`},
+		{http.MethodGet, "/api/retention/holds", ""},
+		{http.MethodPost, "/api/retention/holds", `{"client_id": "` + clientA + `", "reason": "Litigation"}`},
+		{http.MethodPost, "/api/retention/locations/scrub", ""},
+		{http.MethodPost, "/api/schedules/missed/detect", ""},
+		{http.MethodGet, "/api/webhooks", ""},
+		{http.MethodPost, "/api/webhooks", `{"url": "https://alpha.example.com/other", "events": []}`},
+		{http.MethodDelete, "/api/webhooks/" + webhookA, ""},
+		{http.MethodPost, "/api/webhooks/dispatch", ""},
+		{http.MethodGet, "/api/webhooks/deliveries/dead", ""},
+		{http.MethodPost, "/api/webhooks/deliveries/" + deliveryA + "/retry", ""},
+	}
+	for _, r := range requests {
+		if rec := serve(app, caregiver, r.method, r.path, r.body); rec.Code != http.StatusForbidden {
+			t.Errorf("%s %s: expected a caregiver to get 403, got %d", r.method, r.path, rec.Code)
+		}
+	}
+	if rec := serve(app, bearer(t, "agency-a"), http.MethodGet, "/api/api-keys", ""); rec.Code != http.StatusOK {
+		t.Errorf("Expected an admin to list API keys, got %d: %s", rec.Code, rec.Body.String())
+	}
+}
+
+// TestPHIReadsAreRecorded checks that care plan reads and visit streams are
+// recorded in the access log, a stream once as it opens.
+func TestPHIReadsAreRecorded(t *testing.T) {
+	fake := newFakePostgREST(t)
+	app := newApp(t, fake.URL)
+	admin := bearer(t, "agency-a")
+
+	for _, path := range []string{"/api/care-plans/" + planA, "/api/clients/" + clientA + "/care-plan"} {
+		if rec := serve(app, admin, http.MethodGet, path, ""); rec.Code != http.StatusOK {
+			t.Fatalf("GET %s: expected 200, got %d: %s", path, rec.Code, rec.Body.String())
+		}
+	}
+	// A cancelled context makes the stream return as soon as it is open.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	req := httptest.NewRequest(http.MethodGet, "/api/stream/visits?client_id="+clientA, nil).WithContext(ctx)
+	req.Header.Set("Authorization", admin)
+	app.Handler.ServeHTTP(httptest.NewRecorder(), req)
+	if err := app.Close(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+	routes := map[string]int{}
+	for _, row := range fake.tables["phi_access_log"] {
+		if row["tenant_id"] == "agency-a" && row["id"] != "access-a-1" {
+			routes[fmt.Sprint(row["route"])]++
+		}
+	}
+	want := map[string]int{"/api/care-plans/{id}": 1, "/api/clients/{clientId}/care-plan": 1, "/api/stream/visits": 1}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("Expected the reads %v to be recorded, got %v", want, routes)
+	}
+}
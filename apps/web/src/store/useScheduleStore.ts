@@ -1,5 +1,5 @@
 import { create } from "zustand";
-import type { Schedule, ScheduleStats } from "../types/api";
+import type { Schedule, SchedulePage, ScheduleStats } from "../types/api";
 
 const BASE_API_URL = ""; // Leave empty, Vercel will resolve /api automatically.
 
@@ -82,11 +82,19 @@ export const useScheduleStore = create<ScheduleStore>((set, get) => ({
       error: { ...state.error, schedules: null },
     }));
     try {
-      const response = await fetch(`${BASE_API_URL}/api/schedules`);
-      if (!response.ok) {
-        throw new Error(`HTTP error! status: ${response.status}`);
-      }
-      const data: Schedule[] = await response.json();
+      const data: Schedule[] = [];
+      let cursor: string | null = null;
+      do {
+        const params = new URLSearchParams({ limit: "200" });
+        if (cursor) params.set("cursor", cursor);
+        const response = await fetch(`${BASE_API_URL}/api/schedules?${params}`);
+        if (!response.ok) {
+          throw new Error(`HTTP error! status: ${response.status}`);
+        }
+        const page: SchedulePage = await response.json();
+        data.push(...page.data);
+        cursor = page.next_cursor;
+      } while (cursor);
       set({ schedules: data });
       // eslint-disable-next-line
     } catch (err: any) {
@@ -249,6 +257,14 @@ export const useScheduleStore = create<ScheduleStore>((set, get) => ({
           body: JSON.stringify(location),
         }
       );
+      if (response.status === 409) {
+        const body = await response.json().catch(() => null);
+        if (body?.outstanding_task_ids?.length) {
+          throw new Error(
+            `${body.error} (${body.outstanding_task_ids.length} outstanding)`
+          );
+        }
+      }
       if (!response.ok) {
         throw new Error(`HTTP error! status: ${response.status}`);
       }
@@ -9,7 +9,44 @@ export interface Task {
   scheduleId: string;
   description: string;
   completed: boolean;
+  completed_at?: string | null;
+  completed_by?: string | null;
+  reason_code?: TaskReasonCode | null;
   reason?: string | null;
+  category?: string | null;
+  required: boolean;
+  template_id?: string | null;
+  ad_hoc: boolean;
+}
+
+export type TaskReasonCode =
+  | "client_declined"
+  | "client_unavailable"
+  | "not_needed"
+  | "insufficient_time"
+  | "unsafe_conditions"
+  | "supplies_unavailable"
+  | "other";
+
+export interface TaskTemplate {
+  id: string;
+  care_plan_id: string;
+  description: string;
+  category: string;
+  frequency: "every_visit" | "mon_wed_fri" | "weekly";
+  weekday?: string | null;
+  required: boolean;
+  position: number;
+}
+
+export interface CarePlan {
+  id: string;
+  client_id: string;
+  name: string;
+  active: boolean;
+  created_at: string;
+  updated_at: string;
+  templates: TaskTemplate[];
 }
 
 export interface Schedule {
@@ -17,6 +54,7 @@ export interface Schedule {
   client_id: string;
   client_name: string;
   client_avatar?: string;
+  caregiver_id?: string;
   service_name: string;
   location: Location;
   shift_date: string;
@@ -28,15 +66,41 @@ export interface Schedule {
   start_location?: Location | null;
   end_location?: Location | null;
   service_notes?: string;
+  scheduled_start?: string;
   tasks?: Task[];
 }
 
-export interface ScheduleStats {
+export interface SchedulePage {
+  data: Schedule[];
+  next_cursor: string | null;
+}
+
+export interface StatsCounts {
   totalSchedules: number;
   completedSchedules: number;
   scheduledSchedules: number;
+  inProgressSchedules?: number;
   cancelledSchedules: number;
   missedSchedules: number;
+  onTimeRate?: number;
+  averageVisitMinutes?: number;
+  taskCompletionRate?: number;
+}
+
+export interface StatsGroup extends StatsCounts {
+  key: string;
+}
+
+export interface DailyStats extends StatsCounts {
+  date: string;
+}
+
+export interface ScheduleStats extends StatsCounts {
   upcomingToday: number;
   completedToday: number;
+  from?: string;
+  to?: string;
+  groupBy?: "day" | "client" | "caregiver" | "service";
+  groups?: StatsGroup[];
+  daily?: DailyStats[];
 }